@@ -24,7 +24,51 @@ type InfaConfig struct {
 	EmailImapHost      string `envconfig:"EMAIL_IMAP_HOST" default:""`
 	EmailImapUser      string `envconfig:"EMAIL_IMAP_USER" default:""`
 	EmailImapPassword  string `envconfig:"EMAIL_IMAP_PASS" default:""`
-	SepayApiKey        string `envconfig:"SEPAY_API_KEY" default:""`
+	// EMAIL_IMAP_HOST=stub:<thư mục> đọc mail từ file .eml thay cho IMAP server khi chạy local (không đi qua IMAP client/IDLE/reconnect)
+	EmailImapPort        int    `envconfig:"EMAIL_IMAP_PORT" default:"993"`
+	EmailImapSSL         bool   `envconfig:"EMAIL_IMAP_SSL" default:"true"`
+	EmailImapMailbox     string `envconfig:"EMAIL_IMAP_MAILBOX" default:"INBOX"`
+	EmailImapPollSeconds int    `envconfig:"EMAIL_IMAP_POLL_SECONDS" default:"30"` // Khi server không hỗ trợ IDLE
+	SepayApiKey          string `envconfig:"SEPAY_API_KEY" default:""`
+	// SMTP gửi mail thông báo cho user. Trống = không gửi mail; SMTP_HOST=stub:<thư mục> ghi mail ra file .eml (local/test)
+	SmtpHost     string `envconfig:"SMTP_HOST" default:""`
+	SmtpPort     int    `envconfig:"SMTP_PORT" default:"587"`
+	SmtpUsername string `envconfig:"SMTP_USERNAME" default:""`
+	SmtpPassword string `envconfig:"SMTP_PASSWORD" default:""`
+	SmtpFrom     string `envconfig:"SMTP_FROM" default:""`
+	// Giới hạn căn thời lượng TTS theo cue
+	TTSMaxSpeakingRate float64 `envconfig:"TTS_MAX_SPEAKING_RATE" default:"1.5"`
+	TTSRateRetries     int     `envconfig:"TTS_RATE_RETRIES" default:"2"`
+	TTSMaxTempo        float64 `envconfig:"TTS_MAX_TEMPO" default:"1.3"`
+	TTSMaxLeadIn       float64 `envconfig:"TTS_MAX_LEAD_IN" default:"0.3"`
+	// Dung lượng tối đa của cache kết quả (MB), vượt quá sẽ thu hồi theo LRU
+	CacheMaxSizeMB int `envconfig:"CACHE_MAX_SIZE_MB" default:"5120"`
+	// CLI diarization (pyannote) nhận đường dẫn audio, in ra JSON [{start, end, speaker, gender}] hoặc RTTM
+	DiarizationCmd     string `envconfig:"DIARIZATION_CMD" default:"pyannote-diarize"`
+	DiarizationTimeout int    `envconfig:"DIARIZATION_TIMEOUT" default:"600"` // Giây
+	// Thưởng nạp lần đầu: % credit nạp, tối đa FIRST_TOPUP_BONUS_MAX (USD). 0 = tắt
+	FirstTopupBonusPercent float64 `envconfig:"FIRST_TOPUP_BONUS_PERCENT" default:"10"`
+	FirstTopupBonusMax     float64 `envconfig:"FIRST_TOPUP_BONUS_MAX" default:"5"`
+	// Thưởng giới thiệu (credit) cho người giới thiệu và người được giới thiệu khi đơn thanh toán đầu tiên của người được giới thiệu paid. 0 = không thưởng
+	ReferralReferrerCredits float64 `envconfig:"REFERRAL_REFERRER_CREDITS" default:"5"`
+	ReferralRefereeCredits  float64 `envconfig:"REFERRAL_REFEREE_CREDITS" default:"2"`
+	// Ngưỡng cảnh báo số dư thấp (credit) cho user chưa tự đặt ngưỡng, 0 = không cảnh báo
+	LowBalanceDefaultThreshold float64 `envconfig:"LOW_BALANCE_DEFAULT_THRESHOLD" default:"1"`
+	// Nguồn tỷ giá USD/VND: URL trả JSON (đọc theo EXCHANGE_RATE_PROVIDER_FIELD) hoặc "stub:<rate>" cho dev/test. Trống = chỉ nhập tay
+	ExchangeRateProviderURL   string  `envconfig:"EXCHANGE_RATE_PROVIDER_URL" default:""`
+	ExchangeRateProviderField string  `envconfig:"EXCHANGE_RATE_PROVIDER_FIELD" default:"rates.VND"`
+	ExchangeRateSyncHours     int     `envconfig:"EXCHANGE_RATE_SYNC_HOURS" default:"6"`
+	ExchangeRateMaxChange     float64 `envconfig:"EXCHANGE_RATE_MAX_CHANGE_PERCENT" default:"10"` // Từ chối tỷ giá provider lệch quá % này
+	// Nhắc user trước khi đơn thanh toán hết hạn (phút), 0 = tắt
+	PaymentReminderMinutes int `envconfig:"PAYMENT_REMINDER_MINUTES" default:"10"`
+	// Cách chọn tài khoản nhận cho đơn mới trong số tài khoản còn hạn mức: least_loaded hoặc round_robin
+	BankAccountSelection string `envconfig:"BANK_ACCOUNT_SELECTION" default:"least_loaded"`
+	// Thông tin bên bán in trên hoá đơn/sao kê; PDF được tạo bằng CLI INVOICE_PDF_CMD (wkhtmltopdf: đọc HTML stdin, ghi PDF stdout)
+	InvoiceSellerName    string `envconfig:"INVOICE_SELLER_NAME" default:"VideoTool"`
+	InvoiceSellerAddress string `envconfig:"INVOICE_SELLER_ADDRESS" default:""`
+	InvoiceSellerTaxCode string `envconfig:"INVOICE_SELLER_TAX_CODE" default:""`
+	InvoiceSellerEmail   string `envconfig:"INVOICE_SELLER_EMAIL" default:""`
+	InvoicePdfCmd        string `envconfig:"INVOICE_PDF_CMD" default:"wkhtmltopdf"`
 }
 
 func (cfg *InfaConfig) LoadConfig() {
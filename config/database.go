@@ -100,6 +100,11 @@ type CaptionHistory struct {
 	EngagementPrompts datatypes.JSON `json:"engagement_prompts" gorm:"type:json"`
 	CallToAction      string         `json:"call_to_action" gorm:"type:text"`
 	VideoDuration     float64        `json:"video_duration" gorm:"type:decimal(10,2);comment:'Duration in seconds'"`
+	RenderSettings    datatypes.JSON `json:"render_settings" gorm:"type:json"`        // Tham số render để sửa phụ đề và render lại
+	TranslationQA     datatypes.JSON `json:"translation_qa" gorm:"type:json"`         // Báo cáo QA bản dịch (chưa dịch, CPS, rỗng, trùng, lệch timing)
+	LanguageOutputs   datatypes.JSON `json:"language_outputs" gorm:"type:json"`       // Output từng ngôn ngữ khi xử lý nhiều ngôn ngữ đích (target_languages[])
+	Speakers          datatypes.JSON `json:"speakers" gorm:"type:json"`               // Người nói từ diarization và giọng TTS đã gán
+	SourceLanguage    string         `json:"source_language" gorm:"type:varchar(10)"` // Ngôn ngữ nguồn Whisper nhận diện (mã ISO), rỗng = không xác định
 	DeletedAt         *time.Time     `json:"deleted_at" gorm:"index"`
 	CreatedAt         time.Time      `json:"created_at"`
 	UpdatedAt         time.Time      `json:"updated_at"`
@@ -147,6 +152,7 @@ type PricingTier struct {
 	BaseMarkup        float64   `json:"base_markup" gorm:"type:decimal(5,2)"`
 	MonthlyLimit      *int      `json:"monthly_limit"`
 	SubscriptionPrice float64   `json:"subscription_price" gorm:"type:decimal(10,2);default:0.00"`
+	LimitUnit         string    `json:"limit_unit" gorm:"size:20;default:'minutes'"` // Đơn vị của MonthlyLimit: minutes | videos
 	IsActive          bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
@@ -257,24 +263,31 @@ func (AdminUser) TableName() string {
 
 // PaymentOrder lưu thông tin đơn hàng thanh toán
 type PaymentOrder struct {
-	ID                uint            `json:"id" gorm:"primaryKey"`
-	UserID            uint            `json:"user_id" gorm:"index"`
-	OrderCode         string          `json:"order_code" gorm:"uniqueIndex;size:50"`
-	AmountVND         decimal.Decimal `json:"amount_vnd" gorm:"type:decimal(12,0)"`
-	AmountUSD         decimal.Decimal `json:"amount_usd" gorm:"type:decimal(10,2)"`
-	ExchangeRate      decimal.Decimal `json:"exchange_rate" gorm:"type:decimal(10,4)"`
-	BankAccount       string          `json:"bank_account" gorm:"size:50"`
-	BankName          string          `json:"bank_name" gorm:"size:100"`
-	QRCodeURL         *string         `json:"qr_code_url" gorm:"size:500"`
-	QRCodeData        *string         `json:"qr_code_data" gorm:"type:text"`
-	OrderStatus       string          `json:"order_status" gorm:"type:enum('pending','paid','expired','cancelled');default:'pending'"`
-	PaymentMethod     string          `json:"payment_method" gorm:"type:enum('qr_code','bank_transfer');default:'qr_code'"`
-	ExpiresAt         time.Time       `json:"expires_at"`
-	PaidAt            *time.Time      `json:"paid_at"`
-	TransactionID     *string         `json:"transaction_id" gorm:"size:100"`
-	EmailConfirmation *string         `json:"email_confirmation" gorm:"type:text"`
-	CreatedAt         time.Time       `json:"created_at"`
-	UpdatedAt         time.Time       `json:"updated_at"`
+	ID                uint             `json:"id" gorm:"primaryKey"`
+	UserID            uint             `json:"user_id" gorm:"index"`
+	OrderCode         string           `json:"order_code" gorm:"uniqueIndex;size:50"`
+	AmountVND         decimal.Decimal  `json:"amount_vnd" gorm:"type:decimal(12,0)"`
+	AmountUSD         decimal.Decimal  `json:"amount_usd" gorm:"type:decimal(10,2)"`
+	ExchangeRate      decimal.Decimal  `json:"exchange_rate" gorm:"type:decimal(10,4)"`
+	BankAccount       string           `json:"bank_account" gorm:"size:50"`
+	BankName          string           `json:"bank_name" gorm:"size:100"`
+	QRCodeURL         *string          `json:"qr_code_url" gorm:"size:500"`
+	QRCodeData        *string          `json:"qr_code_data" gorm:"type:text"`
+	OrderStatus       string           `json:"order_status" gorm:"type:enum('pending','paid','expired','cancelled');default:'pending'"`
+	PaymentMethod     string           `json:"payment_method" gorm:"type:enum('qr_code','bank_transfer');default:'qr_code'"`
+	Purpose           string           `json:"purpose" gorm:"size:20;default:'topup'"` // topup = nạp credit, subscription = mua gói
+	SubscriptionID    *uint            `json:"subscription_id"`                        // Gói được kích hoạt khi đơn thanh toán (Purpose = subscription)
+	PackageID         *uint            `json:"package_id"`                             // Gói nạp credit định sẵn (tool_credit_packages)
+	PromoCodeID       *uint            `json:"promo_code_id"`                          // Mã khuyến mãi, thưởng được cộng khi đơn thanh toán
+	ExpiresAt         time.Time        `json:"expires_at"`
+	PaidAt            *time.Time       `json:"paid_at"`
+	AmountReceivedVND *decimal.Decimal `json:"amount_received_vnd" gorm:"type:decimal(12,0)"` // Số tiền thực nhận, có thể thiếu/thừa so với AmountVND
+	CreditedUSD       *decimal.Decimal `json:"credited_usd" gorm:"type:decimal(10,2)"`        // Credit thực cộng theo số tiền thực nhận
+	ReminderSentAt    *time.Time       `json:"reminder_sent_at"`
+	TransactionID     *string          `json:"transaction_id" gorm:"size:100"`
+	EmailConfirmation *string          `json:"email_confirmation" gorm:"type:text"`
+	CreatedAt         time.Time        `json:"created_at"`
+	UpdatedAt         time.Time        `json:"updated_at"`
 }
 
 // BankAccount lưu thông tin tài khoản ngân hàng
@@ -293,16 +306,20 @@ type BankAccount struct {
 
 // EmailTemplate lưu template mail xác nhận thanh toán
 type EmailTemplate struct {
-	ID             uint      `json:"id" gorm:"primaryKey"`
-	BankName       string    `json:"bank_name" gorm:"size:100"`
-	TemplateName   string    `json:"template_name" gorm:"size:100"`
-	SubjectPattern *string   `json:"subject_pattern" gorm:"size:200"`
-	SenderPattern  *string   `json:"sender_pattern" gorm:"size:200"`
-	AmountPattern  *string   `json:"amount_pattern" gorm:"size:100"`
-	AccountPattern *string   `json:"account_pattern" gorm:"size:100"`
-	ContentPattern *string   `json:"content_pattern" gorm:"type:text"`
-	IsActive       bool      `json:"is_active" gorm:"default:true"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID                 uint      `json:"id" gorm:"primaryKey"`
+	BankName           string    `json:"bank_name" gorm:"size:100"`
+	TemplateName       string    `json:"template_name" gorm:"size:100"`
+	SubjectPattern     *string   `json:"subject_pattern" gorm:"size:200"`
+	SenderPattern      *string   `json:"sender_pattern" gorm:"size:200"`
+	AmountPattern      *string   `json:"amount_pattern" gorm:"size:100"`
+	AccountPattern     *string   `json:"account_pattern" gorm:"size:100"`
+	ContentPattern     *string   `json:"content_pattern" gorm:"type:text"`
+	OrderCodePattern   *string   `json:"order_code_pattern" gorm:"size:200"`  // nil = PAY + dãy số
+	TransactionPattern *string   `json:"transaction_pattern" gorm:"size:200"` // nil/không khớp = theo Message-Id của mail
+	Priority           int       `json:"priority" gorm:"default:0"`           // Template ưu tiên cao được thử trước
+	IsActive           bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
 }
 
 // PaymentLog lưu log thanh toán
@@ -2,16 +2,19 @@ package handler
 
 import (
 	"creator-tool-backend/config"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"creator-tool-backend/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -862,6 +865,61 @@ func CancelAdminPaymentOrder(c *gin.Context) {
 	})
 }
 
+// ConfirmAdminPaymentOrder xác nhận thủ công đơn hàng đã nhận tiền (admin), kể cả đơn đã hết hạn/huỷ.
+// Body: transaction_id (mã giao dịch ngân hàng), amount_vnd (mặc định bằng số tiền đơn)
+func ConfirmAdminPaymentOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req struct {
+		TransactionID string  `json:"transaction_id"`
+		AmountVND     float64 `json:"amount_vnd"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	var order config.PaymentOrder
+	if err := config.Db.First(&order, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	// Không nhập mã giao dịch thì dùng mã cố định theo đơn để bấm lại không ghi nhận hai lần
+	transactionID := strings.TrimSpace(req.TransactionID)
+	if transactionID == "" {
+		transactionID = fmt.Sprintf("manual-%d", order.ID)
+	}
+	amount := order.AmountVND
+	if req.AmountVND > 0 {
+		amount = decimal.NewFromFloat(req.AmountVND)
+	}
+
+	paymentService := service.NewPaymentOrderService()
+	outcome, _, err := paymentService.ConfirmPayment(service.PaymentSourceManual, transactionID, order.OrderCode, amount, 0)
+	if errors.Is(err, service.ErrInvalidPaymentConfirmation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể xác nhận đơn hàng: " + err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xác nhận đơn hàng: " + err.Error()})
+		return
+	}
+	if outcome == service.PaymentOutcomeDuplicate {
+		c.JSON(http.StatusConflict, gin.H{"error": "Giao dịch đã được xác nhận trước đó"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Xác nhận thanh toán thành công",
+		"order_status": "paid",
+	})
+}
+
 // GET /admin/credit-usage
 func AdminCreditUsageListHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
@@ -1106,6 +1164,7 @@ func AdminUpdatePricingTierHandler(c *gin.Context) {
 		BaseMarkup        float64 `json:"base_markup" binding:"required"`
 		MonthlyLimit      *int    `json:"monthly_limit"`
 		SubscriptionPrice float64 `json:"subscription_price"`
+		LimitUnit         string  `json:"limit_unit"`
 		IsActive          bool    `json:"is_active"`
 	}
 
@@ -1113,6 +1172,10 @@ func AdminUpdatePricingTierHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
 		return
 	}
+	if !validLimitUnit(req.LimitUnit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit_unit phải là minutes hoặc videos"})
+		return
+	}
 
 	// Kiểm tra tier có tồn tại không
 	var existingTier config.PricingTier
@@ -1131,6 +1194,9 @@ func AdminUpdatePricingTierHandler(c *gin.Context) {
 		"is_active":          req.IsActive,
 		"updated_at":         time.Now(),
 	}
+	if req.LimitUnit != "" {
+		updates["limit_unit"] = req.LimitUnit
+	}
 
 	err = db.Model(&existingTier).Updates(updates).Error
 	if err != nil {
@@ -1153,6 +1219,7 @@ func AdminAddPricingTierHandler(c *gin.Context) {
 		BaseMarkup        float64 `json:"base_markup" binding:"required"`
 		MonthlyLimit      *int    `json:"monthly_limit"`
 		SubscriptionPrice float64 `json:"subscription_price"`
+		LimitUnit         string  `json:"limit_unit"`
 		IsActive          bool    `json:"is_active"`
 	}
 
@@ -1160,6 +1227,10 @@ func AdminAddPricingTierHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
 		return
 	}
+	if !validLimitUnit(req.LimitUnit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit_unit phải là minutes hoặc videos"})
+		return
+	}
 
 	// Kiểm tra tên tier đã tồn tại chưa
 	var existingTier config.PricingTier
@@ -1175,6 +1246,7 @@ func AdminAddPricingTierHandler(c *gin.Context) {
 		BaseMarkup:        req.BaseMarkup,
 		MonthlyLimit:      req.MonthlyLimit,
 		SubscriptionPrice: req.SubscriptionPrice,
+		LimitUnit:         limitUnitOrDefault(req.LimitUnit),
 		IsActive:          req.IsActive,
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
@@ -1192,6 +1264,18 @@ func AdminAddPricingTierHandler(c *gin.Context) {
 	})
 }
 
+// validLimitUnit kiểm tra đơn vị hạn mức tháng của tier (rỗng = minutes)
+func validLimitUnit(unit string) bool {
+	return unit == "" || unit == service.LimitUnitMinutes || unit == service.LimitUnitVideos
+}
+
+func limitUnitOrDefault(unit string) string {
+	if unit == "" {
+		return service.LimitUnitMinutes
+	}
+	return unit
+}
+
 // AdminDeletePricingTierHandler xóa pricing tier
 func AdminDeletePricingTierHandler(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type BankAccountHandler struct {
+	bankAccountService *service.BankAccountService
+}
+
+func NewBankAccountHandler(bankAccountService *service.BankAccountService) *BankAccountHandler {
+	return &BankAccountHandler{
+		bankAccountService: bankAccountService,
+	}
+}
+
+// AdminGetBankAccounts (Admin only) lấy các tài khoản nhận kèm tiền đã nhận hôm nay/tháng này và hạn mức còn lại
+func (h *BankAccountHandler) AdminGetBankAccounts(c *gin.Context) {
+	usages, err := h.bankAccountService.GetAccountUsage(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách tài khoản nhận"})
+		return
+	}
+
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"selection": cfg.BankAccountSelection,
+		"data":      usages,
+	})
+}
+
+// AdminGetBankAccountInflows (Admin only) lấy tiền vào theo ngày của một tài khoản nhận.
+// Query: from_date, to_date (YYYY-MM-DD, mặc định 30 ngày gần nhất)
+func (h *BankAccountHandler) AdminGetBankAccountInflows(c *gin.Context) {
+	accountID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -30)
+
+	if fromDate := c.Query("from_date"); fromDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromDate, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from_date không hợp lệ (YYYY-MM-DD)"})
+			return
+		}
+		from = parsed
+	}
+	if toDate := c.Query("to_date"); toDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toDate, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to_date không hợp lệ (YYYY-MM-DD)"})
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_date phải trước to_date"})
+		return
+	}
+
+	inflows, err := h.bankAccountService.GetInflowHistory(accountID, from, to)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tài khoản nhận"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy lịch sử tiền vào"})
+		return
+	}
+
+	total := decimal.Zero
+	transactions := 0
+	for _, inflow := range inflows {
+		total = total.Add(inflow.ReceivedVND)
+		transactions += inflow.TransactionCount
+	}
+	if inflows == nil {
+		inflows = []model.BankAccountInflow{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from_date":          from.Format("2006-01-02"),
+		"to_date":            to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"total_received_vnd": total,
+		"transaction_count":  transactions,
+		"data":               inflows,
+	})
+}
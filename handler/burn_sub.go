@@ -94,6 +94,9 @@ func BurnSubHandler(c *gin.Context) {
 			processService.UpdateProcessStatus(processID, "failed")
 		}
 		util.CleanupDir(videoDir)
+		if respondSpendingCapReached(c, err) {
+			return
+		}
 		c.JSON(http.StatusPaymentRequired, gin.H{
 			"error":   "Không đủ credit để burn subtitle",
 			"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
@@ -145,6 +148,8 @@ func BurnSubHandler(c *gin.Context) {
 	if subtitleBgColor == "" {
 		subtitleBgColor = "#808080" // mặc định xám nhạt thay vì đen
 	}
+	// Output profile cho video đầu ra (tiktok, youtube, square, source)
+	outputProfile := service.GetOutputProfile(c.PostForm("output_profile"))
 
 	// Tạo job burn-sub và enqueue vào queue
 	jobID := fmt.Sprintf("burnsub_%d_%d", userID, timestamp)
@@ -161,6 +166,7 @@ func BurnSubHandler(c *gin.Context) {
 		MaxDuration:     600, // 10 phút
 		SubtitleColor:   subtitleColor,
 		SubtitleBgColor: subtitleBgColor,
+		OutputProfile:   outputProfile.Name,
 	}
 	queueService := service.GetQueueService()
 	if queueService == nil {
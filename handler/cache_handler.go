@@ -12,7 +12,7 @@ import (
 
 // GetCacheStatsHandler lấy thống kê cache
 func GetCacheStatsHandler(c *gin.Context) {
-	cacheService := service.NewCacheService()
+	cacheService := service.GetCacheService()
 	stats := cacheService.GetStats()
 
 	c.JSON(http.StatusOK, gin.H{
@@ -22,7 +22,7 @@ func GetCacheStatsHandler(c *gin.Context) {
 
 // CleanupCacheHandler dọn dẹp cache đã hết hạn
 func CleanupCacheHandler(c *gin.Context) {
-	cacheService := service.NewCacheService()
+	cacheService := service.GetCacheService()
 	err := cacheService.CleanupExpired()
 
 	if err != nil {
@@ -46,7 +46,7 @@ func DeleteCacheEntryHandler(c *gin.Context) {
 		return
 	}
 
-	cacheService := service.NewCacheService()
+	cacheService := service.GetCacheService()
 	err := cacheService.Delete(key)
 
 	if err != nil {
@@ -71,7 +71,7 @@ func GetCacheEntryHandler(c *gin.Context) {
 		return
 	}
 
-	cacheService := service.NewCacheService()
+	cacheService := service.GetCacheService()
 	entry, err := cacheService.Get(key)
 
 	if err != nil {
@@ -87,15 +87,15 @@ func GetCacheEntryHandler(c *gin.Context) {
 	})
 }
 
-// ClearAllCacheHandler xóa tất cả cache
+// ClearAllCacheHandler xóa tất cả cache, hoặc chỉ một loại cache nếu có query type (whisper, background, translation, tts_segment)
 func ClearAllCacheHandler(c *gin.Context) {
-	cacheService := service.NewCacheService()
+	cacheService := service.GetCacheService()
+	cacheType := c.Query("type")
 
 	// Lấy thống kê trước khi xóa
 	stats := cacheService.GetStats()
 
-	// Dọn dẹp tất cả cache
-	err := cacheService.CleanupExpired()
+	count, freed, err := cacheService.Purge(cacheType)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to clear cache",
@@ -105,8 +105,11 @@ func ClearAllCacheHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "All cache cleared successfully",
-		"cleared_stats": stats,
+		"message":         "Cache cleared successfully",
+		"type":            cacheType,
+		"deleted_entries": count,
+		"freed_bytes":     freed,
+		"cleared_stats":   stats,
 	})
 }
 
@@ -130,7 +133,7 @@ func SetCacheTTLHandler(c *gin.Context) {
 		return
 	}
 
-	cacheService := service.NewCacheService()
+	cacheService := service.GetCacheService()
 
 	// Lấy entry hiện tại
 	entry, err := cacheService.Get(key)
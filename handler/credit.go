@@ -2,7 +2,10 @@ package handler
 
 import (
 	"creator-tool-backend/config"
+	"creator-tool-backend/model"
 	"creator-tool-backend/service"
+	"errors"
+	"log"
 	"net/http"
 	"sort"
 	"strconv"
@@ -26,6 +29,12 @@ func GetCreditBalance(c *gin.Context) {
 		return
 	}
 
+	// Chi tiêu hôm nay/tháng này so với hạn mức, lỗi không làm hỏng response số dư
+	spending, err := service.NewSpendingService(config.Db).GetStatus(userID, balanceMap["available_credits"])
+	if err != nil {
+		log.Printf("Failed to get spending status for user %d: %v", userID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"balance":           balanceMap["available_credits"],
 		"total_credits":     balanceMap["total_credits"],
@@ -33,7 +42,66 @@ func GetCreditBalance(c *gin.Context) {
 		"locked_credits":    balanceMap["locked_credits"],
 		"available_credits": balanceMap["available_credits"],
 		"currency":          "USD",
+		"spending":          spending,
+	})
+}
+
+// GetSpendingSettings lấy hạn mức chi tiêu ngày/tháng và ngưỡng cảnh báo số dư thấp của user
+func GetSpendingSettings(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	settings, err := service.NewSpendingService(config.Db).GetSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy cài đặt chi tiêu"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": settings,
+	})
+}
+
+// UpdateSpendingSettings cập nhật hạn mức chi tiêu (0 = không giới hạn), auto-stop và ngưỡng cảnh báo số dư thấp
+func UpdateSpendingSettings(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req model.SpendingSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	spendingService := service.NewSpendingService(config.Db)
+	settings, err := spendingService.UpdateSettings(userID, req)
+	if errors.Is(err, service.ErrInvalidSpendingSettings) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật cài đặt chi tiêu"})
+		return
+	}
+	// Ngưỡng mới có thể đã bị vượt ngay
+	spendingService.CheckAlerts(userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cập nhật cài đặt chi tiêu thành công",
+		"data":    settings,
+	})
+}
+
+// respondSpendingCapReached trả 402 khi LockCredits bị từ chối do chạm hạn mức chi tiêu (auto-stop).
+// Trả về false nếu lỗi không phải do hạn mức để handler trả lỗi không đủ credit như cũ
+func respondSpendingCapReached(c *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrSpendingCapReached) {
+		return false
+	}
+	log.Printf("User %d blocked by spending cap: %v", c.GetUint("user_id"), err)
+	c.JSON(http.StatusPaymentRequired, gin.H{
+		"error":   "Đã chạm hạn mức chi tiêu",
+		"warning": "Job này vượt hạn mức chi tiêu ngày/tháng bạn đã đặt. Vui lòng tăng hạn mức hoặc tắt tự động dừng trong cài đặt chi tiêu!",
 	})
+	return true
 }
 
 // GetCreditHistory lấy lịch sử giao dịch credit (theo video)
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type EmailTemplateHandler struct {
+	emailTemplateService *service.EmailTemplateService
+}
+
+func NewEmailTemplateHandler(emailTemplateService *service.EmailTemplateService) *EmailTemplateHandler {
+	return &EmailTemplateHandler{
+		emailTemplateService: emailTemplateService,
+	}
+}
+
+// AdminGetEmailTemplates (Admin only) lấy danh sách template đọc mail ngân hàng theo thứ tự ưu tiên
+func (h *EmailTemplateHandler) AdminGetEmailTemplates(c *gin.Context) {
+	templates, err := h.emailTemplateService.GetTemplates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách template email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": templates,
+	})
+}
+
+// AdminCreateEmailTemplate (Admin only) tạo template đọc mail ngân hàng
+func (h *EmailTemplateHandler) AdminCreateEmailTemplate(c *gin.Context) {
+	var req model.EmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	template, err := h.emailTemplateService.CreateTemplate(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Tạo template email thành công",
+		"data":    template,
+	})
+}
+
+// AdminUpdateEmailTemplate (Admin only) cập nhật template, worker dùng bản mới từ lần đọc mail kế tiếp
+func (h *EmailTemplateHandler) AdminUpdateEmailTemplate(c *gin.Context) {
+	templateID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req model.EmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	template, err := h.emailTemplateService.UpdateTemplate(templateID, req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template email không tồn tại"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cập nhật template email thành công",
+		"data":    template,
+	})
+}
+
+// AdminDeleteEmailTemplate (Admin only) xoá template email
+func (h *EmailTemplateHandler) AdminDeleteEmailTemplate(c *gin.Context) {
+	templateID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.emailTemplateService.DeleteTemplate(templateID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template email không tồn tại"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xoá template email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Xoá template email thành công",
+	})
+}
+
+// AdminTestEmailTemplate (Admin only) chạy thử template với mail thô, không ghi nhận thanh toán
+func (h *EmailTemplateHandler) AdminTestEmailTemplate(c *gin.Context) {
+	var req model.EmailTemplateTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	result, err := h.emailTemplateService.TestTemplate(req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template email không tồn tại"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidEmailTemplate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể chạy thử template email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": result,
+	})
+}
+
+// AdminGetEmailMonitorStatus (Admin only) trạng thái worker đọc mail ngân hàng (kết nối, lỗi gần nhất, lần thử lại)
+func (h *EmailTemplateHandler) AdminGetEmailMonitorStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": service.GetEmailMonitorStatus(),
+	})
+}
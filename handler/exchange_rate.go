@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type ExchangeRateHandler struct {
+	exchangeRateService *service.ExchangeRateService
+}
+
+func NewExchangeRateHandler(exchangeRateService *service.ExchangeRateService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{
+		exchangeRateService: exchangeRateService,
+	}
+}
+
+// AdminGetExchangeRates (Admin only) lấy tỷ giá hiện tại và lịch sử tỷ giá
+func (h *ExchangeRateHandler) AdminGetExchangeRates(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rates, err := h.exchangeRateService.ListRates(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách tỷ giá"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"current_rate": h.exchangeRateService.GetCurrentRate(),
+		"data":         rates,
+	})
+}
+
+// AdminCreateExchangeRate (Admin only) thêm tỷ giá USD/VND, có hiệu lực ngay hoặc từ effective_from
+func (h *ExchangeRateHandler) AdminCreateExchangeRate(c *gin.Context) {
+	var req model.ExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	var createdBy *uint
+	if adminID := c.GetInt("admin_id"); adminID > 0 {
+		id := uint(adminID)
+		createdBy = &id
+	}
+
+	rate, err := h.exchangeRateService.CreateRate(decimal.NewFromFloat(req.Rate), req.EffectiveFrom, service.ExchangeRateSourceManual, req.Note, createdBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Thêm tỷ giá thành công",
+		"data":    rate,
+	})
+}
+
+// AdminDeleteExchangeRate (Admin only) xoá tỷ giá chưa có hiệu lực
+func (h *ExchangeRateHandler) AdminDeleteExchangeRate(c *gin.Context) {
+	rateID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.exchangeRateService.DeleteScheduledRate(rateID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tỷ giá không tồn tại"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidExchangeRate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chỉ xoá được tỷ giá chưa có hiệu lực"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xoá tỷ giá"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Xoá tỷ giá thành công",
+	})
+}
+
+// AdminSyncExchangeRate (Admin only) đồng bộ tỷ giá từ provider ngay lập tức
+func (h *ExchangeRateHandler) AdminSyncExchangeRate(c *gin.Context) {
+	rate, err := h.exchangeRateService.SyncFromProvider()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Không thể đồng bộ tỷ giá: " + err.Error()})
+		return
+	}
+	if rate == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Tỷ giá không thay đổi",
+			"current_rate": h.exchangeRateService.GetCurrentRate(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Đồng bộ tỷ giá thành công",
+		"data":    rate,
+	})
+}
+
+// AdminGetRevenueReport (Admin only) báo cáo doanh thu VND/USD theo ngày hoặc tháng.
+// Query: from_date, to_date (YYYY-MM-DD, mặc định 30 ngày gần nhất), group_by=day|month
+func (h *ExchangeRateHandler) AdminGetRevenueReport(c *gin.Context) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -30)
+
+	if fromDate := c.Query("from_date"); fromDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromDate, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from_date không hợp lệ (YYYY-MM-DD)"})
+			return
+		}
+		from = parsed
+	}
+	if toDate := c.Query("to_date"); toDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toDate, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to_date không hợp lệ (YYYY-MM-DD)"})
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_date phải trước to_date"})
+		return
+	}
+
+	report, err := h.exchangeRateService.RevenueReport(from, to, c.DefaultQuery("group_by", "day"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy báo cáo doanh thu"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"current_rate": h.exchangeRateService.GetCurrentRate(),
+		"data":         report,
+	})
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GlossaryHandler struct {
+	glossaryService *service.GlossaryService
+}
+
+func NewGlossaryHandler(glossaryService *service.GlossaryService) *GlossaryHandler {
+	return &GlossaryHandler{
+		glossaryService: glossaryService,
+	}
+}
+
+func parseUintParam(c *gin.Context, name string) (uint, bool) {
+	value, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return uint(value), true
+}
+
+// CreateGlossary tạo glossary mới (có thể kèm danh sách thuật ngữ)
+func (h *GlossaryHandler) CreateGlossary(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req model.CreateGlossaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	glossary, err := h.glossaryService.CreateGlossary(userID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Glossary đã được tạo thành công",
+		"data":    glossary,
+	})
+}
+
+// GetUserGlossaries lấy danh sách glossary của user
+func (h *GlossaryHandler) GetUserGlossaries(c *gin.Context) {
+	glossaries, err := h.glossaryService.GetUserGlossaries(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get glossaries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": glossaries,
+	})
+}
+
+// GetGlossaryByID lấy chi tiết glossary kèm thuật ngữ
+func (h *GlossaryHandler) GetGlossaryByID(c *gin.Context) {
+	glossaryID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	glossary, err := h.glossaryService.GetGlossary(c.GetUint("user_id"), glossaryID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Glossary not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": glossary,
+	})
+}
+
+// UpdateGlossary cập nhật tên và cặp ngôn ngữ của glossary
+func (h *GlossaryHandler) UpdateGlossary(c *gin.Context) {
+	glossaryID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req model.UpdateGlossaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if err := h.glossaryService.UpdateGlossary(c.GetUint("user_id"), glossaryID, req); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Glossary not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Glossary đã được cập nhật thành công",
+	})
+}
+
+// DeleteGlossary xoá glossary và toàn bộ thuật ngữ
+func (h *GlossaryHandler) DeleteGlossary(c *gin.Context) {
+	glossaryID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.glossaryService.DeleteGlossary(c.GetUint("user_id"), glossaryID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Glossary not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Glossary đã được xoá",
+	})
+}
+
+// AddTerm thêm thuật ngữ vào glossary
+func (h *GlossaryHandler) AddTerm(c *gin.Context) {
+	glossaryID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req model.GlossaryTermRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	term, err := h.glossaryService.AddTerm(c.GetUint("user_id"), glossaryID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Đã thêm thuật ngữ",
+		"data":    term,
+	})
+}
+
+// UpdateTerm cập nhật một thuật ngữ
+func (h *GlossaryHandler) UpdateTerm(c *gin.Context) {
+	glossaryID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	termID, ok := parseUintParam(c, "term_id")
+	if !ok {
+		return
+	}
+
+	var req model.GlossaryTermRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if err := h.glossaryService.UpdateTerm(c.GetUint("user_id"), glossaryID, termID, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Đã cập nhật thuật ngữ",
+	})
+}
+
+// DeleteTerm xoá một thuật ngữ
+func (h *GlossaryHandler) DeleteTerm(c *gin.Context) {
+	glossaryID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	termID, ok := parseUintParam(c, "term_id")
+	if !ok {
+		return
+	}
+
+	if err := h.glossaryService.DeleteTerm(c.GetUint("user_id"), glossaryID, termID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Glossary not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Đã xoá thuật ngữ",
+	})
+}
+
+// CheckHistoryGlossary kiểm tra bản dịch của một history có dùng đúng thuật ngữ không
+func (h *GlossaryHandler) CheckHistoryGlossary(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		HistoryID   uint   `json:"history_id" binding:"required"`
+		GlossaryIDs []uint `json:"glossary_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	var history config.CaptionHistory
+	if err := config.Db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", req.HistoryID, userID).First(&history).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "History not found"})
+		return
+	}
+	if history.OriginalSrtFile == "" || history.SrtFile == "" || history.OriginalSrtFile == history.SrtFile {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kết quả này không có bản dịch để kiểm tra"})
+		return
+	}
+
+	sourceSRT, err := os.ReadFile(history.OriginalSrtFile)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Original SRT file not found"})
+		return
+	}
+	translatedSRT, err := os.ReadFile(history.SrtFile)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Translated SRT file not found"})
+		return
+	}
+
+	// Không lọc theo ngôn ngữ đích: user chủ động chọn glossary để kiểm tra
+	terms, err := h.glossaryService.LoadTermsForRequest(userID, req.GlossaryIDs, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load glossaries"})
+		return
+	}
+
+	violations := service.CheckGlossaryCompliance(string(sourceSRT), string(translatedSRT), terms)
+	c.JSON(http.StatusOK, gin.H{
+		"history_id":      history.ID,
+		"terms_checked":   len(terms),
+		"violations":      violations,
+		"violation_count": len(violations),
+	})
+}
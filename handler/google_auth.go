@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -53,7 +54,8 @@ func GoogleLoginHandler(c *gin.Context) {
 	}
 
 	// Generate state parameter for security
-	state := generateRandomState()
+	// Mã giới thiệu và device id được gửi kèm state để gắn vào user khi callback tạo tài khoản mới
+	state := encodeOAuthState(generateRandomState(), c.Query("ref"), requestDeviceID(c, c.Query("device_id")))
 
 	// Store state in session or cache (for production, use Redis)
 	// For now, we'll use a simple approach
@@ -107,6 +109,8 @@ func GoogleCallbackHandler(c *gin.Context) {
 			return
 		}
 		isNewUser = true
+		_, referralCode, deviceID := decodeOAuthState(state)
+		attachReferral(user, referralCode, c.ClientIP(), deviceID)
 	}
 
 	// Generate JWT token
@@ -216,6 +220,26 @@ func CreateGoogleUser(c *gin.Context, userInfo *GoogleUserInfo) (config.Users, e
 	return user, nil
 }
 
+// encodeOAuthState ghép state với mã giới thiệu và device id (đã chuẩn hoá, không chứa dấu chấm)
+func encodeOAuthState(state, referralCode, deviceID string) string {
+	referralCode = service.NormalizeReferralCode(referralCode)
+	if referralCode == "" && deviceID == "" {
+		return state
+	}
+	return strings.Join([]string{state, referralCode, deviceID}, ".")
+}
+
+// decodeOAuthState tách state do encodeOAuthState tạo
+func decodeOAuthState(value string) (state, referralCode, deviceID string) {
+	parts := strings.SplitN(value, ".", 3)
+	state = parts[0]
+	if len(parts) == 3 {
+		referralCode = service.NormalizeReferralCode(parts[1])
+		deviceID = service.NormalizeDeviceID(parts[2])
+	}
+	return state, referralCode, deviceID
+}
+
 // generateRandomState generates a random state parameter for OAuth security
 func generateRandomState() string {
 	// In production, use a proper random generator
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InvoiceHandler struct {
+	invoiceService *service.InvoiceService
+}
+
+func NewInvoiceHandler(invoiceService *service.InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{
+		invoiceService: invoiceService,
+	}
+}
+
+// GetBillingProfile lấy thông tin xuất hoá đơn của user
+func (h *InvoiceHandler) GetBillingProfile(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	profile, err := h.invoiceService.GetBillingProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy thông tin xuất hoá đơn"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": profile,
+	})
+}
+
+// UpdateBillingProfile cập nhật thông tin công ty in trên hoá đơn, áp dụng cho hoá đơn xuất sau đó
+func (h *InvoiceHandler) UpdateBillingProfile(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req model.BillingProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	profile, err := h.invoiceService.UpdateBillingProfile(userID, req)
+	if errors.Is(err, service.ErrInvalidBillingProfile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật thông tin xuất hoá đơn"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cập nhật thông tin xuất hoá đơn thành công",
+		"data":    profile,
+	})
+}
+
+// GetPaymentInvoice tải hoá đơn của đơn đã thanh toán. format = html (mặc định), pdf hoặc json
+func (h *InvoiceHandler) GetPaymentInvoice(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	orderCode := c.Param("order_code")
+
+	invoice, err := h.invoiceService.GetOrCreateInvoice(userID, orderCode)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy đơn hàng"})
+		return
+	}
+	if errors.Is(err, service.ErrInvoiceNotAvailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Đơn hàng chưa thanh toán, chưa thể xuất hoá đơn"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get invoice for order %s: %v", orderCode, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xuất hoá đơn"})
+		return
+	}
+
+	if c.DefaultQuery("format", "html") == "json" {
+		c.JSON(http.StatusOK, gin.H{"data": invoice})
+		return
+	}
+
+	html, err := h.invoiceService.RenderInvoiceHTML(invoice)
+	if err != nil {
+		log.Printf("Failed to render invoice %s: %v", invoice.InvoiceNumber, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xuất hoá đơn"})
+		return
+	}
+	h.sendDocument(c, html, "invoice-"+invoice.InvoiceNumber)
+}
+
+// GetCreditStatement tải sao kê credit sử dụng của tháng (YYYY-MM). format = html (mặc định), pdf hoặc json
+func (h *InvoiceHandler) GetCreditStatement(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	month := c.Param("month")
+
+	statement, err := h.invoiceService.BuildUsageStatement(userID, month)
+	if errors.Is(err, service.ErrInvalidStatementMonth) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tháng không hợp lệ, định dạng YYYY-MM và không quá tháng hiện tại"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to build statement %s for user %d: %v", month, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo sao kê"})
+		return
+	}
+
+	if c.DefaultQuery("format", "html") == "json" {
+		c.JSON(http.StatusOK, gin.H{"data": statement})
+		return
+	}
+
+	html, err := h.invoiceService.RenderStatementHTML(statement)
+	if err != nil {
+		log.Printf("Failed to render statement %s for user %d: %v", month, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo sao kê"})
+		return
+	}
+	h.sendDocument(c, html, "statement-"+month)
+}
+
+// sendDocument trả về HTML hoặc PDF (format=pdf) dưới dạng file tải về
+func (h *InvoiceHandler) sendDocument(c *gin.Context, html []byte, filename string) {
+	if c.Query("format") != "pdf" {
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.html"`, filename))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+		return
+	}
+
+	pdf, err := h.invoiceService.RenderPDF(html)
+	if err != nil {
+		log.Printf("Failed to render %s.pdf: %v", filename, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrPDFUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": "Không thể tạo file PDF", "warning": "Vui lòng tải bản HTML (format=html) và in ra PDF từ trình duyệt"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, filename))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
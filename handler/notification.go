@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type NotificationHandler struct {
+	notificationService *service.NotificationService
+}
+
+func NewNotificationHandler(notificationService *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+// GetNotifications lấy thông báo của user, ?unread=true chỉ lấy thông báo chưa đọc
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 {
+		limit = 20
+	}
+
+	notifications, unread, err := h.notificationService.GetUserNotifications(userID, c.Query("unread") == "true", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy thông báo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":         notifications,
+		"unread_count": unread,
+	})
+}
+
+// MarkNotificationRead đánh dấu đã đọc một thông báo
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	notificationID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.notificationService.MarkRead(userID, notificationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thông báo không tồn tại"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật thông báo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã đánh dấu đã đọc"})
+}
+
+// MarkAllNotificationsRead đánh dấu đã đọc tất cả thông báo
+func (h *NotificationHandler) MarkAllNotificationsRead(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	if err := h.notificationService.MarkRead(userID, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật thông báo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã đánh dấu đã đọc tất cả thông báo"})
+}
@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"creator-tool-backend/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOutputProfilesHandler trả về danh sách output profile để frontend chọn
+func GetOutputProfilesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"profiles":        service.ListOutputProfiles(),
+		"default_profile": service.DefaultOutputProfile,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"creator-tool-backend/config"
 	"creator-tool-backend/service"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 	"gorm.io/datatypes"
 )
 
@@ -28,6 +30,8 @@ func CreatePaymentOrder(c *gin.Context) {
 		AmountUSD     float64 `json:"amount_usd"`
 		AmountVND     float64 `json:"amount_vnd"`
 		PaymentMethod string  `json:"payment_method"`
+		PackageID     *uint   `json:"package_id"` // Gói nạp định sẵn, giá và credit lấy theo gói
+		PromoCode     string  `json:"promo_code"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -35,11 +39,13 @@ func CreatePaymentOrder(c *gin.Context) {
 		return
 	}
 
-	// Xử lý amount - hỗ trợ cả USD và VND
+	// Xử lý amount - hỗ trợ cả USD và VND (bỏ qua khi chọn gói nạp)
 	var amountUSD float64
-	if req.AmountVND > 0 {
+	if req.PackageID != nil {
+		amountUSD = 0
+	} else if req.AmountVND > 0 {
 		// Nếu có amount_vnd, chuyển đổi sang USD
-		amountUSD = req.AmountVND / 25000
+		amountUSD = service.NewExchangeRateService(config.Db).VNDToUSD(req.AmountVND)
 	} else if req.AmountUSD > 0 {
 		// Nếu có amount_usd, sử dụng trực tiếp
 		amountUSD = req.AmountUSD
@@ -49,7 +55,7 @@ func CreatePaymentOrder(c *gin.Context) {
 	}
 
 	// Validation
-	if amountUSD <= 0 {
+	if amountUSD <= 0 && req.PackageID == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be greater than 0"})
 		return
 	}
@@ -65,7 +71,16 @@ func CreatePaymentOrder(c *gin.Context) {
 	}
 
 	paymentService := service.NewPaymentOrderService()
-	order, err := paymentService.CreateOrder(userID, amountUSD)
+	order, bonuses, err := paymentService.CreateTopupOrder(userID, amountUSD, req.PackageID, req.PromoCode)
+	if errors.Is(err, service.ErrInvalidTopup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "warning": "Gói nạp hoặc mã khuyến mãi không hợp lệ. Vui lòng kiểm tra lại!"})
+		return
+	}
+	if errors.Is(err, service.ErrNoBankAccountAvailable) {
+		log.Printf("No bank account available for top-up of user %d: %v", userID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No bank account available", "warning": "Các tài khoản nhận tiền đã đạt hạn mức. Vui lòng thử lại sau hoặc liên hệ hỗ trợ!"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment order", "warning": "Không thể tạo đơn hàng thanh toán. Vui lòng thử lại hoặc liên hệ hỗ trợ!"})
 		return
@@ -82,8 +97,10 @@ func CreatePaymentOrder(c *gin.Context) {
 			"bank_account": order.BankAccount,
 			"bank_name":    order.BankName,
 			"order_status": order.OrderStatus,
+			"package_id":   order.PackageID,
 			"created_at":   order.CreatedAt,
 		},
+		"bonuses": bonuses, // Credit thưởng dự kiến, được cộng khi đơn thanh toán
 		"message": "Đơn hàng thanh toán được tạo thành công",
 	})
 }
@@ -126,6 +143,7 @@ func GetPaymentOrder(c *gin.Context) {
 			"bank_account": order.BankAccount,
 			"bank_name":    order.BankName,
 			"order_status": order.OrderStatus,
+			"purpose":      order.Purpose,
 			"paid_at":      order.PaidAt,
 			"created_at":   order.CreatedAt,
 		},
@@ -167,6 +185,7 @@ func GetUserPaymentOrders(c *gin.Context) {
 				"amount_usd":   order.AmountUSD.String(),
 				"amount_vnd":   order.AmountVND.String(),
 				"order_status": order.OrderStatus,
+				"purpose":      order.Purpose,
 				"paid_at":      order.PaidAt,
 				"created_at":   order.CreatedAt,
 			})
@@ -407,95 +426,40 @@ func SepayWebhookHandler(c *gin.Context) {
 	log.Printf("Sepay webhook processed - Order: %s, Amount: %.0f, Gateway: %v, TransactionID: %s",
 		orderCode, amount, webhookData["gateway"], transactionID)
 
-	// Kiểm tra order code có hợp lệ không
-	if orderCode == "" {
-		// Cập nhật log với lỗi order code không tìm thấy
-		errorMsg := "Order code not found in content"
-		config.Db.Model(&logEntry).Updates(map[string]interface{}{
-			"processing_status":  "failed",
-			"error_message":      errorMsg,
-			"processing_time_ms": int(time.Since(startTime).Milliseconds()),
-		})
-
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order code not found in content"})
-		return
-	}
-
-	// Tìm đơn hàng theo order code
+	// Khớp khoản tiền với đơn hàng. Không tìm thấy đơn, đơn hết hạn/đã huỷ hoặc thiếu tiền đơn subscription
+	// thì đưa vào hàng chờ needs_review, vẫn trả 200 để Sepay không gửi lại
 	paymentService := service.NewPaymentOrderService()
-	order, err := paymentService.GetOrderByCode(orderCode)
+	outcome, _, err := paymentService.ConfirmPayment(service.PaymentSourceSepay, transactionID, orderCode, decimal.NewFromFloat(amount), logEntry.ID)
 	if err != nil {
-		// Cập nhật log với lỗi order not found
-		errorMsg := "Order not found: " + orderCode
+		errorMsg := "Failed to process payment: " + err.Error()
 		config.Db.Model(&logEntry).Updates(map[string]interface{}{
 			"processing_status":  "failed",
 			"error_message":      errorMsg,
 			"processing_time_ms": int(time.Since(startTime).Milliseconds()),
 		})
 
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment"})
 		return
 	}
 
-	// Kiểm tra trạng thái đơn hàng
-	if order.OrderStatus != "pending" {
-		// Cập nhật log với trạng thái ignored
+	switch outcome {
+	case service.PaymentOutcomeDuplicate:
 		config.Db.Model(&logEntry).Updates(map[string]interface{}{
 			"processing_status":  "ignored",
-			"error_message":      "Order already processed: " + order.OrderStatus,
+			"error_message":      "Duplicate transaction for order " + orderCode,
 			"processing_time_ms": int(time.Since(startTime).Milliseconds()),
 		})
 
 		c.JSON(http.StatusOK, gin.H{"message": "Order already processed"})
 		return
-	}
-
-	// Kiểm tra số tiền
-	expectedAmount, _ := order.AmountVND.Float64()
-	if amount != expectedAmount {
-		// Cập nhật log với lỗi amount mismatch
-		errorMsg := fmt.Sprintf("Amount mismatch: expected %.0f, got %.0f", expectedAmount, amount)
-		config.Db.Model(&logEntry).Updates(map[string]interface{}{
-			"processing_status":  "failed",
-			"error_message":      errorMsg,
-			"processing_time_ms": int(time.Since(startTime).Milliseconds()),
-		})
-
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount mismatch"})
-		return
-	}
-
-	// Cập nhật trạng thái đơn hàng thành paid
-	err = paymentService.UpdateOrderStatus(order.ID, "paid", &transactionID)
-	if err != nil {
-		// Cập nhật log với lỗi update order status
-		errorMsg := "Failed to update order status: " + err.Error()
+	case service.PaymentOutcomeNeedsReview:
 		config.Db.Model(&logEntry).Updates(map[string]interface{}{
 			"processing_status":  "failed",
-			"error_message":      errorMsg,
-			"processing_time_ms": int(time.Since(startTime).Milliseconds()),
-		})
-
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
-		return
-	}
-
-	// Cộng credit cho user
-	creditService := service.NewCreditService()
-	amountUSD, _ := order.AmountUSD.Float64()
-	err = creditService.AddCredits(order.UserID, amountUSD,
-		fmt.Sprintf("Nạp credit qua Sepay - %s", orderCode),
-		transactionID)
-	if err != nil {
-		// Cập nhật log với lỗi add credits
-		errorMsg := "Failed to add credits: " + err.Error()
-		config.Db.Model(&logEntry).Updates(map[string]interface{}{
-			"processing_status":  "failed",
-			"error_message":      errorMsg,
+			"error_message":      "Payment queued for review",
 			"processing_time_ms": int(time.Since(startTime).Milliseconds()),
 		})
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add credits"})
+		c.JSON(http.StatusOK, gin.H{"message": "Payment queued for review", "order_code": orderCode})
 		return
 	}
 
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PaymentReviewHandler struct {
+	reviewService *service.PaymentReviewService
+}
+
+func NewPaymentReviewHandler(reviewService *service.PaymentReviewService) *PaymentReviewHandler {
+	return &PaymentReviewHandler{
+		reviewService: reviewService,
+	}
+}
+
+// AdminGetPaymentReviews (Admin only) lấy hàng chờ đối soát thanh toán, mặc định status=needs_review
+func (h *PaymentReviewHandler) AdminGetPaymentReviews(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	status := c.DefaultQuery("status", service.ReviewStatusNeedsReview)
+	if status == "all" {
+		status = ""
+	}
+
+	reviews, total, err := h.reviewService.ListReviews(status, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy hàng chờ đối soát"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  reviews,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// AdminResolvePaymentReview (Admin only) ghi nhận khoản tiền cho đơn (apply) hoặc bỏ qua (reject)
+func (h *PaymentReviewHandler) AdminResolvePaymentReview(c *gin.Context) {
+	reviewID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req model.ResolvePaymentReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	var adminID *uint
+	if id := c.GetInt("admin_id"); id > 0 {
+		value := uint(id)
+		adminID = &value
+	}
+
+	review, err := h.reviewService.Resolve(reviewID, req, adminID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Khoản thanh toán không tồn tại"})
+		return
+	}
+	if errors.Is(err, service.ErrReviewResolved) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Khoản thanh toán đã được xử lý"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidReviewResolution) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xử lý khoản thanh toán: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Xử lý khoản thanh toán thành công",
+		"data":    review,
+	})
+}
+
+// AdminGetUnmatchedPaymentLogs (Admin only) lấy log Sepay/email không khớp đơn và chưa vào hàng chờ đối soát
+func (h *PaymentReviewHandler) AdminGetUnmatchedPaymentLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 {
+		limit = 50
+	}
+
+	logs, err := h.reviewService.GetUnmatchedLogs(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy log thanh toán chưa khớp"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": logs,
+	})
+}
+
+// AdminQueuePaymentLog (Admin only) đưa log Sepay/email chưa khớp vào hàng chờ để đối soát với đơn hàng
+func (h *PaymentReviewHandler) AdminQueuePaymentLog(c *gin.Context) {
+	logID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	review, err := h.reviewService.QueueFromLog(c.Param("source"), logID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log thanh toán không tồn tại"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidReviewResolution) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể đưa log vào hàng chờ đối soát"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Đã đưa vào hàng chờ đối soát",
+		"data":    review,
+	})
+}
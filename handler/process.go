@@ -2,6 +2,7 @@ package handler
 
 import (
 	"creator-tool-backend/config"
+	"creator-tool-backend/model"
 	"creator-tool-backend/service"
 	"creator-tool-backend/util"
 	"encoding/json"
@@ -65,6 +66,15 @@ func ProcessVideoHandler(c *gin.Context) {
 		subtitleBgColor = "#808080" // Default to gray (same as burn-sub)
 	}
 
+	// Output profile cho video đầu ra (tiktok, youtube, square, source)
+	outputProfile := service.GetOutputProfile(c.PostForm("output_profile"))
+	// Chế độ reframe video ngang sang dọc (blur, center, smart), rỗng = giữ nguyên; bỏ qua với profile ngang/vuông
+	reframeMode := service.ReframeModeForProfile(c.PostForm("reframe_mode"), outputProfile)
+	// Chế độ giọng nói: replace (mặc định), voice-over, subtitle-only
+	voiceMode := service.NormalizeVoiceMode(c.PostForm("voice_mode"))
+	// Glossary của user áp dụng khi dịch (glossary_ids=1,2)
+	glossary := service.LoadGlossaryTermsForRequest(userID, service.ParseGlossaryIDs(c.PostForm("glossary_ids")), targetLanguage)
+
 	// Get the uploaded file
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -120,6 +130,7 @@ func ProcessVideoHandler(c *gin.Context) {
 	customSrtFile, err := c.FormFile("custom_srt")
 	var transcript string
 	var segments []service.Segment
+	var sourceLanguage string
 	var hasCustomSrt bool = false
 	if err == nil && customSrtFile != nil {
 		// User uploaded custom SRT
@@ -157,7 +168,7 @@ func ProcessVideoHandler(c *gin.Context) {
 			return
 		}
 
-		transcript, segments, _, err = service.TranscribeWithService(audioPath, apiKey, whisperServiceName, whisperModelAPIName)
+		transcribed, _, err := service.TranscribeWithServiceCachedResult(audioPath, apiKey, whisperServiceName, whisperModelAPIName)
 		if err != nil {
 			if processID > 0 {
 				processService.UpdateProcessStatus(processID, "failed")
@@ -166,7 +177,11 @@ func ProcessVideoHandler(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to transcribe vocals: %v", err)})
 			return
 		}
+		transcript, segments = transcribed.Transcript, transcribed.Segments
+		sourceLanguage = service.ResolveSourceLanguage(transcribed.SourceLanguage, transcript)
 	}
+	// Video đã nói đúng ngôn ngữ đích thì dùng luôn SRT gốc, không dịch và không tính phí dịch
+	translationSkipped := !hasCustomSrt && service.IsSameLanguage(sourceLanguage, targetLanguage)
 
 	// Tính chi phí Whisper theo thời gian audio thực tế
 	durationMinutes := duration / 60.0
@@ -191,8 +206,21 @@ func ProcessVideoHandler(c *gin.Context) {
 		return
 	}
 
+	// Không lock credit cho TTS khi chế độ không dùng giọng đọc
+	estimatedCostWithMarkup = service.ApplyVoiceModeToEstimate(estimatedCostWithMarkup, voiceMode)
 	estimatedCost := estimatedCostWithMarkup["total"]
 
+	// Giữ hạn mức tháng của gói trước khi lock credit
+	allowance, reserved := reserveMonthlyAllowance(c, userID, durationMinutes)
+	if !reserved {
+		if processID > 0 {
+			processService.UpdateProcessStatus(processID, "failed")
+		}
+		util.CleanupDir(videoDir)
+		return
+	}
+	defer allowance.releaseUnlessKept()
+
 	// Lock credit trước khi xử lý
 	_, err = creditService.LockCredits(userID, estimatedCost, "process-video", "Lock credit for video processing", nil)
 	if err != nil {
@@ -200,6 +228,9 @@ func ProcessVideoHandler(c *gin.Context) {
 			processService.UpdateProcessStatus(processID, "failed")
 		}
 		util.CleanupDir(videoDir)
+		if respondSpendingCapReached(c, err) {
+			return
+		}
 		c.JSON(http.StatusPaymentRequired, gin.H{
 			"error":   "Không đủ credit để xử lý video",
 			"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
@@ -223,6 +254,7 @@ func ProcessVideoHandler(c *gin.Context) {
 		VideoFilenameOrigin: file.Filename,
 		Transcript:          transcript,
 		Segments:            segmentsJSON,
+		SourceLanguage:      sourceLanguage,
 		ProcessType:         "process-video",
 		CreatedAt:           time.Now(),
 	}
@@ -249,6 +281,7 @@ func ProcessVideoHandler(c *gin.Context) {
 		})
 		return
 	}
+	allowance.keep()
 
 	// Create original SRT file from Whisper segments first
 	originalSRTPath := filepath.Join(videoDir, strings.TrimSuffix(uniqueName, filepath.Ext(uniqueName))+"_original.srt")
@@ -266,8 +299,15 @@ func ProcessVideoHandler(c *gin.Context) {
 	var translatedSRTContent string
 	var translatedSRTPath string
 	var translationCost float64 = 0
-
-	if !hasCustomSrt {
+	var glossaryViolations []model.GlossaryViolation
+	var translationMemory *model.TranslationMemoryStats
+	var translationQA *model.TranslationQAReport
+
+	if translationSkipped {
+		translatedSRTPath = originalSRTPath
+		translatedSRTContent = originalSRTContent
+		log.Printf("Source language %s equals target language, skipping translation", sourceLanguage)
+	} else if !hasCustomSrt {
 		// Lấy service_name và model_api_name cho nghiệp vụ dịch SRT từ bảng service_config
 		serviceName, srtModelAPIName, err := pricingService.GetActiveServiceForType("srt_translation")
 		if err != nil {
@@ -281,12 +321,13 @@ func ProcessVideoHandler(c *gin.Context) {
 		}
 
 		// Translate the original SRT file using the configured service (Gemini or GPT) with context-aware translation
+		memory := service.NewTranslationMemoryContext(userID, sourceLanguage, targetLanguage)
 		if strings.Contains(serviceName, "gpt") {
 			// Use GPT for translation with context awareness
-			translatedSRTContent, err = service.TranslateSRTWithContextAwareness(originalSRTPath, apiKey, srtModelAPIName, targetLanguage)
+			translatedSRTContent, err = service.TranslateSRTWithCache(originalSRTPath, apiKey, srtModelAPIName, sourceLanguage, targetLanguage, glossary, memory)
 		} else {
 			// Use Gemini for translation with context awareness (default)
-			translatedSRTContent, err = service.TranslateSRTWithContextAwareness(originalSRTPath, geminiKey, srtModelAPIName, targetLanguage)
+			translatedSRTContent, err = service.TranslateSRTWithCache(originalSRTPath, geminiKey, srtModelAPIName, sourceLanguage, targetLanguage, glossary, memory)
 		}
 		if err != nil {
 			creditService.UnlockCredits(userID, estimatedCost-whisperCost, "process-video", "Unlock remaining credits due to translation error", nil)
@@ -309,6 +350,11 @@ func ProcessVideoHandler(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translated SRT file"})
 			return
 		}
+		if originalSRTContent, err := os.ReadFile(originalSRTPath); err == nil {
+			glossaryViolations = service.CheckGlossaryCompliance(string(originalSRTContent), translatedSRTContent, glossary)
+			translationQA = service.RunTranslationQAOnSRT(string(originalSRTContent), translatedSRTContent, targetLanguage)
+		}
+		translationMemory = memory.Stats(serviceName)
 
 		// Tính chi phí translation theo service được chọn (tách input/output nếu có)
 		var translationTokens int
@@ -373,6 +419,7 @@ func ProcessVideoHandler(c *gin.Context) {
 	backgroundVolume := 1.2
 	ttsVolume := 1.5 // Tăng default TTS volume để voice rõ ràng hơn
 	speakingRate := 1.2
+	originalVolume := parseOriginalVolume(c)
 
 	// Log raw form values
 	if v := c.PostForm("background_volume"); v != "" {
@@ -391,84 +438,136 @@ func ProcessVideoHandler(c *gin.Context) {
 		}
 	}
 
-	// Read translated SRT content for TTS
-	log.Printf("Reading SRT file for TTS: %s", translatedSRTPath)
-	srtContentBytes, err := os.ReadFile(translatedSRTPath)
-	if err != nil {
-		log.Printf("Failed to read SRT file: %v", err)
-		creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost, "process-video", "Unlock remaining credits due to SRT read error", nil)
-		if processID > 0 {
-			processService.UpdateProcessStatus(processID, "failed")
+	// Chế độ subtitle-only bỏ qua TTS, không tính phí TTS
+	var ttsPath string
+	var ttsCost float64
+	ttsTiming := &service.TTSTimingReport{}
+	if service.VoiceModeUsesTTS(voiceMode) {
+		// Read translated SRT content for TTS
+		log.Printf("Reading SRT file for TTS: %s", translatedSRTPath)
+		srtContentBytes, err := os.ReadFile(translatedSRTPath)
+		if err != nil {
+			log.Printf("Failed to read SRT file: %v", err)
+			creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost, "process-video", "Unlock remaining credits due to SRT read error", nil)
+			if processID > 0 {
+				processService.UpdateProcessStatus(processID, "failed")
+			}
+			util.CleanupDir(videoDir)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read SRT file: %v", err)})
+			return
 		}
-		util.CleanupDir(videoDir)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read SRT file: %v", err)})
-		return
-	}
-	log.Printf("Successfully read SRT file, size: %d bytes", len(srtContentBytes))
+		log.Printf("Successfully read SRT file, size: %d bytes", len(srtContentBytes))
 
-	// Tính chi phí TTS theo số ký tự thực tế (sử dụng Wavenet cho chất lượng tốt)
-	ttsCost, err := pricingService.CalculateTTSCost(string(srtContentBytes), true)
-	if err != nil {
-		creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost, "process-video", "Unlock remaining credits due to TTS cost error", nil)
-		if processID > 0 {
-			processService.UpdateProcessStatus(processID, "failed")
+		// Chỉ tính phí các segment chưa có trong cache TTS (sử dụng Wavenet cho chất lượng tốt)
+		ttsSplit := service.SplitTTSBillingByCache(string(srtContentBytes), targetLanguage, "", speakingRate, nil)
+		log.Printf("TTS cache: %d hit segments (%d chars), %d miss segments (%d chars)", ttsSplit.HitSegments, ttsSplit.CachedCharacters, ttsSplit.MissSegments, ttsSplit.BilledCharacters)
+		if ttsSplit.MissSegments > 0 {
+			ttsCost, err = pricingService.CalculateTTSCost(ttsSplit.BilledText, true)
+		}
+		if err != nil {
+			creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost, "process-video", "Unlock remaining credits due to TTS cost error", nil)
+			if processID > 0 {
+				processService.UpdateProcessStatus(processID, "failed")
+			}
+			util.CleanupDir(videoDir)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate TTS cost"})
+			return
 		}
-		util.CleanupDir(videoDir)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate TTS cost"})
-		return
-	}
 
-	if err := creditService.DeductCredits(userID, ttsCost, "tts", "Google TTS", &captionHistory.ID, "per_character", float64(len(srtContentBytes))); err != nil {
-		creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost-ttsCost, "process-video", "Unlock remaining credits due to TTS deduction error", nil)
-		if processID > 0 {
-			processService.UpdateProcessStatus(processID, "failed")
+		if ttsSplit.MissSegments == 0 {
+			log.Printf("All TTS segments served from cache, skipping TTS charge")
+		} else if err := creditService.DeductCredits(userID, ttsCost, "tts", "Google TTS", &captionHistory.ID, "per_character", float64(ttsSplit.BilledCharacters)); err != nil {
+			creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost-ttsCost, "process-video", "Unlock remaining credits due to TTS deduction error", nil)
+			if processID > 0 {
+				processService.UpdateProcessStatus(processID, "failed")
+			}
+			util.CleanupDir(videoDir)
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"error":   "Không đủ credit cho TTS",
+				"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
+			})
+			return
 		}
-		util.CleanupDir(videoDir)
-		c.JSON(http.StatusPaymentRequired, gin.H{
-			"error":   "Không đủ credit cho TTS",
-			"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
-		})
-		return
-	}
 
-	// Convert translated SRT to speech with target language using service_config
-	log.Printf("Starting TTS conversion with language: %s, speaking rate: %f", targetLanguage, speakingRate)
+		// Convert translated SRT to speech with target language using service_config
+		log.Printf("Starting TTS conversion with language: %s, speaking rate: %f", targetLanguage, speakingRate)
 
-	// Lấy service config cho TTS
-	ttsServiceName, ttsModelAPIName, err := pricingService.GetActiveServiceForType("text_to_speech")
-	if err != nil {
-		creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost-ttsCost, "process-video", "Unlock remaining credits due to TTS service config error", nil)
-		if processID > 0 {
-			processService.UpdateProcessStatus(processID, "failed")
+		// Lấy service config cho TTS
+		ttsServiceName, ttsModelAPIName, err := pricingService.GetActiveServiceForType("text_to_speech")
+		if err != nil {
+			creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost-ttsCost, "process-video", "Unlock remaining credits due to TTS service config error", nil)
+			if processID > 0 {
+				processService.UpdateProcessStatus(processID, "failed")
+			}
+			util.CleanupDir(videoDir)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get active text-to-speech service"})
+			return
 		}
-		util.CleanupDir(videoDir)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get active text-to-speech service"})
-		return
+
+		ttsPath, ttsTiming, err = service.ConvertSRTToSpeechWithService(string(srtContentBytes), videoDir, speakingRate, targetLanguage, ttsServiceName, ttsModelAPIName)
+		if err != nil {
+			creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost-ttsCost, "process-video", "Unlock remaining credits due to TTS conversion error", nil)
+			if processID > 0 {
+				processService.UpdateProcessStatus(processID, "failed")
+			}
+			util.CleanupDir(videoDir)
+			util.HandleError(c, http.StatusInternalServerError, util.ErrProcessingFailed, err)
+			return
+		}
+
+		// Synthesize lại với SpeakingRate cao hơn để vừa cue là request Google TTS riêng, tính phí sau khi biết số lần thực tế
+		if ttsTiming.RetrySegments > 0 {
+			retryCost, err := pricingService.CalculateTTSCost(ttsTiming.RetryText, true)
+			if err != nil {
+				log.Printf("Failed to calculate TTS retry cost: %v", err)
+			} else if err := creditService.DeductCredits(userID, retryCost, "tts", "Google TTS (synthesize lại để vừa cue)", &captionHistory.ID, "per_character", float64(ttsTiming.RetryCharacters)); err != nil {
+				log.Printf("Failed to deduct TTS retry credits for user %d: %v", userID, err)
+			}
+		}
+	} else {
+		log.Printf("Voice mode %s: skipping TTS", voiceMode)
 	}
 
-	ttsPath, err := service.ConvertSRTToSpeechWithService(string(srtContentBytes), videoDir, speakingRate, targetLanguage, ttsServiceName, ttsModelAPIName)
-	if err != nil {
-		creditService.UnlockCredits(userID, estimatedCost-whisperCost-translationCost-ttsCost, "process-video", "Unlock remaining credits due to TTS conversion error", nil)
-		if processID > 0 {
-			processService.UpdateProcessStatus(processID, "failed")
+	// Chuẩn bị track nền cho bản mix theo chế độ giọng nói
+	var backgroundPath string
+	if service.VoiceModeUsesDemucs(voiceMode) {
+		backgroundPath, err = service.ExtractBackgroundMusicAsync(audioPath, uniqueName, videoDir)
+		if err != nil {
+			backgroundPath, err = service.FallbackSeparateAudio(audioPath, uniqueName, "no_vocals", videoDir)
+			if err != nil {
+				// Không tách được giọng gốc: giữ audio gốc ở âm lượng thấp như voice-over để tránh hai giọng chồng nhau
+				log.Printf("Demucs failed, mixing original audio at voice-over volume: %v", err)
+				backgroundPath = audioPath
+				backgroundVolume = originalVolume
+			}
 		}
-		util.CleanupDir(videoDir)
-		util.HandleError(c, http.StatusInternalServerError, util.ErrProcessingFailed, err)
-		return
+	} else if service.VoiceModeUsesTTS(voiceMode) {
+		// voice-over: giữ nguyên audio gốc (cả giọng nói) ở âm lượng thấp, không cần Demucs
+		backgroundPath = audioPath
+		backgroundVolume = originalVolume
 	}
 
-	// Merge video with background music and TTS audio
-	backgroundPath, err := service.ExtractBackgroundMusicAsync(audioPath, uniqueName, videoDir)
-	if err != nil {
-		backgroundPath, err = service.FallbackSeparateAudio(audioPath, uniqueName, "no_vocals", videoDir)
+	// Reframe video ngang sang dọc trước khi merge/burn để phụ đề nằm trong vùng an toàn
+	sourceVideoPath := videoPath
+	if reframeMode != "" {
+		reframedPath, err := service.ReframeVideo(videoPath, videoDir, reframeMode, outputProfile)
 		if err != nil {
-			backgroundPath = audioPath
+			log.Printf("Reframe failed, using original video: %v", err)
+		} else if reframedPath != videoPath {
+			sourceVideoPath = reframedPath
+			if outputProfile.SafeAreaBottom == 0 {
+				outputProfile.SafeAreaBottom = service.VerticalSafeAreaBottom
+			}
 		}
 	}
 
-	mergedVideoPath, err := service.MergeVideoWithAudio(videoPath, backgroundPath, ttsPath, videoDir, backgroundVolume, ttsVolume)
-	if err != nil {
-		mergedVideoPath = ""
+	// subtitle-only: giữ audio gốc, burn phụ đề trực tiếp lên video
+	mergedVideoPath := sourceVideoPath
+	if service.VoiceModeUsesTTS(voiceMode) {
+		mergedVideoPath, err = service.MergeVideoWithAudio(sourceVideoPath, backgroundPath, ttsPath, videoDir, backgroundVolume, ttsVolume, outputProfile)
+		if err != nil {
+			mergedVideoPath = ""
+		}
 	}
 
 	// Burn subtitle vào video với solid background box
@@ -485,13 +584,13 @@ func ProcessVideoHandler(c *gin.Context) {
 			finalVideoPath = mergedVideoPath
 		} else {
 			// Try SRT method first
-			burnedVideoPath, err := service.BurnSubtitleWithBackground(mergedVideoPath, translatedSRTPath, videoDir, subtitleColor, subtitleBgColor)
+			burnedVideoPath, err := service.BurnSubtitleWithBackground(mergedVideoPath, translatedSRTPath, videoDir, subtitleColor, subtitleBgColor, outputProfile)
 			if err != nil {
 				log.Printf("SRT method failed: %v", err)
 
 				// Try ASS method as fallback
 				log.Printf("Trying ASS method as fallback...")
-				burnedVideoPath, err = service.BurnSubtitleWithASS(mergedVideoPath, translatedSRTPath, videoDir, subtitleColor, subtitleBgColor)
+				burnedVideoPath, err = service.BurnSubtitleWithASS(mergedVideoPath, translatedSRTPath, videoDir, subtitleColor, subtitleBgColor, outputProfile)
 				if err != nil {
 					log.Printf("ASS method also failed: %v", err)
 					// Nếu cả hai method đều thất bại, vẫn dùng video đã merge
@@ -516,6 +615,18 @@ func ProcessVideoHandler(c *gin.Context) {
 	captionHistory.TTSFile = ttsPath
 	captionHistory.MergedVideoFile = finalVideoPath
 	captionHistory.BackgroundMusic = backgroundPath
+	captionHistory.TranslationQA = service.MarshalTranslationQA(translationQA)
+	captionHistory.RenderSettings = service.MarshalRenderSettings(service.RenderSettings{
+		TargetLanguage:   targetLanguage,
+		VoiceMode:        voiceMode,
+		SpeakingRate:     speakingRate,
+		BackgroundVolume: backgroundVolume,
+		TTSVolume:        ttsVolume,
+		OutputProfile:    outputProfile.Name,
+		ReframeMode:      reframeMode,
+		SubtitleColor:    subtitleColor,
+		SubtitleBgColor:  subtitleBgColor,
+	})
 	config.Db.Save(&captionHistory)
 
 	// Cập nhật trạng thái process thành completed và video_id
@@ -525,17 +636,24 @@ func ProcessVideoHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":           "Video processed successfully",
-		"background_music":  backgroundPath,
-		"srt_file":          translatedSRTPath, // Trả về file phụ đề đã dịch (khớp với audio TTS)
-		"original_srt_file": originalSRTPath,   // Thêm file phụ đề gốc nếu cần
-		"tts_file":          ttsPath,
-		"merged_video":      finalVideoPath,
-		"transcript":        transcript,
-		"segments":          segments,
-		"segments_vi":       segments,
-		"id":                captionHistory.ID,
-		"process_id":        processID,
+		"message":             "Video processed successfully",
+		"background_music":    backgroundPath,
+		"srt_file":            translatedSRTPath, // Trả về file phụ đề đã dịch (khớp với audio TTS)
+		"original_srt_file":   originalSRTPath,   // Thêm file phụ đề gốc nếu cần
+		"tts_file":            ttsPath,
+		"merged_video":        finalVideoPath,
+		"transcript":          transcript,
+		"segments":            segments,
+		"segments_vi":         segments,
+		"id":                  captionHistory.ID,
+		"process_id":          processID,
+		"voice_mode":          voiceMode,
+		"glossary_violations": glossaryViolations,
+		"translation_memory":  translationMemory,
+		"translation_qa":      translationQA,
+		"tts_overflow":        ttsTiming.OverflowSegments,
+		"source_language":     sourceLanguage,
+		"translation_skipped": translationSkipped,
 	})
 }
 
@@ -551,6 +669,7 @@ func EstimateProcessVideoCostHandler(c *gin.Context) {
 		DurationMinutes  float64 `json:"duration_minutes" binding:"required"`
 		TranscriptLength int     `json:"transcript_length"`
 		SrtLength        int     `json:"srt_length"`
+		VoiceMode        string  `json:"voice_mode"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -574,6 +693,7 @@ func EstimateProcessVideoCostHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to estimate cost"})
 		return
 	}
+	estimates = service.ApplyVoiceModeToEstimate(estimates, service.NormalizeVoiceMode(req.VoiceMode))
 
 	// Lấy credit balance của user
 	creditService := service.NewCreditService()
@@ -768,18 +888,36 @@ func TikTokOptimizerHandler(c *gin.Context) {
 	}
 
 	// --- TẠO PROMPT GPT ---
-	transcript, segments, _, err := service.TranscribeWhisperOpenAI(audioPath, apiKey)
+	transcribed, _, err := service.TranscribeWhisperOpenAIResult(audioPath, apiKey)
 	if err != nil {
 		config.Db.Model(processStatus).Update("status", "failed")
 		util.CleanupDir(videoDir)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Hệ thống đang gặp sự cố, vui lòng thử lại sau"})
 		return
 	}
+	transcript, segments := transcribed.Transcript, transcribed.Segments
+	sourceLanguage := service.ResolveSourceLanguage(transcribed.SourceLanguage, transcript)
+	// Không chọn ngôn ngữ mục tiêu thì bản địa hoá theo ngôn ngữ gốc của video
+	if targetLanguage == "" {
+		targetLanguage = sourceLanguage
+	}
 
 	// --- TÍNH PHÍ CHO TIKTOK OPTIMIZATION ---
 	// Ước tính cost dựa trên độ phức tạp của analysis
 	gptCost := whisperCost * 0.5 // Giảm cost vì sử dụng hybrid approach
 
+	// --- KIỂM TRA HẠN MỨC THÁNG CỦA GÓI ---
+	allowance, reserved := reserveMonthlyAllowance(c, userID, durationMinutes)
+	if !reserved {
+		config.Db.Model(&processStatus).Updates(map[string]interface{}{
+			"status":       "failed",
+			"completed_at": time.Now(),
+		})
+		util.CleanupDir(videoDir)
+		return
+	}
+	defer allowance.releaseUnlessKept()
+
 	// --- LOCK CREDIT TRƯỚC KHI XỬ LÝ ---
 	totalCost := whisperCost + gptCost
 	_, err = creditService.LockCredits(userID, totalCost, "tiktok-optimizer", "Lock credit for TikTok Optimizer", nil)
@@ -789,6 +927,9 @@ func TikTokOptimizerHandler(c *gin.Context) {
 			"completed_at": time.Now(),
 		})
 		util.CleanupDir(videoDir)
+		if respondSpendingCapReached(c, err) {
+			return
+		}
 		c.JSON(http.StatusPaymentRequired, gin.H{
 			"error":   "Không đủ credit để tối ưu TikTok",
 			"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
@@ -811,7 +952,7 @@ func TikTokOptimizerHandler(c *gin.Context) {
 	contentCategory := service.AnalyzeContentCategory(transcript, currentCaption)
 
 	// Generate optimized content với service config
-	localizedContent, err := tikTokManager.GenerateOptimizedContentWithConfig(transcript, contentCategory, targetLanguage, duration, apiKey)
+	localizedContent, err := tikTokManager.GenerateOptimizedContentWithConfig(transcript, contentCategory, sourceLanguage, targetLanguage, duration, apiKey)
 	if err != nil {
 		creditService.UnlockCredits(userID, totalCost, "tiktok-optimizer", "Unlock due to analysis error", nil)
 		config.Db.Model(processStatus).Update("status", "failed")
@@ -866,6 +1007,7 @@ func TikTokOptimizerHandler(c *gin.Context) {
 		"thumbnail_tips":     analysisResult.ThumbnailTips,
 		"sound_suggestions":  analysisResult.SoundSuggestions,
 		"analysis_method":    analysisResult.AnalysisMethod,
+		"source_language":    sourceLanguage,
 	}
 
 	// Lưu history
@@ -876,6 +1018,7 @@ func TikTokOptimizerHandler(c *gin.Context) {
 		VideoFilenameOrigin: file.Filename,
 		Transcript:          transcript,
 		Segments:            jsonData,
+		SourceLanguage:      sourceLanguage,
 		ProcessType:         "tiktok-optimize",
 		VideoDuration:       duration,
 		CreatedAt:           time.Now(),
@@ -926,6 +1069,7 @@ func TikTokOptimizerHandler(c *gin.Context) {
 		})
 		return
 	}
+	allowance.keep()
 	err = creditService.DeductCredits(userID, gptCost, "tiktok-optimizer", "TikTok Optimization Hybrid", &captionHistory.ID, "per_request", 1.0)
 	if err != nil {
 		config.Db.Model(processStatus).Update("status", "failed")
@@ -1010,6 +1154,8 @@ func CreateSubtitleHandler(c *gin.Context) {
 	}
 
 	isBilingual := c.PostForm("is_bilingual") == "true"
+	// Glossary của user áp dụng khi dịch (glossary_ids=1,2)
+	glossary := service.LoadGlossaryTermsForRequest(userID, service.ParseGlossaryIDs(c.PostForm("glossary_ids")), targetLanguage)
 
 	// Tính toán chi phí Whisper
 	whisperCost, err := pricingService.CalculateWhisperCost(1.0) // Ước tính 1 phút
@@ -1074,17 +1220,29 @@ func CreateSubtitleHandler(c *gin.Context) {
 		return
 	}
 
+	// Giữ hạn mức tháng của gói
+	allowance, reserved := reserveMonthlyAllowance(c, userID, c.GetFloat64("file_duration")/60.0)
+	if !reserved {
+		config.Db.Model(processStatus).Update("status", "failed")
+		util.CleanupDir(videoDir)
+		return
+	}
+	defer allowance.releaseUnlessKept()
+
 	// Lock credit
 	_, err = creditService.LockCredits(userID, totalCost, "create-subtitle", "Lock credit for create subtitle", nil)
 	if err != nil {
 		config.Db.Model(processStatus).Update("status", "failed")
 		util.CleanupDir(videoDir)
+		if respondSpendingCapReached(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể khóa credit"})
 		return
 	}
 
 	// Transcribe với Whisper
-	transcript, segments, _, err := service.TranscribeWhisperOpenAI(audioPath, apiKey)
+	transcribed, _, err := service.TranscribeWhisperOpenAIResult(audioPath, apiKey)
 	if err != nil {
 		creditService.UnlockCredits(userID, totalCost, "create-subtitle", "Unlock credits due to transcription error", nil)
 		config.Db.Model(processStatus).Update("status", "failed")
@@ -1092,6 +1250,17 @@ func CreateSubtitleHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Không thể transcribe: %v", err)})
 		return
 	}
+	transcript, segments := transcribed.Transcript, transcribed.Segments
+	sourceLanguage := service.ResolveSourceLanguage(transcribed.SourceLanguage, transcript)
+
+	// Video đã nói đúng ngôn ngữ đích: không cần bản song ngữ, trả lại credit dịch đã lock
+	translationSkipped := isBilingual && service.IsSameLanguage(sourceLanguage, targetLanguage)
+	if translationSkipped {
+		log.Printf("Source language %s equals target language, skipping bilingual translation", sourceLanguage)
+		creditService.UnlockCredits(userID, translationCost, "create-subtitle", "Unlock translation credits: source language equals target", nil)
+		totalCost -= translationCost
+		isBilingual = false
+	}
 
 	// Tạo file SRT gốc
 	originalSRTContent := createSRT(segments)
@@ -1124,6 +1293,7 @@ func CreateSubtitleHandler(c *gin.Context) {
 		Segments:            datatypes.JSON(segmentsJSON),
 		SrtFile:             originalSRTPath, // Sẽ được update nếu có dịch
 		OriginalSrtFile:     originalSRTPath, // Luôn là SRT gốc
+		SourceLanguage:      sourceLanguage,
 		ProcessType:         "create-subtitle",
 		VideoDuration:       fileDuration,
 		CreatedAt:           time.Now(),
@@ -1132,6 +1302,9 @@ func CreateSubtitleHandler(c *gin.Context) {
 
 	// Nếu song ngữ, dịch SRT
 	var translatedSRTPath string
+	var glossaryViolations []model.GlossaryViolation
+	var translationMemory *model.TranslationMemoryStats
+	var translationQA *model.TranslationQAReport
 	if isBilingual {
 		// Lấy service config cho translation
 		serviceName, srtModelAPIName, err := pricingService.GetActiveServiceForType("srt_translation")
@@ -1145,10 +1318,11 @@ func CreateSubtitleHandler(c *gin.Context) {
 
 		// Dịch SRT theo service được chọn với context-aware translation
 		var translatedSRTContent string
+		memory := service.NewTranslationMemoryContext(userID, sourceLanguage, targetLanguage)
 		if strings.Contains(serviceName, "gpt") {
-			translatedSRTContent, err = service.TranslateSRTWithContextAwareness(originalSRTPath, apiKey, srtModelAPIName, targetLanguage)
+			translatedSRTContent, err = service.TranslateSRTWithCache(originalSRTPath, apiKey, srtModelAPIName, sourceLanguage, targetLanguage, glossary, memory)
 		} else {
-			translatedSRTContent, err = service.TranslateSRTWithContextAwareness(originalSRTPath, geminiKey, srtModelAPIName, targetLanguage)
+			translatedSRTContent, err = service.TranslateSRTWithCache(originalSRTPath, geminiKey, srtModelAPIName, sourceLanguage, targetLanguage, glossary, memory)
 		}
 		if err != nil {
 			creditService.UnlockCredits(userID, totalCost, "create-subtitle", "Unlock credits due to translation error", nil)
@@ -1168,6 +1342,12 @@ func CreateSubtitleHandler(c *gin.Context) {
 			return
 		}
 
+		if originalSRTContent, err := os.ReadFile(originalSRTPath); err == nil {
+			glossaryViolations = service.CheckGlossaryCompliance(string(originalSRTContent), translatedSRTContent, glossary)
+			translationQA = service.RunTranslationQAOnSRT(string(originalSRTContent), translatedSRTContent, targetLanguage)
+		}
+		translationMemory = memory.Stats(serviceName)
+
 		// Parse segments đã dịch
 		translatedSegments, _, err := util.ParseSRTFile(translatedSRTPath)
 		if err != nil {
@@ -1181,6 +1361,7 @@ func CreateSubtitleHandler(c *gin.Context) {
 		translatedSegmentsJSON, _ := json.Marshal(translatedSegments)
 		captionHistory.SegmentsVi = datatypes.JSON(translatedSegmentsJSON)
 		captionHistory.SrtFile = translatedSRTPath // SRT đã dịch
+		captionHistory.TranslationQA = service.MarshalTranslationQA(translationQA)
 		// OriginalSrtFile đã được set là originalSRTPath ở trên
 	}
 
@@ -1204,6 +1385,7 @@ func CreateSubtitleHandler(c *gin.Context) {
 		})
 		return
 	}
+	allowance.keep()
 
 	// Trừ credit cho Gemini (nếu song ngữ)
 	if isBilingual {
@@ -1244,17 +1426,22 @@ func CreateSubtitleHandler(c *gin.Context) {
 
 	// Trả về kết quả
 	response := gin.H{
-		"message":      "Tạo phụ đề thành công",
-		"original_srt": originalSRTPath,
-		"transcript":   transcript,
-		"segments":     segments,
-		"id":           captionHistory.ID,
-		"process_id":   processID,
+		"message":             "Tạo phụ đề thành công",
+		"original_srt":        originalSRTPath,
+		"transcript":          transcript,
+		"segments":            segments,
+		"id":                  captionHistory.ID,
+		"process_id":          processID,
+		"source_language":     sourceLanguage,
+		"translation_skipped": translationSkipped,
 	}
 
 	if isBilingual {
 		response["translated_srt"] = translatedSRTPath
 		response["target_language"] = targetLanguage
+		response["glossary_violations"] = glossaryViolations
+		response["translation_memory"] = translationMemory
+		response["translation_qa"] = translationQA
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -1310,6 +1497,13 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 		subtitleBgColor = "#808080" // Default to gray
 	}
 
+	// Output profile cho video đầu ra (tiktok, youtube, square, source)
+	outputProfile := service.GetOutputProfile(c.PostForm("output_profile"))
+	// Chế độ reframe video ngang sang dọc (blur, center, smart), rỗng = giữ nguyên; bỏ qua với profile ngang/vuông
+	reframeMode := service.ReframeModeForProfile(c.PostForm("reframe_mode"), outputProfile)
+	// Chế độ giọng nói: replace (mặc định), voice-over, subtitle-only
+	voiceMode := service.NormalizeVoiceMode(c.PostForm("voice_mode"))
+
 	// Get the uploaded file
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -1413,8 +1607,21 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 		return
 	}
 
+	// Không lock credit cho TTS khi chế độ không dùng giọng đọc
+	estimatedCostWithMarkup = service.ApplyVoiceModeToEstimate(estimatedCostWithMarkup, voiceMode)
 	estimatedCost := estimatedCostWithMarkup["total"]
 
+	// Giữ hạn mức tháng của gói trước khi lock credit
+	allowance, reserved := reserveMonthlyAllowance(c, userID, durationMinutes)
+	if !reserved {
+		if processID > 0 {
+			processService.UpdateProcessStatus(processID, "failed")
+		}
+		util.CleanupDir(videoDir)
+		return
+	}
+	defer allowance.releaseUnlessKept()
+
 	// Lock credit trước khi xử lý
 	_, err = creditService.LockCredits(userID, estimatedCost, "process-video", "Lock credit for parallel video processing", nil)
 	if err != nil {
@@ -1422,6 +1629,9 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 			processService.UpdateProcessStatus(processID, "failed")
 		}
 		util.CleanupDir(videoDir)
+		if respondSpendingCapReached(c, err) {
+			return
+		}
 		c.JSON(http.StatusPaymentRequired, gin.H{
 			"error":   "Không đủ credit để xử lý video",
 			"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
@@ -1446,6 +1656,19 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 	parallelProcessor.BackgroundVolume = backgroundVolume
 	parallelProcessor.TTSVolume = ttsVolume
 	parallelProcessor.SpeakingRate = speakingRate
+	parallelProcessor.OutputProfile = outputProfile
+	parallelProcessor.ReframeMode = reframeMode
+	parallelProcessor.VoiceMode = voiceMode
+	parallelProcessor.OriginalVolume = parseOriginalVolume(c)
+	parallelProcessor.Glossary = service.LoadGlossaryTermsForRequest(userID, service.ParseGlossaryIDs(c.PostForm("glossary_ids")), targetLanguage)
+	// Ngôn ngữ nguồn của memory được gắn sau khi Whisper nhận diện (processTranslation)
+	parallelProcessor.MemoryUserID = userID
+	parallelProcessor.Diarize = c.PostForm("diarize") == "true"
+	if speakerVoices, err := parseStringMapForm(c, "speaker_voices"); err == nil {
+		parallelProcessor.SpeakerVoices = speakerVoices
+	} else {
+		log.Printf("Invalid speaker_voices, using default voices: %v", err)
+	}
 
 	// Xử lý song song
 	result, err := parallelProcessor.ProcessParallel()
@@ -1480,8 +1703,15 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 		TTSFile:             result.TTSPath,
 		MergedVideoFile:     result.FinalVideoPath,
 		BackgroundMusic:     result.BackgroundPath,
+		RenderSettings:      service.MarshalRenderSettings(parallelProcessor.RenderSettings()),
+		TranslationQA:       service.MarshalTranslationQA(result.TranslationQA),
+		SourceLanguage:      result.SourceLanguage,
 		CreatedAt:           time.Now(),
 	}
+	if len(result.Speakers) > 0 {
+		speakersJSON, _ := json.Marshal(result.Speakers)
+		captionHistory.Speakers = speakersJSON
+	}
 
 	if err := config.Db.Create(&captionHistory).Error; err != nil {
 		creditService.UnlockCredits(userID, estimatedCost, "process-video", "Unlock due to database error", nil)
@@ -1514,6 +1744,7 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Không đủ credit cho Whisper"})
 		return
 	}
+	allowance.keep()
 
 	// 2) Translation (Gemini/GPT) per_token
 	serviceName, _, err := pricingService.GetActiveServiceForType("srt_translation")
@@ -1526,54 +1757,62 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy thông tin dịch vụ dịch SRT"})
 		return
 	}
-	// Tính chi phí dịch theo input/output riêng
-	var inputText, outputText string
-	if result.OriginalSRTPath != "" {
-		if b, e := os.ReadFile(result.OriginalSRTPath); e == nil {
-			inputText = string(b)
+	var translationBase float64
+	if result.TranslationSkipped {
+		log.Printf("Source language %s equals target language, no translation charge", result.SourceLanguage)
+	} else {
+		// Tính chi phí dịch theo input/output riêng
+		var inputText, outputText string
+		if result.OriginalSRTPath != "" {
+			if b, e := os.ReadFile(result.OriginalSRTPath); e == nil {
+				inputText = string(b)
+			}
 		}
-	}
-	if result.TranslatedSRTPath != "" {
-		if b, e := os.ReadFile(result.TranslatedSRTPath); e == nil {
-			outputText = string(b)
+		if result.TranslatedSRTPath != "" {
+			if b, e := os.ReadFile(result.TranslatedSRTPath); e == nil {
+				outputText = string(b)
+			}
 		}
-	}
-	if inputText == "" {
-		inputText = result.Transcript
-	}
-	if outputText == "" {
-		outputText = result.Transcript
-	}
-	inCost, outCost, inTok, outTok, _, err := pricingService.CalculateLLMCostSplit(inputText, outputText, serviceName)
-	if err != nil {
-		creditService.UnlockCredits(userID, estimatedCost-whisperBase, "process-video", "Unlock remaining credits due to translation cost error", nil)
-		if processID > 0 {
-			processService.UpdateProcessStatus(processID, "failed")
+		if inputText == "" {
+			inputText = result.Transcript
 		}
-		util.CleanupDir(videoDir)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tính toán chi phí dịch SRT"})
-		return
-	}
-	translationBase := inCost + outCost
-	translationTokens := inTok + outTok
-	var translationDesc string
-	if strings.Contains(serviceName, "gpt") {
-		translationDesc = "GPT dịch SRT"
-	} else {
-		translationDesc = "Gemini dịch SRT"
-	}
-	if err := creditService.DeductCredits(userID, translationBase, serviceName, translationDesc, &captionHistory.ID, "per_token", float64(translationTokens)); err != nil {
-		creditService.UnlockCredits(userID, estimatedCost-whisperBase-translationBase, "process-video", "Unlock remaining credits due to translation deduction error", nil)
-		if processID > 0 {
-			processService.UpdateProcessStatus(processID, "failed")
+		if outputText == "" {
+			outputText = result.Transcript
+		}
+		inCost, outCost, inTok, outTok, _, err := pricingService.CalculateLLMCostSplit(inputText, outputText, serviceName)
+		if err != nil {
+			creditService.UnlockCredits(userID, estimatedCost-whisperBase, "process-video", "Unlock remaining credits due to translation cost error", nil)
+			if processID > 0 {
+				processService.UpdateProcessStatus(processID, "failed")
+			}
+			util.CleanupDir(videoDir)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tính toán chi phí dịch SRT"})
+			return
+		}
+		translationBase = inCost + outCost
+		translationTokens := inTok + outTok
+		var translationDesc string
+		if strings.Contains(serviceName, "gpt") {
+			translationDesc = "GPT dịch SRT"
+		} else {
+			translationDesc = "Gemini dịch SRT"
+		}
+		if err := creditService.DeductCredits(userID, translationBase, serviceName, translationDesc, &captionHistory.ID, "per_token", float64(translationTokens)); err != nil {
+			creditService.UnlockCredits(userID, estimatedCost-whisperBase-translationBase, "process-video", "Unlock remaining credits due to translation deduction error", nil)
+			if processID > 0 {
+				processService.UpdateProcessStatus(processID, "failed")
+			}
+			util.CleanupDir(videoDir)
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "Không đủ credit cho dịch SRT"})
+			return
 		}
-		util.CleanupDir(videoDir)
-		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Không đủ credit cho dịch SRT"})
-		return
 	}
 
-	// 3) TTS per_character
-	ttsBase, err := pricingService.CalculateTTSCost(result.Transcript, true)
+	// 3) TTS per_character - chỉ tính các segment không có trong cache TTS
+	var ttsBase float64
+	if result.TTSBilling.MissSegments > 0 {
+		ttsBase, err = pricingService.CalculateTTSCost(result.TTSBilling.BilledText, true)
+	}
 	if err != nil {
 		creditService.UnlockCredits(userID, estimatedCost-whisperBase-translationBase, "process-video", "Unlock remaining credits due to TTS cost error", nil)
 		if processID > 0 {
@@ -1583,7 +1822,9 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tính toán chi phí TTS"})
 		return
 	}
-	if err := creditService.DeductCredits(userID, ttsBase, "tts", "Google TTS", &captionHistory.ID, "per_character", float64(len([]rune(result.Transcript)))); err != nil {
+	if result.TTSBilling.MissSegments == 0 {
+		log.Printf("All TTS segments served from cache, skipping TTS charge")
+	} else if err := creditService.DeductCredits(userID, ttsBase, "tts", "Google TTS", &captionHistory.ID, "per_character", float64(result.TTSBilling.BilledCharacters)); err != nil {
 		creditService.UnlockCredits(userID, estimatedCost-whisperBase-translationBase-ttsBase, "process-video", "Unlock remaining credits due to TTS deduction error", nil)
 		if processID > 0 {
 			processService.UpdateProcessStatus(processID, "failed")
@@ -1630,9 +1871,40 @@ func ProcessVideoParallelHandler(c *gin.Context) {
 		"process_id":              processID,
 		"processing_time":         result.ProcessingTime.String(),
 		"performance_improvement": "Parallel processing completed",
+		"glossary_violations":     result.GlossaryViolations,
+		"translation_memory":      result.TranslationMemory,
+		"translation_qa":          result.TranslationQA,
+		"tts_overflow":            result.TTSOverflow,
+		"speakers":                result.Speakers,
+		"source_language":         result.SourceLanguage,
+		"translation_skipped":     result.TranslationSkipped,
+		"voice_mode":              voiceMode,
 	})
 }
 
+// parseOriginalVolume đọc âm lượng audio gốc của chế độ voice-over (original_volume), mặc định DefaultVoiceOverOriginalVolume
+func parseOriginalVolume(c *gin.Context) float64 {
+	if v := c.PostForm("original_volume"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return service.DefaultVoiceOverOriginalVolume
+}
+
+// parseStringMapForm đọc field form-data dạng JSON object {"key": "value"}, rỗng thì trả về nil
+func parseStringMapForm(c *gin.Context, field string) (map[string]string, error) {
+	value := c.PostForm(field)
+	if value == "" {
+		return nil, nil
+	}
+	var result map[string]string
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // GetProcessingProgressHandler lấy tiến độ xử lý
 func GetProcessingProgressHandler(c *gin.Context) {
 	processIDStr := c.Param("process_id")
@@ -1692,6 +1964,44 @@ func ProcessVideoAsyncHandler(c *gin.Context) {
 		targetLanguage = "vi"
 	}
 
+	// Nhiều ngôn ngữ đích cho một upload: Whisper/Demucs chạy một lần, dịch/TTS/burn theo từng ngôn ngữ
+	rejectRequest := func(message string) {
+		if processID > 0 {
+			service.NewProcessStatusService().UpdateProcessStatus(processID, "failed")
+		}
+		util.CleanupDir(c.GetString("temp_dir"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	}
+	targetLanguages, err := service.ParseTargetLanguages(append(c.PostFormArray("target_languages[]"), c.PostFormArray("target_languages")...))
+	if err != nil {
+		rejectRequest(fmt.Sprintf("Ngôn ngữ đích không hợp lệ: %v", err))
+		return
+	}
+	if len(targetLanguages) == 1 {
+		targetLanguage = targetLanguages[0]
+		targetLanguages = nil
+	}
+	if len(targetLanguages) > 1 {
+		targetLanguage = targetLanguages[0]
+		if customSrt, _ := c.FormFile("custom_srt"); customSrt != nil {
+			rejectRequest("Không thể dùng custom_srt khi chọn nhiều ngôn ngữ đích")
+			return
+		}
+	}
+	// Giọng đọc riêng theo ngôn ngữ, dạng JSON {"vi": "vi-VN-Wavenet-C", "en": "en-US-Wavenet-F"}
+	voiceNames, err := parseStringMapForm(c, "voice_names")
+	if err != nil {
+		rejectRequest("voice_names không hợp lệ")
+		return
+	}
+	// Diarization: mỗi người nói một giọng, speaker_voices dạng JSON {"SPEAKER_00": "vi-VN-Wavenet-D"}
+	diarize := c.PostForm("diarize") == "true"
+	speakerVoices, err := parseStringMapForm(c, "speaker_voices")
+	if err != nil {
+		rejectRequest("speaker_voices không hợp lệ")
+		return
+	}
+
 	serviceName := c.PostForm("service_name")
 	if serviceName == "" {
 		serviceName = "gpt-4o-mini"
@@ -1707,6 +2017,13 @@ func ProcessVideoAsyncHandler(c *gin.Context) {
 		subtitleBgColor = "#808080" // Default to gray
 	}
 
+	// Output profile cho video đầu ra (tiktok, youtube, square, source)
+	outputProfile := service.GetOutputProfile(c.PostForm("output_profile"))
+	// Chế độ reframe video ngang sang dọc (blur, center, smart), rỗng = giữ nguyên; bỏ qua với profile ngang/vuông
+	reframeMode := service.ReframeModeForProfile(c.PostForm("reframe_mode"), outputProfile)
+	// Chế độ giọng nói: replace (mặc định), voice-over, subtitle-only
+	voiceMode := service.NormalizeVoiceMode(c.PostForm("voice_mode"))
+
 	// Get volume and rate parameters
 	backgroundVolume := 1.2
 	if v := c.PostForm("background_volume"); v != "" {
@@ -1761,6 +2078,29 @@ func ProcessVideoAsyncHandler(c *gin.Context) {
 	// Ước tính chi phí (sử dụng ước tính đơn giản)
 	estimatedCost := 0.1 // Ước tính cơ bản, sẽ được tính chính xác khi xử lý
 
+	// Nhiều ngôn ngữ: lock theo ước tính gộp (Whisper một lần + dịch/TTS mỗi ngôn ngữ)
+	var costEstimate map[string]float64
+	if len(targetLanguages) > 1 {
+		duration, _ := util.GetAudioDuration(audioPath)
+		costEstimate, err = service.EstimateMultiLanguageCost(duration, len(targetLanguages), userID)
+		if err != nil {
+			log.Printf("Failed to estimate multi-language cost: %v", err)
+		} else if costEstimate = service.ApplyVoiceModeToEstimate(costEstimate, voiceMode); costEstimate["total"] > estimatedCost {
+			estimatedCost = costEstimate["total"]
+		}
+	}
+
+	// Giữ hạn mức tháng của gói, giao cho worker khi enqueue thành công (worker trả lại nếu job lỗi)
+	allowance, reserved := reserveMonthlyAllowance(c, userID, c.GetFloat64("file_duration")/60.0)
+	if !reserved {
+		if processID > 0 {
+			service.NewProcessStatusService().UpdateProcessStatus(processID, "failed")
+		}
+		util.CleanupDir(videoDir)
+		return
+	}
+	defer allowance.releaseUnlessKept()
+
 	// Lock credits
 	_, err = creditService.LockCredits(userID, estimatedCost, "process-video", "Lock credit for process video", nil)
 	if err != nil {
@@ -1770,6 +2110,9 @@ func ProcessVideoAsyncHandler(c *gin.Context) {
 			processService.UpdateProcessStatus(processID, "failed")
 		}
 		util.CleanupDir(videoDir)
+		if respondSpendingCapReached(c, err) {
+			return
+		}
 		c.JSON(http.StatusPaymentRequired, gin.H{
 			"error":   "Không đủ credit cho xử lý video",
 			"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
@@ -1813,7 +2156,21 @@ func ProcessVideoAsyncHandler(c *gin.Context) {
 		TTSVolume:        ttsVolume,
 		SpeakingRate:     speakingRate,
 		VoiceName:        voiceName,
-	}
+		OutputProfile:    outputProfile.Name,
+		ReframeMode:      reframeMode,
+		VoiceMode:        voiceMode,
+		OriginalVolume:   parseOriginalVolume(c),
+		GlossaryIDs:      service.ParseGlossaryIDs(c.PostForm("glossary_ids")),
+		TargetLanguages:  targetLanguages,
+		VoiceNames:       voiceNames,
+		Diarize:          diarize,
+		SpeakerVoices:    speakerVoices,
+	}
+	if len(targetLanguages) > 1 {
+		job.LockedCredits = estimatedCost
+	}
+	job.AllowanceReserved = true
+	job.AllowanceMinutes = allowance.minutes
 
 	queueService := service.GetQueueService()
 	if queueService == nil {
@@ -1839,10 +2196,16 @@ func ProcessVideoAsyncHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue job"})
 		return
 	}
+	allowance.keep()
 
 	// Trả về process_id để frontend tracking
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message":    "Đã nhận video, đang xử lý...",
 		"process_id": jobID,
-	})
+	}
+	if len(targetLanguages) > 1 {
+		response["target_languages"] = targetLanguages
+		response["estimated_cost"] = costEstimate
+	}
+	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PromotionHandler struct {
+	promotionService *service.PromotionService
+}
+
+func NewPromotionHandler(promotionService *service.PromotionService) *PromotionHandler {
+	return &PromotionHandler{
+		promotionService: promotionService,
+	}
+}
+
+// GetCreditPackages lấy danh sách gói nạp đang bán
+func (h *PromotionHandler) GetCreditPackages(c *gin.Context) {
+	packages, err := h.promotionService.GetActivePackages()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách gói nạp"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": packages,
+	})
+}
+
+// ValidatePromoCode kiểm tra mã khuyến mãi và trả về credit thưởng dự kiến cho lần nạp
+func (h *PromotionHandler) ValidatePromoCode(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		Code      string  `json:"code" binding:"required"`
+		AmountUSD float64 `json:"amount_usd"`
+		PackageID *uint   `json:"package_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	var pkg *model.CreditPackage
+	amountUSD := req.AmountUSD
+	if req.PackageID != nil {
+		found, err := h.promotionService.GetActivePackage(*req.PackageID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Gói nạp không tồn tại"})
+			return
+		}
+		pkg = found
+		amountUSD = pkg.Credits
+	}
+
+	code, err := h.promotionService.ValidatePromoCode(userID, req.Code, amountUSD)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "valid": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":       true,
+		"code":        code.Code,
+		"description": code.Description,
+		"bonuses":     h.promotionService.EstimateBonuses(userID, amountUSD, pkg, code, 0),
+	})
+}
+
+// AdminGetCreditPackages (Admin only) lấy tất cả gói nạp, kể cả gói đã tắt
+func (h *PromotionHandler) AdminGetCreditPackages(c *gin.Context) {
+	packages, err := h.promotionService.GetAllPackages()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách gói nạp"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": packages,
+	})
+}
+
+// AdminCreateCreditPackage (Admin only) tạo gói nạp mới
+func (h *PromotionHandler) AdminCreateCreditPackage(c *gin.Context) {
+	var req model.CreditPackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	pkg, err := h.promotionService.CreatePackage(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Tạo gói nạp thành công",
+		"data":    pkg,
+	})
+}
+
+// AdminUpdateCreditPackage (Admin only) cập nhật gói nạp
+func (h *PromotionHandler) AdminUpdateCreditPackage(c *gin.Context) {
+	packageID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req model.CreditPackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	pkg, err := h.promotionService.UpdatePackage(packageID, req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gói nạp không tồn tại"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cập nhật gói nạp thành công",
+		"data":    pkg,
+	})
+}
+
+// AdminDeleteCreditPackage (Admin only) xoá gói nạp
+func (h *PromotionHandler) AdminDeleteCreditPackage(c *gin.Context) {
+	packageID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.promotionService.DeletePackage(packageID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gói nạp không tồn tại"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xoá gói nạp"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Xoá gói nạp thành công",
+	})
+}
+
+// AdminGetPromoCodes (Admin only) lấy danh sách mã khuyến mãi kèm số lượt đã dùng
+func (h *PromotionHandler) AdminGetPromoCodes(c *gin.Context) {
+	codes, err := h.promotionService.GetPromoCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách mã khuyến mãi"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": codes,
+	})
+}
+
+// AdminCreatePromoCode (Admin only) tạo mã khuyến mãi
+func (h *PromotionHandler) AdminCreatePromoCode(c *gin.Context) {
+	var req model.PromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	code, err := h.promotionService.CreatePromoCode(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Tạo mã khuyến mãi thành công",
+		"data":    code,
+	})
+}
+
+// AdminUpdatePromoCode (Admin only) cập nhật mã khuyến mãi
+func (h *PromotionHandler) AdminUpdatePromoCode(c *gin.Context) {
+	codeID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req model.PromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	code, err := h.promotionService.UpdatePromoCode(codeID, req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mã khuyến mãi không tồn tại"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cập nhật mã khuyến mãi thành công",
+		"data":    code,
+	})
+}
+
+// AdminDeletePromoCode (Admin only) xoá mã khuyến mãi
+func (h *PromotionHandler) AdminDeletePromoCode(c *gin.Context) {
+	codeID, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.promotionService.DeletePromoCode(codeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mã khuyến mãi không tồn tại"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xoá mã khuyến mãi"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Xoá mã khuyến mãi thành công",
+	})
+}
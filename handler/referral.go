@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReferralHandler struct {
+	referralService *service.ReferralService
+}
+
+func NewReferralHandler(referralService *service.ReferralService) *ReferralHandler {
+	return &ReferralHandler{
+		referralService: referralService,
+	}
+}
+
+// GetReferrals lấy mã giới thiệu của user, danh sách người được giới thiệu và credit thưởng đã nhận
+func (h *ReferralHandler) GetReferrals(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	summary, err := h.referralService.GetSummary(userID, c.ClientIP(), requestDeviceID(c, ""))
+	if err != nil {
+		log.Printf("Failed to get referrals of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy thông tin giới thiệu"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": summary,
+	})
+}
+
+// requestDeviceID lấy device id client gửi lên (body/query, hoặc header X-Device-ID)
+func requestDeviceID(c *gin.Context, deviceID string) string {
+	if deviceID == "" {
+		deviceID = c.GetHeader("X-Device-ID")
+	}
+	return service.NormalizeDeviceID(deviceID)
+}
+
+// attachReferral gắn user mới đăng ký với mã giới thiệu. Mã sai không chặn việc đăng ký, chỉ được log
+func attachReferral(user config.Users, code, signupIP, deviceID string) {
+	if code == "" {
+		return
+	}
+	referral, err := service.NewReferralService(config.Db).AttachReferral(user.ID, code, signupIP, deviceID)
+	if errors.Is(err, service.ErrInvalidReferralCode) {
+		log.Printf("User %d signed up with unknown referral code %q", user.ID, code)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to attach referral code %q to user %d: %v", code, user.ID, err)
+		return
+	}
+	log.Printf("User %d signed up via referral code %s (%s)", user.ID, referral.Code, referral.Status)
+}
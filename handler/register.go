@@ -38,14 +38,17 @@ func RegisterHandler(c *gin.Context) {
 	if err == nil && user.ID != 0 {
 		creditService := service.NewCreditService()
 		_ = creditService.AddCredits(user.ID, 2, "Tặng credit đăng ký mới", "register_bonus")
+		attachReferral(user, req.ReferralCode, c.ClientIP(), requestDeviceID(c, req.DeviceID))
 	}
 
 	c.JSON(200, gin.H{"message": "register success"})
 }
 
 type SaveRegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code"` // Mã giới thiệu (tuỳ chọn)
+	DeviceID     string `json:"device_id"`     // Định danh thiết bị do client tạo, dùng chống gian lận giới thiệu
 }
 
 func CreateUser(c *gin.Context, request SaveRegisterRequest) bool {
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+	"creator-tool-backend/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubscriptionHandler struct {
+	subscriptionService *service.SubscriptionService
+}
+
+func NewSubscriptionHandler(subscriptionService *service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+	}
+}
+
+// GetPlans lấy danh sách gói có thể mua theo tháng
+func (h *SubscriptionHandler) GetPlans(c *gin.Context) {
+	plans, err := h.subscriptionService.GetPlans()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách gói"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": plans,
+	})
+}
+
+// GetSubscription lấy gói hiện tại, hạn mức đã dùng trong chu kỳ và ngày gia hạn
+func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
+	status, err := h.subscriptionService.GetStatus(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy thông tin gói"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": status,
+	})
+}
+
+// Subscribe mua gói bằng credit (kích hoạt ngay) hoặc tạo đơn thanh toán QR (kích hoạt khi thanh toán xong)
+func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req model.CreateSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	subscription, order, err := h.subscriptionService.Subscribe(userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSubscriptionRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrSubscriptionPayment):
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"error":   "Không đủ credit để mua gói",
+				"warning": "Số dư tài khoản của bạn không đủ để mua gói này. Vui lòng nạp thêm credit hoặc thanh toán bằng chuyển khoản!",
+			})
+		case errors.Is(err, service.ErrNoBankAccountAvailable):
+			log.Printf("No bank account available for subscription of user %d: %v", userID, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Tạm thời chưa nhận thanh toán chuyển khoản", "warning": "Các tài khoản nhận tiền đã đạt hạn mức. Vui lòng thử lại sau hoặc liên hệ hỗ trợ!"})
+		default:
+			log.Printf("Failed to subscribe user %d to tier %d: %v", userID, req.TierID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể mua gói", "warning": "Không thể mua gói. Vui lòng thử lại hoặc liên hệ hỗ trợ!"})
+		}
+		return
+	}
+
+	if order != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"message":      "Đơn thanh toán gói đã được tạo, gói sẽ được kích hoạt sau khi thanh toán",
+			"subscription": subscription,
+			"order": gin.H{
+				"id":           order.ID,
+				"order_code":   order.OrderCode,
+				"amount_vnd":   order.AmountVND.String(),
+				"amount_usd":   order.AmountUSD.String(),
+				"qr_code_url":  order.QRCodeURL,
+				"expires_at":   order.ExpiresAt,
+				"bank_account": order.BankAccount,
+				"bank_name":    order.BankName,
+				"order_status": order.OrderStatus,
+				"created_at":   order.CreatedAt,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Gói đã được kích hoạt",
+		"subscription": subscription,
+	})
+}
+
+// UpdateAutoRenew bật/tắt tự gia hạn gói
+func (h *SubscriptionHandler) UpdateAutoRenew(c *gin.Context) {
+	var req struct {
+		AutoRenew *bool `json:"auto_renew" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	h.setAutoRenew(c, *req.AutoRenew)
+}
+
+// CancelSubscription huỷ tự gia hạn, gói vẫn dùng được đến hết hạn rồi về tier free
+func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
+	h.setAutoRenew(c, false)
+}
+
+func (h *SubscriptionHandler) setAutoRenew(c *gin.Context, autoRenew bool) {
+	err := h.subscriptionService.SetAutoRenew(c.GetUint("user_id"), autoRenew)
+	if errors.Is(err, service.ErrNoActiveSubscription) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bạn chưa có gói nào đang hoạt động"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật gói"})
+		return
+	}
+
+	message := "Đã tắt tự gia hạn, gói vẫn dùng được đến hết hạn"
+	if autoRenew {
+		message = "Đã bật tự gia hạn gói"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    message,
+		"auto_renew": autoRenew,
+	})
+}
+
+// monthlyAllowance là phần hạn mức tháng của gói đã giữ cho một video, được trả lại nếu request lỗi trước khi keep
+type monthlyAllowance struct {
+	userID  uint
+	minutes float64
+	kept    bool
+}
+
+// reserveMonthlyAllowance giữ hạn mức tháng của gói trước khi lock credit, trả về false (đã ghi response 402) nếu vượt hạn mức
+func reserveMonthlyAllowance(c *gin.Context, userID uint, minutes float64) (*monthlyAllowance, bool) {
+	err := service.NewSubscriptionService(config.Db).ReserveAllowance(userID, minutes)
+	if err == nil {
+		return &monthlyAllowance{userID: userID, minutes: minutes}, true
+	}
+
+	log.Printf("User %d blocked by monthly allowance: %v", userID, err)
+	c.JSON(http.StatusPaymentRequired, gin.H{
+		"error":   "Đã hết hạn mức tháng của gói",
+		"warning": fmt.Sprintf("Gói hiện tại của bạn không đủ hạn mức tháng cho video này (%.1f phút). Vui lòng nâng cấp gói hoặc chờ chu kỳ mới!", minutes),
+	})
+	return nil, false
+}
+
+// keep giữ lại hạn mức khi video đã được xử lý và tính phí (hoặc đã giao cho worker)
+func (a *monthlyAllowance) keep() {
+	a.kept = true
+}
+
+// releaseUnlessKept trả lại hạn mức nếu request dừng trước khi keep, dùng với defer
+func (a *monthlyAllowance) releaseUnlessKept() {
+	if a.kept {
+		return
+	}
+	if err := service.NewSubscriptionService(config.Db).ReleaseAllowance(a.userID, a.minutes); err != nil {
+		log.Printf("Failed to release subscription allowance for user %d: %v", a.userID, err)
+	}
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"creator-tool-backend/config"
+	"creator-tool-backend/service"
+	"creator-tool-backend/util"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadEditableHistory lấy history của user hiện tại có file phụ đề để chỉnh sửa
+func loadEditableHistory(c *gin.Context) (*config.CaptionHistory, bool) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	var history config.CaptionHistory
+	if err := config.Db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", c.Param("id"), userID).First(&history).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "History not found"})
+		return nil, false
+	}
+	if history.SrtFile == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kết quả này không có phụ đề để chỉnh sửa"})
+		return nil, false
+	}
+	return &history, true
+}
+
+// GetHistoryCuesHandler trả về danh sách cue của history (bản nháp nếu có chỉnh sửa chưa render)
+func GetHistoryCuesHandler(c *gin.Context) {
+	history, ok := loadEditableHistory(c)
+	if !ok {
+		return
+	}
+
+	cues, dirty, err := service.LoadCues(history)
+	if err != nil {
+		util.HandleError(c, http.StatusInternalServerError, util.ErrProcessingFailed, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                     history.ID,
+		"cues":                   cues,
+		"has_unrendered_changes": dirty,
+		"render_settings":        service.LoadRenderSettings(history),
+	})
+}
+
+// PutHistoryCuesHandler thay toàn bộ danh sách cue (lưu bản nháp, chưa render lại)
+func PutHistoryCuesHandler(c *gin.Context) {
+	history, ok := loadEditableHistory(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Cues []service.Segment `json:"cues"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu cue không hợp lệ"})
+		return
+	}
+
+	cues, err := service.SaveCueDraft(history, req.Cues)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                     history.ID,
+		"cues":                   cues,
+		"has_unrendered_changes": true,
+	})
+}
+
+// PatchHistoryCuesHandler áp dụng một hoặc nhiều thao tác edit/split/merge/shift lên cue
+func PatchHistoryCuesHandler(c *gin.Context) {
+	history, ok := loadEditableHistory(c)
+	if !ok {
+		return
+	}
+
+	// Chấp nhận một thao tác hoặc {"operations": [...]}
+	var body json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu thao tác không hợp lệ"})
+		return
+	}
+	var batch struct {
+		Operations []service.CueOperation `json:"operations"`
+	}
+	var operations []service.CueOperation
+	if err := json.Unmarshal(body, &batch); err == nil && len(batch.Operations) > 0 {
+		operations = batch.Operations
+	} else {
+		var op service.CueOperation
+		if err := json.Unmarshal(body, &op); err != nil || op.Op == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu thao tác (op)"})
+			return
+		}
+		operations = []service.CueOperation{op}
+	}
+
+	cues, _, err := service.LoadCues(history)
+	if err != nil {
+		util.HandleError(c, http.StatusInternalServerError, util.ErrProcessingFailed, err)
+		return
+	}
+	for _, op := range operations {
+		cues, err = service.ApplyCueOperation(cues, op)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "op": op.Op})
+			return
+		}
+	}
+
+	cues, err = service.SaveCueDraft(history, cues)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                     history.ID,
+		"cues":                   cues,
+		"has_unrendered_changes": true,
+	})
+}
+
+// RerenderHistoryHandler render lại video từ cue đã sửa, chỉ TTS lại và tính phí các cue chưa có trong cache segment
+func RerenderHistoryHandler(c *gin.Context) {
+	history, ok := loadEditableHistory(c)
+	if !ok {
+		return
+	}
+	userID := history.UserID
+
+	cues, dirty, err := service.LoadCues(history)
+	if err != nil {
+		util.HandleError(c, http.StatusInternalServerError, util.ErrProcessingFailed, err)
+		return
+	}
+	if !dirty {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không có thay đổi nào cần render lại"})
+		return
+	}
+	renderedCues, err := service.LoadRenderedCues(history)
+	if err != nil {
+		util.HandleError(c, http.StatusInternalServerError, util.ErrProcessingFailed, err)
+		return
+	}
+
+	settings := service.LoadRenderSettings(history)
+	// Chỉ cue chưa có trong cache segment (text hoặc giọng mới) phải gọi TTS và bị tính phí
+	var delta service.TTSBillingSplit
+	if service.VoiceModeUsesTTS(settings.VoiceMode) {
+		delta = service.EstimateRerenderTTS(history, cues, settings)
+	}
+
+	// Khoá credit cho phần TTS phải gọi lại trước khi render
+	creditService := service.NewCreditService()
+	pricingService := service.NewPricingService()
+	var ttsBase, ttsFinal float64
+	if delta.MissSegments > 0 {
+		ttsBase, err = pricingService.CalculateTTSCost(delta.BilledText, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tính toán chi phí TTS"})
+			return
+		}
+		ttsFinal, err = pricingService.CalculateUserPrice(ttsBase, "tts", userID)
+		if err != nil {
+			ttsFinal = ttsBase
+		}
+		if _, err := creditService.LockCredits(userID, ttsFinal, "tts", "Lock credit for subtitle re-render", &history.ID); err != nil {
+			if respondSpendingCapReached(c, err) {
+				return
+			}
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"error":   "Không đủ credit để render lại",
+				"warning": "Số dư tài khoản của bạn không đủ để sử dụng dịch vụ này. Vui lòng nạp thêm credit để tiếp tục sử dụng!",
+			})
+			return
+		}
+	}
+
+	result, err := service.RerenderHistory(history, cues, settings)
+	if err != nil {
+		if ttsFinal > 0 {
+			creditService.UnlockCredits(userID, ttsFinal, "tts", "Unlock due to re-render error", &history.ID)
+		}
+		util.HandleError(c, http.StatusInternalServerError, util.ErrProcessingFailed, err)
+		return
+	}
+
+	// Synthesize lại với SpeakingRate cao hơn để vừa cue cũng là request Google TTS, tính thêm vào phần phải trả
+	if result.TTSTiming != nil && result.TTSTiming.RetrySegments > 0 {
+		delta.AddRateRetries(result.TTSTiming)
+		if retryBase, err := pricingService.CalculateTTSCost(result.TTSTiming.RetryText, true); err != nil {
+			log.Printf("Failed to calculate re-render TTS retry cost for history %d: %v", history.ID, err)
+		} else {
+			ttsBase += retryBase
+			if ttsFinal, err = pricingService.CalculateUserPrice(ttsBase, "tts", userID); err != nil {
+				ttsFinal = ttsBase
+			}
+		}
+	}
+	if delta.MissSegments > 0 {
+		if err := creditService.DeductCredits(userID, ttsBase, "tts", "Google TTS (sửa phụ đề)", &history.ID, "per_character", float64(delta.BilledCharacters)); err != nil {
+			log.Printf("Failed to deduct re-render TTS credits for history %d: %v", history.ID, err)
+		}
+	}
+
+	// Câu user sửa tay được dùng lại cho các job sau
+	service.RecordCueEditsToMemory(history, renderedCues, cues, settings.TargetLanguage)
+
+	// Cập nhật history sang bản render mới
+	segmentsJSON, _ := json.Marshal(cues)
+	history.SrtFile = result.SRTPath
+	history.SegmentsVi = segmentsJSON
+	history.MergedVideoFile = result.FinalVideoPath
+	if result.TTSPath != "" {
+		history.TTSFile = result.TTSPath
+	}
+	config.Db.Save(history)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Đã render lại video với phụ đề mới",
+		"id":                 history.ID,
+		"srt_file":           result.SRTPath,
+		"tts_file":           history.TTSFile,
+		"merged_video":       result.FinalVideoPath,
+		"changed_segments":   delta.MissSegments,
+		"unchanged_segments": delta.HitSegments,
+		"billed_characters":  delta.BilledCharacters,
+		"tts_cost":           ttsFinal,
+		"tts_overflow":       result.TTSOverflow,
+	})
+}
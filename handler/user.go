@@ -2,6 +2,7 @@ package handler
 
 import (
 	"creator-tool-backend/config"
+	"creator-tool-backend/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,8 +24,16 @@ func GetUserProfileHandler(c *gin.Context) {
 	// Don't return sensitive information
 	user.PasswordHash = ""
 
+	// Thông tin xuất hoá đơn (công ty) đi kèm profile, sửa qua PUT /user/profile/billing
+	billing, err := service.NewInvoiceService(config.Db).GetBillingProfile(user.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to get billing profile"})
+		return
+	}
+
 	c.JSON(200, gin.H{
-		"user": user,
+		"user":    user,
+		"billing": billing,
 	})
 }
 
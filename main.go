@@ -98,25 +98,60 @@ func main() {
 				} else {
 					log.Println("Background cleanup completed successfully (old caption histories)")
 				}
+				if err := service.GetCacheService().CleanupExpired(); err != nil {
+					log.Printf("Error cleaning up expired cache entries: %v", err)
+				}
+			}
+		}
+	}()
+
+	// Gia hạn hoặc hết hạn gói subscription (hết hạn thì user về tier free)
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+
+		subscriptionService := service.NewSubscriptionService(config.Db)
+		for range ticker.C {
+			if err := subscriptionService.ProcessRenewals(); err != nil {
+				log.Printf("Failed to process subscription renewals: %v", err)
+			}
+		}
+	}()
+
+	// Đồng bộ tỷ giá USD/VND từ provider (chỉ chạy khi có EXCHANGE_RATE_PROVIDER_URL)
+	if interval := service.ExchangeRateSyncInterval(); interval > 0 {
+		go func() {
+			exchangeRateService := service.NewExchangeRateService(config.Db)
+			sync := func() {
+				if _, err := exchangeRateService.SyncFromProvider(); err != nil {
+					log.Printf("Failed to sync exchange rate: %v", err)
+				}
+			}
+
+			sync()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				sync()
+			}
+		}()
+	}
+
+	// Khởi động cron job nhắc, giao lại và hết hạn đơn hàng thanh toán
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+
+		paymentService := service.NewPaymentOrderService()
+		for range ticker.C {
+			if err := paymentService.CheckExpiredOrders(); err != nil {
+				log.Printf("Failed to check expired orders: %v", err)
 			}
 		}
 	}()
 
-	// Khởi động cron job kiểm tra đơn hàng hết hạn
-	//go func() {
-	//	ticker := time.NewTicker(1 * time.Minute)
-	//	defer ticker.Stop()
-	//
-	//	paymentService := service.NewPaymentOrderService()
-	//	for {
-	//		select {
-	//		case <-ticker.C:
-	//			if err := paymentService.CheckExpiredOrders(); err != nil {
-	//				log.Printf("Failed to check expired orders: %v", err)
-	//			}
-	//		}
-	//	}
-	//}()
+	// Đọc mail biến động số dư ngân hàng (chỉ chạy khi có EMAIL_IMAP_HOST), tự kết nối lại khi mất kết nối
+	service.StartEmailMonitor()
 
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
@@ -0,0 +1,83 @@
+-- Migration theo dõi tiền vào từng tài khoản nhận để áp hạn mức ngày/tháng khi chọn tài khoản cho đơn mới
+-- Chạy lệnh: mysql -u root -p tool < migration_add_bank_account_inflows.sql
+
+-- Mã BIN NAPAS dùng tạo VietQR (để trống thì suy ra từ bank_code)
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+     WHERE TABLE_SCHEMA = DATABASE()
+     AND TABLE_NAME = 'bank_accounts'
+     AND COLUMN_NAME = 'card_bin') > 0,
+    'SELECT "Column card_bin already exists" as message',
+    'ALTER TABLE bank_accounts ADD COLUMN card_bin varchar(20) DEFAULT NULL COMMENT ''Mã BIN NAPAS (VD: 970436 cho Vietcombank)'' AFTER bank_code'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+UPDATE `bank_accounts` SET `card_bin` = CASE UPPER(`bank_code`)
+    WHEN 'VCB' THEN '970436'
+    WHEN 'BIDV' THEN '970418'
+    WHEN 'ICB' THEN '970415'
+    WHEN 'CTG' THEN '970415'
+    WHEN 'VBA' THEN '970405'
+    WHEN 'TCB' THEN '970407'
+    WHEN 'ACB' THEN '970416'
+    WHEN 'MB' THEN '970422'
+    WHEN 'VPB' THEN '970432'
+    WHEN 'TPB' THEN '970423'
+    WHEN 'VIB' THEN '970441'
+    WHEN 'STB' THEN '970403'
+    WHEN 'SHB' THEN '970443'
+    WHEN 'HDB' THEN '970437'
+    WHEN 'OCB' THEN '970448'
+    WHEN 'MSB' THEN '970426'
+    WHEN 'EIB' THEN '970431'
+    WHEN 'SCB' THEN '970429'
+    WHEN 'LPB' THEN '970449'
+    WHEN 'SEAB' THEN '970440'
+    WHEN 'NAB' THEN '970428'
+    ELSE `card_bin`
+END
+WHERE `card_bin` IS NULL OR `card_bin` = '';
+
+-- Tổng tiền vào mỗi tài khoản nhận theo ngày
+CREATE TABLE IF NOT EXISTS `tool_bank_account_inflows` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `bank_account_id` bigint unsigned NOT NULL,
+  `date` date NOT NULL,
+  `account_number` varchar(50) DEFAULT NULL,
+  `received_vnd` decimal(14,0) NOT NULL DEFAULT 0,
+  `transaction_count` int NOT NULL DEFAULT 0,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_bank_account_inflow_day` (`bank_account_id`, `date`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu tiền vào theo ngày của tài khoản nhận';
+
+-- Tính lại từ các đơn đã thanh toán (số tiền thực nhận nếu có)
+INSERT INTO `tool_bank_account_inflows` (`bank_account_id`, `date`, `account_number`, `received_vnd`, `transaction_count`, `updated_at`)
+SELECT ba.id, DATE(po.paid_at), ba.account_number, SUM(COALESCE(po.amount_received_vnd, po.amount_vnd)), COUNT(*), NOW(3)
+FROM `payment_orders` po
+JOIN `bank_accounts` ba ON ba.account_number = po.bank_account
+WHERE po.order_status = 'paid' AND po.paid_at IS NOT NULL
+GROUP BY ba.id, DATE(po.paid_at), ba.account_number
+ON DUPLICATE KEY UPDATE
+  `received_vnd` = VALUES(`received_vnd`),
+  `transaction_count` = VALUES(`transaction_count`),
+  `updated_at` = VALUES(`updated_at`);
+
+-- Chọn tài khoản theo round_robin lấy thời điểm giao đơn gần nhất của mỗi tài khoản
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS
+     WHERE TABLE_SCHEMA = DATABASE()
+     AND TABLE_NAME = 'payment_orders'
+     AND INDEX_NAME = 'idx_payment_orders_bank_account_created') > 0,
+    'SELECT "Index idx_payment_orders_bank_account_created already exists" as message',
+    'CREATE INDEX idx_payment_orders_bank_account_created ON payment_orders (bank_account, created_at)'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SELECT "Migration completed successfully" as message;
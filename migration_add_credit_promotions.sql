@@ -0,0 +1,69 @@
+-- Migration cho gói nạp credit, mã khuyến mãi và thưởng nạp lần đầu
+-- Chạy lệnh: mysql -u root -p tool < migration_add_credit_promotions.sql
+
+-- Gói nạp và mã khuyến mãi của đơn thanh toán
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'payment_orders' 
+     AND COLUMN_NAME = 'package_id') > 0,
+    'SELECT "Column package_id already exists" as message',
+    'ALTER TABLE payment_orders ADD COLUMN package_id bigint unsigned NULL AFTER subscription_id, ADD COLUMN promo_code_id bigint unsigned NULL AFTER package_id'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Bảng gói nạp credit định sẵn
+CREATE TABLE IF NOT EXISTS `tool_credit_packages` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  `description` varchar(500) DEFAULT NULL,
+  `price_vnd` decimal(12,0) NOT NULL,
+  `credits` decimal(10,2) NOT NULL,
+  `bonus_percent` decimal(5,2) DEFAULT '0.00',
+  `sort_order` int DEFAULT 0,
+  `is_active` boolean DEFAULT true,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_is_active` (`is_active`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu gói nạp credit định sẵn';
+
+-- Bảng mã khuyến mãi
+CREATE TABLE IF NOT EXISTS `tool_promo_codes` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `code` varchar(50) NOT NULL,
+  `description` varchar(500) DEFAULT NULL,
+  `bonus_percent` decimal(5,2) DEFAULT '0.00',
+  `bonus_credits` decimal(10,2) DEFAULT '0.00',
+  `min_amount_usd` decimal(10,2) DEFAULT '0.00',
+  `starts_at` datetime(3) NULL DEFAULT NULL,
+  `expires_at` datetime(3) NULL DEFAULT NULL,
+  `max_uses` int DEFAULT 0,
+  `max_uses_per_user` int DEFAULT 1,
+  `used_count` int DEFAULT 0,
+  `is_active` boolean DEFAULT true,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_code` (`code`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu mã khuyến mãi nạp credit';
+
+-- Bảng lượt dùng mã khuyến mãi (mỗi đơn tối đa một lượt)
+CREATE TABLE IF NOT EXISTS `tool_promo_code_redemptions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `promo_code_id` bigint unsigned NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `order_id` bigint unsigned NOT NULL,
+  `bonus_credits` decimal(10,2) DEFAULT '0.00',
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_order_id` (`order_id`),
+  KEY `idx_promo_code_id` (`promo_code_id`),
+  KEY `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu lượt dùng mã khuyến mãi';
+
+-- Kiểm tra kết quả
+SELECT "Migration completed successfully" as message;
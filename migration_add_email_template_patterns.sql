@@ -0,0 +1,24 @@
+-- Migration cho template đọc mail biến động số dư do admin cấu hình (thay parser viết cứng theo ngân hàng)
+-- Chạy lệnh: mysql -u root -p tool < migration_add_email_template_patterns.sql
+
+-- Regex mã đơn, mã giao dịch, thứ tự ưu tiên và thời điểm cập nhật của template
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'email_templates' 
+     AND COLUMN_NAME = 'order_code_pattern') > 0,
+    'SELECT "Column order_code_pattern already exists" as message',
+    'ALTER TABLE email_templates ADD COLUMN order_code_pattern varchar(200) DEFAULT NULL AFTER content_pattern, ADD COLUMN transaction_pattern varchar(200) DEFAULT NULL AFTER order_code_pattern, ADD COLUMN priority int NOT NULL DEFAULT 0 AFTER transaction_pattern, ADD COLUMN updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER created_at'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Template ACB (mailalert@acb.com.vn), trước đây là parseACBEmail
+INSERT INTO `email_templates` (`bank_name`, `template_name`, `subject_pattern`, `sender_pattern`, `amount_pattern`, `account_pattern`, `content_pattern`, `order_code_pattern`, `transaction_pattern`, `priority`, `is_active`)
+SELECT 'ACB', 'balance_alert', NULL, 'acb\\.com\\.vn', 'Ghi có\\s*\\+([\\d,]+\\.?\\d*)\\s*VND', '[Tt]ài khoản\\s*(\\d+)\\s*của', NULL, 'PAY\\d{14,20}', 'FT\\d+', 10, true
+FROM DUAL
+WHERE NOT EXISTS (SELECT 1 FROM `email_templates` WHERE `bank_name` = 'ACB' AND `template_name` = 'balance_alert');
+
+SELECT "Migration completed successfully" as message;
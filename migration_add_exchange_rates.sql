@@ -0,0 +1,38 @@
+-- Migration cho tỷ giá USD/VND có hiệu lực theo thời gian
+-- Chạy lệnh: mysql -u root -p tool < migration_add_exchange_rates.sql
+
+-- Bảng lịch sử tỷ giá
+CREATE TABLE IF NOT EXISTS `tool_exchange_rates` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `base_currency` varchar(3) NOT NULL DEFAULT 'USD',
+  `quote_currency` varchar(3) NOT NULL DEFAULT 'VND',
+  `rate` decimal(10,4) NOT NULL,
+  `effective_from` datetime(3) NOT NULL,
+  `source` varchar(20) NOT NULL,
+  `note` varchar(255) DEFAULT NULL,
+  `created_by` bigint unsigned DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_tool_exchange_rates_effective_from` (`effective_from`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu lịch sử tỷ giá USD/VND';
+
+-- Tỷ giá khởi tạo bằng tỷ giá cố định trước đây để lịch sử liền mạch
+INSERT INTO `tool_exchange_rates` (`rate`, `effective_from`, `source`, `note`)
+SELECT 25000, '2000-01-01 00:00:00', 'manual', 'Tỷ giá cố định trước khi có bảng tỷ giá'
+WHERE NOT EXISTS (SELECT 1 FROM `tool_exchange_rates`);
+
+-- Index cho báo cáo doanh thu theo ngày thanh toán
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'payment_orders' 
+     AND INDEX_NAME = 'idx_payment_orders_paid_at') > 0,
+    'SELECT "Index idx_payment_orders_paid_at already exists" as message',
+    'ALTER TABLE payment_orders ADD INDEX idx_payment_orders_paid_at (order_status, paid_at)'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SELECT "Migration completed successfully" as message;
@@ -0,0 +1,63 @@
+-- Migration cho hoá đơn đơn thanh toán và thông tin xuất hoá đơn của user
+-- Chạy lệnh: mysql -u root -p tool < migration_add_invoices.sql
+
+-- Thông tin công ty in trên hoá đơn/sao kê
+CREATE TABLE IF NOT EXISTS `tool_billing_profiles` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `company_name` varchar(255) DEFAULT NULL,
+  `tax_code` varchar(20) DEFAULT NULL,
+  `address` varchar(500) DEFAULT NULL,
+  `billing_email` varchar(255) DEFAULT NULL,
+  `contact_name` varchar(255) DEFAULT NULL,
+  `phone` varchar(30) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_tool_billing_profiles_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu thông tin xuất hoá đơn của user';
+
+-- Hoá đơn xuất cho đơn thanh toán đã paid (một đơn một hoá đơn)
+CREATE TABLE IF NOT EXISTS `tool_invoices` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `invoice_number` varchar(30) NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `order_id` bigint unsigned NOT NULL,
+  `order_code` varchar(50) NOT NULL,
+  `purpose` varchar(20) DEFAULT NULL,
+  `description` varchar(255) DEFAULT NULL,
+  `amount_vnd` decimal(12,0) DEFAULT NULL,
+  `amount_usd` decimal(10,2) DEFAULT NULL,
+  `exchange_rate` decimal(10,4) DEFAULT NULL,
+  `bank_name` varchar(100) DEFAULT NULL,
+  `bank_account` varchar(50) DEFAULT NULL,
+  `transaction_id` varchar(100) DEFAULT NULL,
+  `paid_at` datetime(3) DEFAULT NULL,
+  `buyer_name` varchar(255) DEFAULT NULL,
+  `buyer_email` varchar(255) DEFAULT NULL,
+  `buyer_company` varchar(255) DEFAULT NULL,
+  `buyer_tax_code` varchar(20) DEFAULT NULL,
+  `buyer_address` varchar(500) DEFAULT NULL,
+  `issued_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_tool_invoices_invoice_number` (`invoice_number`),
+  UNIQUE KEY `idx_tool_invoices_order_id` (`order_id`),
+  KEY `idx_tool_invoices_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu hoá đơn đơn thanh toán';
+
+-- Sao kê tháng lọc giao dịch credit theo user và thời gian
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.STATISTICS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'credit_transactions' 
+     AND INDEX_NAME = 'idx_credit_transactions_user_created') > 0,
+    'SELECT "Index idx_credit_transactions_user_created already exists" as message',
+    'CREATE INDEX idx_credit_transactions_user_created ON credit_transactions (user_id, created_at)'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SELECT "Migration completed successfully" as message;
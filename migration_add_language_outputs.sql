@@ -0,0 +1,20 @@
+-- Migration script để thêm trường language_outputs vào bảng caption_histories
+-- Lưu output từng ngôn ngữ (srt, tts, video, QA, chi phí) khi một upload dịch sang nhiều ngôn ngữ (target_languages[])
+-- Thực hiện: ALTER TABLE caption_histories ADD COLUMN language_outputs JSON NULL;
+
+-- Kiểm tra xem trường đã tồn tại chưa
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'caption_histories' 
+     AND COLUMN_NAME = 'language_outputs') > 0,
+    'SELECT "Column language_outputs already exists" as message',
+    'ALTER TABLE caption_histories ADD COLUMN language_outputs JSON NULL'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Kiểm tra kết quả
+SELECT "Migration completed successfully" as message;
@@ -0,0 +1,57 @@
+-- Migration cho nhắc/hết hạn đơn thanh toán, hàng chờ đối soát và thông báo user
+-- Chạy lệnh: mysql -u root -p tool < migration_add_payment_reviews.sql
+
+-- Số tiền thực nhận, credit thực cộng và thời điểm nhắc của đơn thanh toán
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'payment_orders' 
+     AND COLUMN_NAME = 'amount_received_vnd') > 0,
+    'SELECT "Column amount_received_vnd already exists" as message',
+    'ALTER TABLE payment_orders ADD COLUMN amount_received_vnd decimal(12,0) NULL AFTER paid_at, ADD COLUMN credited_usd decimal(10,2) NULL AFTER amount_received_vnd, ADD COLUMN reminder_sent_at datetime(3) NULL AFTER credited_usd'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Bảng hàng chờ đối soát khoản tiền không khớp đơn
+CREATE TABLE IF NOT EXISTS `tool_payment_reviews` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `source` varchar(20) NOT NULL,
+  `source_log_id` bigint unsigned DEFAULT NULL,
+  `order_code` varchar(50) DEFAULT NULL,
+  `order_id` bigint unsigned DEFAULT NULL,
+  `user_id` bigint unsigned DEFAULT NULL,
+  `transaction_id` varchar(100) DEFAULT NULL,
+  `amount_vnd` decimal(12,0) DEFAULT NULL,
+  `reason` varchar(30) NOT NULL,
+  `status` varchar(20) NOT NULL DEFAULT 'needs_review',
+  `resolved_action` varchar(20) DEFAULT NULL,
+  `resolved_by` bigint unsigned DEFAULT NULL,
+  `resolution_note` varchar(500) DEFAULT NULL,
+  `resolved_at` datetime(3) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_tool_payment_reviews_source_log_id` (`source_log_id`),
+  KEY `idx_tool_payment_reviews_order_code` (`order_code`),
+  KEY `idx_tool_payment_reviews_order_id` (`order_id`),
+  KEY `idx_tool_payment_reviews_user_id` (`user_id`),
+  KEY `idx_tool_payment_reviews_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng hàng chờ đối soát thanh toán';
+
+-- Bảng thông báo trong ứng dụng
+CREATE TABLE IF NOT EXISTS `tool_user_notifications` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `type` varchar(30) NOT NULL,
+  `title` varchar(255) NOT NULL,
+  `message` text,
+  `order_id` bigint unsigned DEFAULT NULL,
+  `is_read` boolean DEFAULT false,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_tool_user_notifications_user_id` (`user_id`, `is_read`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng thông báo gửi tới user';
+
+SELECT "Migration completed successfully" as message;
@@ -0,0 +1,28 @@
+-- Migration cho xác nhận thanh toán idempotent (mỗi giao dịch ngân hàng chỉ ghi nhận một lần)
+-- Chạy lệnh: mysql -u root -p tool < migration_add_payment_transactions.sql
+
+-- Bảng giao dịch ngân hàng đã nhận, unique theo (source, transaction_id)
+CREATE TABLE IF NOT EXISTS `tool_payment_transactions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `source` varchar(20) NOT NULL,
+  `transaction_id` varchar(100) NOT NULL,
+  `order_code` varchar(50) DEFAULT NULL,
+  `order_id` bigint unsigned DEFAULT NULL,
+  `amount_vnd` decimal(12,0) DEFAULT NULL,
+  `status` varchar(20) NOT NULL,
+  `error_message` text,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_payment_transaction_source_tx` (`source`, `transaction_id`),
+  KEY `idx_tool_payment_transactions_order_code` (`order_code`),
+  KEY `idx_tool_payment_transactions_order_id` (`order_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng giao dịch ngân hàng đã xác nhận';
+
+-- Ghi lại giao dịch của các đơn đã thanh toán trước đây để không bị ghi nhận lại
+INSERT IGNORE INTO `tool_payment_transactions` (`source`, `transaction_id`, `order_code`, `order_id`, `amount_vnd`, `status`)
+SELECT 'sepay', `transaction_id`, `order_code`, `id`, `amount_vnd`, 'paid'
+FROM `payment_orders`
+WHERE `order_status` = 'paid' AND `transaction_id` IS NOT NULL AND `transaction_id` <> '';
+
+SELECT "Migration completed successfully" as message;
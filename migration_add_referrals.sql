@@ -0,0 +1,42 @@
+-- Migration cho chương trình giới thiệu: mã giới thiệu của user và các lượt đăng ký qua mã
+-- Chạy lệnh: mysql -u root -p tool < migration_add_referrals.sql
+
+-- Mã giới thiệu của user, kèm IP/thiết bị gần nhất của chủ mã để chặn tự giới thiệu
+CREATE TABLE IF NOT EXISTS `tool_referral_codes` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `code` varchar(20) NOT NULL,
+  `last_ip` varchar(64) DEFAULT NULL,
+  `last_device_id` varchar(64) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_tool_referral_codes_user_id` (`user_id`),
+  UNIQUE KEY `idx_tool_referral_codes_code` (`code`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu mã giới thiệu của user';
+
+-- Lượt đăng ký qua mã giới thiệu (mỗi user chỉ được giới thiệu một lần)
+CREATE TABLE IF NOT EXISTS `tool_referrals` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `referrer_id` bigint unsigned NOT NULL,
+  `referee_id` bigint unsigned NOT NULL,
+  `code` varchar(20) NOT NULL,
+  `status` varchar(20) NOT NULL DEFAULT 'pending' COMMENT 'pending, rewarded, rejected',
+  `reject_reason` varchar(50) DEFAULT NULL,
+  `signup_ip` varchar(64) DEFAULT NULL,
+  `device_id` varchar(64) DEFAULT NULL,
+  `order_id` bigint unsigned DEFAULT NULL,
+  `referrer_reward` decimal(10,2) DEFAULT 0.00,
+  `referee_reward` decimal(10,2) DEFAULT 0.00,
+  `rewarded_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_tool_referrals_referee_id` (`referee_id`),
+  KEY `idx_tool_referrals_referrer_id` (`referrer_id`),
+  KEY `idx_tool_referrals_status` (`status`),
+  KEY `idx_tool_referrals_signup_ip` (`signup_ip`),
+  KEY `idx_tool_referrals_device_id` (`device_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu lượt giới thiệu và thưởng credit';
+
+SELECT "Migration completed successfully" as message;
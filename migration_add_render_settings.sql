@@ -0,0 +1,20 @@
+-- Migration script để thêm trường render_settings vào bảng caption_histories
+-- Lưu tham số render (ngôn ngữ, giọng, voice_mode, profile...) để sửa phụ đề và render lại
+-- Thực hiện: ALTER TABLE caption_histories ADD COLUMN render_settings JSON NULL;
+
+-- Kiểm tra xem trường đã tồn tại chưa
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'caption_histories' 
+     AND COLUMN_NAME = 'render_settings') > 0,
+    'SELECT "Column render_settings already exists" as message',
+    'ALTER TABLE caption_histories ADD COLUMN render_settings JSON NULL'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Kiểm tra kết quả
+SELECT "Migration completed successfully" as message;
@@ -0,0 +1,20 @@
+-- Migration script để thêm trường source_language vào bảng caption_histories
+-- Lưu ngôn ngữ nguồn (mã ISO) Whisper nhận diện, dùng để bỏ qua dịch khi trùng ngôn ngữ đích
+-- Thực hiện: ALTER TABLE caption_histories ADD COLUMN source_language VARCHAR(10) NULL;
+
+-- Kiểm tra xem trường đã tồn tại chưa
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'caption_histories' 
+     AND COLUMN_NAME = 'source_language') > 0,
+    'SELECT "Column source_language already exists" as message',
+    'ALTER TABLE caption_histories ADD COLUMN source_language VARCHAR(10) NULL'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Kiểm tra kết quả
+SELECT "Migration completed successfully" as message;
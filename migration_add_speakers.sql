@@ -0,0 +1,20 @@
+-- Migration script để thêm trường speakers vào bảng caption_histories
+-- Lưu người nói phát hiện qua diarization và giọng TTS đã gán cho từng người
+-- Thực hiện: ALTER TABLE caption_histories ADD COLUMN speakers JSON NULL;
+
+-- Kiểm tra xem trường đã tồn tại chưa
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'caption_histories' 
+     AND COLUMN_NAME = 'speakers') > 0,
+    'SELECT "Column speakers already exists" as message',
+    'ALTER TABLE caption_histories ADD COLUMN speakers JSON NULL'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Kiểm tra kết quả
+SELECT "Migration completed successfully" as message;
@@ -0,0 +1,22 @@
+-- Migration cho hạn mức chi tiêu credit và cảnh báo số dư thấp của user
+-- Chạy lệnh: mysql -u root -p tool < migration_add_spending_settings.sql
+
+-- Hạn mức chi tiêu ngày/tháng (0 = không giới hạn), auto-stop và trạng thái cảnh báo đã gửi
+CREATE TABLE IF NOT EXISTS `tool_spending_settings` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `daily_cap` decimal(10,2) NOT NULL DEFAULT 0.00,
+  `monthly_cap` decimal(10,2) NOT NULL DEFAULT 0.00,
+  `auto_stop` tinyint(1) NOT NULL DEFAULT 0 COMMENT 'Từ chối job mới khi vượt hạn mức',
+  `low_balance_threshold` decimal(10,2) NOT NULL DEFAULT 0.00,
+  `email_alerts` tinyint(1) NOT NULL DEFAULT 1,
+  `low_balance_alerted_at` datetime(3) DEFAULT NULL,
+  `daily_cap_alerted_at` datetime(3) DEFAULT NULL,
+  `monthly_cap_alerted_at` datetime(3) DEFAULT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_tool_spending_settings_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu hạn mức chi tiêu và cảnh báo số dư của user';
+
+SELECT "Migration completed successfully" as message;
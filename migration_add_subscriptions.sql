@@ -0,0 +1,68 @@
+-- Migration cho gói subscription theo pricing tier
+-- Chạy lệnh: mysql -u root -p tool < migration_add_subscriptions.sql
+
+-- Đơn vị hạn mức tháng của tier (minutes | videos)
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'pricing_tiers' 
+     AND COLUMN_NAME = 'limit_unit') > 0,
+    'SELECT "Column limit_unit already exists" as message',
+    'ALTER TABLE pricing_tiers ADD COLUMN limit_unit varchar(20) NOT NULL DEFAULT ''minutes'' AFTER subscription_price'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Mục đích của đơn thanh toán (topup = nạp credit, subscription = mua gói)
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'payment_orders' 
+     AND COLUMN_NAME = 'purpose') > 0,
+    'SELECT "Column purpose already exists" as message',
+    'ALTER TABLE payment_orders ADD COLUMN purpose varchar(20) NOT NULL DEFAULT ''topup'' AFTER payment_method, ADD COLUMN subscription_id bigint unsigned NULL AFTER purpose'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Bảng gói subscription của user
+CREATE TABLE IF NOT EXISTS `tool_user_subscriptions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `tier_id` int NOT NULL,
+  `tier_name` varchar(50) DEFAULT NULL,
+  `status` varchar(20) NOT NULL DEFAULT 'pending',
+  `months` int NOT NULL DEFAULT 1,
+  `price` decimal(10,2) DEFAULT '0.00',
+  `payment_source` varchar(20) DEFAULT NULL,
+  `order_id` bigint unsigned DEFAULT NULL,
+  `auto_renew` boolean DEFAULT true,
+  `period_start` datetime(3) NULL DEFAULT NULL,
+  `period_end` datetime(3) NULL DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_id` (`user_id`),
+  KEY `idx_status` (`status`),
+  KEY `idx_period_end` (`period_end`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu gói subscription của user';
+
+-- Bảng usage theo chu kỳ hạn mức tháng
+CREATE TABLE IF NOT EXISTS `tool_subscription_usages` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `cycle_start` datetime(3) NOT NULL,
+  `used_minutes` decimal(10,2) DEFAULT '0.00',
+  `used_videos` int DEFAULT 0,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_user_cycle` (`user_id`, `cycle_start`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu usage hạn mức tháng của gói';
+
+-- Kiểm tra kết quả
+SELECT "Migration completed successfully" as message;
@@ -0,0 +1,20 @@
+-- Migration script để thêm trường translation_qa vào bảng caption_histories
+-- Lưu báo cáo QA bản dịch (cue chưa dịch, vượt CPS, rỗng, trùng lặp, lệch timing)
+-- Thực hiện: ALTER TABLE caption_histories ADD COLUMN translation_qa JSON NULL;
+
+-- Kiểm tra xem trường đã tồn tại chưa
+SET @sql = (SELECT IF(
+    (SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS 
+     WHERE TABLE_SCHEMA = DATABASE() 
+     AND TABLE_NAME = 'caption_histories' 
+     AND COLUMN_NAME = 'translation_qa') > 0,
+    'SELECT "Column translation_qa already exists" as message',
+    'ALTER TABLE caption_histories ADD COLUMN translation_qa JSON NULL'
+));
+
+PREPARE stmt FROM @sql;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- Kiểm tra kết quả
+SELECT "Migration completed successfully" as message;
@@ -0,0 +1,31 @@
+-- Migration cho glossary thuật ngữ dịch của user
+-- Chạy lệnh: mysql -u root -p tool < migration_translation_glossary.sql
+
+-- Bảng glossary (mỗi glossary cho một cặp ngôn ngữ)
+CREATE TABLE IF NOT EXISTS `tool_glossaries` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `source_language` varchar(10) DEFAULT NULL,
+  `target_language` varchar(10) NOT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_user_id` (`user_id`),
+  KEY `idx_target_language` (`target_language`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu glossary thuật ngữ dịch của user';
+
+-- Bảng thuật ngữ trong glossary
+CREATE TABLE IF NOT EXISTS `tool_glossary_terms` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `glossary_id` bigint unsigned NOT NULL,
+  `term` varchar(255) NOT NULL,
+  `translation` varchar(255) DEFAULT NULL,
+  `case_sensitive` boolean DEFAULT false,
+  `do_not_translate` boolean DEFAULT false,
+  `note` varchar(500) DEFAULT NULL,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_glossary_id` (`glossary_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng lưu thuật ngữ của glossary';
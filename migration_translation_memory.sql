@@ -0,0 +1,19 @@
+-- Migration cho translation memory (câu nguồn → câu dịch của user, dùng lại giữa các job)
+-- Chạy lệnh: mysql -u root -p tool < migration_translation_memory.sql
+
+CREATE TABLE IF NOT EXISTS `tool_translation_memories` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `source_language` varchar(10) NOT NULL DEFAULT '',
+  `target_language` varchar(10) NOT NULL,
+  `source_hash` varchar(64) NOT NULL COMMENT 'SHA-256 của câu nguồn đã chuẩn hoá',
+  `source_text` text NOT NULL,
+  `target_text` text NOT NULL,
+  `origin` varchar(16) DEFAULT 'job' COMMENT 'job: từ kết quả dịch, edit: user sửa tay',
+  `use_count` int DEFAULT 0,
+  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_tm_lookup` (`user_id`, `source_language`, `target_language`, `source_hash`),
+  KEY `idx_tm_candidates` (`user_id`, `target_language`, `use_count`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='Bảng translation memory của user';
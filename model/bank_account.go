@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BankAccountInflow tổng tiền vào một tài khoản nhận trong ngày, dùng để áp hạn mức ngày/tháng của BankAccount
+type BankAccountInflow struct {
+	ID               uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	BankAccountID    uint            `json:"bank_account_id" gorm:"not null;uniqueIndex:idx_bank_account_inflow_day"`
+	Date             time.Time       `json:"date" gorm:"type:date;not null;uniqueIndex:idx_bank_account_inflow_day"`
+	AccountNumber    string          `json:"account_number" gorm:"size:50"`
+	ReceivedVND      decimal.Decimal `json:"received_vnd" gorm:"type:decimal(14,0);not null;default:0"`
+	TransactionCount int             `json:"transaction_count" gorm:"not null;default:0"`
+	UpdatedAt        time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (BankAccountInflow) TableName() string {
+	return "tool_bank_account_inflows"
+}
+
+// BankAccountUsage là mức sử dụng hạn mức của một tài khoản nhận (trang admin và chọn tài khoản cho đơn mới)
+type BankAccountUsage struct {
+	ID             uint            `json:"id"`
+	BankName       string          `json:"bank_name"`
+	AccountNumber  string          `json:"account_number"`
+	AccountName    string          `json:"account_name"`
+	BankCode       string          `json:"bank_code"`
+	CardBin        string          `json:"card_bin"`
+	IsActive       bool            `json:"is_active"`
+	DailyLimit     decimal.Decimal `json:"daily_limit"`
+	MonthlyLimit   decimal.Decimal `json:"monthly_limit"`
+	ReceivedToday  decimal.Decimal `json:"received_today"`
+	ReceivedMonth  decimal.Decimal `json:"received_month"`
+	PendingVND     decimal.Decimal `json:"pending_vnd"` // Đơn pending chưa hết hạn đang giữ hạn mức
+	PendingOrders  int64           `json:"pending_orders"`
+	RemainingDay   decimal.Decimal `json:"remaining_day"`
+	RemainingMonth decimal.Decimal `json:"remaining_month"`
+	DailyUsage     float64         `json:"daily_usage_percent"`
+	Available      bool            `json:"available"` // Còn nhận đơn mới (đang bật, chưa chạm hạn mức)
+	LastAssignedAt *time.Time      `json:"last_assigned_at"`
+}
@@ -0,0 +1,51 @@
+package model
+
+// EmailTemplateRequest tạo/cập nhật template đọc mail biến động số dư của ngân hàng.
+// Các pattern là regex (Go RE2); sender/subject so khớp không phân biệt hoa thường
+type EmailTemplateRequest struct {
+	BankName           string `json:"bank_name" binding:"required"`
+	TemplateName       string `json:"template_name"`
+	SenderPattern      string `json:"sender_pattern"`
+	SubjectPattern     string `json:"subject_pattern"`
+	ContentPattern     string `json:"content_pattern"`
+	AmountPattern      string `json:"amount_pattern" binding:"required"`
+	AccountPattern     string `json:"account_pattern"`
+	OrderCodePattern   string `json:"order_code_pattern"`
+	TransactionPattern string `json:"transaction_pattern"`
+	Priority           int    `json:"priority"`
+	IsActive           *bool  `json:"is_active"`
+}
+
+// EmailTemplateTestRequest chạy thử template với một mail thô (RFC 822, dán nguyên văn từ "Show original").
+// Template (bản nháp chưa lưu) được ưu tiên, sau đó TemplateID; không có cả hai thì thử mọi template đang bật
+type EmailTemplateTestRequest struct {
+	RawEmail   string                `json:"raw_email" binding:"required"`
+	TemplateID *uint                 `json:"template_id"`
+	Template   *EmailTemplateRequest `json:"template"`
+}
+
+// EmailTemplateCheck là kết quả so khớp một template với mail
+type EmailTemplateCheck struct {
+	TemplateID   uint   `json:"template_id"`
+	BankName     string `json:"bank_name"`
+	TemplateName string `json:"template_name"`
+	Matched      bool   `json:"matched"`
+	Error        string `json:"error,omitempty"`
+}
+
+// EmailTemplateTestResult là thông tin đọc được từ mail như worker sẽ xử lý
+type EmailTemplateTestResult struct {
+	Sender        string               `json:"sender"`
+	Subject       string               `json:"subject"`
+	MessageID     string               `json:"message_id"`
+	Body          string               `json:"body"`
+	Matched       bool                 `json:"matched"`
+	TemplateID    uint                 `json:"template_id,omitempty"`
+	BankName      string               `json:"bank_name,omitempty"`
+	OrderCode     string               `json:"order_code,omitempty"`
+	Amount        string               `json:"amount,omitempty"`
+	BankAccount   string               `json:"bank_account,omitempty"`
+	TransactionID string               `json:"transaction_id,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	Checks        []EmailTemplateCheck `json:"checks"`
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ExchangeRate là tỷ giá USD/VND có hiệu lực từ EffectiveFrom đến khi có tỷ giá mới hơn.
+// Không sửa tỷ giá đã có hiệu lực để lịch sử đơn hàng luôn đối chiếu được
+type ExchangeRate struct {
+	ID            uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	BaseCurrency  string          `json:"base_currency" gorm:"size:3;not null;default:'USD'"`
+	QuoteCurrency string          `json:"quote_currency" gorm:"size:3;not null;default:'VND'"`
+	Rate          decimal.Decimal `json:"rate" gorm:"type:decimal(10,4);not null"`
+	EffectiveFrom time.Time       `json:"effective_from" gorm:"not null;index"`
+	Source        string          `json:"source" gorm:"size:20;not null"` // manual, provider
+	Note          string          `json:"note" gorm:"size:255"`
+	CreatedBy     *uint           `json:"created_by"` // Admin tạo tỷ giá, nil = provider
+	CreatedAt     time.Time       `json:"created_at" gorm:"autoCreateTime"`
+}
+
+type ExchangeRateRequest struct {
+	Rate          float64    `json:"rate" binding:"required"`
+	EffectiveFrom *time.Time `json:"effective_from"` // Bỏ trống = có hiệu lực ngay
+	Note          string     `json:"note"`
+}
+
+// RevenueReportRow là doanh thu đơn đã thanh toán trong một kỳ (ngày/tháng)
+type RevenueReportRow struct {
+	Period      string  `json:"period"`
+	Purpose     string  `json:"purpose,omitempty"`
+	Orders      int64   `json:"orders"`
+	AmountVND   float64 `json:"amount_vnd"`
+	AmountUSD   float64 `json:"amount_usd"`
+	AverageRate float64 `json:"average_rate"` // Tỷ giá bình quân thực tế = tổng VND / tổng USD
+}
+
+type RevenueReport struct {
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	GroupBy   string             `json:"group_by"`
+	Rows      []RevenueReportRow `json:"rows"`
+	ByPurpose []RevenueReportRow `json:"by_purpose"`
+	Total     RevenueReportRow   `json:"total"`
+}
+
+// TableName specifies the table name for GORM
+func (ExchangeRate) TableName() string {
+	return "tool_exchange_rates"
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+)
+
+// Glossary là bộ thuật ngữ của user cho một cặp ngôn ngữ, gắn vào request dịch qua glossary_ids
+type Glossary struct {
+	ID             uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID         uint           `json:"user_id" gorm:"not null;index"`
+	Name           string         `json:"name" gorm:"not null;size:255"`
+	SourceLanguage string         `json:"source_language" gorm:"size:10"` // Rỗng = áp dụng cho mọi ngôn ngữ nguồn
+	TargetLanguage string         `json:"target_language" gorm:"not null;size:10;index"`
+	Terms          []GlossaryTerm `json:"terms" gorm:"foreignKey:GlossaryID"`
+	CreatedAt      time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// GlossaryTerm là một thuật ngữ: term → translation, hoặc giữ nguyên nếu DoNotTranslate
+type GlossaryTerm struct {
+	ID             uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	GlossaryID     uint      `json:"glossary_id" gorm:"not null;index"`
+	Term           string    `json:"term" gorm:"not null;size:255"`
+	Translation    string    `json:"translation" gorm:"size:255"`
+	CaseSensitive  bool      `json:"case_sensitive" gorm:"default:false"`
+	DoNotTranslate bool      `json:"do_not_translate" gorm:"default:false"`
+	Note           string    `json:"note" gorm:"size:500"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type GlossaryTermRequest struct {
+	Term           string `json:"term" binding:"required"`
+	Translation    string `json:"translation"`
+	CaseSensitive  bool   `json:"case_sensitive"`
+	DoNotTranslate bool   `json:"do_not_translate"`
+	Note           string `json:"note"`
+}
+
+type CreateGlossaryRequest struct {
+	Name           string                `json:"name" binding:"required"`
+	SourceLanguage string                `json:"source_language"`
+	TargetLanguage string                `json:"target_language" binding:"required"`
+	Terms          []GlossaryTermRequest `json:"terms"`
+}
+
+type UpdateGlossaryRequest struct {
+	Name string `json:"name"`
+	// nil = giữ nguyên, "" = áp dụng cho mọi ngôn ngữ nguồn
+	SourceLanguage *string `json:"source_language"`
+	TargetLanguage string  `json:"target_language"`
+}
+
+// GlossaryViolation là một cue không dùng đúng thuật ngữ trong glossary
+type GlossaryViolation struct {
+	CueIndex       int    `json:"cue_index"`
+	Term           string `json:"term"`
+	Expected       string `json:"expected"`
+	SourceText     string `json:"source_text"`
+	TranslatedText string `json:"translated_text"`
+}
+
+// TableName specifies the table name for GORM
+func (Glossary) TableName() string {
+	return "tool_glossaries"
+}
+
+// TableName specifies the table name for GORM
+func (GlossaryTerm) TableName() string {
+	return "tool_glossary_terms"
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BillingProfile thông tin xuất hoá đơn của user (công ty/cá nhân kinh doanh)
+type BillingProfile struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	CompanyName  string    `json:"company_name" gorm:"size:255"`
+	TaxCode      string    `json:"tax_code" gorm:"size:20"`
+	Address      string    `json:"address" gorm:"size:500"`
+	BillingEmail string    `json:"billing_email" gorm:"size:255"`
+	ContactName  string    `json:"contact_name" gorm:"size:255"`
+	Phone        string    `json:"phone" gorm:"size:30"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (BillingProfile) TableName() string {
+	return "tool_billing_profiles"
+}
+
+type BillingProfileRequest struct {
+	CompanyName  string `json:"company_name" binding:"max=255"`
+	TaxCode      string `json:"tax_code" binding:"max=20"`
+	Address      string `json:"address" binding:"max=500"`
+	BillingEmail string `json:"billing_email" binding:"omitempty,email,max=255"`
+	ContactName  string `json:"contact_name" binding:"max=255"`
+	Phone        string `json:"phone" binding:"max=30"`
+}
+
+// Invoice hoá đơn của một đơn thanh toán đã paid. Số tiền và thông tin người mua được chốt khi xuất lần đầu
+type Invoice struct {
+	ID            uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	InvoiceNumber string          `json:"invoice_number" gorm:"size:30;not null;uniqueIndex"`
+	UserID        uint            `json:"user_id" gorm:"not null;index"`
+	OrderID       uint            `json:"order_id" gorm:"not null;uniqueIndex"`
+	OrderCode     string          `json:"order_code" gorm:"size:50;not null"`
+	Purpose       string          `json:"purpose" gorm:"size:20"`
+	Description   string          `json:"description" gorm:"size:255"`
+	AmountVND     decimal.Decimal `json:"amount_vnd" gorm:"type:decimal(12,0)"` // Số tiền thực nhận
+	AmountUSD     decimal.Decimal `json:"amount_usd" gorm:"type:decimal(10,2)"` // Credit tương ứng (không gồm thưởng)
+	ExchangeRate  decimal.Decimal `json:"exchange_rate" gorm:"type:decimal(10,4)"`
+	BankName      string          `json:"bank_name" gorm:"size:100"`
+	BankAccount   string          `json:"bank_account" gorm:"size:50"`
+	TransactionID string          `json:"transaction_id" gorm:"size:100"`
+	PaidAt        time.Time       `json:"paid_at"`
+	BuyerName     string          `json:"buyer_name" gorm:"size:255"`
+	BuyerEmail    string          `json:"buyer_email" gorm:"size:255"`
+	BuyerCompany  string          `json:"buyer_company" gorm:"size:255"`
+	BuyerTaxCode  string          `json:"buyer_tax_code" gorm:"size:20"`
+	BuyerAddress  string          `json:"buyer_address" gorm:"size:500"`
+	IssuedAt      time.Time       `json:"issued_at"`
+	CreatedAt     time.Time       `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (Invoice) TableName() string {
+	return "tool_invoices"
+}
+
+// UsageStatementService tổng credit sử dụng theo service trong tháng
+type UsageStatementService struct {
+	Service      string  `json:"service"`
+	Transactions int     `json:"transactions"`
+	UnitsUsed    float64 `json:"units_used"`
+	Charged      float64 `json:"charged"`
+	Refunded     float64 `json:"refunded"`
+	Net          float64 `json:"net"`
+}
+
+// UsageStatementVideo tổng credit sử dụng theo video trong tháng
+type UsageStatementVideo struct {
+	VideoID       uint     `json:"video_id"`
+	VideoFilename string   `json:"video_filename"`
+	Services      []string `json:"services"`
+	Charged       float64  `json:"charged"`
+	Refunded      float64  `json:"refunded"`
+	Net           float64  `json:"net"`
+}
+
+// UsageStatement sao kê credit sử dụng trong tháng (USD credit), dựng từ CreditTransaction
+type UsageStatement struct {
+	Month         string                  `json:"month"` // YYYY-MM
+	From          time.Time               `json:"from"`
+	To            time.Time               `json:"to"`
+	UserID        uint                    `json:"user_id"`
+	UserName      string                  `json:"user_name"`
+	UserEmail     string                  `json:"user_email"`
+	Billing       *BillingProfile         `json:"billing,omitempty"`
+	TotalTopup    float64                 `json:"total_topup"` // Credit nạp/thưởng trong tháng
+	TotalCharged  float64                 `json:"total_charged"`
+	TotalRefunded float64                 `json:"total_refunded"`
+	NetUsage      float64                 `json:"net_usage"`
+	Services      []UsageStatementService `json:"services"`
+	Videos        []UsageStatementVideo   `json:"videos"`
+	GeneratedAt   time.Time               `json:"generated_at"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// LanguageOutput là kết quả của một ngôn ngữ đích trong job dịch nhiều ngôn ngữ (target_languages[]), lưu trong CaptionHistory.LanguageOutputs
+type LanguageOutput struct {
+	TargetLanguage     string               `json:"target_language"`
+	Status             string               `json:"status"` // completed, failed
+	Error              string               `json:"error,omitempty"`
+	VoiceName          string               `json:"voice_name,omitempty"`
+	SrtFile            string               `json:"srt_file,omitempty"`
+	TTSFile            string               `json:"tts_file,omitempty"`
+	MergedVideoFile    string               `json:"merged_video_file,omitempty"`
+	TranslationQA      *TranslationQAReport `json:"translation_qa,omitempty"`
+	Speakers           []SpeakerVoice       `json:"speakers,omitempty"`
+	TranslationSkipped bool                 `json:"translation_skipped,omitempty"` // Trùng ngôn ngữ nguồn: dùng luôn SRT gốc, không tính phí dịch
+	Cost               float64              `json:"cost"`                          // Credit đã trừ cho dịch + TTS của ngôn ngữ này (Whisper/Demucs tính một lần cho cả nhóm)
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PaymentReview là khoản tiền vào không tự khớp được với đơn hàng (đơn hết hạn/đã huỷ, không tìm thấy đơn,
+// thiếu tiền đơn subscription...) và chờ admin xử lý
+type PaymentReview struct {
+	ID             uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	Source         string          `json:"source" gorm:"size:20;not null"` // sepay, email
+	SourceLogID    uint            `json:"source_log_id" gorm:"index"`     // ID SepayWebhookLog hoặc PaymentEmailLog
+	OrderCode      string          `json:"order_code" gorm:"size:50;index"`
+	OrderID        *uint           `json:"order_id" gorm:"index"`
+	UserID         *uint           `json:"user_id" gorm:"index"` // Chủ đơn hàng nếu khớp được mã đơn
+	TransactionID  string          `json:"transaction_id" gorm:"size:100"`
+	AmountVND      decimal.Decimal `json:"amount_vnd" gorm:"type:decimal(12,0)"`
+	Reason         string          `json:"reason" gorm:"size:30;not null"` // order_not_found, order_expired, order_cancelled, order_paid, amount_short
+	Status         string          `json:"status" gorm:"size:20;not null;default:'needs_review';index"`
+	ResolvedAction string          `json:"resolved_action" gorm:"size:20"` // apply, reject
+	ResolvedBy     *uint           `json:"resolved_by"`
+	ResolutionNote string          `json:"resolution_note" gorm:"size:500"`
+	ResolvedAt     *time.Time      `json:"resolved_at"`
+	CreatedAt      time.Time       `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ResolvePaymentReviewRequest là quyết định của admin: apply = ghi nhận khoản tiền cho đơn OrderCode
+// (mặc định đơn gốc), reject = bỏ qua (đã hoàn tiền/không phải tiền nạp)
+type ResolvePaymentReviewRequest struct {
+	Action    string `json:"action" binding:"required"`
+	OrderCode string `json:"order_code"`
+	Note      string `json:"note"`
+}
+
+// UserNotification là thông báo trong ứng dụng gửi tới user (đơn sắp hết hạn, đã hết hạn, thanh toán chờ duyệt...)
+type UserNotification struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Type      string    `json:"type" gorm:"size:30;not null"`
+	Title     string    `json:"title" gorm:"size:255;not null"`
+	Message   string    `json:"message" gorm:"type:text"`
+	OrderID   *uint     `json:"order_id"`
+	IsRead    bool      `json:"is_read" gorm:"default:false"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (PaymentReview) TableName() string {
+	return "tool_payment_reviews"
+}
+
+// TableName specifies the table name for GORM
+func (UserNotification) TableName() string {
+	return "tool_user_notifications"
+}
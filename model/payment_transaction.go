@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PaymentTransaction ghi mỗi giao dịch ngân hàng đã nhận đúng một lần theo (Source, TransactionID),
+// để webhook gửi lại hoặc email đọc lại không cộng credit hai lần. Cùng khoản chuyển khoản báo qua kênh khác
+// được nhận ra theo đơn và số tiền (xem ConfirmPayment)
+type PaymentTransaction struct {
+	ID            uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	Source        string          `json:"source" gorm:"size:20;not null;uniqueIndex:idx_payment_transaction_source_tx"` // sepay, email, manual
+	TransactionID string          `json:"transaction_id" gorm:"size:100;not null;uniqueIndex:idx_payment_transaction_source_tx"`
+	OrderCode     string          `json:"order_code" gorm:"size:50;index"`
+	OrderID       *uint           `json:"order_id" gorm:"index"`
+	AmountVND     decimal.Decimal `json:"amount_vnd" gorm:"type:decimal(12,0)"`
+	Status        string          `json:"status" gorm:"size:20;not null"` // processing, paid, needs_review, duplicate, failed, fulfill_failed
+	ErrorMessage  string          `json:"error_message" gorm:"type:text"`
+	CreatedAt     time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time       `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (PaymentTransaction) TableName() string {
+	return "tool_payment_transactions"
+}
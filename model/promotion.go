@@ -0,0 +1,92 @@
+package model
+
+import (
+	"time"
+)
+
+// CreditPackage là gói nạp định sẵn: trả PriceVND nhận Credits (USD) + BonusPercent% credit thưởng
+type CreditPackage struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name         string    `json:"name" gorm:"not null;size:100"`
+	Description  string    `json:"description" gorm:"size:500"`
+	PriceVND     float64   `json:"price_vnd" gorm:"type:decimal(12,0);not null"`
+	Credits      float64   `json:"credits" gorm:"type:decimal(10,2);not null"`
+	BonusPercent float64   `json:"bonus_percent" gorm:"type:decimal(5,2);default:0.00"`
+	SortOrder    int       `json:"sort_order" gorm:"default:0"`
+	IsActive     bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// PromoCode là mã khuyến mãi khi nạp: thưởng BonusPercent% và/hoặc BonusCredits cố định, có thời hạn và giới hạn lượt dùng
+type PromoCode struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Code           string     `json:"code" gorm:"not null;size:50;uniqueIndex"`
+	Description    string     `json:"description" gorm:"size:500"`
+	BonusPercent   float64    `json:"bonus_percent" gorm:"type:decimal(5,2);default:0.00"`
+	BonusCredits   float64    `json:"bonus_credits" gorm:"type:decimal(10,2);default:0.00"`
+	MinAmountUSD   float64    `json:"min_amount_usd" gorm:"type:decimal(10,2);default:0.00"`
+	StartsAt       *time.Time `json:"starts_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxUses        int        `json:"max_uses" gorm:"default:0"`          // Tổng lượt dùng tối đa, 0 = không giới hạn
+	MaxUsesPerUser int        `json:"max_uses_per_user" gorm:"default:1"` // 0 = không giới hạn
+	UsedCount      int        `json:"used_count" gorm:"default:0"`
+	IsActive       bool       `json:"is_active" gorm:"default:true"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// PromoCodeRedemption là một lượt dùng mã khuyến mãi, ghi khi đơn nạp được thanh toán
+type PromoCodeRedemption struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	PromoCodeID  uint      `json:"promo_code_id" gorm:"not null;index"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	OrderID      uint      `json:"order_id" gorm:"not null;uniqueIndex"`
+	BonusCredits float64   `json:"bonus_credits" gorm:"type:decimal(10,2);default:0.00"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+type CreditPackageRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	Description  string  `json:"description"`
+	PriceVND     float64 `json:"price_vnd" binding:"required"`
+	Credits      float64 `json:"credits" binding:"required"`
+	BonusPercent float64 `json:"bonus_percent"`
+	SortOrder    int     `json:"sort_order"`
+	IsActive     *bool   `json:"is_active"`
+}
+
+type PromoCodeRequest struct {
+	Code           string     `json:"code" binding:"required"`
+	Description    string     `json:"description"`
+	BonusPercent   float64    `json:"bonus_percent"`
+	BonusCredits   float64    `json:"bonus_credits"`
+	MinAmountUSD   float64    `json:"min_amount_usd"`
+	StartsAt       *time.Time `json:"starts_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxUses        int        `json:"max_uses"`
+	MaxUsesPerUser *int       `json:"max_uses_per_user"`
+	IsActive       *bool      `json:"is_active"`
+}
+
+// TopupBonus là một khoản credit thưởng khi nạp (gói, mã khuyến mãi, nạp lần đầu)
+type TopupBonus struct {
+	Type        string  `json:"type"` // package, promo_code, first_topup
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description"`
+}
+
+// TableName specifies the table name for GORM
+func (CreditPackage) TableName() string {
+	return "tool_credit_packages"
+}
+
+// TableName specifies the table name for GORM
+func (PromoCode) TableName() string {
+	return "tool_promo_codes"
+}
+
+// TableName specifies the table name for GORM
+func (PromoCodeRedemption) TableName() string {
+	return "tool_promo_code_redemptions"
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+)
+
+// ReferralCode là mã giới thiệu của user (mỗi user một mã, tạo khi user mở trang giới thiệu lần đầu).
+// LastIP/LastDeviceID là IP và thiết bị gần nhất của chủ mã, dùng chặn tự giới thiệu bằng tài khoản phụ
+type ReferralCode struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	Code         string    `json:"code" gorm:"not null;size:20;uniqueIndex"`
+	LastIP       string    `json:"-" gorm:"size:64"`
+	LastDeviceID string    `json:"-" gorm:"size:64"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Referral là một lượt đăng ký qua mã giới thiệu. Thưởng được cộng cho cả hai bên khi đơn thanh toán đầu tiên
+// của người được giới thiệu paid; lượt bị chặn bởi kiểm tra gian lận được lưu với status rejected
+type Referral struct {
+	ID             uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReferrerID     uint       `json:"referrer_id" gorm:"not null;index"`
+	RefereeID      uint       `json:"referee_id" gorm:"not null;uniqueIndex"`
+	Code           string     `json:"code" gorm:"not null;size:20"`
+	Status         string     `json:"status" gorm:"size:20;not null;default:'pending';index"` // pending, rewarded, rejected
+	RejectReason   string     `json:"reject_reason,omitempty" gorm:"size:50"`
+	SignupIP       string     `json:"-" gorm:"size:64;index"`
+	DeviceID       string     `json:"-" gorm:"size:64;index"`
+	OrderID        *uint      `json:"order_id"` // Đơn thanh toán đầu tiên kích hoạt thưởng
+	ReferrerReward float64    `json:"referrer_reward" gorm:"type:decimal(10,2);default:0.00"`
+	RefereeReward  float64    `json:"referee_reward" gorm:"type:decimal(10,2);default:0.00"`
+	RewardedAt     *time.Time `json:"rewarded_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// ReferralItem là một người được giới thiệu trong danh sách của người giới thiệu (email được che bớt)
+type ReferralItem struct {
+	ID           uint       `json:"id"`
+	RefereeEmail string     `json:"referee_email"`
+	Status       string     `json:"status"`
+	RejectReason string     `json:"reject_reason,omitempty"`
+	Reward       float64    `json:"reward"`
+	RewardedAt   *time.Time `json:"rewarded_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ReferralSummary là trang giới thiệu của user: mã, thống kê và credit đã nhận
+type ReferralSummary struct {
+	Code           string         `json:"code"`
+	ReferrerReward float64        `json:"referrer_reward"` // Credit người giới thiệu nhận cho mỗi lượt thành công
+	RefereeReward  float64        `json:"referee_reward"`  // Credit người được giới thiệu nhận
+	TotalReferrals int            `json:"total_referrals"`
+	Pending        int            `json:"pending"`
+	Rewarded       int            `json:"rewarded"`
+	Rejected       int            `json:"rejected"`
+	EarnedCredits  float64        `json:"earned_credits"` // Tổng credit đã nhận từ giới thiệu (cả thưởng khi được giới thiệu)
+	ReferredBy     *string        `json:"referred_by"`    // Mã đã dùng khi đăng ký, nếu có
+	Referrals      []ReferralItem `json:"referrals"`
+}
+
+// TableName specifies the table name for GORM
+func (ReferralCode) TableName() string {
+	return "tool_referral_codes"
+}
+
+// TableName specifies the table name for GORM
+func (Referral) TableName() string {
+	return "tool_referrals"
+}
@@ -0,0 +1,10 @@
+package model
+
+// SpeakerVoice là một người nói phát hiện được qua diarization và giọng TTS được gán cho người đó, lưu trong CaptionHistory.Speakers
+type SpeakerVoice struct {
+	Speaker      string  `json:"speaker"`          // Nhãn từ diarization, ví dụ SPEAKER_00
+	Gender       string  `json:"gender,omitempty"` // male, female, rỗng = không xác định
+	VoiceName    string  `json:"voice_name"`
+	CueCount     int     `json:"cue_count"`
+	SpeakingTime float64 `json:"speaking_time"` // Tổng số giây nói
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+)
+
+// SpendingSettings là hạn mức chi tiêu credit và ngưỡng cảnh báo số dư do user tự đặt.
+// Cap = 0 là không giới hạn; AutoStop bật thì LockCredits từ chối job mới khi vượt cap, tắt thì chỉ cảnh báo
+type SpendingSettings struct {
+	ID                  uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID              uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	DailyCap            float64    `json:"daily_cap" gorm:"type:decimal(10,2);not null"`
+	MonthlyCap          float64    `json:"monthly_cap" gorm:"type:decimal(10,2);not null"`
+	AutoStop            bool       `json:"auto_stop" gorm:"not null"`
+	LowBalanceThreshold float64    `json:"low_balance_threshold" gorm:"type:decimal(10,2);not null"` // 0 = không cảnh báo
+	EmailAlerts         bool       `json:"email_alerts" gorm:"not null"`                             // Gửi cảnh báo qua email ngoài thông báo trong ứng dụng
+	LowBalanceAlertedAt *time.Time `json:"-"`                                                        // Đã cảnh báo số dư thấp, xoá khi số dư lên lại trên ngưỡng
+	DailyCapAlertedAt   *time.Time `json:"-"`
+	MonthlyCapAlertedAt *time.Time `json:"-"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt           time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// SpendingSettingsRequest cập nhật một phần SpendingSettings, trường nil giữ nguyên
+type SpendingSettingsRequest struct {
+	DailyCap            *float64 `json:"daily_cap"`
+	MonthlyCap          *float64 `json:"monthly_cap"`
+	AutoStop            *bool    `json:"auto_stop"`
+	LowBalanceThreshold *float64 `json:"low_balance_threshold"`
+	EmailAlerts         *bool    `json:"email_alerts"`
+}
+
+// SpendingStatus là mức chi tiêu hiện tại so với hạn mức, trả kèm /credit/balance
+type SpendingStatus struct {
+	DailySpent          float64  `json:"daily_spent"`
+	MonthlySpent        float64  `json:"monthly_spent"`
+	DailyCap            float64  `json:"daily_cap"`
+	MonthlyCap          float64  `json:"monthly_cap"`
+	DailyRemaining      *float64 `json:"daily_remaining"` // nil = không giới hạn
+	MonthlyRemaining    *float64 `json:"monthly_remaining"`
+	AutoStop            bool     `json:"auto_stop"`
+	CapReached          bool     `json:"cap_reached"`
+	LowBalanceThreshold float64  `json:"low_balance_threshold"`
+	LowBalance          bool     `json:"low_balance"`
+}
+
+// TableName specifies the table name for GORM
+func (SpendingSettings) TableName() string {
+	return "tool_spending_settings"
+}
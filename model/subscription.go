@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+)
+
+// UserSubscription là một lần mua gói (PricingTier) của user trong một khoảng thời gian.
+// Gói cùng tier mua thêm khi đang còn hạn được xếp nối tiếp (PeriodStart = PeriodEnd của gói trước)
+type UserSubscription struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID        uint      `json:"user_id" gorm:"not null;index"`
+	TierID        int       `json:"tier_id" gorm:"not null"`
+	TierName      string    `json:"tier_name" gorm:"size:50"`
+	Status        string    `json:"status" gorm:"size:20;not null;default:'pending';index"` // pending, active, cancelled, expired
+	Months        int       `json:"months" gorm:"not null;default:1"`
+	Price         float64   `json:"price" gorm:"type:decimal(10,2);default:0.00"` // Tổng số tiền (USD) đã trả cho Months tháng
+	PaymentSource string    `json:"payment_source" gorm:"size:20"`                // credits, payment_order
+	OrderID       *uint     `json:"order_id"`
+	AutoRenew     bool      `json:"auto_renew" gorm:"default:true"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// SubscriptionUsage là lượng sử dụng của user trong một chu kỳ hạn mức tháng (tính từ ngày bắt đầu gói, hoặc đầu tháng nếu không có gói)
+type SubscriptionUsage struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_user_cycle"`
+	CycleStart  time.Time `json:"cycle_start" gorm:"not null;uniqueIndex:idx_user_cycle"`
+	UsedMinutes float64   `json:"used_minutes" gorm:"type:decimal(10,2);default:0.00"`
+	UsedVideos  int       `json:"used_videos" gorm:"default:0"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type CreateSubscriptionRequest struct {
+	TierID        int    `json:"tier_id" binding:"required"`
+	Months        int    `json:"months"`
+	PaymentMethod string `json:"payment_method"` // credits (mặc định) hoặc payment_order (chuyển khoản QR)
+	AutoRenew     *bool  `json:"auto_renew"`
+}
+
+// SubscriptionStatus là gói hiện tại, hạn mức và lượng đã dùng trong chu kỳ của user
+type SubscriptionStatus struct {
+	TierID       int               `json:"tier_id"`
+	TierName     string            `json:"tier_name"`
+	MonthlyLimit *int              `json:"monthly_limit"` // nil = không giới hạn
+	LimitUnit    string            `json:"limit_unit"`
+	Used         float64           `json:"used"`
+	Remaining    *float64          `json:"remaining"`
+	UsedMinutes  float64           `json:"used_minutes"`
+	UsedVideos   int               `json:"used_videos"`
+	CycleStart   time.Time         `json:"cycle_start"`
+	CycleEnd     time.Time         `json:"cycle_end"`
+	Subscription *UserSubscription `json:"subscription"`
+	Pending      *UserSubscription `json:"pending_subscription,omitempty"`
+	RenewsAt     *time.Time        `json:"renews_at"`  // Ngày gia hạn tự động (nil nếu không tự gia hạn)
+	ExpiresAt    *time.Time        `json:"expires_at"` // Ngày hết hạn gói (kể cả các gói đã xếp nối tiếp)
+	RenewalPrice float64           `json:"renewal_price"`
+}
+
+// TableName specifies the table name for GORM
+func (UserSubscription) TableName() string {
+	return "tool_user_subscriptions"
+}
+
+// TableName specifies the table name for GORM
+func (SubscriptionUsage) TableName() string {
+	return "tool_subscription_usages"
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// TranslationMemory lưu câu nguồn → câu dịch của user theo cặp ngôn ngữ, dùng lại cho các job sau
+type TranslationMemory struct {
+	ID             uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID         uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_tm_lookup,priority:1"`
+	SourceLanguage string    `json:"source_language" gorm:"size:10;uniqueIndex:idx_tm_lookup,priority:2"` // Rỗng = chưa xác định ngôn ngữ nguồn
+	TargetLanguage string    `json:"target_language" gorm:"not null;size:10;uniqueIndex:idx_tm_lookup,priority:3"`
+	SourceHash     string    `json:"source_hash" gorm:"not null;size:64;uniqueIndex:idx_tm_lookup,priority:4"` // SHA-256 của câu nguồn đã chuẩn hoá
+	SourceText     string    `json:"source_text" gorm:"type:text;not null"`
+	TargetText     string    `json:"target_text" gorm:"type:text;not null"`
+	Origin         string    `json:"origin" gorm:"size:16;default:'job'"` // job, edit
+	UseCount       int       `json:"use_count" gorm:"default:0"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TranslationMemoryStats thống kê số cue lấy từ translation memory trong một job
+type TranslationMemoryStats struct {
+	TotalCues        int     `json:"total_cues"`
+	ExactMatches     int     `json:"exact_matches"`
+	FuzzyMatches     int     `json:"fuzzy_matches"`
+	CharactersReused int     `json:"characters_reused"`
+	CostSaved        float64 `json:"cost_saved"`
+}
+
+// TableName specifies the table name for GORM
+func (TranslationMemory) TableName() string {
+	return "tool_translation_memories"
+}
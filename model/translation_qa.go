@@ -0,0 +1,32 @@
+package model
+
+// Các loại lỗi QA bản dịch
+const (
+	QAIssueUntranslated  = "untranslated"
+	QAIssueCPSExceeded   = "cps_exceeded"
+	QAIssueEmpty         = "empty"
+	QAIssueDuplicate     = "duplicate"
+	QAIssueTimingDrift   = "timing_drift"
+	QAIssueCountMismatch = "count_mismatch"
+)
+
+// TranslationQAIssue là một lỗi QA trên một cue của bản dịch
+type TranslationQAIssue struct {
+	CueIndex       int     `json:"cue_index"` // Bắt đầu từ 1, 0 = lỗi toàn file
+	Type           string  `json:"type"`
+	Severity       string  `json:"severity"` // error: cần dịch lại, warning: chỉ báo cáo
+	Message        string  `json:"message"`
+	SourceText     string  `json:"source_text,omitempty"`
+	TranslatedText string  `json:"translated_text,omitempty"`
+	CPS            float64 `json:"cps,omitempty"`
+}
+
+// TranslationQAReport là kết quả QA bản dịch, lưu cùng history
+type TranslationQAReport struct {
+	SourceLanguage string               `json:"source_language"`
+	TargetLanguage string               `json:"target_language"`
+	TotalCues      int                  `json:"total_cues"`
+	Issues         []TranslationQAIssue `json:"issues"`
+	IssueCounts    map[string]int       `json:"issue_counts"`
+	Passed         bool                 `json:"passed"` // Không còn lỗi mức error
+}
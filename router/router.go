@@ -17,6 +17,26 @@ func SetupRoutes(r *gin.Engine) {
 	db := config.Db
 	feedbackService := service.NewFeedbackService(db)
 	feedbackHandler := handler.NewFeedbackHandler(feedbackService)
+	glossaryService := service.NewGlossaryService(db)
+	glossaryHandler := handler.NewGlossaryHandler(glossaryService)
+	subscriptionService := service.NewSubscriptionService(db)
+	subscriptionHandler := handler.NewSubscriptionHandler(subscriptionService)
+	promotionService := service.NewPromotionService(db)
+	promotionHandler := handler.NewPromotionHandler(promotionService)
+	exchangeRateService := service.NewExchangeRateService(db)
+	exchangeRateHandler := handler.NewExchangeRateHandler(exchangeRateService)
+	paymentReviewService := service.NewPaymentReviewService(db)
+	paymentReviewHandler := handler.NewPaymentReviewHandler(paymentReviewService)
+	notificationService := service.NewNotificationService(db)
+	notificationHandler := handler.NewNotificationHandler(notificationService)
+	emailTemplateService := service.NewEmailTemplateService(db)
+	emailTemplateHandler := handler.NewEmailTemplateHandler(emailTemplateService)
+	invoiceService := service.NewInvoiceService(db)
+	invoiceHandler := handler.NewInvoiceHandler(invoiceService)
+	bankAccountService := service.NewBankAccountService(db)
+	bankAccountHandler := handler.NewBankAccountHandler(bankAccountService)
+	referralService := service.NewReferralService(db)
+	referralHandler := handler.NewReferralHandler(referralService)
 
 	// Public routes
 	r.POST("/register", handler.RegisterHandler)
@@ -44,12 +64,20 @@ func SetupRoutes(r *gin.Engine) {
 	protected.Use(middleware.AuthMiddleware())
 	{
 		protected.GET("/user/profile", handler.GetUserProfileHandler)
+		protected.GET("/user/profile/billing", invoiceHandler.GetBillingProfile)
+		protected.PUT("/user/profile/billing", invoiceHandler.UpdateBillingProfile)
+		protected.GET("/user/referrals", referralHandler.GetReferrals)
 		protected.POST("/tiktok-optimize", middleware.FileValidationMiddleware(), middleware.ProcessAnyStatusMiddleware(), handler.TikTokOptimizerHandler)
 		protected.POST("/save-history", handler.SaveHistory)
 		protected.GET("/history", handler.GetHistory)
 		protected.GET("/history/:id", handler.GetHistoryByID)
 		protected.DELETE("/history/:id", handler.DeleteHistory)
 		protected.DELETE("/history", handler.DeleteHistories)
+		// Sửa phụ đề và render lại không cần transcribe lại
+		protected.GET("/history/:id/cues", handler.GetHistoryCuesHandler)
+		protected.PUT("/history/:id/cues", handler.PutHistoryCuesHandler)
+		protected.PATCH("/history/:id/cues", handler.PatchHistoryCuesHandler)
+		protected.POST("/history/:id/rerender", handler.RerenderHistoryHandler)
 		protected.GET("/user/video-count", handler.GetUserVideoCount)
 		protected.GET("/user/video-stats", handler.GetUserVideoStats)
 		protected.POST("/process-voice", handler.ProcessVoiceHandler)
@@ -58,6 +86,7 @@ func SetupRoutes(r *gin.Engine) {
 		protected.POST("/process-video-parallel", middleware.FileValidationMiddleware(), middleware.ProcessAnyStatusMiddleware(), middleware.ProcessStatusMiddleware("process-video"), handler.ProcessVideoParallelHandler)
 		protected.POST("/process-video-async", middleware.FileValidationMiddleware(), middleware.ProcessAnyStatusMiddleware(), middleware.ProcessStatusMiddleware("process-video"), handler.ProcessVideoAsyncHandler)
 		protected.GET("/process/:process_id/progress", handler.GetProcessingProgressHandler)
+		protected.GET("/output-profiles", handler.GetOutputProfilesHandler)
 
 		// Optimized TTS endpoints
 		protected.POST("/optimized-tts", handler.OptimizedTTSHandler)
@@ -78,6 +107,9 @@ func SetupRoutes(r *gin.Engine) {
 		protected.GET("/credit/history", handler.GetCreditHistory)
 		//protected.POST("/credit/add", handler.AddCredits)
 		protected.POST("/credit/estimate", handler.EstimateCost)
+		protected.GET("/credit/statements/:month", invoiceHandler.GetCreditStatement)
+		protected.GET("/credit/spending-settings", handler.GetSpendingSettings)
+		protected.PUT("/credit/spending-settings", handler.UpdateSpendingSettings)
 
 		// Legacy estimate endpoint
 		protected.POST("/estimate-cost", handler.EstimateProcessVideoCostHandler)
@@ -86,6 +118,29 @@ func SetupRoutes(r *gin.Engine) {
 		protected.POST("/feedback", feedbackHandler.CreateFeedback)
 		protected.GET("/feedback", feedbackHandler.GetUserFeedbacks)
 		protected.GET("/feedback/:id", feedbackHandler.GetFeedbackByID)
+
+		// Glossary endpoints (thuật ngữ dịch của user)
+		protected.GET("/glossaries", glossaryHandler.GetUserGlossaries)
+		protected.POST("/glossaries", glossaryHandler.CreateGlossary)
+		protected.POST("/glossaries/check", glossaryHandler.CheckHistoryGlossary)
+		protected.GET("/glossaries/:id", glossaryHandler.GetGlossaryByID)
+		protected.PUT("/glossaries/:id", glossaryHandler.UpdateGlossary)
+		protected.DELETE("/glossaries/:id", glossaryHandler.DeleteGlossary)
+		protected.POST("/glossaries/:id/terms", glossaryHandler.AddTerm)
+		protected.PUT("/glossaries/:id/terms/:term_id", glossaryHandler.UpdateTerm)
+		protected.DELETE("/glossaries/:id/terms/:term_id", glossaryHandler.DeleteTerm)
+
+		// Subscription endpoints (gói tháng theo pricing tier)
+		protected.GET("/subscription/plans", subscriptionHandler.GetPlans)
+		protected.GET("/subscription", subscriptionHandler.GetSubscription)
+		protected.POST("/subscription", subscriptionHandler.Subscribe)
+		protected.PUT("/subscription/auto-renew", subscriptionHandler.UpdateAutoRenew)
+		protected.POST("/subscription/cancel", subscriptionHandler.CancelSubscription)
+
+		// Thông báo trong ứng dụng (đơn sắp hết hạn, thanh toán chờ xác nhận...)
+		protected.GET("/notifications", notificationHandler.GetNotifications)
+		protected.POST("/notifications/read-all", notificationHandler.MarkAllNotificationsRead)
+		protected.POST("/notifications/:id/read", notificationHandler.MarkNotificationRead)
 	}
 
 	// Payment routes
@@ -97,6 +152,9 @@ func SetupRoutes(r *gin.Engine) {
 		payment.GET("/payment/orders", handler.GetUserPaymentOrders)
 		payment.POST("/payment/order/:order_code/cancel", handler.CancelPaymentOrder)
 		payment.GET("/payment/order/:order_code/status", handler.GetPaymentOrderStatus)
+		payment.GET("/payment/order/:order_code/invoice", invoiceHandler.GetPaymentInvoice)
+		payment.GET("/payment/packages", promotionHandler.GetCreditPackages)
+		payment.POST("/payment/promo-code/validate", promotionHandler.ValidatePromoCode)
 	}
 
 	// API v1 group
@@ -145,11 +203,55 @@ func SetupRoutes(r *gin.Engine) {
 			// Payment management
 			adminProtected.GET("/payments", handler.GetAdminPaymentOrders)
 			adminProtected.GET("/payments/stats", handler.GetAdminPaymentStats)
+			adminProtected.GET("/payments/revenue", exchangeRateHandler.AdminGetRevenueReport)
 			adminProtected.POST("/payments/:id/cancel", handler.CancelAdminPaymentOrder)
+			adminProtected.POST("/payments/:id/confirm", handler.ConfirmAdminPaymentOrder)
+
+			// Tài khoản nhận: tiền vào theo ngày và hạn mức còn lại
+			adminProtected.GET("/bank-accounts", bankAccountHandler.AdminGetBankAccounts)
+			adminProtected.GET("/bank-accounts/:id/inflows", bankAccountHandler.AdminGetBankAccountInflows)
+
+			// Đối soát khoản tiền không khớp đơn (needs_review)
+			adminProtected.GET("/payment-reviews", paymentReviewHandler.AdminGetPaymentReviews)
+			adminProtected.POST("/payment-reviews/:id/resolve", paymentReviewHandler.AdminResolvePaymentReview)
+			adminProtected.GET("/payment-reviews/unmatched-logs", paymentReviewHandler.AdminGetUnmatchedPaymentLogs)
+			adminProtected.POST("/payment-reviews/unmatched-logs/:source/:id", paymentReviewHandler.AdminQueuePaymentLog)
+
+			// Template đọc mail ngân hàng và trạng thái worker đọc mail
+			adminProtected.GET("/email-templates", emailTemplateHandler.AdminGetEmailTemplates)
+			adminProtected.POST("/email-templates", emailTemplateHandler.AdminCreateEmailTemplate)
+			adminProtected.POST("/email-templates/test", emailTemplateHandler.AdminTestEmailTemplate)
+			adminProtected.PUT("/email-templates/:id", emailTemplateHandler.AdminUpdateEmailTemplate)
+			adminProtected.DELETE("/email-templates/:id", emailTemplateHandler.AdminDeleteEmailTemplate)
+			adminProtected.GET("/payment/email-monitor", emailTemplateHandler.AdminGetEmailMonitorStatus)
+
+			// Tỷ giá USD/VND
+			adminProtected.GET("/exchange-rates", exchangeRateHandler.AdminGetExchangeRates)
+			adminProtected.POST("/exchange-rates", exchangeRateHandler.AdminCreateExchangeRate)
+			adminProtected.POST("/exchange-rates/sync", exchangeRateHandler.AdminSyncExchangeRate)
+			adminProtected.DELETE("/exchange-rates/:id", exchangeRateHandler.AdminDeleteExchangeRate)
+
+			// Gói nạp và mã khuyến mãi
+			adminProtected.GET("/credit-packages", promotionHandler.AdminGetCreditPackages)
+			adminProtected.POST("/credit-packages", promotionHandler.AdminCreateCreditPackage)
+			adminProtected.PUT("/credit-packages/:id", promotionHandler.AdminUpdateCreditPackage)
+			adminProtected.DELETE("/credit-packages/:id", promotionHandler.AdminDeleteCreditPackage)
+			adminProtected.GET("/promo-codes", promotionHandler.AdminGetPromoCodes)
+			adminProtected.POST("/promo-codes", promotionHandler.AdminCreatePromoCode)
+			adminProtected.PUT("/promo-codes/:id", promotionHandler.AdminUpdatePromoCode)
+			adminProtected.DELETE("/promo-codes/:id", promotionHandler.AdminDeletePromoCode)
 
 			// Feedback management
 			adminProtected.GET("/feedbacks", feedbackHandler.GetAllFeedbacks)
 			adminProtected.PUT("/feedbacks/:id", feedbackHandler.UpdateFeedback)
+
+			// Result cache management
+			adminProtected.GET("/cache/stats", handler.GetCacheStatsHandler)
+			adminProtected.POST("/cache/cleanup", handler.CleanupCacheHandler)
+			adminProtected.DELETE("/cache", handler.ClearAllCacheHandler)
+			adminProtected.GET("/cache/:key", handler.GetCacheEntryHandler)
+			adminProtected.DELETE("/cache/:key", handler.DeleteCacheEntryHandler)
+			adminProtected.PUT("/cache/:key/ttl", handler.SetCacheTTLHandler)
 		}
 		admin.GET("/payment/email-logs", handler.GetPaymentEmailLogs)
 		admin.GET("/credit-usage", handler.AdminCreditUsageListHandler)
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"strings"
+)
+
+// Tham số sidechain ducking: nhạc nền được hạ xuống khi có giọng TTS
+const (
+	duckThreshold = 0.02 // Ngưỡng kích hoạt theo biên độ tuyến tính của TTS (~ -34 dBFS)
+	duckRatio     = 8
+	duckAttackMs  = 20
+	duckReleaseMs = 400
+)
+
+// loudnormStats là kết quả đo lượt 1 của loudnorm (print_format=json)
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// buildDuckedMixFilter tạo filter mix nhạc nền và TTS, nhạc nền được duck bởi sidechaincompress theo TTS.
+// Input 1 là nhạc nền, input 2 là TTS, output là label [mix]
+func buildDuckedMixFilter(backgroundVolume, ttsVolume float64, videoDuration string) string {
+	bgPad := "apad"
+	if videoDuration != "" {
+		bgPad = fmt.Sprintf("apad=whole_dur=%s", videoDuration)
+	}
+	return fmt.Sprintf(
+		"[1:a]volume=%.2f,%s,aformat=channel_layouts=stereo[bg];"+
+			"[2:a]volume=%.2f,aformat=channel_layouts=stereo,asplit=2[tts][sc];"+
+			"[bg][sc]sidechaincompress=threshold=%.3f:ratio=%d:attack=%d:release=%d[ducked];"+
+			"[ducked][tts]amix=inputs=2:duration=longest:normalize=0[mix]",
+		backgroundVolume, bgPad, ttsVolume,
+		duckThreshold, duckRatio, duckAttackMs, duckReleaseMs,
+	)
+}
+
+// loudnormBaseArgs trả về tham số mục tiêu loudnorm theo profile
+func loudnormBaseArgs(profile OutputProfile) string {
+	target, truePeak, lra := profile.LoudnessTarget, profile.TruePeak, profile.LoudnessRange
+	if target == 0 {
+		target = -16
+	}
+	if truePeak == 0 {
+		truePeak = -1.5
+	}
+	if lra == 0 {
+		lra = 11
+	}
+	return fmt.Sprintf("I=%.1f:TP=%.1f:LRA=%.1f", target, truePeak, lra)
+}
+
+// measureLoudness chạy lượt 1 của loudnorm trên bản mix để lấy các chỉ số đo được
+func measureLoudness(inputs []string, mixFilter string, profile OutputProfile) (*loudnormStats, error) {
+	var args []string
+	for _, input := range inputs {
+		args = append(args, "-i", input)
+	}
+	args = append(args,
+		"-filter_complex", fmt.Sprintf("%s;[mix]loudnorm=%s:print_format=json[measured]", mixFilter, loudnormBaseArgs(profile)),
+		"-map", "[measured]",
+		"-f", "null", "-",
+	)
+
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("loudness measurement failed: %v, output: %s", err, string(output))
+	}
+
+	// loudnorm in kết quả JSON ở cuối log
+	text := string(output)
+	start := strings.LastIndex(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("loudnorm stats not found in ffmpeg output")
+	}
+	var stats loudnormStats
+	if err := json.Unmarshal([]byte(text[start:end+1]), &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse loudnorm stats: %v", err)
+	}
+	// Audio im lặng hoàn toàn cho kết quả -inf, không dùng được cho lượt 2
+	if strings.Contains(stats.InputI, "inf") || strings.Contains(stats.InputTP, "inf") {
+		return nil, fmt.Errorf("invalid loudness measurement: I=%s TP=%s", stats.InputI, stats.InputTP)
+	}
+	return &stats, nil
+}
+
+// buildLoudnormFilter tạo chuỗi chuẩn hoá EBU R128 cho bản mix: loudnorm (2 lượt nếu có số đo) và limiter true-peak.
+// Nhận label [mix], trả về label [audio]
+func buildLoudnormFilter(profile OutputProfile, stats *loudnormStats) string {
+	loudnorm := "loudnorm=" + loudnormBaseArgs(profile)
+	if stats != nil {
+		loudnorm += fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+			stats.InputI, stats.InputTP, stats.InputLRA, stats.InputThresh, stats.TargetOffset)
+	}
+
+	truePeak := profile.TruePeak
+	if truePeak == 0 {
+		truePeak = -1.5
+	}
+	// loudnorm resample lên 192kHz, đưa về 48kHz trước khi giới hạn đỉnh
+	limit := math.Pow(10, truePeak/20)
+	return fmt.Sprintf("[mix]%s,aresample=48000,alimiter=limit=%.4f:level=disabled[audio]", loudnorm, limit)
+}
+
+// buildNormalizedMixFilter tạo filter mix hoàn chỉnh: ducking nhạc nền + loudnorm 2 lượt theo profile.
+// Nếu lượt đo thất bại thì dùng loudnorm 1 lượt (dynamic)
+func buildNormalizedMixFilter(videoPath, backgroundMusicPath, ttsPath string, backgroundVolume, ttsVolume float64, videoDuration string, profile OutputProfile) string {
+	mixFilter := buildDuckedMixFilter(backgroundVolume, ttsVolume, videoDuration)
+
+	stats, err := measureLoudness([]string{videoPath, backgroundMusicPath, ttsPath}, mixFilter, profile)
+	if err != nil {
+		log.Printf("Loudness measurement failed, using single-pass loudnorm: %v", err)
+	} else {
+		log.Printf("Measured mix loudness: I=%s LUFS, TP=%s dBTP, LRA=%s LU (target %s)",
+			stats.InputI, stats.InputTP, stats.InputLRA, loudnormBaseArgs(profile))
+	}
+
+	return mixFilter + ";" + buildLoudnormFilter(profile, stats)
+}
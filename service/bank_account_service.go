@@ -0,0 +1,272 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	BankAccountSelectionLeastLoaded = "least_loaded"
+	BankAccountSelectionRoundRobin  = "round_robin"
+)
+
+var ErrNoBankAccountAvailable = errors.New("no bank account available")
+
+// BankAccountService theo dõi tiền vào từng tài khoản nhận và chọn tài khoản cho đơn mới theo hạn mức ngày/tháng
+type BankAccountService struct {
+	db *gorm.DB
+}
+
+func NewBankAccountService(db *gorm.DB) *BankAccountService {
+	return &BankAccountService{db: db}
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// remainingLimit hạn mức còn lại sau tiền đã nhận và đơn đang chờ. limit <= 0 = không giới hạn (trả về nil)
+func remainingLimit(limit, received, pending decimal.Decimal) *decimal.Decimal {
+	if !limit.IsPositive() {
+		return nil
+	}
+	remaining := limit.Sub(received).Sub(pending)
+	if remaining.IsNegative() {
+		remaining = decimal.Zero
+	}
+	return &remaining
+}
+
+// GetAccountUsage tính tiền đã nhận hôm nay/tháng này, tiền đơn pending đang giữ và hạn mức còn lại của mỗi tài khoản
+func (s *BankAccountService) GetAccountUsage(activeOnly bool) ([]model.BankAccountUsage, error) {
+	var accounts []config.BankAccount
+	query := s.db.Order("id ASC")
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+	if err := query.Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get bank accounts: %v", err)
+	}
+	if len(accounts) == 0 {
+		return []model.BankAccountUsage{}, nil
+	}
+
+	now := time.Now()
+	today := startOfDay(now)
+	month := startOfMonth(now)
+
+	type inflowSum struct {
+		BankAccountID uint
+		Received      decimal.Decimal
+	}
+	var todayRows, monthRows []inflowSum
+	err := s.db.Model(&model.BankAccountInflow{}).
+		Select("bank_account_id, SUM(received_vnd) AS received").
+		Where("date = ?", today).
+		Group("bank_account_id").Scan(&todayRows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get today inflows: %v", err)
+	}
+	err = s.db.Model(&model.BankAccountInflow{}).
+		Select("bank_account_id, SUM(received_vnd) AS received").
+		Where("date >= ? AND date < ?", month, month.AddDate(0, 1, 0)).
+		Group("bank_account_id").Scan(&monthRows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get month inflows: %v", err)
+	}
+
+	type orderSum struct {
+		BankAccount string
+		Amount      decimal.Decimal
+		Orders      int64
+	}
+	var pendingRows []orderSum
+	err = s.db.Model(&config.PaymentOrder{}).
+		Select("bank_account, SUM(amount_vnd) AS amount, COUNT(*) AS orders").
+		Where("order_status = ? AND expires_at > ?", "pending", now).
+		Group("bank_account").Scan(&pendingRows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending orders: %v", err)
+	}
+
+	type lastAssigned struct {
+		BankAccount string
+		LastAt      time.Time
+	}
+	var assignedRows []lastAssigned
+	err = s.db.Model(&config.PaymentOrder{}).
+		Select("bank_account, MAX(created_at) AS last_at").
+		Group("bank_account").Scan(&assignedRows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last assigned orders: %v", err)
+	}
+
+	receivedToday := map[uint]decimal.Decimal{}
+	for _, row := range todayRows {
+		receivedToday[row.BankAccountID] = row.Received
+	}
+	receivedMonth := map[uint]decimal.Decimal{}
+	for _, row := range monthRows {
+		receivedMonth[row.BankAccountID] = row.Received
+	}
+	pending := map[string]orderSum{}
+	for _, row := range pendingRows {
+		pending[row.BankAccount] = row
+	}
+	assignedAt := map[string]time.Time{}
+	for _, row := range assignedRows {
+		assignedAt[row.BankAccount] = row.LastAt
+	}
+
+	usages := make([]model.BankAccountUsage, 0, len(accounts))
+	for _, account := range accounts {
+		usage := model.BankAccountUsage{
+			ID:            account.ID,
+			BankName:      account.BankName,
+			AccountNumber: account.AccountNumber,
+			AccountName:   account.AccountName,
+			BankCode:      account.BankCode,
+			CardBin:       account.CardBin,
+			IsActive:      account.IsActive,
+			DailyLimit:    account.DailyLimit,
+			MonthlyLimit:  account.MonthlyLimit,
+			ReceivedToday: receivedToday[account.ID],
+			ReceivedMonth: receivedMonth[account.ID],
+			PendingVND:    pending[account.AccountNumber].Amount,
+			PendingOrders: pending[account.AccountNumber].Orders,
+		}
+		if last, ok := assignedAt[account.AccountNumber]; ok {
+			usage.LastAssignedAt = &last
+		}
+
+		usage.Available = account.IsActive
+		if remaining := remainingLimit(account.DailyLimit, usage.ReceivedToday, usage.PendingVND); remaining != nil {
+			usage.RemainingDay = *remaining
+			usage.DailyUsage = usage.ReceivedToday.Add(usage.PendingVND).Div(account.DailyLimit).Mul(decimal.NewFromInt(100)).Round(2).InexactFloat64()
+			usage.Available = usage.Available && remaining.IsPositive()
+		}
+		if remaining := remainingLimit(account.MonthlyLimit, usage.ReceivedMonth, usage.PendingVND); remaining != nil {
+			usage.RemainingMonth = *remaining
+			usage.Available = usage.Available && remaining.IsPositive()
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// canReceive kiểm tra tài khoản còn đủ hạn mức ngày và tháng cho thêm amount
+func canReceive(usage model.BankAccountUsage, amount decimal.Decimal) bool {
+	if !usage.Available {
+		return false
+	}
+	if usage.DailyLimit.IsPositive() && usage.RemainingDay.LessThan(amount) {
+		return false
+	}
+	if usage.MonthlyLimit.IsPositive() && usage.RemainingMonth.LessThan(amount) {
+		return false
+	}
+	return true
+}
+
+// SelectAccount chọn tài khoản nhận cho đơn mới theo BANK_ACCOUNT_SELECTION, bỏ qua tài khoản đã chạm hạn mức ngày/tháng
+// (tính cả đơn pending đang giữ). least_loaded: tài khoản dùng ít % hạn mức ngày nhất; round_robin: tài khoản lâu nhất chưa được giao đơn
+func (s *BankAccountService) SelectAccount(amount decimal.Decimal) (*config.BankAccount, error) {
+	usages, err := s.GetAccountUsage(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []model.BankAccountUsage
+	for _, usage := range usages {
+		if canReceive(usage, amount) {
+			candidates = append(candidates, usage)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w for %s VND", ErrNoBankAccountAvailable, amount.String())
+	}
+
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if cfg.BankAccountSelection == BankAccountSelectionRoundRobin {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i].LastAssignedAt, candidates[j].LastAssignedAt
+			if a == nil || b == nil {
+				return a == nil && b != nil
+			}
+			return a.Before(*b)
+		})
+	} else {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].DailyUsage < candidates[j].DailyUsage
+		})
+	}
+
+	var account config.BankAccount
+	if err := s.db.First(&account, candidates[0].ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get bank account: %v", err)
+	}
+	return &account, nil
+}
+
+// RecordInflow cộng tiền vào tổng trong ngày của tài khoản nhận, chạy trong transaction ghi nhận đơn paid.
+// Tài khoản không còn trong bank_accounts chỉ được log để không chặn việc ghi nhận thanh toán
+func (s *BankAccountService) RecordInflow(tx *gorm.DB, accountNumber string, amount decimal.Decimal, at time.Time) error {
+	if !amount.IsPositive() {
+		return nil
+	}
+
+	var account config.BankAccount
+	err := tx.Where("account_number = ?", accountNumber).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Bank account %s not found, inflow of %s VND not tracked", accountNumber, amount.String())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get bank account %s: %v", accountNumber, err)
+	}
+
+	inflow := model.BankAccountInflow{
+		BankAccountID:    account.ID,
+		Date:             startOfDay(at),
+		AccountNumber:    account.AccountNumber,
+		ReceivedVND:      amount,
+		TransactionCount: 1,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "bank_account_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"received_vnd":      gorm.Expr("received_vnd + ?", amount),
+			"transaction_count": gorm.Expr("transaction_count + 1"),
+			"updated_at":        time.Now(),
+		}),
+	}).Create(&inflow).Error
+}
+
+// GetInflowHistory lấy tiền vào theo ngày của một tài khoản trong khoảng [from, to)
+func (s *BankAccountService) GetInflowHistory(accountID uint, from, to time.Time) ([]model.BankAccountInflow, error) {
+	var account config.BankAccount
+	if err := s.db.First(&account, accountID).Error; err != nil {
+		return nil, err
+	}
+
+	var inflows []model.BankAccountInflow
+	err := s.db.Where("bank_account_id = ? AND date >= ? AND date < ?", accountID, startOfDay(from), startOfDay(to)).
+		Order("date DESC").
+		Find(&inflows).Error
+	return inflows, err
+}
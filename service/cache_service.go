@@ -1,14 +1,29 @@
 package service
 
 import (
-	"crypto/md5"
+	"creator-tool-backend/model"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"creator-tool-backend/config"
+)
+
+// Các loại cache theo nội dung
+const (
+	CacheTypeWhisper     = "whisper"
+	CacheTypeBackground  = "background"
+	CacheTypeTranslation = "translation"
+	CacheTypeTTSSegment  = "tts_segment"
 )
 
 // CacheEntry đại diện cho một entry trong cache
@@ -18,45 +33,126 @@ type CacheEntry struct {
 	Type           string        `json:"type"`
 	CreatedAt      time.Time     `json:"created_at"`
 	ExpiresAt      time.Time     `json:"expires_at"`
+	LastAccessedAt time.Time     `json:"last_accessed_at"`
+	HitCount       int           `json:"hit_count"`
 	FileSize       int64         `json:"file_size"`
 	ProcessingTime time.Duration `json:"processing_time"`
 }
 
-// CacheService quản lý cache cho các kết quả xử lý
+// cacheCounter đếm hit/miss theo loại cache kể từ khi server khởi động
+type cacheCounter struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// CacheService quản lý cache cho các kết quả xử lý.
+// Key được tạo từ SHA-256 của nội dung đầu vào (không phụ thuộc đường dẫn file),
+// file kết quả được copy vào thư mục blobs của cache và bị thu hồi theo LRU khi vượt quá dung lượng
 type CacheService struct {
 	CacheDir string
+	MaxSize  int64 // Dung lượng tối đa (bytes) của các file được cache
+
+	mutex    sync.Mutex
+	counters map[string]*cacheCounter
+
+	// Chỉ mục trong bộ nhớ của các entry (key → metadata) và tổng dung lượng, nạp từ thư mục cache một lần
+	// để store/evict không phải đọc lại mọi file entry
+	index     map[string]*CacheEntry
+	totalSize int64
 }
 
+var (
+	cacheService     *CacheService
+	cacheServiceOnce sync.Once
+)
+
 // NewCacheService tạo service cache mới
 func NewCacheService() *CacheService {
 	cacheDir := "./cache"
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Join(cacheDir, "blobs"), 0755); err != nil {
 		log.Printf("Failed to create cache directory: %v", err)
 	}
 
+	conf := config.InfaConfig{}
+	conf.LoadConfig()
+	maxSize := int64(conf.CacheMaxSizeMB) * 1024 * 1024
+	if maxSize <= 0 {
+		maxSize = 5 * 1024 * 1024 * 1024
+	}
+
 	return &CacheService{
 		CacheDir: cacheDir,
+		MaxSize:  maxSize,
+		counters: make(map[string]*cacheCounter),
 	}
 }
 
-// GenerateCacheKey tạo key cache từ input
-func (c *CacheService) GenerateCacheKey(input string, cacheType string) string {
-	hash := md5.Sum([]byte(input + cacheType))
+// GetCacheService trả về instance dùng chung để thống kê hit/miss được gộp giữa các request
+func GetCacheService() *CacheService {
+	cacheServiceOnce.Do(func() {
+		cacheService = NewCacheService()
+	})
+	return cacheService
+}
+
+// HashBytes trả về SHA-256 (hex) của dữ liệu
+func HashBytes(data []byte) string {
+	hash := sha256.Sum256(data)
 	return hex.EncodeToString(hash[:])
 }
 
-// Get lấy giá trị từ cache
-func (c *CacheService) Get(key string) (*CacheEntry, error) {
-	cacheFile := filepath.Join(c.CacheDir, key+".json")
+// HashFile trả về SHA-256 (hex) của nội dung file
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
 
-	// Kiểm tra file tồn tại
-	if _, err := os.Stat(cacheFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("cache entry not found")
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// GenerateCacheKey tạo key cache từ loại cache và các thành phần (hash nội dung, model, tham số)
+func (c *CacheService) GenerateCacheKey(cacheType string, parts ...string) string {
+	return HashBytes([]byte(cacheType + "\x00" + strings.Join(parts, "\x00")))
+}
+
+func (c *CacheService) entryPath(key string) string {
+	return filepath.Join(c.CacheDir, key+".json")
+}
+
+func (c *CacheService) blobPath(key, ext string) string {
+	return filepath.Join(c.CacheDir, "blobs", key+ext)
+}
+
+// recordLookup cập nhật bộ đếm hit/miss, cần giữ mutex khi gọi
+func (c *CacheService) recordLookup(cacheType string, hit bool) {
+	if cacheType == "" {
+		return
+	}
+	counter, ok := c.counters[cacheType]
+	if !ok {
+		counter = &cacheCounter{}
+		c.counters[cacheType] = counter
+	}
+	if hit {
+		counter.Hits++
+	} else {
+		counter.Misses++
+	}
+}
 
-	// Đọc file cache
-	data, err := os.ReadFile(cacheFile)
+// readEntry đọc entry từ file, không kiểm tra hết hạn
+func (c *CacheService) readEntry(key string) (*CacheEntry, error) {
+	data, err := os.ReadFile(c.entryPath(key))
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("cache entry not found")
+		}
 		return nil, fmt.Errorf("failed to read cache file: %v", err)
 	}
 
@@ -64,99 +160,294 @@ func (c *CacheService) Get(key string) (*CacheEntry, error) {
 	if err := json.Unmarshal(data, &entry); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal cache entry: %v", err)
 	}
+	return &entry, nil
+}
+
+func (c *CacheService) writeEntry(entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %v", err)
+	}
+	if err := os.WriteFile(c.entryPath(entry.Key), data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+	return nil
+}
+
+// removeEntry xoá entry và file blob của nó, cần giữ mutex khi gọi
+func (c *CacheService) removeEntry(entry *CacheEntry) {
+	if entry.Value != "" && c.isBlob(entry.Value) {
+		if err := os.Remove(entry.Value); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove cached file: %v", err)
+		}
+	}
+	os.Remove(c.entryPath(entry.Key))
+	c.unindex(entry.Key)
+}
+
+// loadIndexLocked nạp chỉ mục từ thư mục cache ở lần dùng đầu tiên, cần giữ mutex khi gọi
+func (c *CacheService) loadIndexLocked() {
+	if c.index != nil {
+		return
+	}
+	c.index = make(map[string]*CacheEntry)
+	c.totalSize = 0
+	entries, err := c.listEntries()
+	if err != nil {
+		log.Printf("Failed to load cache index: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		c.index[entry.Key] = entry
+		c.totalSize += entry.FileSize
+	}
+	log.Printf("Loaded cache index: %d entries, %d bytes", len(entries), c.totalSize)
+}
+
+// indexEntry thêm hoặc thay entry trong chỉ mục, cần giữ mutex khi gọi
+func (c *CacheService) indexEntry(entry *CacheEntry) {
+	c.loadIndexLocked()
+	c.unindex(entry.Key)
+	indexed := *entry
+	c.index[entry.Key] = &indexed
+	c.totalSize += entry.FileSize
+}
+
+// unindex bỏ entry khỏi chỉ mục, cần giữ mutex khi gọi
+func (c *CacheService) unindex(key string) {
+	if indexed, ok := c.index[key]; ok {
+		c.totalSize -= indexed.FileSize
+		delete(c.index, key)
+	}
+}
+
+// indexedEntries trả về bản sao danh sách entry trong chỉ mục, cần giữ mutex khi gọi
+func (c *CacheService) indexedEntries() []*CacheEntry {
+	c.loadIndexLocked()
+	entries := make([]*CacheEntry, 0, len(c.index))
+	for _, entry := range c.index {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (c *CacheService) isBlob(path string) bool {
+	blobDir, err := filepath.Abs(filepath.Join(c.CacheDir, "blobs"))
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(absPath, blobDir+string(filepath.Separator))
+}
+
+// lookup lấy entry còn hiệu lực và cập nhật thời điểm truy cập (LRU), cần giữ mutex khi gọi
+func (c *CacheService) lookup(key string) (*CacheEntry, error) {
+	entry, err := c.readEntry(key)
+	if err != nil {
+		return nil, err
+	}
 
 	// Kiểm tra expiration
 	if time.Now().After(entry.ExpiresAt) {
-		// Cache đã hết hạn, xóa file
-		os.Remove(cacheFile)
+		c.removeEntry(entry)
 		return nil, fmt.Errorf("cache entry expired")
 	}
 
 	// Kiểm tra file value tồn tại
 	if _, err := os.Stat(entry.Value); os.IsNotExist(err) {
-		// File không tồn tại, xóa cache entry
-		os.Remove(cacheFile)
+		os.Remove(c.entryPath(key))
+		c.unindex(key)
 		return nil, fmt.Errorf("cached file not found")
 	}
 
-	return &entry, nil
+	entry.LastAccessedAt = time.Now()
+	entry.HitCount++
+	if err := c.writeEntry(entry); err != nil {
+		log.Printf("Failed to update cache access time: %v", err)
+	}
+	c.indexEntry(entry)
+	return entry, nil
+}
+
+// Get lấy giá trị từ cache
+func (c *CacheService) Get(key string) (*CacheEntry, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lookup(key)
 }
 
-// Set lưu giá trị vào cache
+// getTyped lấy entry theo loại cache và ghi nhận hit/miss
+func (c *CacheService) getTyped(key, cacheType string) (*CacheEntry, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, err := c.lookup(key)
+	c.recordLookup(cacheType, err == nil)
+	return entry, err
+}
+
+// Set lưu giá trị vào cache, file value được copy vào thư mục blobs để không phụ thuộc vòng đời thư mục video
 func (c *CacheService) Set(key string, value string, cacheType string, ttl time.Duration) error {
 	// Kiểm tra file value tồn tại
-	fileInfo, err := os.Stat(value)
-	if err != nil {
+	if _, err := os.Stat(value); err != nil {
 		return fmt.Errorf("value file not found: %v", err)
 	}
 
-	entry := CacheEntry{
-		Key:       key,
-		Value:     value,
-		Type:      cacheType,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(ttl),
-		FileSize:  fileInfo.Size(),
-	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	// Lưu entry vào file
-	cacheFile := filepath.Join(c.CacheDir, key+".json")
-	data, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("failed to marshal cache entry: %v", err)
+	blob := value
+	if !c.isBlob(value) {
+		blob = c.blobPath(key, filepath.Ext(value))
+		if err := copyFile(value, blob); err != nil {
+			return fmt.Errorf("failed to copy value into cache: %v", err)
+		}
 	}
+	return c.store(key, blob, cacheType, ttl)
+}
 
-	if err := os.WriteFile(cacheFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write cache file: %v", err)
-	}
+// SetBytes lưu dữ liệu trực tiếp vào cache dưới dạng file blob với phần mở rộng ext
+func (c *CacheService) SetBytes(key string, data []byte, ext string, cacheType string, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	log.Printf("Cached %s: %s -> %s", cacheType, key, value)
-	return nil
+	blob := c.blobPath(key, ext)
+	if err := os.WriteFile(blob, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache blob: %v", err)
+	}
+	return c.store(key, blob, cacheType, ttl)
 }
 
-// Delete xóa entry khỏi cache
-func (c *CacheService) Delete(key string) error {
-	cacheFile := filepath.Join(c.CacheDir, key+".json")
+// store ghi entry cho blob đã có sẵn và thu hồi LRU nếu vượt dung lượng, cần giữ mutex khi gọi
+func (c *CacheService) store(key, blob, cacheType string, ttl time.Duration) error {
+	fileInfo, err := os.Stat(blob)
+	if err != nil {
+		return fmt.Errorf("value file not found: %v", err)
+	}
 
-	// Đọc entry để lấy file value
-	if entry, err := c.Get(key); err == nil {
-		// Xóa file value
-		if err := os.Remove(entry.Value); err != nil {
-			log.Printf("Failed to remove cached file: %v", err)
-		}
+	now := time.Now()
+	entry := &CacheEntry{
+		Key:            key,
+		Value:          blob,
+		Type:           cacheType,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+		LastAccessedAt: now,
+		FileSize:       fileInfo.Size(),
 	}
+	if err := c.writeEntry(entry); err != nil {
+		return err
+	}
+	c.indexEntry(entry)
 
-	// Xóa file cache
-	return os.Remove(cacheFile)
+	log.Printf("Cached %s: %s (%d bytes)", cacheType, key, entry.FileSize)
+	c.evictLocked(key)
+	return nil
 }
 
-// CleanupExpired dọn dẹp cache đã hết hạn
-func (c *CacheService) CleanupExpired() error {
+// listEntries đọc tất cả entry trong thư mục cache (chỉ dùng để nạp chỉ mục), cần giữ mutex khi gọi
+func (c *CacheService) listEntries() ([]*CacheEntry, error) {
 	files, err := os.ReadDir(c.CacheDir)
 	if err != nil {
-		return fmt.Errorf("failed to read cache directory: %v", err)
+		return nil, fmt.Errorf("failed to read cache directory: %v", err)
 	}
 
-	var deletedCount int
+	var entries []*CacheEntry
 	for _, file := range files {
 		if filepath.Ext(file.Name()) != ".json" {
 			continue
 		}
-
-		cacheFile := filepath.Join(c.CacheDir, file.Name())
-		data, err := os.ReadFile(cacheFile)
+		entry, err := c.readEntry(strings.TrimSuffix(file.Name(), ".json"))
 		if err != nil {
 			continue
 		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// evictLocked chỉ chạy khi tổng dung lượng trong chỉ mục vượt MaxSize: xoá entry hết hạn rồi thu hồi entry
+// ít được truy cập gần đây nhất cho đến khi dưới MaxSize. Entry vừa ghi (keep) không bị thu hồi. Cần giữ mutex khi gọi
+func (c *CacheService) evictLocked(keep string) {
+	c.loadIndexLocked()
+	if c.totalSize <= c.MaxSize {
+		return
+	}
 
-		var entry CacheEntry
-		if err := json.Unmarshal(data, &entry); err != nil {
+	now := time.Now()
+	var live []*CacheEntry
+	for _, entry := range c.indexedEntries() {
+		if now.After(entry.ExpiresAt) {
+			c.removeEntry(entry)
 			continue
 		}
+		live = append(live, entry)
+	}
+
+	sort.Slice(live, func(i, j int) bool { return live[i].LastAccessedAt.Before(live[j].LastAccessedAt) })
+	var evicted int
+	for _, entry := range live {
+		if c.totalSize <= c.MaxSize {
+			break
+		}
+		if entry.Key == keep {
+			continue
+		}
+		c.removeEntry(entry)
+		evicted++
+	}
+	log.Printf("Cache LRU eviction removed %d entries, size now %d/%d bytes", evicted, c.totalSize, c.MaxSize)
+}
+
+// Delete xóa entry khỏi cache
+func (c *CacheService) Delete(key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, err := c.readEntry(key)
+	if err != nil {
+		return err
+	}
+	c.removeEntry(entry)
+	return nil
+}
 
+// Purge xoá toàn bộ entry của một loại cache (rỗng = tất cả), trả về số entry và dung lượng đã giải phóng
+func (c *CacheService) Purge(cacheType string) (int, int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entries := c.indexedEntries()
+
+	var count int
+	var freed int64
+	for _, entry := range entries {
+		if cacheType != "" && entry.Type != cacheType {
+			continue
+		}
+		c.removeEntry(entry)
+		count++
+		freed += entry.FileSize
+	}
+	log.Printf("Purged %d cache entries (type=%q, %d bytes)", count, cacheType, freed)
+	return count, freed, nil
+}
+
+// CleanupExpired dọn dẹp cache đã hết hạn
+func (c *CacheService) CleanupExpired() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entries := c.indexedEntries()
+
+	var deletedCount int
+	for _, entry := range entries {
 		// Kiểm tra expiration
 		if time.Now().After(entry.ExpiresAt) {
-			c.Delete(entry.Key)
+			c.removeEntry(entry)
 			deletedCount++
 		}
 	}
@@ -170,31 +461,17 @@ func (c *CacheService) CleanupExpired() error {
 
 // GetStats lấy thống kê cache
 func (c *CacheService) GetStats() map[string]interface{} {
-	files, err := os.ReadDir(c.CacheDir)
-	if err != nil {
-		return map[string]interface{}{"error": err.Error()}
-	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entries := c.indexedEntries()
 
 	var totalSize int64
 	var entryCount int
 	typeStats := make(map[string]int)
+	typeSizes := make(map[string]int64)
 
-	for _, file := range files {
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
-		}
-
-		cacheFile := filepath.Join(c.CacheDir, file.Name())
-		data, err := os.ReadFile(cacheFile)
-		if err != nil {
-			continue
-		}
-
-		var entry CacheEntry
-		if err := json.Unmarshal(data, &entry); err != nil {
-			continue
-		}
-
+	for _, entry := range entries {
 		// Kiểm tra expiration
 		if time.Now().After(entry.ExpiresAt) {
 			continue
@@ -203,59 +480,278 @@ func (c *CacheService) GetStats() map[string]interface{} {
 		entryCount++
 		totalSize += entry.FileSize
 		typeStats[entry.Type]++
+		typeSizes[entry.Type] += entry.FileSize
+	}
+
+	var hits, misses int64
+	lookups := make(map[string]interface{})
+	for cacheType, counter := range c.counters {
+		hits += counter.Hits
+		misses += counter.Misses
+		lookups[cacheType] = map[string]interface{}{
+			"hits":      counter.Hits,
+			"misses":    counter.Misses,
+			"hit_ratio": hitRatio(counter.Hits, counter.Misses),
+		}
 	}
 
 	return map[string]interface{}{
 		"total_entries": entryCount,
 		"total_size":    totalSize,
+		"max_size":      c.MaxSize,
 		"type_stats":    typeStats,
+		"type_sizes":    typeSizes,
+		"hits":          hits,
+		"misses":        misses,
+		"hit_ratio":     hitRatio(hits, misses),
+		"lookups":       lookups,
 		"cache_dir":     c.CacheDir,
 	}
 }
 
+func hitRatio(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// copyFile copy nội dung file src sang dst
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// whisperCacheValue là dữ liệu kết quả Whisper được lưu trong cache
+type whisperCacheValue struct {
+	Transcript     string    `json:"transcript"`
+	Segments       []Segment `json:"segments"`
+	SourceLanguage string    `json:"source_language"` // Ngôn ngữ Whisper nhận diện, rỗng với entry cũ
+}
+
+// whisperCacheKey tạo key từ nội dung audio và service/model transcribe
+func (c *CacheService) whisperCacheKey(audioPath, model string) (string, error) {
+	audioHash, err := HashFile(audioPath)
+	if err != nil {
+		return "", err
+	}
+	return c.GenerateCacheKey(CacheTypeWhisper, audioHash, model), nil
+}
+
 // CacheWhisperResult cache kết quả Whisper
-func (c *CacheService) CacheWhisperResult(audioPath string, result *WhisperResult) error {
-	key := c.GenerateCacheKey(audioPath, "whisper")
-	return c.Set(key, result.SRTPath, "whisper", 24*time.Hour) // Cache 24 giờ
+func (c *CacheService) CacheWhisperResult(audioPath, model string, result *WhisperResult) error {
+	key, err := c.whisperCacheKey(audioPath, model)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(whisperCacheValue{Transcript: result.Transcript, Segments: result.Segments, SourceLanguage: result.SourceLanguage})
+	if err != nil {
+		return err
+	}
+	return c.SetBytes(key, data, ".json", CacheTypeWhisper, 7*24*time.Hour)
 }
 
-// GetCachedWhisperResult lấy kết quả Whisper từ cache
-func (c *CacheService) GetCachedWhisperResult(audioPath string) (*WhisperResult, error) {
-	key := c.GenerateCacheKey(audioPath, "whisper")
-	entry, err := c.Get(key)
+// GetCachedWhisperResult lấy kết quả Whisper từ cache theo nội dung audio (SRTPath để trống, caller tự tạo SRT)
+func (c *CacheService) GetCachedWhisperResult(audioPath, model string) (*WhisperResult, error) {
+	key, err := c.whisperCacheKey(audioPath, model)
 	if err != nil {
 		return nil, err
 	}
-
-	// Đọc SRT content
-	content, err := os.ReadFile(entry.Value)
+	entry, err := c.getTyped(key, CacheTypeWhisper)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse SRT để tạo segments (đơn giản hóa)
-	segments := []Segment{{Start: 0, End: 0, Text: string(content)}}
+	data, err := os.ReadFile(entry.Value)
+	if err != nil {
+		return nil, err
+	}
+	var value whisperCacheValue
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
 
 	return &WhisperResult{
-		Transcript: string(content),
-		Segments:   segments,
-		SRTPath:    entry.Value,
+		Transcript:     value.Transcript,
+		Segments:       value.Segments,
+		SourceLanguage: value.SourceLanguage,
 	}, nil
 }
 
-// CacheBackgroundResult cache kết quả background extraction
-func (c *CacheService) CacheBackgroundResult(audioPath string, backgroundPath string) error {
-	key := c.GenerateCacheKey(audioPath, "background")
-	return c.Set(key, backgroundPath, "background", 12*time.Hour) // Cache 12 giờ
+// backgroundCacheKey tạo key từ nội dung audio, model tách nguồn và stem
+func (c *CacheService) backgroundCacheKey(audioPath, stemType string) (string, error) {
+	audioHash, err := HashFile(audioPath)
+	if err != nil {
+		return "", err
+	}
+	return c.GenerateCacheKey(CacheTypeBackground, audioHash, "htdemucs", stemType), nil
+}
+
+// CacheBackgroundResult cache kết quả tách stem bằng Demucs
+func (c *CacheService) CacheBackgroundResult(audioPath, stemType, stemPath string) error {
+	key, err := c.backgroundCacheKey(audioPath, stemType)
+	if err != nil {
+		return err
+	}
+	return c.Set(key, stemPath, CacheTypeBackground, 7*24*time.Hour)
 }
 
-// GetCachedBackgroundResult lấy kết quả background từ cache
-func (c *CacheService) GetCachedBackgroundResult(audioPath string) (string, error) {
-	key := c.GenerateCacheKey(audioPath, "background")
-	entry, err := c.Get(key)
+// GetCachedBackgroundResult lấy stem từ cache và copy vào outputDir, trả về đường dẫn file đã copy
+func (c *CacheService) GetCachedBackgroundResult(audioPath, stemType, outputDir string) (string, error) {
+	key, err := c.backgroundCacheKey(audioPath, stemType)
+	if err != nil {
+		return "", err
+	}
+	entry, err := c.getTyped(key, CacheTypeBackground)
 	if err != nil {
 		return "", err
 	}
 
-	return entry.Value, nil
+	destPath := filepath.Join(outputDir, fmt.Sprintf("%d_cached_%s%s", time.Now().UnixNano(), stemType, filepath.Ext(entry.Value)))
+	if err := copyFile(entry.Value, destPath); err != nil {
+		return "", fmt.Errorf("failed to restore cached stem: %v", err)
+	}
+	return destPath, nil
+}
+
+// translationCacheKey tạo key từ nội dung SRT nguồn, ngôn ngữ đích và model dịch
+func (c *CacheService) translationCacheKey(srtContent, targetLanguage, model string) string {
+	return c.GenerateCacheKey(CacheTypeTranslation, HashBytes([]byte(srtContent)), targetLanguage, model)
+}
+
+// CacheTranslationResult cache SRT đã dịch
+func (c *CacheService) CacheTranslationResult(srtContent, targetLanguage, model, translatedContent string) error {
+	key := c.translationCacheKey(srtContent, targetLanguage, model)
+	return c.SetBytes(key, []byte(translatedContent), ".srt", CacheTypeTranslation, 30*24*time.Hour)
+}
+
+// GetCachedTranslation lấy SRT đã dịch từ cache
+func (c *CacheService) GetCachedTranslation(srtContent, targetLanguage, model string) (string, error) {
+	entry, err := c.getTyped(c.translationCacheKey(srtContent, targetLanguage, model), CacheTypeTranslation)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(entry.Value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ttsSegmentCacheKey tạo key từ text đã chuẩn hoá, giọng đọc, ngôn ngữ, tốc độ đọc và nhà cung cấp TTS
+func (c *CacheService) ttsSegmentCacheKey(provider, text, voiceName, languageCode string, speakingRate float64) string {
+	return c.GenerateCacheKey(CacheTypeTTSSegment, provider, NormalizeTTSText(text), voiceName, languageCode, fmt.Sprintf("%.3f", speakingRate))
+}
+
+// CacheTTSSegment cache audio (MP3) của một đoạn TTS
+func (c *CacheService) CacheTTSSegment(provider, text, voiceName, languageCode string, speakingRate float64, audio []byte) error {
+	key := c.ttsSegmentCacheKey(provider, text, voiceName, languageCode, speakingRate)
+	return c.SetBytes(key, audio, ".mp3", CacheTypeTTSSegment, 30*24*time.Hour)
+}
+
+// GetCachedTTSSegment lấy audio (MP3) của một đoạn TTS từ cache
+func (c *CacheService) GetCachedTTSSegment(provider, text, voiceName, languageCode string, speakingRate float64) ([]byte, error) {
+	entry, err := c.getTyped(c.ttsSegmentCacheKey(provider, text, voiceName, languageCode, speakingRate), CacheTypeTTSSegment)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(entry.Value)
+}
+
+// HasCachedTTSSegment kiểm tra đoạn TTS đã có trong cache chưa, không tính vào hit/miss và không cập nhật LRU
+func (c *CacheService) HasCachedTTSSegment(provider, text, voiceName, languageCode string, speakingRate float64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, err := c.readEntry(c.ttsSegmentCacheKey(provider, text, voiceName, languageCode, speakingRate))
+	if err != nil || time.Now().After(entry.ExpiresAt) {
+		return false
+	}
+	_, err = os.Stat(entry.Value)
+	return err == nil
+}
+
+// TranslateSRTWithCache dịch file SRT với cache theo nội dung SRT nguồn + ngôn ngữ đích + model (+ glossary nếu có).
+// memory khác nil thì cue có trong translation memory được điền sẵn và kết quả được lưu lại vào memory
+// sourceLanguage rỗng thì detect từ nội dung SRT; nguồn trùng ngôn ngữ đích thì trả về nguyên SRT, không gọi LLM
+func TranslateSRTWithCache(srtFilePath, apiKey, modelName, sourceLanguage, targetLanguage string, glossary []model.GlossaryTerm, memory *TranslationMemoryContext) (string, error) {
+	cache := GetCacheService()
+	srtContent, err := os.ReadFile(srtFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read SRT file: %v", err)
+	}
+
+	if sourceLanguage == "" {
+		sourceLanguage = ResolveSourceLanguage("", extractTextFromSRT(string(srtContent)))
+	}
+	if IsSameLanguage(sourceLanguage, targetLanguage) {
+		log.Printf("Source language %s equals target, skipping translation for %s", sourceLanguage, srtFilePath)
+		return string(srtContent), nil
+	}
+
+	// Glossary khác nhau cho ra bản dịch khác nhau nên phải nằm trong key cache
+	cacheModel := modelName
+	if fingerprint := GlossaryFingerprint(glossary); fingerprint != "" {
+		cacheModel = modelName + ":glossary:" + fingerprint
+	}
+
+	if cached, err := cache.GetCachedTranslation(string(srtContent), targetLanguage, cacheModel); err == nil {
+		log.Printf("Using cached translation for %s (%s, %s)", srtFilePath, targetLanguage, modelName)
+		memory.Record(string(srtContent), cached)
+		return cached, nil
+	}
+
+	translated, err := TranslateSRTWithContextAwareness(srtFilePath, apiKey, modelName, sourceLanguage, targetLanguage, glossary, memory)
+	if err != nil {
+		return "", err
+	}
+	if err := cache.CacheTranslationResult(string(srtContent), targetLanguage, cacheModel, translated); err != nil {
+		log.Printf("Failed to cache translation: %v", err)
+	}
+	memory.Record(string(srtContent), translated)
+	return translated, nil
+}
+
+// TranscribeWithServiceCached transcribe audio với cache theo nội dung audio + service/model
+func TranscribeWithServiceCached(filePath, apiKey, serviceName, modelAPIName string) (string, []Segment, *WhisperUsage, error) {
+	result, usage, err := TranscribeWithServiceCachedResult(filePath, apiKey, serviceName, modelAPIName)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return result.Transcript, result.Segments, usage, nil
+}
+
+// TranscribeWithServiceCachedResult giống TranscribeWithServiceCached nhưng trả về WhisperResult (kèm ngôn ngữ nguồn)
+func TranscribeWithServiceCachedResult(filePath, apiKey, serviceName, modelAPIName string) (*WhisperResult, *WhisperUsage, error) {
+	cache := GetCacheService()
+	model := serviceName + ":" + modelAPIName
+	if cached, err := cache.GetCachedWhisperResult(filePath, model); err == nil {
+		log.Printf("Using cached transcription for %s", filePath)
+		return &WhisperResult{Transcript: cached.Transcript, Segments: cached.Segments, SourceLanguage: cached.SourceLanguage}, nil, nil
+	}
+
+	result, usage, err := TranscribeWithServiceResult(filePath, apiKey, serviceName, modelAPIName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cache.CacheWhisperResult(filePath, model, &WhisperResult{Transcript: result.Transcript, Segments: result.Segments, SourceLanguage: result.SourceLanguage}); err != nil {
+		log.Printf("Failed to cache transcription: %v", err)
+	}
+	return result, usage, nil
 }
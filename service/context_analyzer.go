@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"creator-tool-backend/model"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,6 +23,28 @@ type ContextAnalysisResult struct {
 	AnalysisTime time.Duration          `json:"analysis_time"`
 }
 
+// ApplyUserGlossary gộp glossary của user vào kết quả phân tích, term của user ghi đè term LLM tự suy ra
+func (r *ContextAnalysisResult) ApplyUserGlossary(terms []model.GlossaryTerm) {
+	if len(terms) == 0 {
+		return
+	}
+	if r.Glossary == nil {
+		r.Glossary = make(map[string]string)
+	}
+	for _, term := range terms {
+		for existing := range r.Glossary {
+			if strings.EqualFold(existing, term.Term) {
+				delete(r.Glossary, existing)
+			}
+		}
+		if term.DoNotTranslate {
+			r.Glossary[term.Term] = term.Term + " (giữ nguyên, không dịch)"
+		} else {
+			r.Glossary[term.Term] = term.Translation
+		}
+	}
+}
+
 // PronounRule quy tắc xưng hô cho một nhân vật
 type PronounRule struct {
 	Self        string            `json:"self"`         // Cách nhân vật tự xưng
@@ -225,7 +248,8 @@ func (ca *ContextAnalyzer) parseContextAnalysisResponse(content string) (*Contex
 }
 
 // GenerateContextAwarePrompt tạo prompt với context awareness
-func (ca *ContextAnalyzer) GenerateContextAwarePrompt(contextResult *ContextAnalysisResult, targetLanguage string) string {
+// sourceLanguage rỗng thì để model tự nhận biết ngôn ngữ nguồn
+func (ca *ContextAnalyzer) GenerateContextAwarePrompt(contextResult *ContextAnalysisResult, sourceLanguage, targetLanguage string) string {
 	languageMap := map[string]string{
 		"vi": "Tiếng Việt", "en": "Tiếng Anh", "ja": "Tiếng Nhật",
 		"ko": "Tiếng Hàn", "zh": "Tiếng Trung", "fr": "Tiếng Pháp",
@@ -240,6 +264,9 @@ func (ca *ContextAnalyzer) GenerateContextAwarePrompt(contextResult *ContextAnal
 	// Tạo context rules string
 	var contextRules strings.Builder
 	contextRules.WriteString(fmt.Sprintf("NGỮ CẢNH ĐÃ PHÂN TÍCH:\n"))
+	if clause := sourceLanguageClause(sourceLanguage); clause != "" {
+		contextRules.WriteString(fmt.Sprintf("- Ngôn ngữ gốc: %s\n", strings.TrimPrefix(clause, " từ ")))
+	}
 	contextRules.WriteString(fmt.Sprintf("- Ngôn ngữ đích: %s\n", languageName))
 	contextRules.WriteString(fmt.Sprintf("- Mối quan hệ: %s\n", contextResult.Relationship))
 
@@ -262,17 +289,16 @@ func (ca *ContextAnalyzer) GenerateContextAwarePrompt(contextResult *ContextAnal
 		}
 	}
 
-	return fmt.Sprintf(`Hãy dịch phần SRT sau sang %s, tối ưu hóa đặc biệt cho Text-to-Speech (TTS).
+	return fmt.Sprintf(`Hãy dịch các câu thoại phụ đề sau%s sang %s, tối ưu hóa đặc biệt cho Text-to-Speech (TTS).
 
 %s
 
 TUÂN THỦ NGHIÊM NGẶT CÁC QUY TẮC SAU:
-QUY TẮC 1: TIMESTAMP VÀ SỐ THỨ TỰ LÀ BẤT BIẾN
-Giữ nguyên 100%% số thứ tự và dòng thời gian (timestamps) từ file gốc.
-TUYỆT ĐỐI KHÔNG được thay đổi, làm tròn, hay "sửa lỗi" thời gian.
+QUY TẮC 1: ID LÀ BẤT BIẾN
+Mỗi câu có một id. Giữ nguyên 100%% id, mỗi id trả về đúng một câu dịch.
 
 QUY TẮC 2: ƯU TIÊN HÀNG ĐẦU LÀ ĐỘ DÀI CÂU DỊCH
-Ngắn gọn là Vua: Câu dịch phải đủ ngắn để đọc xong trong khoảng thời gian của timestamp.
+Ngắn gọn là Vua: Câu dịch phải đủ ngắn để đọc xong trong thời lượng duration của câu.
 Áp dụng quy tắc Ký tự/Giây (CPS): Cố gắng giữ cho câu dịch không vượt quá 17 ký tự cho mỗi giây thời lượng.
 
 QUY TẮC 3: ÁP DỤNG QUY TẮC XƯNG HÔ ĐÃ PHÂN TÍCH
@@ -282,11 +308,11 @@ TUYỆT ĐỐI TUÂN THỦ quy tắc xưng hô đã được phân tích ở tr
 QUY TẮC 4: SỬ DỤNG THUẬT NGỮ THỐNG NHẤT
 Áp dụng chính xác các thuật ngữ đã được định nghĩa trong phần phân tích ngữ cảnh.
 
-QUY TẮC 5: QUẢ TRẢ VỀ LUÔN LÀ ĐỊNH DẠNG SRT
-Kết quả trả về chỉ là nội dung file srt, không thêm bất kỳ ghi chú hay giải thích nào khác.
+QUY TẮC 5: KẾT QUẢ TRẢ VỀ LUÔN LÀ JSON
+%s
 QUY TẮC 6: XỬ LÝ ĐẠI TỪ NHÂN XƯNG CÓ LỰA CHỌN
 Khi quy tắc xưng hô cung cấp một lựa chọn (ví dụ: 'thầy/cô', 'tôi/em' ...), bạn BẮT BUỘC PHẢI CHỌN MỘT phương án phù hợp nhất với ngữ cảnh của câu thoại đó. TUYỆT ĐỐI KHÔNG được viết cả hai lựa chọn cách nhau bằng dấu gạch chéo trong câu dịch.
 
-Phần SRT cần dịch:
-{{SRT_CONTENT}}`, languageName, contextRules.String())
+Các câu cần dịch:
+{{CUES_JSON}}`, sourceLanguageClause(sourceLanguage), languageName, contextRules.String(), jsonCueOutputRule)
 }
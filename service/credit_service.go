@@ -91,6 +91,12 @@ func (s *CreditService) LockCredits(userID uint, amount float64, service, descri
 		return 0, fmt.Errorf("insufficient credits: available %.2f, required %.2f", availableCredits, amount)
 	}
 
+	// Kiểm tra hạn mức chi tiêu ngày/tháng user tự đặt (chỉ chặn khi bật auto-stop)
+	if err := NewSpendingService(config.Db).checkCap(tx, userID, userCredits.LockedCredits, amount); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
 	// Cập nhật locked credits
 	err = tx.Model(&userCredits).Update("locked_credits", userCredits.LockedCredits+amount).Error
 	if err != nil {
@@ -122,6 +128,7 @@ func (s *CreditService) LockCredits(userID uint, amount float64, service, descri
 		return 0, fmt.Errorf("failed to commit lock transaction: %v", err)
 	}
 
+	NewSpendingService(config.Db).CheckAlerts(userID)
 	return transaction.ID, nil
 }
 
@@ -184,18 +191,11 @@ func (s *CreditService) DeductCredits(userID uint, baseAmount float64, service,
 	}()
 
 	// Tính final amount với markup (chuẩn hóa tên service để áp dụng đúng markup nhóm)
-	pricingService := NewPricingService()
-	markupService := normalizeServiceForMarkup(service)
-	finalAmount, err := pricingService.CalculateUserPrice(baseAmount, markupService, userID)
-	if err != nil {
-		// Fallback to base amount nếu có lỗi
-		finalAmount = baseAmount
-		log.Printf("Error calculating markup for %s, using base amount: %v", service, err)
-	}
+	finalAmount := s.FinalAmount(userID, baseAmount, service)
 
 	// Cập nhật used credits và giảm locked credits
 	var userCredits config.UserCredits
-	err = tx.Where("user_id = ?", userID).First(&userCredits).Error
+	err := tx.Where("user_id = ?", userID).First(&userCredits).Error
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to get user credits: %v", err)
@@ -241,7 +241,22 @@ func (s *CreditService) DeductCredits(userID uint, baseAmount float64, service,
 	log.Printf("Deducted %.6f credits (base: %.6f, markup: %.6f) from user %d for %s",
 		finalAmount, baseAmount, markupAmount, userID, service)
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	NewSpendingService(config.Db).CheckAlerts(userID)
+	return nil
+}
+
+// FinalAmount tính số credit thực trừ (đã áp markup) cho baseAmount, giống DeductCredits
+func (s *CreditService) FinalAmount(userID uint, baseAmount float64, service string) float64 {
+	finalAmount, err := NewPricingService().CalculateUserPrice(baseAmount, normalizeServiceForMarkup(service), userID)
+	if err != nil {
+		// Fallback to base amount nếu có lỗi
+		log.Printf("Error calculating markup for %s, using base amount: %v", service, err)
+		return baseAmount
+	}
+	return finalAmount
 }
 
 // normalizeServiceForMarkup chuẩn hóa tên service con về nhóm để tính markup đúng
@@ -266,13 +281,27 @@ func normalizeServiceForMarkup(service string) string {
 
 // AddCredits thêm credit cho user
 func (s *CreditService) AddCredits(userID uint, amount float64, description, referenceID string) error {
-	tx := config.Db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	return s.addCredits(userID, amount, "topup", description, referenceID)
+}
+
+// AddBonusCredits thêm credit thưởng (gói nạp, mã khuyến mãi, nạp lần đầu) thành transaction riêng với service "bonus"
+func (s *CreditService) AddBonusCredits(userID uint, amount float64, description, referenceID string) error {
+	return s.addCredits(userID, amount, "bonus", description, referenceID)
+}
 
+func (s *CreditService) addCredits(userID uint, amount float64, service, description, referenceID string) error {
+	err := config.Db.Transaction(func(tx *gorm.DB) error {
+		return s.addCreditsTx(tx, userID, amount, service, description, referenceID)
+	})
+	if err != nil {
+		return err
+	}
+	NewSpendingService(config.Db).CheckAlerts(userID)
+	return nil
+}
+
+// addCreditsTx là addCredits trong transaction của người gọi (vd thưởng giới thiệu cùng với cập nhật trạng thái lượt giới thiệu)
+func (s *CreditService) addCreditsTx(tx *gorm.DB, userID uint, amount float64, service, description, referenceID string) error {
 	// Tìm hoặc tạo user credits
 	var userCredits config.UserCredits
 	err := tx.Where("user_id = ?", userID).First(&userCredits).Error
@@ -286,7 +315,6 @@ func (s *CreditService) AddCredits(userID uint, amount float64, description, ref
 			}
 			err = tx.Create(&userCredits).Error
 		} else {
-			tx.Rollback()
 			return fmt.Errorf("failed to get user credits: %v", err)
 		}
 	} else {
@@ -295,7 +323,6 @@ func (s *CreditService) AddCredits(userID uint, amount float64, description, ref
 	}
 
 	if err != nil {
-		tx.Rollback()
 		return fmt.Errorf("failed to update user credits: %v", err)
 	}
 
@@ -304,20 +331,69 @@ func (s *CreditService) AddCredits(userID uint, amount float64, description, ref
 		UserID:            userID,
 		TransactionType:   "add",
 		Amount:            amount,
-		Service:           "topup",
+		Service:           service,
 		Description:       description,
 		ReferenceID:       referenceID,
 		TransactionStatus: "completed",
 		CreatedAt:         time.Now(),
 	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		return fmt.Errorf("failed to create add transaction: %v", err)
+	}
+	return nil
+}
 
-	err = tx.Create(&transaction).Error
+// ChargeCredits trừ thẳng credit khả dụng (không lock, không markup), dùng cho khoản phí cố định như mua gói subscription
+func (s *CreditService) ChargeCredits(userID uint, amount float64, service, description, referenceID string) error {
+	err := config.Db.Transaction(func(tx *gorm.DB) error {
+		return s.chargeCredits(tx, userID, amount, service, description, referenceID)
+	})
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to create add transaction: %v", err)
+		return err
 	}
+	NewSpendingService(config.Db).CheckAlerts(userID)
+	return nil
+}
 
-	return tx.Commit().Error
+// chargeCredits là ChargeCredits trong transaction của người gọi (vd gia hạn gói cùng với cập nhật thời hạn)
+func (s *CreditService) chargeCredits(tx *gorm.DB, userID uint, amount float64, service, description, referenceID string) error {
+	var userCredits config.UserCredits
+	err := tx.Where("user_id = ?", userID).First(&userCredits).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("insufficient credits: available 0.00, required %.2f", amount)
+		}
+		return fmt.Errorf("failed to get user credits: %v", err)
+	}
+
+	availableCredits := userCredits.TotalCredits - userCredits.UsedCredits - userCredits.LockedCredits
+	if availableCredits < amount {
+		return fmt.Errorf("insufficient credits: available %.2f, required %.2f", availableCredits, amount)
+	}
+
+	err = tx.Model(&userCredits).Update("used_credits", userCredits.UsedCredits+amount).Error
+	if err != nil {
+		return fmt.Errorf("failed to charge credits: %v", err)
+	}
+
+	transaction := config.CreditTransaction{
+		UserID:            userID,
+		TransactionType:   "deduct",
+		Amount:            amount,
+		BaseAmount:        amount,
+		Service:           service,
+		Description:       description,
+		PricingType:       "fixed",
+		UnitsUsed:         1,
+		TransactionStatus: "completed",
+		ReferenceID:       referenceID,
+		CreatedAt:         time.Now(),
+	}
+
+	if err := tx.Create(&transaction).Error; err != nil {
+		return fmt.Errorf("failed to create charge transaction: %v", err)
+	}
+	return nil
 }
 
 // RefundCredits hoàn tiền khi có lỗi
@@ -366,7 +442,11 @@ func (s *CreditService) RefundCredits(userID uint, amount float64, service, desc
 		return fmt.Errorf("failed to create refund transaction: %v", err)
 	}
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	NewSpendingService(config.Db).CheckAlerts(userID)
+	return nil
 }
 
 // GetTransactionHistory lấy lịch sử giao dịch
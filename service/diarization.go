@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+)
+
+// SpeakerTurn là một đoạn nói của một người trong kết quả diarization
+type SpeakerTurn struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker"`
+	Gender  string  `json:"gender,omitempty"` // Tuỳ CLI, rỗng = không xác định
+}
+
+// DiarizeAudio chạy CLI diarization (DIARIZATION_CMD, mặc định pyannote-diarize) trên file audio.
+// CLI in ra JSON [{start, end, speaker, gender}] hoặc RTTM chuẩn của pyannote
+func DiarizeAudio(audioPath string) ([]SpeakerTurn, error) {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if cfg.DiarizationCmd == "" {
+		return nil, fmt.Errorf("diarization command is not configured")
+	}
+
+	cmdPath, err := exec.LookPath(cfg.DiarizationCmd)
+	if err != nil {
+		return nil, fmt.Errorf("diarization command %q not found: %v", cfg.DiarizationCmd, err)
+	}
+
+	timeout := time.Duration(cfg.DiarizationTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log.Printf("🗣️ [DIARIZATION] Running %s on %s", cmdPath, audioPath)
+	cmd := exec.CommandContext(ctx, cmdPath, audioPath)
+	cmd.Env = append(os.Environ(), "PATH=/Library/Frameworks/Python.framework/Versions/3.11/bin:"+os.Getenv("PATH"))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("diarization failed: %v, output: %s", err, stderr.String())
+	}
+
+	turns, err := parseDiarizationOutput(string(output))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🗣️ [DIARIZATION] %d turns, %d speakers", len(turns), len(speakerLabels(turns)))
+	return turns, nil
+}
+
+// parseDiarizationOutput đọc output JSON hoặc RTTM ("SPEAKER <file> 1 <start> <duration> <NA> <NA> <speaker> <NA> <NA>")
+func parseDiarizationOutput(output string) ([]SpeakerTurn, error) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return nil, fmt.Errorf("diarization returned no output")
+	}
+
+	var turns []SpeakerTurn
+	if strings.HasPrefix(output, "[") {
+		if err := json.Unmarshal([]byte(output), &turns); err != nil {
+			return nil, fmt.Errorf("invalid diarization JSON: %v", err)
+		}
+	} else {
+		scanner := bufio.NewScanner(strings.NewReader(output))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 8 || fields[0] != "SPEAKER" {
+				continue
+			}
+			start, err1 := strconv.ParseFloat(fields[3], 64)
+			duration, err2 := strconv.ParseFloat(fields[4], 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			turns = append(turns, SpeakerTurn{Start: start, End: start + duration, Speaker: fields[7]})
+		}
+	}
+
+	valid := turns[:0]
+	for _, turn := range turns {
+		if turn.Speaker != "" && turn.End > turn.Start {
+			turn.Gender = strings.ToLower(turn.Gender)
+			valid = append(valid, turn)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("diarization returned no speaker turns")
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].Start < valid[j].Start })
+	return valid, nil
+}
+
+func speakerLabels(turns []SpeakerTurn) map[string]bool {
+	labels := make(map[string]bool)
+	for _, turn := range turns {
+		labels[turn.Speaker] = true
+	}
+	return labels
+}
+
+// AssignSpeakers gán nhãn người nói cho từng segment theo đoạn nói trùng thời gian nhiều nhất
+func AssignSpeakers(segments []Segment, turns []SpeakerTurn) []Segment {
+	result := make([]Segment, len(segments))
+	for i, segment := range segments {
+		result[i] = segment
+		overlaps := make(map[string]float64)
+		for _, turn := range turns {
+			if turn.Start >= segment.End {
+				break
+			}
+			if overlap := math.Min(turn.End, segment.End) - math.Max(turn.Start, segment.Start); overlap > 0 {
+				overlaps[turn.Speaker] += overlap
+			}
+		}
+		best := 0.0
+		for speaker, overlap := range overlaps {
+			if overlap > best || (overlap == best && speaker < result[i].Speaker) {
+				best = overlap
+				result[i].Speaker = speaker
+			}
+		}
+	}
+	return result
+}
+
+// ResolveSpeakerVoices gán giọng cho từng người nói: speaker_voices của user (nếu đúng ngôn ngữ đích) → giọng mặc định theo giới tính.
+// Người nói nhiều nhất dùng defaultVoice (voice_name của request); giới tính chưa biết thì xen kẽ nữ/nam để các người nói nghe khác nhau
+func ResolveSpeakerVoices(segments []Segment, turns []SpeakerTurn, targetLanguage, defaultVoice string, userVoices map[string]string) []model.SpeakerVoice {
+	genders := make(map[string]string)
+	for _, turn := range turns {
+		if turn.Gender == "male" || turn.Gender == "female" {
+			genders[turn.Speaker] = turn.Gender
+		}
+	}
+
+	stats := make(map[string]*model.SpeakerVoice)
+	var speakers []*model.SpeakerVoice
+	for _, segment := range segments {
+		if segment.Speaker == "" {
+			continue
+		}
+		speaker, ok := stats[segment.Speaker]
+		if !ok {
+			speaker = &model.SpeakerVoice{Speaker: segment.Speaker, Gender: genders[segment.Speaker]}
+			stats[segment.Speaker] = speaker
+			speakers = append(speakers, speaker)
+		}
+		speaker.CueCount++
+		speaker.SpeakingTime += segment.End - segment.Start
+	}
+	sort.SliceStable(speakers, func(i, j int) bool { return speakers[i].SpeakingTime > speakers[j].SpeakingTime })
+
+	languageVoices := GetAvailableVoices()[targetLanguage]
+	voiceGender := make(map[string]string)
+	for _, voice := range languageVoices {
+		voiceGender[voice.Name] = voice.Gender
+	}
+	used := make(map[string]bool)
+	pickVoice := func(gender string) string {
+		// Ưu tiên giọng wavenet chưa dùng cùng giới tính
+		for _, quality := range []string{"wavenet", "standard", ""} {
+			for _, voice := range languageVoices {
+				if voice.Gender == gender && !used[voice.Name] && (quality == "" || voice.Quality == quality) {
+					return voice.Name
+				}
+			}
+		}
+		// Hết giọng chưa dùng thì dùng lại
+		for _, voice := range languageVoices {
+			if voice.Gender == gender {
+				return voice.Name
+			}
+		}
+		_, voice := getVoiceForLanguage(targetLanguage)
+		return voice
+	}
+
+	nextGender := "female"
+	result := make([]model.SpeakerVoice, 0, len(speakers))
+	for i, speaker := range speakers {
+		voice := ""
+		if userVoice := userVoices[speaker.Speaker]; userVoice != "" && voiceGender[userVoice] != "" {
+			voice = userVoice
+		} else if i == 0 && defaultVoice != "" && voiceGender[defaultVoice] != "" && (speaker.Gender == "" || speaker.Gender == voiceGender[defaultVoice]) {
+			voice = defaultVoice
+		} else {
+			gender := speaker.Gender
+			if gender == "" {
+				gender = nextGender
+			}
+			voice = pickVoice(gender)
+		}
+		if voiceGender[voice] == "female" {
+			nextGender = "male"
+		} else {
+			nextGender = "female"
+		}
+		used[voice] = true
+		speaker.VoiceName = voice
+		result = append(result, *speaker)
+	}
+	return result
+}
+
+// BuildCueVoices trả về giọng cho từng cue SRT (số thứ tự bắt đầu từ 1, khớp createSRT) theo người nói của segment
+func BuildCueVoices(segments []Segment, speakers []model.SpeakerVoice) map[int]string {
+	if len(speakers) == 0 {
+		return nil
+	}
+	voices := make(map[string]string, len(speakers))
+	for _, speaker := range speakers {
+		voices[speaker.Speaker] = speaker.VoiceName
+	}
+	cueVoices := make(map[int]string)
+	for i, segment := range segments {
+		if voice := voices[segment.Speaker]; voice != "" {
+			cueVoices[i+1] = voice
+		}
+	}
+	return cueVoices
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+const (
+	mailboxModeIdle = "idle"
+	mailboxModePoll = "poll"
+	mailboxModeStub = "stub"
+
+	// Lần đầu kết nối (chưa có UID) chỉ đọc mail trong khoảng này, mail đã xử lý được bỏ qua nhờ sổ giao dịch
+	emailInitialLookback = time.Hour
+	imapCommandTimeout   = time.Minute
+)
+
+// mailMessage là một mail thô trong hộp thư, UID tăng dần theo thứ tự nhận
+type mailMessage struct {
+	UID uint32
+	Raw []byte
+}
+
+// mailbox là nguồn mail của EmailMonitoringService: IMAP thật hoặc thư mục .eml khi chạy local
+type mailbox interface {
+	Connect() error
+	// FetchSince lấy mail có UID > lastUID theo thứ tự UID; lastUID = 0 lấy mail gần đây (emailInitialLookback)
+	FetchSince(lastUID uint32) ([]mailMessage, error)
+	// WaitForUpdate chờ tới khi có mail mới, hết timeout hoặc stop bị đóng; trả lỗi khi mất kết nối
+	WaitForUpdate(timeout time.Duration, stop <-chan struct{}) error
+	// Validity đổi (UIDVALIDITY) nghĩa là UID đã lưu không còn dùng được
+	Validity() uint32
+	Mode() string
+	Close() error
+}
+
+// imapMailbox đọc mail qua IMAP, dùng IDLE nếu server hỗ trợ, ngược lại NOOP theo PollInterval
+type imapMailbox struct {
+	cfg      EmailConfig
+	client   *client.Client
+	updates  chan client.Update
+	newMail  chan struct{}
+	validity uint32
+	idle     bool
+}
+
+func newIMAPMailbox(cfg EmailConfig) *imapMailbox {
+	return &imapMailbox{cfg: cfg}
+}
+
+func (m *imapMailbox) Connect() error {
+	addr := fmt.Sprintf("%s:%d", m.cfg.Host, m.cfg.Port)
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var c *client.Client
+	var err error
+	if m.cfg.SSL {
+		c, err = client.DialWithDialerTLS(dialer, addr, nil)
+	} else {
+		c, err = client.DialWithDialer(dialer, addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to mail server: %v", err)
+	}
+	c.Timeout = imapCommandTimeout
+
+	if err := c.Login(m.cfg.Username, m.cfg.Password); err != nil {
+		c.Terminate()
+		return fmt.Errorf("failed to login: %v", err)
+	}
+
+	status, err := c.Select(m.cfg.Mailbox, true)
+	if err != nil {
+		c.Logout()
+		return fmt.Errorf("failed to select %s: %v", m.cfg.Mailbox, err)
+	}
+
+	idle, err := c.Support("IDLE")
+	if err != nil {
+		c.Logout()
+		return fmt.Errorf("failed to read server capabilities: %v", err)
+	}
+
+	// Client bị chặn nếu không ai đọc Updates: chuyển tiếp EXISTS/RECENT thành tín hiệu có mail mới
+	m.updates = make(chan client.Update, 32)
+	m.newMail = make(chan struct{}, 1)
+	c.Updates = m.updates
+	go func(updates <-chan client.Update, newMail chan<- struct{}) {
+		for update := range updates {
+			if _, ok := update.(*client.MailboxUpdate); ok {
+				select {
+				case newMail <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}(m.updates, m.newMail)
+
+	m.client = c
+	m.validity = status.UidValidity
+	m.idle = idle
+	return nil
+}
+
+func (m *imapMailbox) FetchSince(lastUID uint32) ([]mailMessage, error) {
+	if m.client == nil {
+		return nil, fmt.Errorf("not connected to mail server")
+	}
+
+	criteria := imap.NewSearchCriteria()
+	if lastUID == 0 {
+		criteria.Since = time.Now().Add(-emailInitialLookback)
+	} else {
+		uidRange := new(imap.SeqSet)
+		uidRange.AddRange(lastUID+1, 0) // 0 = "*"
+		criteria.Uid = uidRange
+	}
+	uids, err := m.client.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search emails: %v", err)
+	}
+
+	// "n:*" luôn trả về mail cuối cùng kể cả khi UID của nó < n
+	uidSet := new(imap.SeqSet)
+	for _, uid := range uids {
+		if uid > lastUID {
+			uidSet.AddNum(uid)
+		}
+	}
+	if uidSet.Empty() {
+		return nil, nil
+	}
+
+	// BODY.PEEK[] để không đánh dấu đã đọc trên hộp thư
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- m.client.UidFetch(uidSet, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	var result []mailMessage
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			log.Printf("Failed to read email UID %d: %v", msg.Uid, err)
+			continue
+		}
+		result = append(result, mailMessage{UID: msg.Uid, Raw: raw})
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("failed to fetch emails: %v", err)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].UID < result[j].UID })
+	return result, nil
+}
+
+func (m *imapMailbox) WaitForUpdate(timeout time.Duration, stop <-chan struct{}) error {
+	if m.client == nil {
+		return fmt.Errorf("not connected to mail server")
+	}
+
+	stopIdle := make(chan struct{})
+	idleDone := make(chan error, 1)
+	go func() {
+		idleDone <- m.client.Idle(stopIdle, &client.IdleOptions{PollInterval: m.cfg.PollInterval})
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-m.newMail:
+	case <-timer.C:
+	case <-stop:
+	case err := <-idleDone:
+		// IDLE chỉ tự kết thúc khi mất kết nối
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+		return fmt.Errorf("idle failed: %v", err)
+	}
+
+	close(stopIdle)
+	if err := <-idleDone; err != nil {
+		return fmt.Errorf("idle failed: %v", err)
+	}
+	return nil
+}
+
+func (m *imapMailbox) Validity() uint32 {
+	return m.validity
+}
+
+func (m *imapMailbox) Mode() string {
+	if m.idle {
+		return mailboxModeIdle
+	}
+	return mailboxModePoll
+}
+
+func (m *imapMailbox) Close() error {
+	if m.client == nil {
+		return nil
+	}
+	c := m.client
+	m.client = nil
+
+	err := c.Logout()
+	if err != nil {
+		c.Terminate()
+	}
+	select {
+	case <-c.LoggedOut():
+		close(m.updates)
+	case <-time.After(imapCommandTimeout):
+		log.Printf("Timed out waiting for IMAP connection to close")
+	}
+	return err
+}
+
+// stubMailbox đọc mail từ thư mục file .eml thay cho IMAP server (EMAIL_IMAP_HOST=stub:<dir>), chỉ là dev shim khi chạy local:
+// không đi qua IMAP client, IDLE hay reconnect/backoff nên không dùng để kiểm tra các luồng đó.
+// UID là thứ tự file theo tên, file mới phải có tên xếp sau các file đã có
+type stubMailbox struct {
+	dir          string
+	pollInterval time.Duration
+}
+
+func newStubMailbox(dir string, pollInterval time.Duration) *stubMailbox {
+	return &stubMailbox{dir: dir, pollInterval: pollInterval}
+}
+
+func (m *stubMailbox) Connect() error {
+	info, err := os.Stat(m.dir)
+	if err != nil {
+		return fmt.Errorf("failed to open stub mailbox: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("stub mailbox %s is not a directory", m.dir)
+	}
+	return nil
+}
+
+func (m *stubMailbox) FetchSince(lastUID uint32) ([]mailMessage, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stub mailbox: %v", err)
+	}
+
+	var result []mailMessage
+	var uid uint32
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".eml") {
+			continue
+		}
+		uid++
+		if uid <= lastUID {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(m.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", entry.Name(), err)
+		}
+		result = append(result, mailMessage{UID: uid, Raw: raw})
+	}
+	return result, nil
+}
+
+func (m *stubMailbox) WaitForUpdate(timeout time.Duration, stop <-chan struct{}) error {
+	if m.pollInterval > 0 && m.pollInterval < timeout {
+		timeout = m.pollInterval
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+	return nil
+}
+
+func (m *stubMailbox) Validity() uint32 {
+	return 1
+}
+
+func (m *stubMailbox) Mode() string {
+	return mailboxModeStub
+}
+
+func (m *stubMailbox) Close() error {
+	return nil
+}
@@ -3,29 +3,46 @@ package service
 import (
 	"fmt"
 	"log"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"creator-tool-backend/config"
 
-	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/client"
+	"github.com/shopspring/decimal"
 )
 
-// EmailMonitoringService quản lý việc đọc mail xác nhận thanh toán
+const (
+	emailMonitorMinBackoff = 5 * time.Second
+	emailMonitorMaxBackoff = 5 * time.Minute
+	// Dù có IDLE vẫn đọc lại định kỳ phòng server không gửi thông báo mail mới
+	emailMonitorRecheckInterval = 5 * time.Minute
+)
+
+// EmailMonitoringService theo dõi hộp thư nhận mail biến động số dư và ghi nhận thanh toán.
+// Worker tự kết nối lại (backoff 5s → 5m) khi mất kết nối; mail được đọc theo EmailTemplate admin cấu hình
 type EmailMonitoringService struct {
-	client      *client.Client
 	emailConfig EmailConfig
+	mailbox     mailbox
+	templates   *EmailTemplateService
+	stop        chan struct{}
+	stopOnce    sync.Once
+
+	mu       sync.Mutex
+	status   EmailMonitorStatus
+	lastUID  uint32
+	validity uint32
 }
 
 // EmailConfig cấu hình email
 type EmailConfig struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
-	SSL      bool
+	Host         string // "stub:<thư mục .eml>" để đọc mail từ file khi chạy local (dev shim, không phải IMAP)
+	Port         int
+	Username     string
+	Password     string
+	SSL          bool
+	Mailbox      string
+	PollInterval time.Duration // Chu kỳ NOOP khi server không hỗ trợ IDLE
 }
 
 // PaymentConfirmation thông tin xác nhận thanh toán từ mail
@@ -38,298 +55,291 @@ type PaymentConfirmation struct {
 	ReceivedAt    time.Time
 }
 
+// EmailMonitorStatus trạng thái worker đọc mail cho trang admin
+type EmailMonitorStatus struct {
+	Running             bool       `json:"running"`
+	Connected           bool       `json:"connected"`
+	Mode                string     `json:"mode,omitempty"` // idle, poll, stub
+	Host                string     `json:"host,omitempty"`
+	Mailbox             string     `json:"mailbox,omitempty"`
+	LastUID             uint32     `json:"last_uid"`
+	LastConnectedAt     *time.Time `json:"last_connected_at"`
+	LastCheckedAt       *time.Time `json:"last_checked_at"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	NextRetryAt         *time.Time `json:"next_retry_at"`
+	MatchedEmails       int64      `json:"matched_emails"` // Mail khớp template từ khi khởi động
+}
+
+var (
+	emailMonitorMu sync.Mutex
+	emailMonitor   *EmailMonitoringService
+)
+
 // NewEmailMonitoringService tạo instance mới
-func NewEmailMonitoringService(config EmailConfig) *EmailMonitoringService {
-	return &EmailMonitoringService{
-		emailConfig: config,
+func NewEmailMonitoringService(emailConfig EmailConfig) *EmailMonitoringService {
+	if emailConfig.Mailbox == "" {
+		emailConfig.Mailbox = "INBOX"
+	}
+	if emailConfig.PollInterval <= 0 {
+		emailConfig.PollInterval = 30 * time.Second
 	}
-}
 
-// ConnectIMAP kết nối đến mail server
-func (s *EmailMonitoringService) ConnectIMAP() error {
-	var err error
-	if s.emailConfig.SSL {
-		s.client, err = client.DialTLS(fmt.Sprintf("%s:%d", s.emailConfig.Host, s.emailConfig.Port), nil)
+	var box mailbox
+	if dir, ok := strings.CutPrefix(emailConfig.Host, "stub:"); ok {
+		box = newStubMailbox(dir, emailConfig.PollInterval)
 	} else {
-		s.client, err = client.Dial(fmt.Sprintf("%s:%d", s.emailConfig.Host, s.emailConfig.Port))
-	}
-	if err != nil {
-		return fmt.Errorf("failed to connect to mail server: %v", err)
+		box = newIMAPMailbox(emailConfig)
 	}
 
-	// Login
-	err = s.client.Login(s.emailConfig.Username, s.emailConfig.Password)
-	if err != nil {
-		return fmt.Errorf("failed to login: %v", err)
+	return &EmailMonitoringService{
+		emailConfig: emailConfig,
+		mailbox:     box,
+		templates:   NewEmailTemplateService(config.Db),
+		stop:        make(chan struct{}),
 	}
+}
 
-	log.Printf("Connected to mail server: %s", s.emailConfig.Host)
-	return nil
+// StartEmailMonitor khởi động worker đọc mail theo cấu hình env. Không cấu hình EMAIL_IMAP_HOST thì không chạy và trả về nil
+func StartEmailMonitor() *EmailMonitoringService {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if cfg.EmailImapHost == "" {
+		log.Println("EMAIL_IMAP_HOST not set, email payment monitor disabled")
+		return nil
+	}
+
+	emailMonitorMu.Lock()
+	defer emailMonitorMu.Unlock()
+	if emailMonitor != nil {
+		return emailMonitor
+	}
+
+	emailMonitor = NewEmailMonitoringService(EmailConfig{
+		Host:         cfg.EmailImapHost,
+		Port:         cfg.EmailImapPort,
+		Username:     cfg.EmailImapUser,
+		Password:     cfg.EmailImapPassword,
+		SSL:          cfg.EmailImapSSL,
+		Mailbox:      cfg.EmailImapMailbox,
+		PollInterval: time.Duration(cfg.EmailImapPollSeconds) * time.Second,
+	})
+	emailMonitor.StartEmailWorker()
+	return emailMonitor
 }
 
-// ReadNewEmails đọc mail mới
-func (s *EmailMonitoringService) ReadNewEmails() error {
-	if s.client == nil {
-		return fmt.Errorf("not connected to mail server")
+// GetEmailMonitorStatus trả về trạng thái worker đọc mail đang chạy (Running = false nếu chưa khởi động)
+func GetEmailMonitorStatus() EmailMonitorStatus {
+	emailMonitorMu.Lock()
+	monitor := emailMonitor
+	emailMonitorMu.Unlock()
+	if monitor == nil {
+		return EmailMonitorStatus{}
 	}
+	return monitor.Status()
+}
 
-	// Chọn mailbox INBOX
-	_, err := s.client.Select("INBOX", false)
-	if err != nil {
-		return fmt.Errorf("failed to select INBOX: %v", err)
-	}
+// Status trả về bản sao trạng thái hiện tại
+func (s *EmailMonitoringService) Status() EmailMonitorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.LastUID = s.lastUID
+	return status
+}
 
-	// Lấy mail mới (từ 1 giờ trước)
-	since := time.Now().Add(-1 * time.Hour)
-	criteria := imap.NewSearchCriteria()
-	criteria.Since = since
+// StartEmailWorker chạy worker trong goroutine, tự kết nối lại với backoff tăng dần khi lỗi
+func (s *EmailMonitoringService) StartEmailWorker() {
+	s.mu.Lock()
+	s.status.Running = true
+	s.status.Host = s.emailConfig.Host
+	s.status.Mailbox = s.emailConfig.Mailbox
+	s.mu.Unlock()
 
-	uids, err := s.client.Search(criteria)
-	if err != nil {
-		return fmt.Errorf("failed to search emails: %v", err)
-	}
+	go s.supervise()
+	log.Println("Email monitoring worker started")
+}
 
-	if len(uids) == 0 {
-		return nil // Không có mail mới
-	}
+// Stop dừng worker và đóng kết nối mail
+func (s *EmailMonitoringService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
 
-	// Lấy nội dung mail
-	seqset := new(imap.SeqSet)
-	seqset.AddNum(uids...)
+func (s *EmailMonitoringService) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
 
-	messages := make(chan *imap.Message, 10)
-	done := make(chan error, 1)
-	go func() {
-		done <- s.client.Fetch(seqset, []imap.FetchItem{imap.FetchEnvelope, imap.FetchBody, imap.FetchUid}, messages)
+func (s *EmailMonitoringService) supervise() {
+	defer func() {
+		s.mu.Lock()
+		s.status.Running = false
+		s.status.Connected = false
+		s.status.NextRetryAt = nil
+		s.mu.Unlock()
+		log.Println("Email monitoring worker stopped")
 	}()
 
-	for msg := range messages {
-		// Chỉ xử lý email từ ACB
-		sender := msg.Envelope.From[0].Address()
-		if !strings.Contains(strings.ToLower(sender), "acb") {
-			continue
+	backoff := emailMonitorMinBackoff
+	for {
+		connected, err := s.runSession()
+		if s.stopped() {
+			return
+		}
+		// Mất kết nối sau khi đã chạy được thì thử lại ngay với backoff nhỏ nhất
+		if connected {
+			backoff = emailMonitorMinBackoff
 		}
 
-		confirmation, err := s.parsePaymentEmail(msg)
-		if err != nil {
-			log.Printf("Failed to parse email: %v", err)
-			// Lưu log lỗi parse
-			savePaymentEmailLog(config.PaymentEmailLog{
-				Sender:       sender,
-				Subject:      msg.Envelope.Subject,
-				EmailContent: s.getEmailBody(msg),
-				Status:       "error",
-				ErrorMessage: err.Error(),
-				ReceivedAt:   msg.Envelope.Date,
-				CreatedAt:    time.Now(),
-			})
-			continue
+		now := time.Now()
+		retryAt := now.Add(backoff)
+		s.mu.Lock()
+		s.status.Connected = false
+		s.status.LastError = err.Error()
+		s.status.LastErrorAt = &now
+		s.status.ConsecutiveFailures++
+		s.status.NextRetryAt = &retryAt
+		s.mu.Unlock()
+		log.Printf("Email monitor error: %v, reconnecting in %s", err, backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.stop:
+			timer.Stop()
+			return
 		}
 
-		if confirmation != nil {
-			err = s.processPaymentEmail(confirmation, sender, msg.Envelope.Subject, s.getEmailBody(msg), msg.Envelope.Date)
-			if err != nil {
-				log.Printf("Failed to process payment email: %v", err)
+		if !connected {
+			backoff *= 2
+			if backoff > emailMonitorMaxBackoff {
+				backoff = emailMonitorMaxBackoff
 			}
 		}
 	}
-
-	return <-done
-}
-
-// parsePaymentEmail parse mail xác nhận thanh toán
-func (s *EmailMonitoringService) parsePaymentEmail(msg *imap.Message) (*PaymentConfirmation, error) {
-	// Kiểm tra sender
-	sender := msg.Envelope.From[0].Address()
-	if !s.isBankEmail(sender) {
-		return nil, nil // Không phải mail ngân hàng
-	}
-
-	// Lấy nội dung mail
-	body := s.getEmailBody(msg)
-	if body == "" {
-		return nil, fmt.Errorf("empty email body")
-	}
-
-	// Parse thông tin thanh toán
-	confirmation, err := s.extractPaymentInfo(body, sender)
-	if err != nil {
-		return nil, err
-	}
-
-	return confirmation, nil
 }
 
-// isBankEmail kiểm tra có phải mail ngân hàng không
-func (s *EmailMonitoringService) isBankEmail(sender string) bool {
-	bankEmails := []string{
-		"noreply@vietcombank.com.vn",
-		"noreply@bidv.com.vn",
-		"noreply@tcb.com.vn",
-		"noreply@acb.com.vn",
-		"noreply@mb.com.vn",
-		"mailalert@acb.com.vn",
+// runSession kết nối và đọc mail tới khi lỗi hoặc worker dừng. connected cho biết đã kết nối thành công
+func (s *EmailMonitoringService) runSession() (connected bool, err error) {
+	if err := s.mailbox.Connect(); err != nil {
+		return false, err
 	}
-
-	for _, bankEmail := range bankEmails {
-		if strings.Contains(strings.ToLower(sender), strings.ToLower(bankEmail)) {
-			return true
+	defer func() {
+		if closeErr := s.mailbox.Close(); closeErr != nil {
+			log.Printf("Failed to close mailbox: %v", closeErr)
 		}
-	}
-
-	return false
-}
-
-// getEmailBody lấy nội dung mail
-func (s *EmailMonitoringService) getEmailBody(msg *imap.Message) string {
-	// Đơn giản hóa: trả về placeholder cho bây giờ
-	// Trong thực tế cần implement đọc MIME content đầy đủ
-	// TODO: Implement proper email body reading
-	return "Email content placeholder - cần implement đọc MIME content"
-}
-
-// extractPaymentInfo trích xuất thông tin thanh toán từ nội dung mail
-func (s *EmailMonitoringService) extractPaymentInfo(content, sender string) (*PaymentConfirmation, error) {
-	// Template cho Vietcombank
-	if strings.Contains(sender, "vietcombank") {
-		return s.parseVietcombankEmail(content)
-	}
-
-	// Template cho BIDV
-	if strings.Contains(sender, "bidv") {
-		return s.parseBIDVEmail(content)
-	}
+	}()
 
-	// Template cho ACB
-	if strings.Contains(sender, "acb") {
-		return s.parseACBEmail(content)
+	now := time.Now()
+	s.mu.Lock()
+	// UIDVALIDITY đổi: UID cũ không còn ý nghĩa, đọc lại mail gần đây
+	if validity := s.mailbox.Validity(); validity != s.validity {
+		s.validity = validity
+		s.lastUID = 0
+	}
+	s.status.Connected = true
+	s.status.Mode = s.mailbox.Mode()
+	s.status.LastConnectedAt = &now
+	s.status.ConsecutiveFailures = 0
+	s.status.NextRetryAt = nil
+	s.mu.Unlock()
+	log.Printf("Email monitor connected to %s/%s (%s)", s.emailConfig.Host, s.emailConfig.Mailbox, s.mailbox.Mode())
+
+	for {
+		if err := s.ReadNewEmails(); err != nil {
+			return true, err
+		}
+		if err := s.mailbox.WaitForUpdate(emailMonitorRecheckInterval, s.stop); err != nil {
+			return true, err
+		}
+		if s.stopped() {
+			return true, nil
+		}
 	}
-
-	// Template mặc định
-	return s.parseDefaultEmail(content)
 }
 
-// parseVietcombankEmail parse mail Vietcombank
-func (s *EmailMonitoringService) parseVietcombankEmail(content string) (*PaymentConfirmation, error) {
-	// Regex patterns cho Vietcombank
-	amountPattern := regexp.MustCompile(`Số tiền:\s*([\d,]+)\s*VND`)
-	accountPattern := regexp.MustCompile(`Tài khoản:\s*(\d+)`)
-	orderPattern := regexp.MustCompile(`Nội dung:\s*([A-Z0-9]+)`)
-
-	amountMatch := amountPattern.FindStringSubmatch(content)
-	accountMatch := accountPattern.FindStringSubmatch(content)
-	orderMatch := orderPattern.FindStringSubmatch(content)
+// ReadNewEmails đọc mail mới từ UID đã xử lý gần nhất.
+// Lỗi đọc DB/hộp thư được trả về để worker kết nối lại và đọc lại từ mail chưa xử lý
+func (s *EmailMonitoringService) ReadNewEmails() error {
+	s.mu.Lock()
+	lastUID := s.lastUID
+	s.mu.Unlock()
 
-	if len(amountMatch) < 2 || len(accountMatch) < 2 || len(orderMatch) < 2 {
-		return nil, fmt.Errorf("failed to extract payment info from Vietcombank email")
+	messages, err := s.mailbox.FetchSince(lastUID)
+	if err != nil {
+		return err
 	}
 
-	return &PaymentConfirmation{
-		OrderCode:     orderMatch[1],
-		Amount:        strings.ReplaceAll(amountMatch[1], ",", ""),
-		BankAccount:   accountMatch[1],
-		TransactionID: fmt.Sprintf("VCB_%d", time.Now().Unix()),
-		EmailContent:  content,
-		ReceivedAt:    time.Now(),
-	}, nil
-}
-
-// parseBIDVEmail parse mail BIDV
-func (s *EmailMonitoringService) parseBIDVEmail(content string) (*PaymentConfirmation, error) {
-	// Regex patterns cho BIDV
-	amountPattern := regexp.MustCompile(`Số tiền:\s*([\d,]+)\s*VNĐ`)
-	accountPattern := regexp.MustCompile(`Tài khoản:\s*(\d+)`)
-	orderPattern := regexp.MustCompile(`Nội dung:\s*([A-Z0-9]+)`)
-
-	amountMatch := amountPattern.FindStringSubmatch(content)
-	accountMatch := accountPattern.FindStringSubmatch(content)
-	orderMatch := orderPattern.FindStringSubmatch(content)
-
-	if len(amountMatch) < 2 || len(accountMatch) < 2 || len(orderMatch) < 2 {
-		return nil, fmt.Errorf("failed to extract payment info from BIDV email")
+	for _, msg := range messages {
+		if err := s.handleEmail(msg.Raw); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.lastUID = msg.UID
+		s.mu.Unlock()
 	}
 
-	return &PaymentConfirmation{
-		OrderCode:     orderMatch[1],
-		Amount:        strings.ReplaceAll(amountMatch[1], ",", ""),
-		BankAccount:   accountMatch[1],
-		TransactionID: fmt.Sprintf("BIDV_%d", time.Now().Unix()),
-		EmailContent:  content,
-		ReceivedAt:    time.Now(),
-	}, nil
+	now := time.Now()
+	s.mu.Lock()
+	s.status.LastCheckedAt = &now
+	s.mu.Unlock()
+	return nil
 }
 
-// parseACBEmail parse mail ACB
-func (s *EmailMonitoringService) parseACBEmail(content string) (*PaymentConfirmation, error) {
-	// Regex patterns cho ACB dựa trên email mẫu
-	amountPattern := regexp.MustCompile(`Ghi có\s*\+([\d,]+\.?\d*)\s*VND`)
-	accountPattern := regexp.MustCompile(`tài khoản\s*(\d+)\s*của`)
-	orderPattern := regexp.MustCompile(`PAY\d{14,20}`) // Cập nhật để linh hoạt hơn
-	transactionPattern := regexp.MustCompile(`FT\d+`)
-
-	amountMatch := amountPattern.FindStringSubmatch(content)
-	accountMatch := accountPattern.FindStringSubmatch(content)
-	orderMatch := orderPattern.FindString(content)
-	transactionMatch := transactionPattern.FindString(content)
-
-	if orderMatch == "" {
-		return nil, fmt.Errorf("no order code found in ACB email")
-	}
-
-	if len(amountMatch) < 2 {
-		return nil, fmt.Errorf("failed to extract amount from ACB email")
-	}
-
-	bankAccount := "Unknown"
-	if len(accountMatch) >= 2 {
-		bankAccount = accountMatch[1]
+// handleEmail đọc một mail thô theo template; mail không khớp template nào không phải mail ngân hàng và được bỏ qua
+func (s *EmailMonitoringService) handleEmail(raw []byte) error {
+	email, err := ParseRawEmail(raw)
+	if err != nil {
+		log.Printf("Skipping unreadable email: %v", err)
+		return nil
 	}
 
-	transactionID := fmt.Sprintf("ACB_%d", time.Now().Unix())
-	if transactionMatch != "" {
-		transactionID = transactionMatch
+	template, confirmation, err := s.templates.MatchEmail(email)
+	if template == nil {
+		if err != nil {
+			return fmt.Errorf("failed to load email templates: %v", err)
+		}
+		return nil
 	}
 
-	return &PaymentConfirmation{
-		OrderCode:     orderMatch,
-		Amount:        strings.ReplaceAll(amountMatch[1], ",", ""),
-		BankAccount:   bankAccount,
-		TransactionID: transactionID,
-		EmailContent:  content,
-		ReceivedAt:    time.Now(),
-	}, nil
-}
+	s.mu.Lock()
+	s.status.MatchedEmails++
+	s.mu.Unlock()
 
-// parseDefaultEmail parse mail mặc định
-func (s *EmailMonitoringService) parseDefaultEmail(content string) (*PaymentConfirmation, error) {
-	// Tìm order code trong nội dung
-	orderPattern := regexp.MustCompile(`PAY\d{14,20}`)
-	orderMatch := orderPattern.FindString(content)
+	if err != nil {
+		// Worker đọc lại mail gần đây sau khi khởi động: chỉ lưu log lỗi một lần cho mỗi mail
+		transactionID := email.TransactionID()
+		var count int64
+		config.Db.Model(&config.PaymentEmailLog{}).Where("transaction_id = ? AND status = ?", transactionID, "error").Count(&count)
+		if count > 0 {
+			return nil
+		}
 
-	if orderMatch == "" {
-		return nil, fmt.Errorf("no order code found in email")
+		log.Printf("Failed to parse %s email %s: %v", template.BankName, email.MessageID, err)
+		savePaymentEmailLog(&config.PaymentEmailLog{
+			TransactionID: transactionID,
+			Sender:        email.Sender,
+			Subject:       email.Subject,
+			EmailContent:  email.Body,
+			Status:        "error",
+			ErrorMessage:  err.Error(),
+			ReceivedAt:    email.Date,
+			CreatedAt:     time.Now(),
+		})
+		return nil
 	}
 
-	// Tìm số tiền
-	amountPattern := regexp.MustCompile(`(\d{1,3}(?:,\d{3})*)`)
-	amountMatches := amountPattern.FindAllString(content, -1)
-
-	var amount string
-	for _, match := range amountMatches {
-		// Tìm số tiền lớn nhất (có thể là số tiền thanh toán)
-		if len(match) > len(amount) {
-			amount = match
-		}
+	if err := s.processPaymentEmail(confirmation, email.Sender, email.Subject, email.Body, email.Date); err != nil {
+		log.Printf("Failed to process payment email: %v", err)
 	}
-
-	return &PaymentConfirmation{
-		OrderCode:     orderMatch,
-		Amount:        strings.ReplaceAll(amount, ",", ""),
-		BankAccount:   "Unknown",
-		TransactionID: fmt.Sprintf("BANK_%d", time.Now().Unix()),
-		EmailContent:  content,
-		ReceivedAt:    time.Now(),
-	}, nil
+	return nil
 }
 
 // processPaymentEmail xử lý mail xác nhận thanh toán
@@ -346,100 +356,56 @@ func (s *EmailMonitoringService) processPaymentEmail(confirmation *PaymentConfir
 		CreatedAt:     time.Now(),
 	}
 
-	// Tìm đơn hàng theo order code
+	// Mail đã được xử lý ở lần đọc trước (worker đọc lại mail trong 1 giờ gần nhất)
 	paymentService := NewPaymentOrderService()
-	order, err := paymentService.GetOrderByCode(confirmation.OrderCode)
-	if err != nil {
-		logEntry.Status = "unmatched"
-		logEntry.ErrorMessage = "order not found: " + confirmation.OrderCode
-		savePaymentEmailLog(logEntry)
-		return fmt.Errorf(logEntry.ErrorMessage)
+	if paymentService.IsPaymentTransactionProcessed(PaymentSourceEmail, confirmation.TransactionID) {
+		return nil
 	}
-	logEntry.OrderID = &order.ID
 
-	// Kiểm tra trạng thái đơn hàng
-	if order.OrderStatus != "pending" {
+	amount, err := decimal.NewFromString(confirmation.Amount)
+	if err != nil {
 		logEntry.Status = "error"
-		logEntry.ErrorMessage = fmt.Sprintf("order %s is not pending", confirmation.OrderCode)
-		savePaymentEmailLog(logEntry)
+		logEntry.ErrorMessage = fmt.Sprintf("invalid amount %q: %v", confirmation.Amount, err)
+		savePaymentEmailLog(&logEntry)
 		return fmt.Errorf(logEntry.ErrorMessage)
 	}
 
-	// Kiểm tra số tiền
-	expectedAmount := order.AmountVND.String()
-	if confirmation.Amount != expectedAmount {
-		logEntry.Status = "error"
-		logEntry.ErrorMessage = fmt.Sprintf("amount mismatch: expected %s, got %s", expectedAmount, confirmation.Amount)
-		savePaymentEmailLog(logEntry)
-		return fmt.Errorf(logEntry.ErrorMessage)
-	}
+	// Lưu log trước để hàng chờ needs_review tham chiếu được log email
+	logEntry.Status = "unmatched"
+	savePaymentEmailLog(&logEntry)
 
-	// Cập nhật trạng thái đơn hàng thành paid
-	err = paymentService.UpdateOrderStatus(order.ID, "paid", &confirmation.TransactionID)
-	if err != nil {
-		logEntry.Status = "error"
-		logEntry.ErrorMessage = fmt.Sprintf("failed to update order status: %v", err)
-		savePaymentEmailLog(logEntry)
-		return fmt.Errorf(logEntry.ErrorMessage)
+	// Khớp khoản tiền với đơn hàng, đơn không còn pending/thiếu tiền thì đưa vào hàng chờ needs_review
+	outcome, order, err := paymentService.ConfirmPayment(PaymentSourceEmail, confirmation.TransactionID, confirmation.OrderCode, amount, logEntry.ID)
+	updates := map[string]interface{}{}
+	if order != nil {
+		updates["order_id"] = order.ID
 	}
-
-	// Cộng credit cho user
-	creditService := NewCreditService()
-	amountUSD, _ := order.AmountUSD.Float64()
-	err = creditService.AddCredits(order.UserID, amountUSD,
-		fmt.Sprintf("Nạp credit qua thanh toán QR - %s", confirmation.OrderCode),
-		confirmation.TransactionID)
-	if err != nil {
-		logEntry.Status = "error"
-		logEntry.ErrorMessage = fmt.Sprintf("failed to add credits: %v", err)
-		savePaymentEmailLog(logEntry)
-		return fmt.Errorf(logEntry.ErrorMessage)
+	switch {
+	case err != nil:
+		updates["status"] = "error"
+		updates["error_message"] = err.Error()
+	case outcome == PaymentOutcomeNeedsReview:
+		updates["error_message"] = "payment queued for review"
+	case outcome == PaymentOutcomeDuplicate:
+		updates["status"] = "matched"
+		updates["error_message"] = "duplicate transaction, already processed"
+	default:
+		updates["status"] = "matched"
+	}
+	if updateErr := config.Db.Model(&logEntry).Updates(updates).Error; updateErr != nil {
+		log.Printf("Failed to update payment email log %d: %v", logEntry.ID, updateErr)
 	}
 
-	logEntry.Status = "matched"
-	logEntry.ErrorMessage = ""
-	savePaymentEmailLog(logEntry)
-
-	log.Printf("Payment confirmed for order %s: %s USD", confirmation.OrderCode, order.AmountUSD.String())
-	return nil
-}
-
-// Lưu log email thanh toán vào DB
-func savePaymentEmailLog(log config.PaymentEmailLog) {
-	_ = config.Db.Create(&log).Error
-}
-
-// StartEmailWorker khởi động worker đọc mail
-func (s *EmailMonitoringService) StartEmailWorker() error {
-	// Kết nối mail server
-	err := s.ConnectIMAP()
 	if err != nil {
-		return fmt.Errorf("failed to connect to mail server: %v", err)
+		return err
+	}
+	if outcome == PaymentOutcomePaid {
+		log.Printf("Payment confirmed for order %s: %s VND", confirmation.OrderCode, amount.String())
 	}
-
-	// Chạy worker trong goroutine
-	go func() {
-		ticker := time.NewTicker(30 * time.Second) // Đọc mail mỗi 30 giây
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				if err := s.ReadNewEmails(); err != nil {
-					log.Printf("Error reading emails: %v", err)
-				}
-			}
-		}
-	}()
-
-	log.Println("Email monitoring worker started")
 	return nil
 }
 
-// Close đóng kết nối mail
-func (s *EmailMonitoringService) Close() error {
-	if s.client != nil {
-		return s.client.Logout()
-	}
-	return nil
+// Lưu log email thanh toán vào DB
+func savePaymentEmailLog(log *config.PaymentEmailLog) {
+	_ = config.Db.Create(log).Error
 }
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+
+	"github.com/shopspring/decimal"
+)
+
+// Mã đơn mặc định khi template không khai báo order_code_pattern (xem generateOrderCode)
+const defaultOrderCodePattern = `PAY\d{14,20}`
+
+// Giới hạn độ sâu multipart lồng nhau để mail lỗi không làm treo worker
+const maxEmailPartDepth = 5
+
+// ParsedEmail là mail ngân hàng đã giải mã header và nội dung
+type ParsedEmail struct {
+	MessageID string
+	Sender    string
+	Subject   string
+	Date      time.Time
+	Body      string // Ưu tiên text/plain, không có thì lấy text từ text/html
+}
+
+// TransactionID trả về mã giao dịch cố định của mail (theo Message-Id) để đọc lại không ghi nhận trùng
+func (e *ParsedEmail) TransactionID() string {
+	if e.MessageID != "" {
+		return "EMAIL_" + strings.Trim(e.MessageID, "<>")
+	}
+	sum := sha1.Sum([]byte(e.Sender + "\n" + e.Subject + "\n" + e.Date.UTC().Format(time.RFC3339) + "\n" + e.Body))
+	return "EMAIL_" + hex.EncodeToString(sum[:10])
+}
+
+// ParseRawEmail giải mã mail thô RFC 822 (header mã hoá, multipart, quoted-printable/base64)
+func ParseRawEmail(raw []byte) (*ParsedEmail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %v", err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	decodeHeader := func(value string) string {
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+
+	parsed := &ParsedEmail{
+		MessageID: strings.TrimSpace(msg.Header.Get("Message-Id")),
+		Subject:   decodeHeader(msg.Header.Get("Subject")),
+	}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		parsed.Sender = from.Address
+	} else {
+		parsed.Sender = decodeHeader(msg.Header.Get("From"))
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		parsed.Date = date
+	} else {
+		parsed.Date = time.Now()
+	}
+
+	plain, htmlBody := readEmailPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, 0)
+	if plain != "" {
+		parsed.Body = plain
+	} else {
+		parsed.Body = htmlToText(htmlBody)
+	}
+	return parsed, nil
+}
+
+// readEmailPart đọc đệ quy một phần của mail, trả về text/plain và text/html đầu tiên tìm thấy
+func readEmailPart(contentType, transferEncoding string, body io.Reader, depth int) (string, string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxEmailPartDepth || params["boundary"] == "" {
+			return "", ""
+		}
+		var plain, htmlBody string
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err != nil {
+				break
+			}
+			p, h := readEmailPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+			if plain == "" {
+				plain = p
+			}
+			if htmlBody == "" {
+				htmlBody = h
+			}
+		}
+		return plain, htmlBody
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", ""
+	}
+
+	content, err := io.ReadAll(decodeTransferEncoding(transferEncoding, body))
+	if err != nil {
+		return "", ""
+	}
+	text := strings.TrimSpace(strings.ReplaceAll(string(content), "\r\n", "\n"))
+	if mediaType == "text/html" {
+		return "", text
+	}
+	return text, ""
+}
+
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, newBase64Cleaner(body))
+	}
+	return body
+}
+
+// base64Cleaner bỏ xuống dòng/khoảng trắng trong base64 của mail (mỗi dòng 76 ký tự)
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func newBase64Cleaner(r io.Reader) io.Reader {
+	return &base64Cleaner{r: r}
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+var (
+	htmlIgnoredBlockRegex = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlLineBreakRegex    = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|tr|li|h[1-6]|table)>`)
+	htmlCellRegex         = regexp.MustCompile(`(?i)</t[dh]>`)
+	htmlTagRegex          = regexp.MustCompile(`<[^>]+>`)
+	inlineSpaceRegex      = regexp.MustCompile(`[ \t\x{00a0}]+`)
+)
+
+// htmlToText lấy phần chữ của mail HTML, giữ xuống dòng theo thẻ block để regex theo dòng vẫn dùng được
+func htmlToText(body string) string {
+	if body == "" {
+		return ""
+	}
+	text := htmlIgnoredBlockRegex.ReplaceAllString(body, "")
+	text = htmlLineBreakRegex.ReplaceAllString(text, "\n")
+	text = htmlCellRegex.ReplaceAllString(text, " ")
+	text = htmlTagRegex.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(inlineSpaceRegex.ReplaceAllString(line, " "))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// emailTemplateMatcher là EmailTemplate đã biên dịch regex
+type emailTemplateMatcher struct {
+	template    config.EmailTemplate
+	sender      *regexp.Regexp
+	subject     *regexp.Regexp
+	content     *regexp.Regexp
+	amount      *regexp.Regexp
+	account     *regexp.Regexp
+	orderCode   *regexp.Regexp
+	transaction *regexp.Regexp
+}
+
+func compileEmailTemplate(template config.EmailTemplate) (*emailTemplateMatcher, error) {
+	compile := func(field string, pattern *string, caseInsensitive bool) (*regexp.Regexp, error) {
+		if pattern == nil || strings.TrimSpace(*pattern) == "" {
+			return nil, nil
+		}
+		expr := *pattern
+		if caseInsensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidEmailTemplate, field, err)
+		}
+		return re, nil
+	}
+
+	matcher := &emailTemplateMatcher{template: template}
+	var err error
+	if matcher.sender, err = compile("sender_pattern", template.SenderPattern, true); err != nil {
+		return nil, err
+	}
+	if matcher.subject, err = compile("subject_pattern", template.SubjectPattern, true); err != nil {
+		return nil, err
+	}
+	if matcher.content, err = compile("content_pattern", template.ContentPattern, false); err != nil {
+		return nil, err
+	}
+	if matcher.amount, err = compile("amount_pattern", template.AmountPattern, false); err != nil {
+		return nil, err
+	}
+	if matcher.account, err = compile("account_pattern", template.AccountPattern, false); err != nil {
+		return nil, err
+	}
+	if matcher.transaction, err = compile("transaction_pattern", template.TransactionPattern, false); err != nil {
+		return nil, err
+	}
+	orderCodePattern := template.OrderCodePattern
+	if orderCodePattern == nil || strings.TrimSpace(*orderCodePattern) == "" {
+		pattern := defaultOrderCodePattern
+		orderCodePattern = &pattern
+	}
+	if matcher.orderCode, err = compile("order_code_pattern", orderCodePattern, false); err != nil {
+		return nil, err
+	}
+
+	if matcher.amount == nil {
+		return nil, fmt.Errorf("%w: amount_pattern is required", ErrInvalidEmailTemplate)
+	}
+	if matcher.sender == nil && matcher.subject == nil && matcher.content == nil {
+		return nil, fmt.Errorf("%w: at least one of sender_pattern, subject_pattern, content_pattern is required", ErrInvalidEmailTemplate)
+	}
+	return matcher, nil
+}
+
+// matches kiểm tra mail có thuộc template (mọi pattern nhận diện đã khai báo đều phải khớp)
+func (m *emailTemplateMatcher) matches(email *ParsedEmail) bool {
+	if m.sender != nil && !m.sender.MatchString(email.Sender) {
+		return false
+	}
+	if m.subject != nil && !m.subject.MatchString(email.Subject) {
+		return false
+	}
+	if m.content != nil && !m.content.MatchString(email.Body) {
+		return false
+	}
+	return true
+}
+
+// extract đọc thông tin thanh toán từ mail đã khớp template.
+// Không có mã đơn vẫn trả về để khoản tiền được đưa vào hàng chờ đối soát
+func (m *emailTemplateMatcher) extract(email *ParsedEmail) (*PaymentConfirmation, error) {
+	text := email.Subject + "\n" + email.Body
+
+	rawAmount := firstSubmatch(m.amount, text)
+	if rawAmount == "" {
+		return nil, fmt.Errorf("failed to extract amount from %s email", m.template.BankName)
+	}
+	amount, err := normalizeEmailAmount(rawAmount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract amount from %s email: %v", m.template.BankName, err)
+	}
+
+	confirmation := &PaymentConfirmation{
+		OrderCode:     strings.ToUpper(firstSubmatch(m.orderCode, text)),
+		Amount:        amount,
+		BankAccount:   "Unknown",
+		TransactionID: email.TransactionID(),
+		EmailContent:  email.Body,
+		ReceivedAt:    email.Date,
+	}
+	if account := firstSubmatch(m.account, text); account != "" {
+		confirmation.BankAccount = account
+	}
+	if transactionID := firstSubmatch(m.transaction, text); transactionID != "" {
+		confirmation.TransactionID = transactionID
+	}
+	return confirmation, nil
+}
+
+// firstSubmatch trả về group 1 nếu regex có group, ngược lại toàn bộ chuỗi khớp
+func firstSubmatch(re *regexp.Regexp, text string) string {
+	if re == nil {
+		return ""
+	}
+	match := re.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	if len(match) > 1 {
+		return strings.TrimSpace(match[1])
+	}
+	return strings.TrimSpace(match[0])
+}
+
+var amountDecimalSuffixRegex = regexp.MustCompile(`[.,]\d{1,2}$`)
+
+// normalizeEmailAmount chuyển số tiền dạng "1,500,000", "1.500.000" hoặc "1,500,000.00" thành "1500000"
+func normalizeEmailAmount(raw string) (string, error) {
+	amount := strings.NewReplacer(" ", "", "+", "", "VND", "", "VNĐ", "", "đ", "").Replace(raw)
+	amount = amountDecimalSuffixRegex.ReplaceAllString(amount, "")
+	amount = strings.NewReplacer(",", "", ".", "").Replace(amount)
+
+	value, err := decimal.NewFromString(amount)
+	if err != nil {
+		return "", fmt.Errorf("invalid amount %q", raw)
+	}
+	if !value.IsPositive() {
+		return "", fmt.Errorf("invalid amount %q", raw)
+	}
+	return value.String(), nil
+}
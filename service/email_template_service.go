@@ -0,0 +1,222 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidEmailTemplate = errors.New("invalid email template")
+
+// EmailTemplateService quản lý template đọc mail biến động số dư (mỗi ngân hàng/mẫu mail một template)
+type EmailTemplateService struct {
+	db *gorm.DB
+}
+
+func NewEmailTemplateService(db *gorm.DB) *EmailTemplateService {
+	return &EmailTemplateService{db: db}
+}
+
+func (s *EmailTemplateService) GetTemplates() ([]config.EmailTemplate, error) {
+	var templates []config.EmailTemplate
+	err := s.db.Order("priority DESC, id ASC").Find(&templates).Error
+	return templates, err
+}
+
+// activeMatchers biên dịch các template đang bật theo thứ tự ưu tiên. Template lỗi regex bị bỏ qua và trả về trong danh sách lỗi
+func (s *EmailTemplateService) activeMatchers() ([]*emailTemplateMatcher, []error, error) {
+	var templates []config.EmailTemplate
+	if err := s.db.Where("is_active = ?", true).Order("priority DESC, id ASC").Find(&templates).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var matchers []*emailTemplateMatcher
+	var invalid []error
+	for _, template := range templates {
+		matcher, err := compileEmailTemplate(template)
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("template %d (%s): %v", template.ID, template.BankName, err))
+			continue
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, invalid, nil
+}
+
+func optionalPattern(pattern string) *string {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return nil
+	}
+	return &pattern
+}
+
+func emailTemplateFromRequest(req model.EmailTemplateRequest) config.EmailTemplate {
+	templateName := strings.TrimSpace(req.TemplateName)
+	if templateName == "" {
+		templateName = "payment_confirmation"
+	}
+	return config.EmailTemplate{
+		BankName:           strings.TrimSpace(req.BankName),
+		TemplateName:       templateName,
+		SenderPattern:      optionalPattern(req.SenderPattern),
+		SubjectPattern:     optionalPattern(req.SubjectPattern),
+		ContentPattern:     optionalPattern(req.ContentPattern),
+		AmountPattern:      optionalPattern(req.AmountPattern),
+		AccountPattern:     optionalPattern(req.AccountPattern),
+		OrderCodePattern:   optionalPattern(req.OrderCodePattern),
+		TransactionPattern: optionalPattern(req.TransactionPattern),
+		Priority:           req.Priority,
+		IsActive:           req.IsActive == nil || *req.IsActive,
+	}
+}
+
+func (s *EmailTemplateService) CreateTemplate(req model.EmailTemplateRequest) (*config.EmailTemplate, error) {
+	template := emailTemplateFromRequest(req)
+	if _, err := compileEmailTemplate(template); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&template).Error; err != nil {
+		return nil, fmt.Errorf("failed to create email template: %v", err)
+	}
+	return &template, nil
+}
+
+func (s *EmailTemplateService) UpdateTemplate(templateID uint, req model.EmailTemplateRequest) (*config.EmailTemplate, error) {
+	updated := emailTemplateFromRequest(req)
+	if _, err := compileEmailTemplate(updated); err != nil {
+		return nil, err
+	}
+
+	var template config.EmailTemplate
+	if err := s.db.First(&template, templateID).Error; err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"bank_name":           updated.BankName,
+		"template_name":       updated.TemplateName,
+		"sender_pattern":      updated.SenderPattern,
+		"subject_pattern":     updated.SubjectPattern,
+		"content_pattern":     updated.ContentPattern,
+		"amount_pattern":      updated.AmountPattern,
+		"account_pattern":     updated.AccountPattern,
+		"order_code_pattern":  updated.OrderCodePattern,
+		"transaction_pattern": updated.TransactionPattern,
+		"priority":            updated.Priority,
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if err := s.db.Model(&template).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update email template: %v", err)
+	}
+	s.db.First(&template, templateID)
+	return &template, nil
+}
+
+func (s *EmailTemplateService) DeleteTemplate(templateID uint) error {
+	result := s.db.Delete(&config.EmailTemplate{}, templateID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MatchEmail tìm template đầu tiên (theo ưu tiên) khớp mail và đọc thông tin thanh toán.
+// Trả về nil, nil, nil nếu không template nào khớp (không phải mail biến động số dư)
+func (s *EmailTemplateService) MatchEmail(email *ParsedEmail) (*config.EmailTemplate, *PaymentConfirmation, error) {
+	matchers, _, err := s.activeMatchers()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, matcher := range matchers {
+		if !matcher.matches(email) {
+			continue
+		}
+		confirmation, err := matcher.extract(email)
+		return &matcher.template, confirmation, err
+	}
+	return nil, nil, nil
+}
+
+// TestTemplate chạy thử template với mail thô, không ghi nhận thanh toán.
+// Nội dung không có header mail được coi là phần thân để thử nhanh content/amount pattern
+func (s *EmailTemplateService) TestTemplate(req model.EmailTemplateTestRequest) (*model.EmailTemplateTestResult, error) {
+	raw := strings.TrimLeft(req.RawEmail, "\r\n")
+	email, err := ParseRawEmail([]byte(raw))
+	if err != nil {
+		email = &ParsedEmail{Body: strings.TrimSpace(raw)}
+	}
+
+	var matchers []*emailTemplateMatcher
+	var invalid []error
+	switch {
+	case req.Template != nil:
+		matcher, err := compileEmailTemplate(emailTemplateFromRequest(*req.Template))
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	case req.TemplateID != nil:
+		var template config.EmailTemplate
+		if err := s.db.First(&template, *req.TemplateID).Error; err != nil {
+			return nil, err
+		}
+		matcher, err := compileEmailTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	default:
+		if matchers, invalid, err = s.activeMatchers(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &model.EmailTemplateTestResult{
+		Sender:    email.Sender,
+		Subject:   email.Subject,
+		MessageID: email.MessageID,
+		Body:      email.Body,
+		Checks:    []model.EmailTemplateCheck{},
+	}
+	for _, matcher := range matchers {
+		check := model.EmailTemplateCheck{
+			TemplateID:   matcher.template.ID,
+			BankName:     matcher.template.BankName,
+			TemplateName: matcher.template.TemplateName,
+			Matched:      matcher.matches(email),
+		}
+		// Worker dùng template khớp đầu tiên
+		if check.Matched && !result.Matched {
+			result.Matched = true
+			result.TemplateID = matcher.template.ID
+			result.BankName = matcher.template.BankName
+			confirmation, err := matcher.extract(email)
+			if err != nil {
+				check.Error = err.Error()
+				result.Error = err.Error()
+			} else {
+				result.OrderCode = confirmation.OrderCode
+				result.Amount = confirmation.Amount
+				result.BankAccount = confirmation.BankAccount
+				result.TransactionID = confirmation.TransactionID
+			}
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	for _, err := range invalid {
+		result.Checks = append(result.Checks, model.EmailTemplateCheck{Error: err.Error()})
+	}
+	return result, nil
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	// Tỷ giá dùng khi bảng tool_exchange_rates chưa có dữ liệu
+	defaultUSDVNDRate = 25000
+
+	ExchangeRateSourceManual   = "manual"
+	ExchangeRateSourceProvider = "provider"
+)
+
+var ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+
+// ExchangeRateProvider lấy tỷ giá USD/VND từ nguồn bên ngoài
+type ExchangeRateProvider interface {
+	FetchUSDVND() (decimal.Decimal, error)
+}
+
+// HTTPExchangeRateProvider gọi GET URL và đọc tỷ giá theo đường dẫn field trong JSON (vd "rates.VND")
+type HTTPExchangeRateProvider struct {
+	URL    string
+	Field  string
+	Client *http.Client
+}
+
+func (p *HTTPExchangeRateProvider) FetchUSDVND() (decimal.Decimal, error) {
+	resp, err := p.Client.Get(p.URL)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to call exchange rate provider: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to read exchange rate response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decimal.Zero, fmt.Errorf("exchange rate provider returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return decimal.Zero, fmt.Errorf("invalid exchange rate JSON: %v", err)
+	}
+	value := payload
+	for _, key := range strings.Split(p.Field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return decimal.Zero, fmt.Errorf("field %q not found in exchange rate response", p.Field)
+		}
+		value = object[key]
+	}
+
+	switch rate := value.(type) {
+	case float64:
+		return decimal.NewFromFloat(rate), nil
+	case string:
+		return decimal.NewFromString(rate)
+	}
+	return decimal.Zero, fmt.Errorf("field %q is not a number", p.Field)
+}
+
+// StaticExchangeRateProvider trả về tỷ giá cố định, dùng cho dev/test (EXCHANGE_RATE_PROVIDER_URL=stub:25500)
+type StaticExchangeRateProvider struct {
+	Rate decimal.Decimal
+}
+
+func (p *StaticExchangeRateProvider) FetchUSDVND() (decimal.Decimal, error) {
+	return p.Rate, nil
+}
+
+// NewExchangeRateProvider tạo provider theo cấu hình, nil nếu không cấu hình EXCHANGE_RATE_PROVIDER_URL
+func NewExchangeRateProvider(cfg config.InfaConfig) (ExchangeRateProvider, error) {
+	url := strings.TrimSpace(cfg.ExchangeRateProviderURL)
+	if url == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(url, "stub:") {
+		rate, err := decimal.NewFromString(strings.TrimPrefix(url, "stub:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid stub exchange rate %q: %v", url, err)
+		}
+		return &StaticExchangeRateProvider{Rate: rate}, nil
+	}
+	return &HTTPExchangeRateProvider{
+		URL:    url,
+		Field:  cfg.ExchangeRateProviderField,
+		Client: &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+type ExchangeRateService struct {
+	db *gorm.DB
+}
+
+func NewExchangeRateService(db *gorm.DB) *ExchangeRateService {
+	return &ExchangeRateService{db: db}
+}
+
+// GetCurrentRate lấy tỷ giá USD/VND đang có hiệu lực, chưa có tỷ giá nào thì dùng mặc định 25,000
+func (s *ExchangeRateService) GetCurrentRate() decimal.Decimal {
+	var rate model.ExchangeRate
+	err := s.db.Where("effective_from <= ?", time.Now()).Order("effective_from DESC, id DESC").First(&rate).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Printf("Failed to get exchange rate, using default %d: %v", defaultUSDVNDRate, err)
+		}
+		return decimal.NewFromInt(defaultUSDVNDRate)
+	}
+	return rate.Rate
+}
+
+// ListRates lấy lịch sử tỷ giá (kể cả tỷ giá hẹn giờ trong tương lai), mới nhất trước
+func (s *ExchangeRateService) ListRates(limit int) ([]model.ExchangeRate, error) {
+	var rates []model.ExchangeRate
+	err := s.db.Order("effective_from DESC, id DESC").Limit(limit).Find(&rates).Error
+	return rates, err
+}
+
+// CreateRate thêm tỷ giá mới, effectiveFrom nil = có hiệu lực ngay
+func (s *ExchangeRateService) CreateRate(rate decimal.Decimal, effectiveFrom *time.Time, source, note string, createdBy *uint) (*model.ExchangeRate, error) {
+	if rate.LessThanOrEqual(decimal.Zero) {
+		return nil, fmt.Errorf("%w: rate must be greater than 0", ErrInvalidExchangeRate)
+	}
+
+	effective := time.Now()
+	if effectiveFrom != nil {
+		effective = *effectiveFrom
+	}
+
+	exchangeRate := &model.ExchangeRate{
+		BaseCurrency:  "USD",
+		QuoteCurrency: "VND",
+		Rate:          rate.Round(4),
+		EffectiveFrom: effective,
+		Source:        source,
+		Note:          note,
+		CreatedBy:     createdBy,
+	}
+	if err := s.db.Create(exchangeRate).Error; err != nil {
+		return nil, fmt.Errorf("failed to create exchange rate: %v", err)
+	}
+
+	log.Printf("Exchange rate USD/VND %s (%s) effective from %s", exchangeRate.Rate.String(), source, effective.Format(time.RFC3339))
+	return exchangeRate, nil
+}
+
+// DeleteScheduledRate xoá tỷ giá chưa có hiệu lực. Tỷ giá đã có hiệu lực được giữ lại để đối soát
+func (s *ExchangeRateService) DeleteScheduledRate(rateID uint) error {
+	var rate model.ExchangeRate
+	if err := s.db.First(&rate, rateID).Error; err != nil {
+		return err
+	}
+	if !rate.EffectiveFrom.After(time.Now()) {
+		return fmt.Errorf("%w: rate %d is already in effect and cannot be deleted", ErrInvalidExchangeRate, rateID)
+	}
+	return s.db.Delete(&rate).Error
+}
+
+// SyncFromProvider lấy tỷ giá từ provider và lưu nếu khác tỷ giá hiện tại.
+// Tỷ giá lệch quá EXCHANGE_RATE_MAX_CHANGE% so với hiện tại bị từ chối để tránh dữ liệu lỗi từ provider
+func (s *ExchangeRateService) SyncFromProvider() (*model.ExchangeRate, error) {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	provider, err := NewExchangeRateProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("exchange rate provider is not configured")
+	}
+
+	rate, err := provider.FetchUSDVND()
+	if err != nil {
+		return nil, err
+	}
+	if rate.LessThanOrEqual(decimal.Zero) {
+		return nil, fmt.Errorf("%w: provider returned %s", ErrInvalidExchangeRate, rate.String())
+	}
+
+	current := s.GetCurrentRate()
+	if rate.Round(4).Equal(current) {
+		return nil, nil
+	}
+	if cfg.ExchangeRateMaxChange > 0 {
+		change := rate.Sub(current).Abs().Div(current).Mul(decimal.NewFromInt(100))
+		if change.GreaterThan(decimal.NewFromFloat(cfg.ExchangeRateMaxChange)) {
+			return nil, fmt.Errorf("%w: provider rate %s changes %s%% from current %s", ErrInvalidExchangeRate, rate.String(), change.StringFixed(2), current.String())
+		}
+	}
+
+	return s.CreateRate(rate, nil, ExchangeRateSourceProvider, "Đồng bộ từ "+providerName(cfg.ExchangeRateProviderURL), nil)
+}
+
+func providerName(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	if i := strings.Index(url, "/"); i >= 0 {
+		url = url[:i]
+	}
+	return url
+}
+
+// ExchangeRateSyncInterval trả về chu kỳ đồng bộ tỷ giá, 0 nếu không cấu hình provider
+func ExchangeRateSyncInterval() time.Duration {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if strings.TrimSpace(cfg.ExchangeRateProviderURL) == "" || cfg.ExchangeRateSyncHours <= 0 {
+		return 0
+	}
+	return time.Duration(cfg.ExchangeRateSyncHours) * time.Hour
+}
+
+// USDToVND quy đổi theo tỷ giá hiện tại
+func (s *ExchangeRateService) USDToVND(amountUSD float64) decimal.Decimal {
+	return decimal.NewFromFloat(amountUSD).Mul(s.GetCurrentRate())
+}
+
+// VNDToUSD quy đổi theo tỷ giá hiện tại, làm tròn 2 chữ số (amount_usd là decimal(10,2))
+func (s *ExchangeRateService) VNDToUSD(amountVND float64) float64 {
+	usd, _ := decimal.NewFromFloat(amountVND).Div(s.GetCurrentRate()).Round(2).Float64()
+	return usd
+}
+
+// RevenueReport tổng hợp doanh thu đơn đã thanh toán theo ngày/tháng ở cả VND và USD (theo tỷ giá snapshot trên từng đơn)
+func (s *ExchangeRateService) RevenueReport(from, to time.Time, groupBy string) (*model.RevenueReport, error) {
+	periodFormat := "%Y-%m-%d"
+	if groupBy == "month" {
+		periodFormat = "%Y-%m"
+	} else {
+		groupBy = "day"
+	}
+
+	report := &model.RevenueReport{From: from, To: to, GroupBy: groupBy}
+	base := func() *gorm.DB {
+		return s.db.Model(&config.PaymentOrder{}).Where("order_status = ? AND paid_at >= ? AND paid_at < ?", "paid", from, to)
+	}
+	selectSums := "COUNT(*) as orders, COALESCE(SUM(amount_vnd), 0) as amount_vnd, COALESCE(SUM(amount_usd), 0) as amount_usd"
+
+	periodExpr := "DATE_FORMAT(paid_at, '" + periodFormat + "')"
+	if err := base().Select(periodExpr + " as period, " + selectSums).Group(periodExpr).Order("period ASC").Scan(&report.Rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get revenue by period: %v", err)
+	}
+	if err := base().Select("purpose, " + selectSums).Group("purpose").Scan(&report.ByPurpose).Error; err != nil {
+		return nil, fmt.Errorf("failed to get revenue by purpose: %v", err)
+	}
+	if err := base().Select(selectSums).Scan(&report.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to get revenue total: %v", err)
+	}
+
+	fillAverageRate := func(row *model.RevenueReportRow) {
+		if row.AmountUSD > 0 {
+			row.AverageRate, _ = strconv.ParseFloat(decimal.NewFromFloat(row.AmountVND/row.AmountUSD).StringFixed(2), 64)
+		}
+	}
+	for i := range report.Rows {
+		fillAverageRate(&report.Rows[i])
+	}
+	for i := range report.ByPurpose {
+		fillAverageRate(&report.ByPurpose[i])
+	}
+	report.Total.Period = "total"
+	fillAverageRate(&report.Total)
+	return report, nil
+}
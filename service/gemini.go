@@ -13,7 +13,14 @@ import (
 
 // GeminiRequest định nghĩa cấu trúc của request gửi tới Gemini API
 type GeminiRequest struct {
-	Contents []Content `json:"contents"`
+	Contents         []Content               `json:"contents"`
+	GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiGenerationConfig cấu hình output, dùng để ép Gemini trả về JSON theo schema
+type GeminiGenerationConfig struct {
+	ResponseMimeType string                 `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]interface{} `json:"responseSchema,omitempty"`
 }
 
 // Content định nghĩa nội dung gửi tới Gemini API (text, image, v.v.)
@@ -111,6 +118,18 @@ func CountTokens(prompt, apiKey, modelName string) (int, error) {
 
 // GenerateWithGemini gửi text tới Gemini API và nhận phản hồi (ví dụ: caption, dịch, hoặc phân tích)
 func GenerateWithGemini(prompt, apiKey, modelName string) (string, error) {
+	return generateGeminiContent(prompt, apiKey, modelName, nil)
+}
+
+// GenerateJSONWithGemini giống GenerateWithGemini nhưng ép Gemini trả về JSON khớp responseSchema
+func GenerateJSONWithGemini(prompt, apiKey, modelName string, schema map[string]interface{}) (string, error) {
+	return generateGeminiContent(prompt, apiKey, modelName, &GeminiGenerationConfig{
+		ResponseMimeType: "application/json",
+		ResponseSchema:   schema,
+	})
+}
+
+func generateGeminiContent(prompt, apiKey, modelName string, generationConfig *GeminiGenerationConfig) (string, error) {
 	log.Infof("dịch bởi model gemini: %s", modelName)
 	url := "https://generativelanguage.googleapis.com/v1beta/models/" + modelName + ":generateContent"
 
@@ -125,6 +144,7 @@ func GenerateWithGemini(prompt, apiKey, modelName string) (string, error) {
 				},
 			},
 		},
+		GenerationConfig: generationConfig,
 	}
 
 	// Chuyển payload thành JSON
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+)
+
+type GlossaryService struct {
+	db *gorm.DB
+}
+
+func NewGlossaryService(db *gorm.DB) *GlossaryService {
+	return &GlossaryService{db: db}
+}
+
+func validateGlossaryTerm(req model.GlossaryTermRequest) error {
+	if strings.TrimSpace(req.Term) == "" {
+		return fmt.Errorf("term is required")
+	}
+	if !req.DoNotTranslate && strings.TrimSpace(req.Translation) == "" {
+		return fmt.Errorf("term %q needs a translation or do_not_translate", req.Term)
+	}
+	return nil
+}
+
+func newGlossaryTerm(glossaryID uint, req model.GlossaryTermRequest) model.GlossaryTerm {
+	return model.GlossaryTerm{
+		GlossaryID:     glossaryID,
+		Term:           strings.TrimSpace(req.Term),
+		Translation:    strings.TrimSpace(req.Translation),
+		CaseSensitive:  req.CaseSensitive,
+		DoNotTranslate: req.DoNotTranslate,
+		Note:           req.Note,
+	}
+}
+
+func (s *GlossaryService) CreateGlossary(userID uint, req model.CreateGlossaryRequest) (*model.Glossary, error) {
+	for _, term := range req.Terms {
+		if err := validateGlossaryTerm(term); err != nil {
+			return nil, err
+		}
+	}
+
+	glossary := &model.Glossary{
+		UserID:         userID,
+		Name:           req.Name,
+		SourceLanguage: req.SourceLanguage,
+		TargetLanguage: req.TargetLanguage,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(glossary).Error; err != nil {
+			return err
+		}
+		for _, termReq := range req.Terms {
+			term := newGlossaryTerm(glossary.ID, termReq)
+			if err := tx.Create(&term).Error; err != nil {
+				return err
+			}
+			glossary.Terms = append(glossary.Terms, term)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create glossary: %v", err)
+	}
+
+	return glossary, nil
+}
+
+func (s *GlossaryService) GetUserGlossaries(userID uint) ([]model.Glossary, error) {
+	var glossaries []model.Glossary
+
+	if err := s.db.Preload("Terms").Where("user_id = ?", userID).Order("created_at DESC").Find(&glossaries).Error; err != nil {
+		return nil, fmt.Errorf("failed to query user glossaries: %v", err)
+	}
+
+	return glossaries, nil
+}
+
+func (s *GlossaryService) GetGlossary(userID, glossaryID uint) (*model.Glossary, error) {
+	var glossary model.Glossary
+
+	if err := s.db.Preload("Terms").Where("id = ? AND user_id = ?", glossaryID, userID).First(&glossary).Error; err != nil {
+		return nil, fmt.Errorf("failed to get glossary: %v", err)
+	}
+
+	return &glossary, nil
+}
+
+func (s *GlossaryService) UpdateGlossary(userID, glossaryID uint, req model.UpdateGlossaryRequest) error {
+	updates := map[string]interface{}{}
+	if req.Name != "" {
+		updates["name"] = req.Name
+	}
+	if req.TargetLanguage != "" {
+		updates["target_language"] = req.TargetLanguage
+	}
+	// Chỉ đổi source_language khi request có gửi; gửi rỗng nghĩa là áp dụng cho mọi ngôn ngữ nguồn
+	if req.SourceLanguage != nil {
+		updates["source_language"] = *req.SourceLanguage
+	}
+	if len(updates) == 0 {
+		_, err := s.GetGlossary(userID, glossaryID)
+		return err
+	}
+
+	result := s.db.Model(&model.Glossary{}).Where("id = ? AND user_id = ?", glossaryID, userID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update glossary: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s *GlossaryService) DeleteGlossary(userID, glossaryID uint) error {
+	if _, err := s.GetGlossary(userID, glossaryID); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("glossary_id = ?", glossaryID).Delete(&model.GlossaryTerm{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Glossary{}, glossaryID).Error
+	})
+}
+
+func (s *GlossaryService) AddTerm(userID, glossaryID uint, req model.GlossaryTermRequest) (*model.GlossaryTerm, error) {
+	if err := validateGlossaryTerm(req); err != nil {
+		return nil, err
+	}
+	if _, err := s.GetGlossary(userID, glossaryID); err != nil {
+		return nil, err
+	}
+
+	term := newGlossaryTerm(glossaryID, req)
+	if err := s.db.Create(&term).Error; err != nil {
+		return nil, fmt.Errorf("failed to create glossary term: %v", err)
+	}
+
+	return &term, nil
+}
+
+func (s *GlossaryService) UpdateTerm(userID, glossaryID, termID uint, req model.GlossaryTermRequest) error {
+	if err := validateGlossaryTerm(req); err != nil {
+		return err
+	}
+	if _, err := s.GetGlossary(userID, glossaryID); err != nil {
+		return err
+	}
+
+	term := newGlossaryTerm(glossaryID, req)
+	result := s.db.Model(&model.GlossaryTerm{}).Where("id = ? AND glossary_id = ?", termID, glossaryID).Updates(map[string]interface{}{
+		"term":             term.Term,
+		"translation":      term.Translation,
+		"case_sensitive":   term.CaseSensitive,
+		"do_not_translate": term.DoNotTranslate,
+		"note":             term.Note,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update glossary term: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s *GlossaryService) DeleteTerm(userID, glossaryID, termID uint) error {
+	if _, err := s.GetGlossary(userID, glossaryID); err != nil {
+		return err
+	}
+
+	return s.db.Where("id = ? AND glossary_id = ?", termID, glossaryID).Delete(&model.GlossaryTerm{}).Error
+}
+
+// LoadTermsForRequest gộp thuật ngữ của các glossary được gắn vào request cho ngôn ngữ đích.
+// Glossary khác ngôn ngữ đích bị bỏ qua; cùng một term thì glossary đứng sau ghi đè glossary đứng trước
+func (s *GlossaryService) LoadTermsForRequest(userID uint, glossaryIDs []uint, targetLanguage string) ([]model.GlossaryTerm, error) {
+	if len(glossaryIDs) == 0 {
+		return nil, nil
+	}
+
+	var glossaries []model.Glossary
+	if err := s.db.Preload("Terms").Where("id IN ? AND user_id = ?", glossaryIDs, userID).Find(&glossaries).Error; err != nil {
+		return nil, fmt.Errorf("failed to load glossaries: %v", err)
+	}
+	byID := make(map[uint]model.Glossary, len(glossaries))
+	for _, glossary := range glossaries {
+		byID[glossary.ID] = glossary
+	}
+
+	var terms []model.GlossaryTerm
+	position := make(map[string]int)
+	for _, id := range glossaryIDs {
+		glossary, ok := byID[id]
+		if !ok {
+			log.Printf("Glossary %d not found for user %d, skipping", id, userID)
+			continue
+		}
+		if targetLanguage != "" && glossary.TargetLanguage != targetLanguage {
+			log.Printf("Glossary %d targets %s, not %s, skipping", id, glossary.TargetLanguage, targetLanguage)
+			continue
+		}
+		for _, term := range glossary.Terms {
+			key := strings.ToLower(term.Term)
+			if i, exists := position[key]; exists {
+				terms[i] = term
+				continue
+			}
+			position[key] = len(terms)
+			terms = append(terms, term)
+		}
+	}
+
+	return terms, nil
+}
+
+// LoadGlossaryTermsForRequest là helper dùng trong pipeline dịch, lỗi khi load glossary không làm hỏng job
+func LoadGlossaryTermsForRequest(userID uint, glossaryIDs []uint, targetLanguage string) []model.GlossaryTerm {
+	terms, err := NewGlossaryService(config.Db).LoadTermsForRequest(userID, glossaryIDs, targetLanguage)
+	if err != nil {
+		log.Printf("Failed to load glossaries %v for user %d: %v", glossaryIDs, userID, err)
+		return nil
+	}
+	return terms
+}
+
+// ParseGlossaryIDs đọc glossary_ids dạng "1,2,3" từ form-data
+func ParseGlossaryIDs(value string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			log.Printf("Invalid glossary id %q, skipping", part)
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids
+}
+
+// GlossaryFingerprint trả về hash của bộ thuật ngữ, dùng làm một phần key cache bản dịch
+func GlossaryFingerprint(terms []model.GlossaryTerm) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	type termKey struct {
+		Term, Translation             string
+		CaseSensitive, DoNotTranslate bool
+	}
+	keys := make([]termKey, 0, len(terms))
+	for _, term := range terms {
+		keys = append(keys, termKey{term.Term, term.Translation, term.CaseSensitive, term.DoNotTranslate})
+	}
+	data, _ := json.Marshal(keys)
+	return HashBytes(data)
+}
+
+// FormatGlossaryPrompt tạo phần thuật ngữ bắt buộc để chèn vào prompt dịch
+func FormatGlossaryPrompt(terms []model.GlossaryTerm) string {
+	if len(terms) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("THUẬT NGỮ BẮT BUỘC (glossary của người dùng, ưu tiên cao hơn mọi quy tắc đặt tên khác):\n")
+	for _, term := range terms {
+		caseNote := ""
+		if term.CaseSensitive {
+			caseNote = " (giữ đúng chữ hoa/thường)"
+		}
+		if term.DoNotTranslate {
+			b.WriteString(fmt.Sprintf("  + %s → GIỮ NGUYÊN, không dịch%s\n", term.Term, caseNote))
+		} else {
+			b.WriteString(fmt.Sprintf("  + %s → %s%s\n", term.Term, term.Translation, caseNote))
+		}
+		if term.Note != "" {
+			b.WriteString(fmt.Sprintf("    ghi chú: %s\n", term.Note))
+		}
+	}
+	return b.String()
+}
+
+// containsTerm kiểm tra text có chứa term, với term chữ Latin thì yêu cầu ranh giới từ để "cat" không khớp "category"
+func containsTerm(text, term string, caseSensitive bool) bool {
+	if term == "" {
+		return false
+	}
+	if !caseSensitive {
+		text = strings.ToLower(text)
+		term = strings.ToLower(term)
+	}
+
+	textRunes := []rune(text)
+	termRunes := []rune(term)
+	needBoundary := isWordRune(termRunes[0]) && termRunes[0] < unicode.MaxLatin1
+
+	offset := 0
+	for {
+		i := strings.Index(text[offset:], term)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(term)
+		if !needBoundary {
+			return true
+		}
+		startRune := len([]rune(text[:start]))
+		endRune := startRune + len(termRunes)
+		beforeOK := startRune == 0 || !isWordRune(textRunes[startRune-1])
+		afterOK := endRune >= len(textRunes) || !isWordRune(textRunes[endRune])
+		if beforeOK && afterOK {
+			return true
+		}
+		offset = end
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// CheckGlossaryCompliance so sánh SRT gốc với SRT đã dịch theo số thứ tự cue,
+// trả về các cue có chứa term trong bản gốc nhưng bản dịch không dùng đúng bản dịch (hoặc không giữ nguyên term)
+func CheckGlossaryCompliance(sourceSRT, translatedSRT string, terms []model.GlossaryTerm) []model.GlossaryViolation {
+	violations := []model.GlossaryViolation{}
+	if len(terms) == 0 {
+		return violations
+	}
+
+	sourceEntries, err := parseSRT(cleanSRTContent(sourceSRT))
+	if err != nil {
+		return violations
+	}
+	translatedEntries, err := parseSRT(cleanSRTContent(translatedSRT))
+	if err != nil {
+		return violations
+	}
+	translatedByIndex := make(map[int]string, len(translatedEntries))
+	for _, entry := range translatedEntries {
+		translatedByIndex[entry.Index] = entry.Text
+	}
+
+	for _, source := range sourceEntries {
+		translated, ok := translatedByIndex[source.Index]
+		if !ok {
+			continue
+		}
+		for _, term := range terms {
+			if !containsTerm(source.Text, term.Term, term.CaseSensitive) {
+				continue
+			}
+			expected := term.Translation
+			if term.DoNotTranslate {
+				expected = term.Term
+			}
+			if containsTerm(translated, expected, term.CaseSensitive) {
+				continue
+			}
+			violations = append(violations, model.GlossaryViolation{
+				CueIndex:       source.Index,
+				Term:           term.Term,
+				Expected:       expected,
+				SourceText:     source.Text,
+				TranslatedText: translated,
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		log.Printf("Glossary check: %d cues did not respect glossary terms", len(violations))
+	}
+	return violations
+}
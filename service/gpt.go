@@ -11,8 +11,14 @@ import (
 )
 
 type GPTRequest struct {
-	Model    string       `json:"model"`
-	Messages []GPTMessage `json:"messages"`
+	Model          string             `json:"model"`
+	Messages       []GPTMessage       `json:"messages"`
+	ResponseFormat *GPTResponseFormat `json:"response_format,omitempty"`
+}
+
+// GPTResponseFormat bật JSON mode ({"type": "json_object"})
+type GPTResponseFormat struct {
+	Type string `json:"type"`
 }
 
 type GPTMessage struct {
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvoiceNotAvailable   = errors.New("invoice is only available for paid orders")
+	ErrInvalidStatementMonth = errors.New("invalid statement month")
+	ErrInvalidBillingProfile = errors.New("invalid billing profile")
+	ErrPDFUnavailable        = errors.New("pdf rendering is not available")
+)
+
+const pdfRenderTimeout = time.Minute
+
+var taxCodeRegex = regexp.MustCompile(`^\d{10}(-\d{3})?$`)
+
+// InvoiceService xuất hoá đơn cho đơn thanh toán và sao kê credit sử dụng hằng tháng
+type InvoiceService struct {
+	db *gorm.DB
+}
+
+func NewInvoiceService(db *gorm.DB) *InvoiceService {
+	return &InvoiceService{db: db}
+}
+
+// GetBillingProfile lấy thông tin xuất hoá đơn của user, chưa có thì trả về bản trống
+func (s *InvoiceService) GetBillingProfile(userID uint) (*model.BillingProfile, error) {
+	var profile model.BillingProfile
+	err := s.db.Where("user_id = ?", userID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.BillingProfile{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// UpdateBillingProfile tạo hoặc cập nhật thông tin xuất hoá đơn. Hoá đơn đã xuất giữ nguyên thông tin cũ
+func (s *InvoiceService) UpdateBillingProfile(userID uint, req model.BillingProfileRequest) (*model.BillingProfile, error) {
+	taxCode := strings.TrimSpace(req.TaxCode)
+	if taxCode != "" && !taxCodeRegex.MatchString(taxCode) {
+		return nil, fmt.Errorf("%w: tax_code must be 10 digits or 10 digits-3 digits", ErrInvalidBillingProfile)
+	}
+	if taxCode != "" && strings.TrimSpace(req.CompanyName) == "" {
+		return nil, fmt.Errorf("%w: company_name is required with tax_code", ErrInvalidBillingProfile)
+	}
+
+	profile, err := s.GetBillingProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	profile.CompanyName = strings.TrimSpace(req.CompanyName)
+	profile.TaxCode = taxCode
+	profile.Address = strings.TrimSpace(req.Address)
+	profile.BillingEmail = strings.TrimSpace(req.BillingEmail)
+	profile.ContactName = strings.TrimSpace(req.ContactName)
+	profile.Phone = strings.TrimSpace(req.Phone)
+
+	if err := s.db.Save(profile).Error; err != nil {
+		return nil, fmt.Errorf("failed to save billing profile: %v", err)
+	}
+	return profile, nil
+}
+
+// GetOrCreateInvoice lấy hoá đơn của đơn đã thanh toán, xuất mới ở lần tải đầu tiên.
+// Đơn không thuộc user trả về gorm.ErrRecordNotFound
+func (s *InvoiceService) GetOrCreateInvoice(userID uint, orderCode string) (*model.Invoice, error) {
+	var order config.PaymentOrder
+	if err := s.db.Where("order_code = ? AND user_id = ?", orderCode, userID).First(&order).Error; err != nil {
+		return nil, err
+	}
+	if order.OrderStatus != "paid" || order.PaidAt == nil {
+		return nil, ErrInvoiceNotAvailable
+	}
+
+	var invoice model.Invoice
+	err := s.db.Where("order_id = ?", order.ID).First(&invoice).Error
+	if err == nil {
+		return &invoice, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	invoice, err = s.buildInvoice(&order)
+	if err != nil {
+		return nil, err
+	}
+
+	// Số hoá đơn theo ID nên tạo bản ghi trước rồi gán số; unique order_id chặn xuất trùng khi tải đồng thời
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invoice).Error; err != nil {
+			return err
+		}
+		invoice.InvoiceNumber = fmt.Sprintf("INV%s-%06d", invoice.PaidAt.Format("200601"), invoice.ID)
+		return tx.Model(&invoice).Update("invoice_number", invoice.InvoiceNumber).Error
+	})
+	if err != nil {
+		var existing model.Invoice
+		if getErr := s.db.Where("order_id = ?", order.ID).First(&existing).Error; getErr == nil {
+			return &existing, nil
+		}
+		return nil, fmt.Errorf("failed to create invoice: %v", err)
+	}
+
+	log.Printf("Issued invoice %s for order %s", invoice.InvoiceNumber, order.OrderCode)
+	return &invoice, nil
+}
+
+func (s *InvoiceService) buildInvoice(order *config.PaymentOrder) (model.Invoice, error) {
+	var user config.Users
+	if err := s.db.First(&user, order.UserID).Error; err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to get user: %v", err)
+	}
+	profile, err := s.GetBillingProfile(order.UserID)
+	if err != nil {
+		return model.Invoice{}, err
+	}
+
+	// Số tiền thực nhận/credit thực cộng (đơn có thể nhận thiếu/thừa), không gồm credit thưởng
+	amountVND := order.AmountVND
+	if order.AmountReceivedVND != nil {
+		amountVND = *order.AmountReceivedVND
+	}
+	amountUSD := order.AmountUSD
+	description := "Nạp credit"
+	if order.Purpose == OrderPurposeSubscription {
+		description = "Thanh toán gói subscription"
+	} else if order.CreditedUSD != nil {
+		amountUSD = *order.CreditedUSD
+	}
+
+	transactionID := ""
+	if order.TransactionID != nil {
+		transactionID = *order.TransactionID
+	}
+	buyerName := profile.ContactName
+	if buyerName == "" {
+		buyerName = user.Name
+	}
+	buyerEmail := profile.BillingEmail
+	if buyerEmail == "" {
+		buyerEmail = user.Email
+	}
+
+	return model.Invoice{
+		InvoiceNumber: "PENDING-" + order.OrderCode,
+		UserID:        order.UserID,
+		OrderID:       order.ID,
+		OrderCode:     order.OrderCode,
+		Purpose:       order.Purpose,
+		Description:   description,
+		AmountVND:     amountVND,
+		AmountUSD:     amountUSD,
+		ExchangeRate:  order.ExchangeRate,
+		BankName:      order.BankName,
+		BankAccount:   order.BankAccount,
+		TransactionID: transactionID,
+		PaidAt:        *order.PaidAt,
+		BuyerName:     buyerName,
+		BuyerEmail:    buyerEmail,
+		BuyerCompany:  profile.CompanyName,
+		BuyerTaxCode:  profile.TaxCode,
+		BuyerAddress:  profile.Address,
+		IssuedAt:      time.Now(),
+	}, nil
+}
+
+// ParseStatementMonth đọc tháng dạng YYYY-MM, không nhận tháng trong tương lai
+func ParseStatementMonth(month string) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: expected YYYY-MM", ErrInvalidStatementMonth)
+	}
+	if from.After(time.Now()) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: month is in the future", ErrInvalidStatementMonth)
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// BuildUsageStatement tổng hợp credit sử dụng trong tháng theo service và theo video.
+// Chi phí = giao dịch deduct, trừ đi refund; lock/unlock chỉ là tạm giữ nên không tính
+func (s *InvoiceService) BuildUsageStatement(userID uint, month string) (*model.UsageStatement, error) {
+	from, to, err := ParseStatementMonth(month)
+	if err != nil {
+		return nil, err
+	}
+
+	var user config.Users
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user: %v", err)
+	}
+	profile, err := s.GetBillingProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []config.CreditTransaction
+	err = s.db.Where("user_id = ? AND transaction_status = ? AND created_at >= ? AND created_at < ?", userID, "completed", from, to).
+		Where("transaction_type IN ?", []string{"add", "deduct", "refund"}).
+		Order("created_at ASC, id ASC").
+		Find(&transactions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit transactions: %v", err)
+	}
+
+	statement := &model.UsageStatement{
+		Month:       month,
+		From:        from,
+		To:          to,
+		UserID:      userID,
+		UserName:    user.Name,
+		UserEmail:   user.Email,
+		Services:    []model.UsageStatementService{},
+		Videos:      []model.UsageStatementVideo{},
+		GeneratedAt: time.Now(),
+	}
+	if profile.ID > 0 {
+		statement.Billing = profile
+	}
+
+	services := map[string]*model.UsageStatementService{}
+	videos := map[uint]*model.UsageStatementVideo{}
+	videoServices := map[uint]map[string]bool{}
+	for _, tx := range transactions {
+		if tx.TransactionType == "add" {
+			statement.TotalTopup += tx.Amount
+			continue
+		}
+
+		serviceName := tx.Service
+		if serviceName == "" {
+			serviceName = "other"
+		}
+		svc, ok := services[serviceName]
+		if !ok {
+			svc = &model.UsageStatementService{Service: serviceName}
+			services[serviceName] = svc
+		}
+
+		var video *model.UsageStatementVideo
+		if tx.VideoID != nil {
+			video, ok = videos[*tx.VideoID]
+			if !ok {
+				video = &model.UsageStatementVideo{VideoID: *tx.VideoID}
+				videos[*tx.VideoID] = video
+				videoServices[*tx.VideoID] = map[string]bool{}
+			}
+			videoServices[*tx.VideoID][serviceName] = true
+		}
+
+		if tx.TransactionType == "deduct" {
+			statement.TotalCharged += tx.Amount
+			svc.Transactions++
+			svc.UnitsUsed += tx.UnitsUsed
+			svc.Charged += tx.Amount
+			if video != nil {
+				video.Charged += tx.Amount
+			}
+		} else {
+			statement.TotalRefunded += tx.Amount
+			svc.Refunded += tx.Amount
+			if video != nil {
+				video.Refunded += tx.Amount
+			}
+		}
+	}
+	statement.NetUsage = roundStatementAmount(statement.TotalCharged - statement.TotalRefunded)
+	statement.TotalCharged = roundStatementAmount(statement.TotalCharged)
+	statement.TotalRefunded = roundStatementAmount(statement.TotalRefunded)
+	statement.TotalTopup = roundStatementAmount(statement.TotalTopup)
+
+	for _, svc := range services {
+		svc.Net = roundStatementAmount(svc.Charged - svc.Refunded)
+		svc.Charged = roundStatementAmount(svc.Charged)
+		svc.Refunded = roundStatementAmount(svc.Refunded)
+		statement.Services = append(statement.Services, *svc)
+	}
+	sort.Slice(statement.Services, func(i, j int) bool {
+		return statement.Services[i].Net > statement.Services[j].Net
+	})
+
+	if len(videos) > 0 {
+		videoIDs := make([]uint, 0, len(videos))
+		for id := range videos {
+			videoIDs = append(videoIDs, id)
+		}
+		var histories []config.CaptionHistory
+		s.db.Select("id", "video_filename_origin").Where("id IN ?", videoIDs).Find(&histories)
+		for _, h := range histories {
+			if video, ok := videos[h.ID]; ok {
+				video.VideoFilename = h.VideoFilenameOrigin
+			}
+		}
+	}
+	for id, video := range videos {
+		for serviceName := range videoServices[id] {
+			video.Services = append(video.Services, serviceName)
+		}
+		sort.Strings(video.Services)
+		video.Net = roundStatementAmount(video.Charged - video.Refunded)
+		video.Charged = roundStatementAmount(video.Charged)
+		video.Refunded = roundStatementAmount(video.Refunded)
+		statement.Videos = append(statement.Videos, *video)
+	}
+	sort.Slice(statement.Videos, func(i, j int) bool {
+		return statement.Videos[i].VideoID < statement.Videos[j].VideoID
+	})
+
+	return statement, nil
+}
+
+// Credit lưu 6 chữ số thập phân, sao kê hiển thị 4
+func roundStatementAmount(amount float64) float64 {
+	return decimal.NewFromFloat(amount).Round(4).InexactFloat64()
+}
+
+// RenderInvoiceHTML dựng hoá đơn HTML (in được hoặc chuyển sang PDF)
+func (s *InvoiceService) RenderInvoiceHTML(invoice *model.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := invoiceTemplate.Execute(&buf, invoiceView{Seller: loadInvoiceSeller(), Invoice: invoice}); err != nil {
+		return nil, fmt.Errorf("failed to render invoice: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderStatementHTML dựng sao kê tháng HTML
+func (s *InvoiceService) RenderStatementHTML(statement *model.UsageStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := statementTemplate.Execute(&buf, statementView{Seller: loadInvoiceSeller(), Statement: statement}); err != nil {
+		return nil, fmt.Errorf("failed to render statement: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderPDF chuyển HTML sang PDF bằng INVOICE_PDF_CMD (mặc định wkhtmltopdf, đọc stdin và ghi stdout)
+func (s *InvoiceService) RenderPDF(html []byte) ([]byte, error) {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if cfg.InvoicePdfCmd == "" {
+		return nil, fmt.Errorf("%w: INVOICE_PDF_CMD is not configured", ErrPDFUnavailable)
+	}
+	cmdPath, err := exec.LookPath(cfg.InvoicePdfCmd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: command %q not found", ErrPDFUnavailable, cfg.InvoicePdfCmd)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfRenderTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cmdPath, "--quiet", "--encoding", "utf-8", "-", "-")
+	cmd.Stdin = bytes.NewReader(html)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render pdf: %v, output: %s", err, stderr.String())
+	}
+	if !bytes.HasPrefix(output, []byte("%PDF")) {
+		return nil, fmt.Errorf("failed to render pdf: command returned no PDF data")
+	}
+	return output, nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"html/template"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// invoiceSeller thông tin bên bán in trên hoá đơn (INVOICE_SELLER_*)
+type invoiceSeller struct {
+	Name    string
+	Address string
+	TaxCode string
+	Email   string
+}
+
+type invoiceView struct {
+	Seller  invoiceSeller
+	Invoice *model.Invoice
+}
+
+type statementView struct {
+	Seller    invoiceSeller
+	Statement *model.UsageStatement
+}
+
+func loadInvoiceSeller() invoiceSeller {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	return invoiceSeller{
+		Name:    cfg.InvoiceSellerName,
+		Address: cfg.InvoiceSellerAddress,
+		TaxCode: cfg.InvoiceSellerTaxCode,
+		Email:   cfg.InvoiceSellerEmail,
+	}
+}
+
+// formatThousands chèn dấu chấm phân cách hàng nghìn theo kiểu Việt Nam (1.250.000)
+func formatThousands(digits string) string {
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+	var out strings.Builder
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteByte('.')
+		}
+		out.WriteRune(r)
+	}
+	if negative {
+		return "-" + out.String()
+	}
+	return out.String()
+}
+
+var invoiceTemplateFuncs = template.FuncMap{
+	"vnd": func(amount decimal.Decimal) string {
+		return formatThousands(amount.Round(0).String()) + " ₫"
+	},
+	"usd": func(amount decimal.Decimal) string {
+		return "$" + amount.StringFixed(2)
+	},
+	"rate": func(rate decimal.Decimal) string {
+		return formatThousands(rate.Round(0).String())
+	},
+	"credit": func(amount float64) string {
+		return decimal.NewFromFloat(amount).StringFixed(4)
+	},
+	"units": func(amount float64) string {
+		return decimal.NewFromFloat(amount).Round(2).String()
+	},
+	"datetime": func(t time.Time) string {
+		return t.Format("02/01/2006 15:04")
+	},
+	"date": func(t time.Time) string {
+		return t.Format("02/01/2006")
+	},
+	"lastDay": func(t time.Time) time.Time {
+		return t.AddDate(0, 0, -1)
+	},
+	"join": strings.Join,
+}
+
+const documentStyle = `
+<style>
+  body { font-family: "DejaVu Sans", Arial, sans-serif; font-size: 13px; color: #222; margin: 32px; }
+  h1 { font-size: 22px; margin: 0 0 4px; }
+  .muted { color: #666; }
+  .header { display: flex; justify-content: space-between; margin-bottom: 24px; }
+  .parties { width: 100%; margin-bottom: 24px; }
+  .parties td { vertical-align: top; width: 50%; padding-right: 16px; }
+  table.lines { width: 100%; border-collapse: collapse; margin-bottom: 16px; }
+  table.lines th, table.lines td { border: 1px solid #ccc; padding: 6px 8px; text-align: left; }
+  table.lines th { background: #f3f3f3; }
+  td.num, th.num { text-align: right; }
+  .total td { font-weight: bold; }
+  .footer { margin-top: 32px; font-size: 11px; color: #666; }
+</style>`
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(invoiceTemplateFuncs).Parse(`<!DOCTYPE html>
+<html lang="vi">
+<head>
+<meta charset="utf-8">
+<title>Hoá đơn {{.Invoice.InvoiceNumber}}</title>` + documentStyle + `
+</head>
+<body>
+<div class="header">
+  <div>
+    <h1>HOÁ ĐƠN / BIÊN NHẬN THANH TOÁN</h1>
+    <div class="muted">Số: <strong>{{.Invoice.InvoiceNumber}}</strong> · Ngày xuất: {{date .Invoice.IssuedAt}}</div>
+  </div>
+</div>
+<table class="parties">
+  <tr>
+    <td>
+      <strong>Bên bán</strong><br>
+      {{.Seller.Name}}<br>
+      {{if .Seller.Address}}{{.Seller.Address}}<br>{{end}}
+      {{if .Seller.TaxCode}}MST: {{.Seller.TaxCode}}<br>{{end}}
+      {{if .Seller.Email}}{{.Seller.Email}}{{end}}
+    </td>
+    <td>
+      <strong>Bên mua</strong><br>
+      {{if .Invoice.BuyerCompany}}{{.Invoice.BuyerCompany}}<br>{{end}}
+      {{if .Invoice.BuyerTaxCode}}MST: {{.Invoice.BuyerTaxCode}}<br>{{end}}
+      {{if .Invoice.BuyerAddress}}{{.Invoice.BuyerAddress}}<br>{{end}}
+      {{if .Invoice.BuyerName}}{{.Invoice.BuyerName}}<br>{{end}}
+      {{.Invoice.BuyerEmail}}
+    </td>
+  </tr>
+</table>
+<table class="lines">
+  <tr><th>Nội dung</th><th>Mã đơn</th><th class="num">Credit (USD)</th><th class="num">Tỷ giá</th><th class="num">Thành tiền</th></tr>
+  <tr>
+    <td>{{.Invoice.Description}}</td>
+    <td>{{.Invoice.OrderCode}}</td>
+    <td class="num">{{usd .Invoice.AmountUSD}}</td>
+    <td class="num">{{rate .Invoice.ExchangeRate}}</td>
+    <td class="num">{{vnd .Invoice.AmountVND}}</td>
+  </tr>
+  <tr class="total"><td colspan="4">Tổng cộng đã thanh toán</td><td class="num">{{vnd .Invoice.AmountVND}}</td></tr>
+</table>
+<table class="lines">
+  <tr><th>Hình thức</th><td>Chuyển khoản ngân hàng</td></tr>
+  <tr><th>Ngân hàng nhận</th><td>{{.Invoice.BankName}} - {{.Invoice.BankAccount}}</td></tr>
+  {{if .Invoice.TransactionID}}<tr><th>Mã giao dịch</th><td>{{.Invoice.TransactionID}}</td></tr>{{end}}
+  <tr><th>Thời gian thanh toán</th><td>{{datetime .Invoice.PaidAt}}</td></tr>
+</table>
+<div class="footer">Credit thưởng (khuyến mãi, nạp lần đầu) không được tính vào hoá đơn. Chứng từ được tạo tự động từ hệ thống.</div>
+</body>
+</html>`))
+
+var statementTemplate = template.Must(template.New("statement").Funcs(invoiceTemplateFuncs).Parse(`<!DOCTYPE html>
+<html lang="vi">
+<head>
+<meta charset="utf-8">
+<title>Sao kê sử dụng {{.Statement.Month}}</title>` + documentStyle + `
+</head>
+<body>
+<div class="header">
+  <div>
+    <h1>SAO KÊ SỬ DỤNG CREDIT</h1>
+    <div class="muted">Kỳ: {{date .Statement.From}} - {{date (lastDay .Statement.To)}} · Tạo lúc: {{datetime .Statement.GeneratedAt}}</div>
+  </div>
+</div>
+<table class="parties">
+  <tr>
+    <td>
+      <strong>Nhà cung cấp</strong><br>
+      {{.Seller.Name}}<br>
+      {{if .Seller.TaxCode}}MST: {{.Seller.TaxCode}}<br>{{end}}
+      {{if .Seller.Email}}{{.Seller.Email}}{{end}}
+    </td>
+    <td>
+      <strong>Khách hàng</strong><br>
+      {{with .Statement.Billing}}{{if .CompanyName}}{{.CompanyName}}<br>{{end}}{{if .TaxCode}}MST: {{.TaxCode}}<br>{{end}}{{if .Address}}{{.Address}}<br>{{end}}{{end}}
+      {{if .Statement.UserName}}{{.Statement.UserName}}<br>{{end}}
+      {{.Statement.UserEmail}}
+    </td>
+  </tr>
+</table>
+<table class="lines">
+  <tr><th>Credit nạp trong kỳ</th><td class="num">{{credit .Statement.TotalTopup}}</td></tr>
+  <tr><th>Credit sử dụng</th><td class="num">{{credit .Statement.TotalCharged}}</td></tr>
+  <tr><th>Credit hoàn lại</th><td class="num">{{credit .Statement.TotalRefunded}}</td></tr>
+  <tr class="total"><td>Sử dụng thực tế</td><td class="num">{{credit .Statement.NetUsage}}</td></tr>
+</table>
+<h3>Theo dịch vụ</h3>
+<table class="lines">
+  <tr><th>Dịch vụ</th><th class="num">Số giao dịch</th><th class="num">Đơn vị</th><th class="num">Sử dụng</th><th class="num">Hoàn lại</th><th class="num">Thực tế</th></tr>
+  {{range .Statement.Services}}
+  <tr><td>{{.Service}}</td><td class="num">{{.Transactions}}</td><td class="num">{{units .UnitsUsed}}</td><td class="num">{{credit .Charged}}</td><td class="num">{{credit .Refunded}}</td><td class="num">{{credit .Net}}</td></tr>
+  {{else}}
+  <tr><td colspan="6" class="muted">Không có giao dịch trong kỳ</td></tr>
+  {{end}}
+</table>
+{{if .Statement.Videos}}
+<h3>Theo video</h3>
+<table class="lines">
+  <tr><th>Video</th><th>Dịch vụ</th><th class="num">Sử dụng</th><th class="num">Hoàn lại</th><th class="num">Thực tế</th></tr>
+  {{range .Statement.Videos}}
+  <tr><td>#{{.VideoID}} {{.VideoFilename}}</td><td>{{join .Services ", "}}</td><td class="num">{{credit .Charged}}</td><td class="num">{{credit .Refunded}}</td><td class="num">{{credit .Net}}</td></tr>
+  {{end}}
+</table>
+{{end}}
+<div class="footer">Số liệu tính bằng credit (1 credit = 1 USD). Chứng từ được tạo tự động từ hệ thống.</div>
+</body>
+</html>`))
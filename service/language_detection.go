@@ -0,0 +1,156 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Độ tin cậy tối thiểu để dùng kết quả detect từ text làm ngôn ngữ nguồn (bỏ qua dịch khi trùng ngôn ngữ đích)
+const minSourceLanguageConfidence = 0.6
+
+// whisperLanguageCodes map tên ngôn ngữ Whisper verbose_json trả về ("english", "vietnamese"...) sang mã ISO 639-1
+var whisperLanguageCodes = map[string]string{
+	"vietnamese": "vi", "english": "en", "japanese": "ja", "korean": "ko",
+	"chinese": "zh", "cantonese": "zh", "mandarin": "zh", "french": "fr",
+	"german": "de", "spanish": "es", "portuguese": "pt", "russian": "ru",
+	"thai": "th", "indonesian": "id", "malay": "ms", "tagalog": "tl",
+	"italian": "it", "dutch": "nl", "turkish": "tr", "arabic": "ar",
+	"hindi": "hi", "polish": "pl", "ukrainian": "uk", "khmer": "km", "lao": "lo",
+}
+
+// Từ phổ biến đặc trưng của từng ngôn ngữ Latin (bỏ các từ trùng giữa nhiều ngôn ngữ như "de", "la", "en")
+var languageStopwords = map[string]map[string]bool{
+	"en": wordSet("the", "and", "is", "are", "was", "were", "you", "i", "to", "of", "that", "it", "this", "what", "have", "with", "for", "not", "be", "my", "your", "we", "they", "he", "she", "do", "don't", "can", "will", "just", "so", "but", "there", "here", "know", "me"),
+	"fr": wordSet("le", "les", "et", "est", "je", "tu", "vous", "nous", "pas", "une", "des", "du", "ce", "qui", "dans", "pour", "avec", "sur", "mais", "c'est", "il", "elle", "on", "au", "aux", "mon", "ton", "oui", "très"),
+	"de": wordSet("der", "die", "das", "und", "ist", "ich", "du", "nicht", "ein", "eine", "zu", "mit", "auf", "für", "es", "wir", "ihr", "sie", "sind", "auch", "was", "wie", "aber", "dass", "mein", "den", "dem", "ja", "nein"),
+	"es": wordSet("el", "los", "las", "y", "es", "que", "por", "para", "con", "yo", "tú", "está", "pero", "muy", "qué", "como", "del", "lo", "se", "su", "al", "una", "sí", "hola", "gracias"),
+	"vi": wordSet("tôi", "là", "và", "của", "không", "có", "được", "những", "một", "các", "người", "này", "cho", "với", "anh", "em", "chúng", "ta", "đi", "rồi", "thì", "mà", "nhé", "ạ"),
+}
+
+// Ký tự có dấu chỉ xuất hiện trong tiếng Việt (bỏ à, é, â, ô... vì tiếng Pháp/Tây Ban Nha cũng dùng)
+const vietnameseOnlyChars = "ạảãầấậẩẫăằắặẳẵẹẻẽềếệểễịỉĩọỏồốộổỗơờớợởỡụủũưừứựửữỳỵỷỹđ"
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// NormalizeLanguageCode chuẩn hoá ngôn ngữ về mã ISO 639-1: "english" → "en", "zh-CN" → "zh", "" → ""
+func NormalizeLanguageCode(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		return ""
+	}
+	if code, ok := whisperLanguageCodes[language]; ok {
+		return code
+	}
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		language = language[:i]
+	}
+	return language
+}
+
+// IsSameLanguage kiểm tra ngôn ngữ nguồn đã là ngôn ngữ đích (không cần dịch). Nguồn chưa xác định thì luôn dịch
+func IsSameLanguage(sourceLanguage, targetLanguage string) bool {
+	source := NormalizeLanguageCode(sourceLanguage)
+	return source != "" && source == NormalizeLanguageCode(targetLanguage)
+}
+
+// DetectTextLanguage xác định ngôn ngữ của đoạn text theo hệ chữ (Hangul, Kana, Hán) và tần suất từ phổ biến,
+// trả về mã ngôn ngữ và độ tin cậy 0-1. Không đủ dấu hiệu thì trả về ("", 0)
+func DetectTextLanguage(text string) (string, float64) {
+	text = strings.ToLower(text)
+
+	var hangul, kana, han, latin int
+	for _, r := range text {
+		switch {
+		case r >= 0xAC00 && r <= 0xD7AF:
+			hangul++
+		case (r >= 0x3040 && r <= 0x309F) || (r >= 0x30A0 && r <= 0x30FF):
+			kana++
+		case (r >= 0x4E00 && r <= 0x9FFF) || (r >= 0x3400 && r <= 0x4DBF):
+			han++
+		case unicode.IsLetter(r) && r < 0x2000:
+			latin++
+		}
+	}
+
+	// Chữ CJK chiếm đa số: phân biệt theo Hangul / Kana (tiếng Nhật luôn có Kana xen với Kanji)
+	if cjk := hangul + kana + han; cjk > 0 && cjk >= latin {
+		confidence := float64(cjk) / float64(cjk+latin)
+		switch {
+		case hangul >= kana+han:
+			return "ko", confidence
+		case kana > 0 && float64(kana) >= 0.1*float64(kana+han):
+			return "ja", confidence
+		default:
+			return "zh", confidence
+		}
+	}
+
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) == 0 {
+		return "", 0
+	}
+
+	scores := make(map[string]float64)
+	total := 0.0
+	for _, word := range words {
+		if strings.ContainsAny(word, vietnameseOnlyChars) {
+			scores["vi"]++
+			total++
+			continue
+		}
+		for language, stopwords := range languageStopwords {
+			if stopwords[word] {
+				scores[language]++
+				total++
+			}
+		}
+	}
+	if total == 0 {
+		return "", 0
+	}
+
+	best, bestScore := "", 0.0
+	for _, language := range []string{"vi", "en", "fr", "de", "es"} {
+		if scores[language] > bestScore {
+			best, bestScore = language, scores[language]
+		}
+	}
+	confidence := bestScore / total
+	// Quá ít từ nhận diện được thì giảm độ tin cậy (câu 1-2 từ dễ trùng giữa các ngôn ngữ)
+	if bestScore < 3 {
+		confidence *= bestScore / 3
+	}
+	return best, confidence
+}
+
+// ResolveSourceLanguage chọn ngôn ngữ nguồn: ngôn ngữ Whisper trả về → detect từ transcript nếu đủ tin cậy → "" (không xác định)
+func ResolveSourceLanguage(whisperLanguage, transcript string) string {
+	if code := NormalizeLanguageCode(whisperLanguage); code != "" {
+		return code
+	}
+	if language, confidence := DetectTextLanguage(transcript); confidence >= minSourceLanguageConfidence {
+		return language
+	}
+	return ""
+}
+
+// sourceLanguageClause trả về " từ <tên ngôn ngữ>" để chèn vào prompt dịch, rỗng khi chưa xác định được ngôn ngữ nguồn
+func sourceLanguageClause(sourceLanguage string) string {
+	code := NormalizeLanguageCode(sourceLanguage)
+	if code == "" {
+		return ""
+	}
+	name := getLanguageNameForAI(code)
+	if name == getLanguageNameForAI("vi") && code != "vi" {
+		return ""
+	}
+	return " từ " + name
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+)
+
+var ErrMailerDisabled = errors.New("mailer is not configured")
+
+// SendMail gửi mail text/plain UTF-8 qua SMTP (SMTP_HOST). STARTTLS được dùng khi server hỗ trợ.
+// SMTP_HOST=stub:<thư mục> ghi mail ra file .eml thay vì gửi, dùng khi chạy local/test
+func SendMail(to, subject, body string) error {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if cfg.SmtpHost == "" {
+		return ErrMailerDisabled
+	}
+
+	from := cfg.SmtpFrom
+	if from == "" {
+		from = cfg.SmtpUsername
+	}
+	message := buildMailMessage(from, to, subject, body)
+
+	if dir, ok := strings.CutPrefix(cfg.SmtpHost, "stub:"); ok {
+		name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), NormalizeDeviceID(to))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create stub mail dir: %v", err)
+		}
+		return os.WriteFile(filepath.Join(dir, name), message, 0o644)
+	}
+
+	var auth smtp.Auth
+	if cfg.SmtpUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SmtpUsername, cfg.SmtpPassword, cfg.SmtpHost)
+	}
+	addr := cfg.SmtpHost + ":" + strconv.Itoa(cfg.SmtpPort)
+	if err := smtp.SendMail(addr, auth, from, []string{to}, message); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %v", to, err)
+	}
+	return nil
+}
+
+func buildMailMessage(from, to, subject, body string) []byte {
+	var msg strings.Builder
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(msg.String())
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Số ngôn ngữ đích tối đa cho một lần upload
+	MaxTargetLanguages = 5
+	// Số ngôn ngữ xử lý đồng thời (mỗi ngôn ngữ đã chạy TTS song song bên trong)
+	multiLanguageConcurrency = 2
+	// Ước tính số ký tự transcript mỗi giây audio khi chưa có transcript (dùng để ước tính chi phí trước khi xử lý)
+	estimatedTranscriptCharsPerSecond = 15.0
+)
+
+// supportedTargetLanguages là các ngôn ngữ đích có prompt dịch và giọng TTS mặc định
+var supportedTargetLanguages = []string{"vi", "en", "ja", "ko", "zh", "fr", "de", "es"}
+
+// ParseTargetLanguages đọc target_languages[] (mỗi phần tử có thể là "vi,en"), bỏ trùng và ngôn ngữ không hỗ trợ
+func ParseTargetLanguages(values []string) ([]string, error) {
+	var languages []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			lang := strings.ToLower(strings.TrimSpace(part))
+			if lang == "" || seen[lang] {
+				continue
+			}
+			if !isSupportedTargetLanguage(lang) {
+				return nil, fmt.Errorf("unsupported target language %q", lang)
+			}
+			seen[lang] = true
+			languages = append(languages, lang)
+		}
+	}
+	if len(languages) > MaxTargetLanguages {
+		return nil, fmt.Errorf("too many target languages: %d (max %d)", len(languages), MaxTargetLanguages)
+	}
+	return languages, nil
+}
+
+func isSupportedTargetLanguage(lang string) bool {
+	for _, supported := range supportedTargetLanguages {
+		if supported == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// VoiceForLanguage chọn giọng cho một ngôn ngữ đích: voice_names[lang] → voice_name nếu cùng ngôn ngữ → giọng mặc định
+func VoiceForLanguage(lang, voiceName string, voiceNames map[string]string) string {
+	if voice := voiceNames[lang]; voice != "" {
+		return voice
+	}
+	languageCode, defaultVoice := getVoiceForLanguage(lang)
+	if voiceName != "" && strings.HasPrefix(voiceName, languageCode+"-") {
+		return voiceName
+	}
+	return defaultVoice
+}
+
+// EstimateMultiLanguageCost ước tính tổng chi phí (có markup) cho một video dịch sang languageCount ngôn ngữ:
+// Whisper tính một lần, dịch và TTS nhân theo số ngôn ngữ
+func EstimateMultiLanguageCost(durationSeconds float64, languageCount int, userID uint) (map[string]float64, error) {
+	transcriptLength := int(durationSeconds * estimatedTranscriptCharsPerSecond)
+	single, err := NewPricingService().EstimateProcessVideoCostWithMarkup(durationSeconds/60.0, transcriptLength, transcriptLength, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	count := float64(languageCount)
+	estimates := map[string]float64{
+		"languages":    count,
+		"whisper":      single["whisper"],
+		"whisper_base": single["whisper_base"],
+		"gemini":       single["gemini"] * count,
+		"gemini_base":  single["gemini_base"] * count,
+		"tts":          single["tts"] * count,
+		"tts_base":     single["tts_base"] * count,
+		"per_language": single["gemini"] + single["tts"],
+	}
+	estimates["total_base"] = estimates["whisper_base"] + estimates["gemini_base"] + estimates["tts_base"]
+	estimates["total"] = estimates["whisper"] + estimates["gemini"] + estimates["tts"]
+	// Số tiền tiết kiệm so với upload riêng từng ngôn ngữ (Whisper chỉ chạy một lần)
+	estimates["saved_vs_separate"] = single["whisper"] * (count - 1)
+	return estimates, nil
+}
+
+// LanguageProcessResult là kết quả xử lý của một ngôn ngữ đích trong job nhiều ngôn ngữ
+type LanguageProcessResult struct {
+	Language string
+	Task     *ProcessVideoParallel // Cấu hình đã dùng cho ngôn ngữ này (giọng đọc, glossary...)
+	Result   *ProcessVideoResult
+	Err      error
+}
+
+// MultiLanguageResult là kết quả job nhiều ngôn ngữ: phần dùng chung + kết quả từng ngôn ngữ theo thứ tự request
+type MultiLanguageResult struct {
+	Transcript      string
+	Segments        []Segment
+	SourceLanguage  string
+	OriginalSRTPath string
+	BackgroundPath  string
+	Outputs         []*LanguageProcessResult
+	ProcessingTime  time.Duration
+}
+
+// Succeeded trả về các ngôn ngữ xử lý thành công
+func (r *MultiLanguageResult) Succeeded() []*LanguageProcessResult {
+	var succeeded []*LanguageProcessResult
+	for _, output := range r.Outputs {
+		if output.Err == nil && output.Result != nil {
+			succeeded = append(succeeded, output)
+		}
+	}
+	return succeeded
+}
+
+// forLanguage tạo bản sao của task cho một ngôn ngữ đích, output ghi vào thư mục con riêng để không đè nhau
+func (p *ProcessVideoParallel) forLanguage(lang string) (*ProcessVideoParallel, error) {
+	languageDir := filepath.Join(p.VideoDir, lang)
+	if err := os.MkdirAll(languageDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir for %s: %v", lang, err)
+	}
+
+	task := *p
+	task.TargetLanguage = lang
+	task.VideoDir = languageDir
+	task.Processor = NewParallelProcessor()
+	task.Glossary = nil
+	return &task, nil
+}
+
+// ProcessParallelMultiLanguage chạy Whisper, tách background và reframe một lần, sau đó fan out dịch/TTS/burn theo từng ngôn ngữ.
+// configure được gọi cho từng ngôn ngữ để gắn giọng đọc, glossary; translation memory tạo theo ngôn ngữ nguồn Whisper nhận diện.
+// Một ngôn ngữ lỗi không làm hỏng các ngôn ngữ khác; chỉ trả về lỗi khi phần dùng chung lỗi hoặc mọi ngôn ngữ đều lỗi
+func (p *ProcessVideoParallel) ProcessParallelMultiLanguage(languages []string, configure func(task *ProcessVideoParallel)) (*MultiLanguageResult, error) {
+	log.Printf("🌐 [MULTI LANGUAGE] Bắt đầu xử lý %d ngôn ngữ: %v", len(languages), languages)
+	startTime := time.Now()
+
+	whisperResult, backgroundResult, err := p.processSharedStages()
+	if err != nil {
+		return nil, err
+	}
+
+	// Reframe một lần cho mọi ngôn ngữ
+	reframedVideoPath := ""
+	if p.ReframeMode != ReframeModeNone {
+		reframedPath, err := ReframeVideo(p.VideoPath, p.VideoDir, p.ReframeMode, p.OutputProfile)
+		if err != nil {
+			log.Printf("Reframe failed, using original video: %v", err)
+		} else if reframedPath != p.VideoPath {
+			reframedVideoPath = reframedPath
+		}
+	}
+
+	outputs := make([]*LanguageProcessResult, len(languages))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, multiLanguageConcurrency)
+	for i, lang := range languages {
+		wg.Add(1)
+		go func(i int, lang string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			output := &LanguageProcessResult{Language: lang}
+			outputs[i] = output
+
+			task, err := p.forLanguage(lang)
+			if err != nil {
+				output.Err = err
+				return
+			}
+			task.reframedVideoPath = reframedVideoPath
+			if configure != nil {
+				configure(task)
+			}
+			output.Task = task
+
+			log.Printf("🌐 [MULTI LANGUAGE] Bắt đầu ngôn ngữ %s (voice: %s)", lang, task.VoiceName)
+			output.Result, output.Err = task.processLanguageStages(whisperResult, backgroundResult)
+			if output.Err != nil {
+				log.Printf("❌ [MULTI LANGUAGE] Ngôn ngữ %s thất bại: %v", lang, output.Err)
+			} else {
+				log.Printf("✅ [MULTI LANGUAGE] Ngôn ngữ %s hoàn thành: %s", lang, output.Result.FinalVideoPath)
+			}
+		}(i, lang)
+	}
+	wg.Wait()
+
+	result := &MultiLanguageResult{
+		Transcript:      whisperResult.Transcript,
+		Segments:        whisperResult.Segments,
+		SourceLanguage:  whisperResult.SourceLanguage,
+		OriginalSRTPath: whisperResult.SRTPath,
+		BackgroundPath:  backgroundResult.Path,
+		Outputs:         outputs,
+		ProcessingTime:  time.Since(startTime),
+	}
+	if len(result.Succeeded()) == 0 {
+		return nil, fmt.Errorf("all %d target languages failed: %v", len(languages), outputs[0].Err)
+	}
+
+	log.Printf("🏁 [MULTI LANGUAGE] Hoàn thành %d/%d ngôn ngữ trong %v", len(result.Succeeded()), len(languages), result.ProcessingTime)
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"log"
+
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	NotificationPaymentReminder = "payment_reminder"
+	NotificationOrderExpired    = "order_expired"
+	NotificationPaymentReview   = "payment_review"
+	NotificationPaymentResolved = "payment_resolved"
+	NotificationReferralReward  = "referral_reward"
+	NotificationLowBalance      = "low_balance"
+	NotificationSpendingCap     = "spending_cap"
+)
+
+type NotificationService struct {
+	db *gorm.DB
+}
+
+func NewNotificationService(db *gorm.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// Notify tạo thông báo cho user. Lỗi chỉ được log vì thông báo không được làm hỏng luồng chính
+func (s *NotificationService) Notify(userID uint, notificationType, title, message string, orderID *uint) {
+	notification := model.UserNotification{
+		UserID:  userID,
+		Type:    notificationType,
+		Title:   title,
+		Message: message,
+		OrderID: orderID,
+	}
+	if err := s.db.Create(&notification).Error; err != nil {
+		log.Printf("Failed to create %s notification for user %d: %v", notificationType, userID, err)
+	}
+}
+
+// GetUserNotifications lấy thông báo của user, mới nhất trước, kèm số thông báo chưa đọc
+func (s *NotificationService) GetUserNotifications(userID uint, unreadOnly bool, limit int) ([]model.UserNotification, int64, error) {
+	var notifications []model.UserNotification
+	query := s.db.Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&notifications).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var unread int64
+	if err := s.db.Model(&model.UserNotification{}).Where("user_id = ? AND is_read = ?", userID, false).Count(&unread).Error; err != nil {
+		return nil, 0, err
+	}
+	return notifications, unread, nil
+}
+
+// MarkRead đánh dấu đã đọc một thông báo (notificationID > 0) hoặc tất cả thông báo của user
+func (s *NotificationService) MarkRead(userID, notificationID uint) error {
+	if notificationID > 0 {
+		var notification model.UserNotification
+		if err := s.db.Where("id = ? AND user_id = ?", notificationID, userID).First(&notification).Error; err != nil {
+			return err
+		}
+		return s.db.Model(&notification).Update("is_read", true).Error
+	}
+	return s.db.Model(&model.UserNotification{}).Where("user_id = ? AND is_read = ?", userID, false).Update("is_read", true).Error
+}
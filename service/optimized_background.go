@@ -67,6 +67,12 @@ func (o *OptimizedBackgroundExtractor) extractWithDemucs() (string, error) {
 		return "", fmt.Errorf("failed to create separated audio directory: %v", err)
 	}
 
+	// Kiểm tra cache theo nội dung audio trước khi chạy Demucs
+	if cachedPath, err := GetCacheService().GetCachedBackgroundResult(o.AudioPath, "no_vocals", outputDir); err == nil {
+		log.Printf("Using cached background result: %s", cachedPath)
+		return cachedPath, nil
+	}
+
 	// Sử dụng Demucs với cấu hình tối ưu hóa
 	cmd := exec.Command(demucsPath,
 		"-n", "htdemucs", // Sử dụng model nhẹ hơn
@@ -103,6 +109,9 @@ func (o *OptimizedBackgroundExtractor) extractWithDemucs() (string, error) {
 	}
 
 	log.Printf("Background extracted to: %s", stemPath)
+	if err := GetCacheService().CacheBackgroundResult(o.AudioPath, "no_vocals", stemPath); err != nil {
+		log.Printf("Failed to cache background result: %v", err)
+	}
 	return stemPath, nil
 }
 
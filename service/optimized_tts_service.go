@@ -47,7 +47,8 @@ type TTSProcessingOptions struct {
 	SpeakingRate     float64
 	MaxConcurrent    int
 	UserID           uint
-	VoiceName        string // Thêm trường chọn giọng đọc
+	VoiceName        string         // Thêm trường chọn giọng đọc
+	CueVoices        map[int]string // Giọng riêng theo số thứ tự cue (diarization), cue không có thì dùng VoiceName
 }
 
 var (
@@ -242,24 +243,44 @@ func (s *OptimizedTTSService) processSingleSegment(
 		SegmentIndex: index,
 	}
 
-	// Chờ rate limiter
-	if !s.rateLimiter.WaitForSlot(30 * time.Second) {
-		result.Error = fmt.Errorf("timeout waiting for rate limit slot")
-		return result
+	// Cue có người nói riêng thì đọc bằng giọng của người nói đó
+	if voice := options.CueVoices[entry.Index]; voice != "" {
+		options.VoiceName = voice
 	}
 
-	// Reserve slot
-	if !s.rateLimiter.ReserveSlot(options.UserID, entry.Text, fmt.Sprintf("%s_%d", jobID, index)) {
-		result.Error = fmt.Errorf("failed to reserve rate limit slot")
-		return result
-	}
+	// Kiểm tra cache segment trước, hit thì không cần rate limit slot cũng như gọi API
+	languageCode, voiceName := getVoiceForLanguageWithSelection(options.TargetLanguage, options.VoiceName)
+	cache := GetCacheService()
+	audioContent, err := cache.GetCachedTTSSegment(TTSProviderGoogle, entry.Text, voiceName, languageCode, options.SpeakingRate)
+	cacheHit := err == nil
+	recordTTSSegmentCacheLookup(cacheHit)
+	if cacheHit {
+		log.Printf("Segment %d served from TTS cache", index)
+	} else {
 
-	// Gọi Google TTS API
-	audioContent, err := s.callGoogleTTS(entry.Text, options)
-	if err != nil {
-		result.Error = fmt.Errorf("Google TTS API call failed: %v", err)
-		s.updateSegmentMapping(jobID, index, map[string]interface{}{"error": result.Error})
-		return result
+		// Chờ rate limiter
+		if !s.rateLimiter.WaitForSlot(30 * time.Second) {
+			result.Error = fmt.Errorf("timeout waiting for rate limit slot")
+			return result
+		}
+
+		// Reserve slot
+		if !s.rateLimiter.ReserveSlot(options.UserID, entry.Text, fmt.Sprintf("%s_%d", jobID, index)) {
+			result.Error = fmt.Errorf("failed to reserve rate limit slot")
+			return result
+		}
+
+		// Gọi Google TTS API
+		audioContent, err = s.callGoogleTTS(entry.Text, options)
+		if err != nil {
+			result.Error = fmt.Errorf("Google TTS API call failed: %v", err)
+			s.updateSegmentMapping(jobID, index, map[string]interface{}{"error": result.Error})
+			return result
+		}
+
+		if err := cache.CacheTTSSegment(TTSProviderGoogle, entry.Text, voiceName, languageCode, options.SpeakingRate, audioContent); err != nil {
+			log.Printf("Failed to cache TTS segment %d: %v", index, err)
+		}
 	}
 
 	// Lưu audio content
@@ -285,6 +306,7 @@ func (s *OptimizedTTSService) processSingleSegment(
 		"audio_duration":  duration,
 		"adjusted_path":   wavPath,
 		"processing_time": time.Since(startTime),
+		"cache_hit":       cacheHit,
 	})
 
 	result.AudioPath = wavPath
@@ -297,26 +319,8 @@ func (s *OptimizedTTSService) processSingleSegment(
 
 // callGoogleTTS gọi Google TTS API
 func (s *OptimizedTTSService) callGoogleTTS(text string, options TTSProcessingOptions) ([]byte, error) {
-	// Lấy voice settings cho target language với voice selection
-	var languageCode, voiceName string
-	if options.VoiceName != "" {
-		// Sử dụng voice được chọn
-		voices := GetAvailableVoices()
-		if languageVoices, exists := voices[options.TargetLanguage]; exists {
-			for _, voice := range languageVoices {
-				if voice.Name == options.VoiceName {
-					languageCode = voice.LanguageCode
-					voiceName = voice.Name
-					break
-				}
-			}
-		}
-	}
-
-	// Fallback về default voice nếu không tìm thấy
-	if languageCode == "" || voiceName == "" {
-		languageCode, voiceName = getVoiceForLanguage(options.TargetLanguage)
-	}
+	// Lấy voice settings cho target language với voice selection (fallback về default voice)
+	languageCode, voiceName := getVoiceForLanguageWithSelection(options.TargetLanguage, options.VoiceName)
 
 	// Tạo request
 	req := &texttospeechpb.SynthesizeSpeechRequest{
@@ -596,6 +600,9 @@ func (s *OptimizedTTSService) GetServiceStatistics() map[string]interface{} {
 	stats["max_concurrent_workers"] = s.maxConcurrent
 	stats["active_workers"] = len(s.workerPool)
 
+	// Tỉ lệ hit/miss của cache segment TTS trên mọi luồng TTS
+	stats["segment_cache"] = TTSSegmentCacheStats()
+
 	return stats
 }
 
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// OutputProfile mô tả cấu hình encode cho video đầu ra (độ phân giải, tỉ lệ, codec, bitrate)
+type OutputProfile struct {
+	Name         string `json:"name"`
+	Label        string `json:"label"`
+	Width        int    `json:"width"`  // 0 = giữ nguyên kích thước gốc
+	Height       int    `json:"height"` // 0 = giữ nguyên kích thước gốc
+	AspectRatio  string `json:"aspect_ratio"`
+	FitMode      string `json:"fit_mode"` // "pad" (thêm viền), "crop" (cắt), "" (giữ nguyên)
+	VideoCodec   string `json:"video_codec"`
+	Preset       string `json:"preset"`
+	CRF          int    `json:"crf"`
+	MaxBitrate   string `json:"max_bitrate"` // "" = không giới hạn bitrate
+	AudioCodec   string `json:"audio_codec"`
+	AudioBitrate string `json:"audio_bitrate"`
+	MaxFPS       int    `json:"max_fps"` // 0 = giữ nguyên fps gốc
+	// Tỉ lệ chiều cao phía dưới khung hình dành cho UI nền tảng, phụ đề sẽ được đẩy lên trên vùng này
+	SafeAreaBottom float64 `json:"safe_area_bottom"`
+	// Chuẩn hoá âm lượng EBU R128 cho bản mix cuối cùng
+	LoudnessTarget float64 `json:"loudness_target"` // Integrated loudness (LUFS)
+	TruePeak       float64 `json:"true_peak"`       // Giới hạn true-peak (dBTP)
+	LoudnessRange  float64 `json:"loudness_range"`  // Loudness range (LU)
+}
+
+const DefaultOutputProfile = "source"
+
+var outputProfiles = map[string]OutputProfile{
+	"tiktok": {
+		Name:           "tiktok",
+		Label:          "TikTok / Reels 1080x1920 (9:16)",
+		Width:          1080,
+		Height:         1920,
+		AspectRatio:    "9:16",
+		FitMode:        "pad",
+		VideoCodec:     "libx264",
+		Preset:         "veryfast",
+		CRF:            21,
+		MaxBitrate:     "8M",
+		AudioCodec:     "aac",
+		AudioBitrate:   "192k",
+		MaxFPS:         30,
+		SafeAreaBottom: VerticalSafeAreaBottom,
+		LoudnessTarget: -14,
+		TruePeak:       -1.0,
+		LoudnessRange:  11,
+	},
+	"youtube": {
+		Name:           "youtube",
+		Label:          "YouTube 1080p (16:9)",
+		Width:          1920,
+		Height:         1080,
+		AspectRatio:    "16:9",
+		FitMode:        "pad",
+		VideoCodec:     "libx264",
+		Preset:         "veryfast",
+		CRF:            20,
+		MaxBitrate:     "12M",
+		AudioCodec:     "aac",
+		AudioBitrate:   "192k",
+		MaxFPS:         60,
+		LoudnessTarget: -14,
+		TruePeak:       -1.0,
+		LoudnessRange:  11,
+	},
+	"square": {
+		Name:           "square",
+		Label:          "Square 1080x1080 (1:1)",
+		Width:          1080,
+		Height:         1080,
+		AspectRatio:    "1:1",
+		FitMode:        "crop",
+		VideoCodec:     "libx264",
+		Preset:         "veryfast",
+		CRF:            21,
+		MaxBitrate:     "8M",
+		AudioCodec:     "aac",
+		AudioBitrate:   "192k",
+		MaxFPS:         30,
+		LoudnessTarget: -14,
+		TruePeak:       -1.0,
+		LoudnessRange:  11,
+	},
+	"source": {
+		Name:           "source",
+		Label:          "Giữ nguyên video gốc",
+		VideoCodec:     "libx264",
+		Preset:         "veryfast",
+		CRF:            23,
+		AudioCodec:     "aac",
+		AudioBitrate:   "192k",
+		LoudnessTarget: -16,
+		TruePeak:       -1.5,
+		LoudnessRange:  11,
+	},
+}
+
+// GetOutputProfile trả về profile theo tên, fallback về "source" nếu không tồn tại
+func GetOutputProfile(name string) OutputProfile {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if profile, ok := outputProfiles[name]; ok {
+		return profile
+	}
+	if name != "" {
+		log.Printf("Unknown output profile %q, falling back to %s", name, DefaultOutputProfile)
+	}
+	return outputProfiles[DefaultOutputProfile]
+}
+
+// IsValidOutputProfile kiểm tra tên profile có được hỗ trợ không
+func IsValidOutputProfile(name string) bool {
+	_, ok := outputProfiles[strings.ToLower(strings.TrimSpace(name))]
+	return ok
+}
+
+// ListOutputProfiles trả về danh sách profile đã sắp xếp theo tên
+func ListOutputProfiles() []OutputProfile {
+	profiles := make([]OutputProfile, 0, len(outputProfiles))
+	for _, profile := range outputProfiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// ScaleFilter trả về filter scale/pad/crop cho profile, rỗng nếu giữ nguyên kích thước
+func (p OutputProfile) ScaleFilter() string {
+	if p.Width <= 0 || p.Height <= 0 {
+		return ""
+	}
+	switch p.FitMode {
+	case "crop":
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,setsar=1",
+			p.Width, p.Height, p.Width, p.Height)
+	default:
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=black,setsar=1",
+			p.Width, p.Height, p.Width, p.Height)
+	}
+}
+
+// BuildVideoFilter ghép filter của profile với các filter bổ sung (ví dụ subtitles)
+// Filter của profile luôn đứng trước để phụ đề được render theo kích thước đầu ra
+func (p OutputProfile) BuildVideoFilter(extra ...string) string {
+	var filters []string
+	if scale := p.ScaleFilter(); scale != "" {
+		filters = append(filters, scale)
+	}
+	for _, f := range extra {
+		if f != "" {
+			filters = append(filters, f)
+		}
+	}
+	return strings.Join(filters, ",")
+}
+
+// RequiresVideoReencode cho biết profile có bắt buộc encode lại video không
+func (p OutputProfile) RequiresVideoReencode() bool {
+	return p.ScaleFilter() != "" || p.MaxFPS > 0
+}
+
+// VideoEncodeArgs trả về các tham số ffmpeg để encode video theo profile
+func (p OutputProfile) VideoEncodeArgs() []string {
+	args := []string{"-c:v", p.VideoCodec}
+	if p.Preset != "" {
+		args = append(args, "-preset", p.Preset)
+	}
+	if p.CRF > 0 {
+		args = append(args, "-crf", fmt.Sprintf("%d", p.CRF))
+	}
+	if p.MaxBitrate != "" {
+		args = append(args, "-maxrate", p.MaxBitrate, "-bufsize", p.MaxBitrate)
+	}
+	if p.MaxFPS > 0 {
+		args = append(args, "-fpsmax", fmt.Sprintf("%d", p.MaxFPS))
+	}
+	args = append(args, "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+	return args
+}
+
+// assPlayResY là chiều cao script mặc định libass dùng khi render SRT/ASS không khai báo PlayResY
+const assPlayResY = 288
+
+// SubtitleMarginV trả về MarginV (theo đơn vị script của libass) để phụ đề nằm trong vùng an toàn, 0 = mặc định
+func (p OutputProfile) SubtitleMarginV() int {
+	if p.SafeAreaBottom <= 0 {
+		return 0
+	}
+	return int(math.Round(p.SafeAreaBottom * assPlayResY))
+}
+
+// AudioEncodeArgs trả về các tham số ffmpeg để encode audio theo profile
+func (p OutputProfile) AudioEncodeArgs() []string {
+	return []string{"-c:a", p.AudioCodec, "-b:a", p.AudioBitrate}
+}
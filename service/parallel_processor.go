@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"creator-tool-backend/model"
 	"fmt"
 	"log"
 	"os"
@@ -98,11 +99,22 @@ type ProcessVideoParallel struct {
 	VoiceName        string // Thêm trường chọn giọng đọc
 	HasCustomSrt     bool
 	CustomSrtPath    string
+	OutputProfile    OutputProfile
+	ReframeMode      string               // "", "blur", "center", "smart" - chuyển video ngang sang dọc trước khi burn sub
+	Glossary         []model.GlossaryTerm // Thuật ngữ bắt buộc khi dịch (từ glossary_ids của request)
+	MemoryUserID     uint                 // User có translation memory dùng khi dịch (0 = không dùng)
+	Diarize          bool                 // Tách người nói để mỗi người một giọng TTS
+	SpeakerVoices    map[string]string    // Giọng user chọn theo nhãn người nói (SPEAKER_00 → voice)
+	VoiceMode        string               // replace (Demucs + TTS), voice-over (audio gốc + TTS), subtitle-only (không TTS)
+	OriginalVolume   float64              // Âm lượng audio gốc trong chế độ voice-over
 	Processor        *ParallelProcessor
 	APIKey           string
 	GeminiKey        string
 	CacheService     *CacheService
 	PricingService   *PricingService
+
+	// Video đã reframe sẵn (job nhiều ngôn ngữ reframe một lần rồi dùng chung), rỗng = processVideo tự reframe
+	reframedVideoPath string
 }
 
 // NewProcessVideoParallel tạo processor mới
@@ -118,10 +130,13 @@ func NewProcessVideoParallel(videoPath, audioPath, videoDir, targetLanguage, api
 		TTSVolume:        1.5,
 		SpeakingRate:     1.2,
 		VoiceName:        "", // Sẽ được set sau từ job
+		OutputProfile:    GetOutputProfile(DefaultOutputProfile),
+		VoiceMode:        VoiceModeReplace,
+		OriginalVolume:   DefaultVoiceOverOriginalVolume,
 		Processor:        NewParallelProcessor(),
 		APIKey:           apiKey,
 		GeminiKey:        geminiKey,
-		CacheService:     NewCacheService(),
+		CacheService:     GetCacheService(),
 		PricingService:   NewPricingService(),
 	}
 }
@@ -131,6 +146,25 @@ func (p *ProcessVideoParallel) ProcessParallel() (*ProcessVideoResult, error) {
 	log.Printf("🚀 [PARALLEL PROCESSING] Bắt đầu parallel video processing...")
 	startTime := time.Now()
 
+	whisperResult, backgroundResult, err := p.processSharedStages()
+	if err != nil {
+		return nil, err
+	}
+
+	videoResult, err := p.processLanguageStages(whisperResult, backgroundResult)
+	if err != nil {
+		return nil, err
+	}
+
+	processingTime := time.Since(startTime)
+	log.Printf("🏁 [PARALLEL PROCESSING] Tất cả parallel processing hoàn thành trong %v", processingTime)
+	videoResult.ProcessingTime = processingTime
+
+	return videoResult, nil
+}
+
+// processSharedStages chạy Whisper và tách background song song (dùng chung cho mọi ngôn ngữ đích)
+func (p *ProcessVideoParallel) processSharedStages() (*WhisperResult, *BackgroundResult, error) {
 	// Khởi tạo các tác vụ
 	p.Processor.AddTask("whisper", "speech_to_text")
 	p.Processor.AddTask("background", "audio_separation")
@@ -161,21 +195,40 @@ func (p *ProcessVideoParallel) ProcessParallel() (*ProcessVideoResult, error) {
 		}
 	}()
 
-	// Background extraction
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		log.Printf("🎵 [PARALLEL-BACKGROUND] Worker bắt đầu xử lý background extraction...")
-		p.Processor.UpdateTaskProgress("background", 10, "running")
-		backgroundResult, backgroundErr = p.processBackground()
-		if backgroundErr != nil {
-			log.Printf("❌ [PARALLEL-BACKGROUND] Background extraction failed: %v", backgroundErr)
-			p.Processor.UpdateTaskProgress("background", 0, "failed")
-		} else {
-			log.Printf("✅ [PARALLEL-BACKGROUND] Background extraction completed successfully")
-			p.Processor.UpdateTaskProgress("background", 100, "completed")
-		}
-	}()
+	// Background extraction, chỉ chế độ replace cần Demucs
+	if VoiceModeUsesDemucs(p.VoiceMode) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Printf("🎵 [PARALLEL-BACKGROUND] Worker bắt đầu xử lý background extraction...")
+			p.Processor.UpdateTaskProgress("background", 10, "running")
+			backgroundResult, backgroundErr = p.processBackground()
+			if backgroundErr != nil {
+				log.Printf("❌ [PARALLEL-BACKGROUND] Background extraction failed: %v", backgroundErr)
+				p.Processor.UpdateTaskProgress("background", 0, "failed")
+			} else {
+				log.Printf("✅ [PARALLEL-BACKGROUND] Background extraction completed successfully")
+				p.Processor.UpdateTaskProgress("background", 100, "completed")
+			}
+		}()
+	} else {
+		// voice-over giữ audio gốc làm track nền, subtitle-only không mix audio
+		log.Printf("⏭️ [PARALLEL-BACKGROUND] Voice mode %s: bỏ qua Demucs", p.VoiceMode)
+		backgroundResult = &BackgroundResult{Path: p.AudioPath}
+		p.Processor.UpdateTaskProgress("background", 100, "completed")
+	}
+
+	// Diarization (tuỳ chọn) chạy song song, lỗi thì bỏ qua
+	var speakerTurns []SpeakerTurn
+	var diarizeErr error
+	if p.Diarize && !p.HasCustomSrt {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Printf("🗣️ [PARALLEL-DIARIZATION] Worker bắt đầu xử lý diarization...")
+			speakerTurns, diarizeErr = DiarizeAudio(p.AudioPath)
+		}()
+	}
 
 	log.Printf("⏳ [PARALLEL PROCESSING] Đang chờ 2 goroutines hoàn thành...")
 	wg.Wait()
@@ -183,7 +236,13 @@ func (p *ProcessVideoParallel) ProcessParallel() (*ProcessVideoResult, error) {
 
 	// Kiểm tra lỗi
 	if whisperErr != nil {
-		return nil, fmt.Errorf("whisper processing failed: %v", whisperErr)
+		return nil, nil, fmt.Errorf("whisper processing failed: %v", whisperErr)
+	}
+	if diarizeErr != nil {
+		log.Printf("⚠️ [PARALLEL PROCESSING] Diarization failed, dùng một giọng cho toàn bộ video: %v", diarizeErr)
+	} else if len(speakerTurns) > 0 {
+		whisperResult.Segments = AssignSpeakers(whisperResult.Segments, speakerTurns)
+		whisperResult.SpeakerTurns = speakerTurns
 	}
 	if backgroundErr != nil {
 		log.Printf("⚠️ [PARALLEL PROCESSING] Background extraction failed, sử dụng fallback: %v", backgroundErr)
@@ -193,6 +252,11 @@ func (p *ProcessVideoParallel) ProcessParallel() (*ProcessVideoResult, error) {
 		}
 	}
 
+	return whisperResult, backgroundResult, nil
+}
+
+// processLanguageStages chạy translation → TTS → video cho ngôn ngữ đích của p
+func (p *ProcessVideoParallel) processLanguageStages(whisperResult *WhisperResult, backgroundResult *BackgroundResult) (*ProcessVideoResult, error) {
 	log.Printf("🔤 [PARALLEL PROCESSING] Bước 2: Bắt đầu translation (phụ thuộc vào Whisper)...")
 	// Bước 2: Translation (phụ thuộc vào Whisper)
 	p.Processor.AddTask("translation", "srt_translation")
@@ -211,13 +275,25 @@ func (p *ProcessVideoParallel) ProcessParallel() (*ProcessVideoResult, error) {
 	p.Processor.AddTask("tts", "text_to_speech")
 	p.Processor.UpdateTaskProgress("tts", 10, "running")
 
-	ttsResult, err := p.processTTS(translationResult)
-	if err != nil {
-		p.Processor.UpdateTaskProgress("tts", 0, "failed")
-		return nil, fmt.Errorf("Lỗi TTS: %v", err)
+	// Mỗi người nói một giọng khi đã chạy diarization
+	speakers := ResolveSpeakerVoices(whisperResult.Segments, whisperResult.SpeakerTurns, p.TargetLanguage, p.VoiceName, p.SpeakerVoices)
+	if len(speakers) > 0 {
+		log.Printf("🗣️ [PARALLEL PROCESSING] %d người nói: %+v", len(speakers), speakers)
+	}
+
+	// subtitle-only không tạo giọng đọc, không tính phí TTS
+	ttsResult := &TTSResult{}
+	if VoiceModeUsesTTS(p.VoiceMode) {
+		ttsResult, err = p.processTTS(translationResult, BuildCueVoices(whisperResult.Segments, speakers))
+		if err != nil {
+			p.Processor.UpdateTaskProgress("tts", 0, "failed")
+			return nil, fmt.Errorf("Lỗi TTS: %v", err)
+		}
+		log.Printf("✅ [PARALLEL PROCESSING] TTS completed successfully")
+	} else {
+		log.Printf("⏭️ [PARALLEL PROCESSING] Voice mode %s: bỏ qua TTS", p.VoiceMode)
 	}
 	p.Processor.UpdateTaskProgress("tts", 100, "completed")
-	log.Printf("✅ [PARALLEL PROCESSING] TTS completed successfully")
 
 	log.Printf("🎬 [PARALLEL PROCESSING] Bước 4: Bắt đầu video processing...")
 	// Bước 4: Video processing
@@ -232,23 +308,24 @@ func (p *ProcessVideoParallel) ProcessParallel() (*ProcessVideoResult, error) {
 	p.Processor.UpdateTaskProgress("video", 100, "completed")
 	log.Printf("✅ [PARALLEL PROCESSING] Video processing completed successfully")
 
-	processingTime := time.Since(startTime)
-	log.Printf("🏁 [PARALLEL PROCESSING] Tất cả parallel processing hoàn thành trong %v", processingTime)
-
 	// Set thông tin bổ sung
+	videoResult.Speakers = speakers
+	videoResult.SourceLanguage = whisperResult.SourceLanguage
+	videoResult.TranslationSkipped = translationResult.Skipped
 	videoResult.OriginalSRTPath = whisperResult.SRTPath
 	videoResult.Transcript = whisperResult.Transcript
 	videoResult.Segments = whisperResult.Segments
-	videoResult.ProcessingTime = processingTime
 
 	return videoResult, nil
 }
 
 // WhisperResult kết quả từ Whisper
 type WhisperResult struct {
-	Transcript string
-	Segments   []Segment
-	SRTPath    string
+	Transcript     string
+	Segments       []Segment
+	SRTPath        string
+	SourceLanguage string        // Mã ISO ngôn ngữ nguồn (Whisper verbose_json hoặc detect từ transcript), rỗng = không xác định
+	SpeakerTurns   []SpeakerTurn // Kết quả diarization (không cache cùng transcript)
 }
 
 // BackgroundResult kết quả từ background extraction
@@ -258,25 +335,68 @@ type BackgroundResult struct {
 
 // TranslationResult kết quả từ translation
 type TranslationResult struct {
-	TranslatedSRTPath string
-	TranslatedContent string
+	TranslatedSRTPath  string
+	TranslatedContent  string
+	GlossaryViolations []model.GlossaryViolation
+	TranslationMemory  *model.TranslationMemoryStats
+	QAReport           *model.TranslationQAReport
+	Skipped            bool // Ngôn ngữ nguồn trùng ngôn ngữ đích, SRT gốc được dùng làm bản dịch
 }
 
 // TTSResult kết quả từ TTS
 type TTSResult struct {
-	TTSPath string
+	TTSPath          string
+	Billing          TTSBillingSplit
+	OverflowSegments []TTSMapping // Segment vẫn bị cắt phần thừa sau khi căn chỉnh (chỉ có ở luồng TTS tuần tự)
 }
 
 // ProcessVideoResult kết quả cuối cùng
 type ProcessVideoResult struct {
-	FinalVideoPath    string
-	BackgroundPath    string
-	TTSPath           string
-	OriginalSRTPath   string
-	TranslatedSRTPath string
-	Transcript        string
-	Segments          []Segment
-	ProcessingTime    time.Duration
+	FinalVideoPath     string
+	BackgroundPath     string
+	TTSPath            string
+	OriginalSRTPath    string
+	TranslatedSRTPath  string
+	Transcript         string
+	Segments           []Segment
+	TTSBilling         TTSBillingSplit // Phần TTS phải tính phí (các segment không có trong cache)
+	TTSOverflow        []TTSMapping    // Segment TTS bị cắt phần thừa vì không căn vừa cue, cần review
+	GlossaryViolations []model.GlossaryViolation
+	TranslationMemory  *model.TranslationMemoryStats // Số cue lấy từ translation memory và chi phí LLM tiết kiệm được
+	TranslationQA      *model.TranslationQAReport    // Báo cáo QA bản dịch, lưu cùng history
+	Speakers           []model.SpeakerVoice          // Người nói và giọng đã gán (rỗng = không chạy diarization)
+	SourceLanguage     string                        // Ngôn ngữ nguồn đã nhận diện (lưu vào CaptionHistory.SourceLanguage)
+	TranslationSkipped bool                          // Bỏ qua dịch vì nguồn trùng đích, không tính phí dịch
+	ProcessingTime     time.Duration
+}
+
+// RenderSettings trả về tham số render của job để lưu vào history (dùng khi sửa phụ đề và render lại)
+func (p *ProcessVideoParallel) RenderSettings() RenderSettings {
+	targetLanguage := p.TargetLanguage
+	if p.HasCustomSrt {
+		// SRT custom: ngôn ngữ TTS được detect lại từ nội dung khi render
+		targetLanguage = ""
+	}
+	return RenderSettings{
+		TargetLanguage:   targetLanguage,
+		VoiceName:        p.VoiceName,
+		VoiceMode:        NormalizeVoiceMode(p.VoiceMode),
+		SpeakingRate:     p.SpeakingRate,
+		BackgroundVolume: p.backgroundVolume(),
+		TTSVolume:        p.TTSVolume,
+		OutputProfile:    p.OutputProfile.Name,
+		ReframeMode:      p.ReframeMode,
+		SubtitleColor:    p.SubtitleColor,
+		SubtitleBgColor:  p.SubtitleBgColor,
+	}
+}
+
+// backgroundVolume là âm lượng track nền khi mix: voice-over dùng âm lượng audio gốc
+func (p *ProcessVideoParallel) backgroundVolume() float64 {
+	if p.VoiceMode == VoiceModeVoiceOver {
+		return p.OriginalVolume
+	}
+	return p.BackgroundVolume
 }
 
 // processWhisper xử lý Whisper
@@ -285,6 +405,7 @@ func (p *ProcessVideoParallel) processWhisper() (*WhisperResult, error) {
 
 	var transcript string
 	var segments []Segment
+	var whisperLanguage string
 
 	if p.HasCustomSrt {
 		// Sử dụng custom SRT - parse file SRT để lấy segments và transcript
@@ -302,18 +423,16 @@ func (p *ProcessVideoParallel) processWhisper() (*WhisperResult, error) {
 		transcript = strings.Join(transcriptLines, " ")
 		segments = parsedSegments
 	} else {
-		// Kiểm tra cache trước
-		if cachedResult, err := p.CacheService.GetCachedWhisperResult(p.AudioPath); err == nil {
-			log.Printf("Using cached Whisper result")
-			return cachedResult, nil
+		// Sử dụng Whisper theo service_config, kết quả được cache theo nội dung audio
+		whisperServiceName, whisperModelAPIName, err := p.PricingService.GetActiveServiceForType("speech_to_text")
+		if err != nil {
+			whisperServiceName, whisperModelAPIName = "whisper", ""
 		}
-
-		// Sử dụng Whisper
-		var err error
-		transcript, segments, _, err = TranscribeWhisperOpenAI(p.AudioPath, p.APIKey)
+		transcribed, _, err := TranscribeWithServiceCachedResult(p.AudioPath, p.APIKey, whisperServiceName, whisperModelAPIName)
 		if err != nil {
 			return nil, err
 		}
+		transcript, segments, whisperLanguage = transcribed.Transcript, transcribed.Segments, transcribed.SourceLanguage
 	}
 
 	// Tạo SRT file
@@ -324,15 +443,12 @@ func (p *ProcessVideoParallel) processWhisper() (*WhisperResult, error) {
 	}
 
 	result := &WhisperResult{
-		Transcript: transcript,
-		Segments:   segments,
-		SRTPath:    srtPath,
-	}
-
-	// Cache kết quả
-	if !p.HasCustomSrt {
-		p.CacheService.CacheWhisperResult(p.AudioPath, result)
+		Transcript:     transcript,
+		Segments:       segments,
+		SRTPath:        srtPath,
+		SourceLanguage: ResolveSourceLanguage(whisperLanguage, transcript),
 	}
+	log.Printf("🌐 [PARALLEL-WHISPER] Ngôn ngữ nguồn: %q (whisper: %q)", result.SourceLanguage, whisperLanguage)
 
 	return result, nil
 }
@@ -341,22 +457,13 @@ func (p *ProcessVideoParallel) processWhisper() (*WhisperResult, error) {
 func (p *ProcessVideoParallel) processBackground() (*BackgroundResult, error) {
 	log.Printf("Processing background extraction...")
 
-	// Kiểm tra cache trước
-	if cachedPath, err := p.CacheService.GetCachedBackgroundResult(p.AudioPath); err == nil {
-		log.Printf("Using cached background result")
-		return &BackgroundResult{Path: cachedPath}, nil
-	}
-
-	// Sử dụng optimized background extractor
+	// Sử dụng optimized background extractor (kết quả Demucs được cache theo nội dung audio)
 	extractor := NewOptimizedBackgroundExtractor(p.AudioPath, p.VideoDir)
 	backgroundPath, err := extractor.ExtractWithFallback()
 	if err != nil {
 		return nil, err
 	}
 
-	// Cache kết quả
-	p.CacheService.CacheBackgroundResult(p.AudioPath, backgroundPath)
-
 	return &BackgroundResult{
 		Path: backgroundPath,
 	}, nil
@@ -374,6 +481,28 @@ func (p *ProcessVideoParallel) processTranslation(whisperResult *WhisperResult)
 		}, nil
 	}
 
+	translatedSRTPath := filepath.Join(p.VideoDir, "translated.srt")
+
+	// Video đã nói đúng ngôn ngữ đích: dùng luôn SRT gốc, không gọi LLM và không tính phí dịch
+	if IsSameLanguage(whisperResult.SourceLanguage, p.TargetLanguage) {
+		log.Printf("⏭️ [PARALLEL PROCESSING] Ngôn ngữ nguồn %s trùng ngôn ngữ đích, bỏ qua bước dịch", whisperResult.SourceLanguage)
+		originalContent, err := os.ReadFile(whisperResult.SRTPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(translatedSRTPath, originalContent, 0644); err != nil {
+			return nil, err
+		}
+		return &TranslationResult{
+			TranslatedSRTPath: translatedSRTPath,
+			TranslatedContent: string(originalContent),
+			Skipped:           true,
+		}, nil
+	}
+
+	// Translation memory tra theo cặp ngôn ngữ nguồn đã nhận diện → ngôn ngữ đích
+	memory := NewTranslationMemoryContext(p.MemoryUserID, whisperResult.SourceLanguage, p.TargetLanguage)
+
 	// Lấy service_name và model_api_name cho nghiệp vụ dịch SRT từ bảng service_config
 	serviceName, srtModelAPIName, err := p.PricingService.GetActiveServiceForType("srt_translation")
 	if err != nil {
@@ -384,29 +513,42 @@ func (p *ProcessVideoParallel) processTranslation(whisperResult *WhisperResult)
 	var translatedContent string
 	if strings.Contains(serviceName, "gpt") {
 		// Use GPT for translation with context awareness
-		translatedContent, err = TranslateSRTWithContextAwareness(whisperResult.SRTPath, p.APIKey, srtModelAPIName, p.TargetLanguage)
+		translatedContent, err = TranslateSRTWithCache(whisperResult.SRTPath, p.APIKey, srtModelAPIName, whisperResult.SourceLanguage, p.TargetLanguage, p.Glossary, memory)
 	} else {
 		// Use Gemini for translation with context awareness (default)
-		translatedContent, err = TranslateSRTWithContextAwareness(whisperResult.SRTPath, p.GeminiKey, srtModelAPIName, p.TargetLanguage)
+		translatedContent, err = TranslateSRTWithCache(whisperResult.SRTPath, p.GeminiKey, srtModelAPIName, whisperResult.SourceLanguage, p.TargetLanguage, p.Glossary, memory)
 	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Lưu file đã dịch
-	translatedSRTPath := filepath.Join(p.VideoDir, "translated.srt")
 	if err := os.WriteFile(translatedSRTPath, []byte(translatedContent), 0644); err != nil {
 		return nil, err
 	}
 
+	// Kiểm tra bản dịch có dùng đúng thuật ngữ trong glossary không
+	var violations []model.GlossaryViolation
+	var qaReport *model.TranslationQAReport
+	if originalContent, err := os.ReadFile(whisperResult.SRTPath); err == nil {
+		if len(p.Glossary) > 0 {
+			violations = CheckGlossaryCompliance(string(originalContent), translatedContent, p.Glossary)
+		}
+		qaReport = RunTranslationQAOnSRT(string(originalContent), translatedContent, p.TargetLanguage)
+	}
+
 	return &TranslationResult{
-		TranslatedSRTPath: translatedSRTPath,
-		TranslatedContent: translatedContent,
+		TranslatedSRTPath:  translatedSRTPath,
+		TranslatedContent:  translatedContent,
+		GlossaryViolations: violations,
+		TranslationMemory:  memory.Stats(serviceName),
+		QAReport:           qaReport,
 	}, nil
 }
 
 // processTTS xử lý TTS
-func (p *ProcessVideoParallel) processTTS(translationResult *TranslationResult) (*TTSResult, error) {
+// cueVoices là giọng riêng theo cue khi có diarization (nil = một giọng cho toàn bộ)
+func (p *ProcessVideoParallel) processTTS(translationResult *TranslationResult, cueVoices map[int]string) (*TTSResult, error) {
 	log.Printf("Processing TTS...")
 
 	// Đọc nội dung SRT đã dịch
@@ -433,31 +575,66 @@ func (p *ProcessVideoParallel) processTTS(translationResult *TranslationResult)
 		log.Printf("Using target language for TTS: %s", ttsLanguage)
 	}
 
+	// Xác định phần phải tính phí trước khi synthesize (segment tạo trong job này vẫn tính là miss)
+	billing := SplitTTSBillingByCache(content, ttsLanguage, p.VoiceName, p.SpeakingRate, cueVoices)
+	log.Printf("TTS cache: %d hit segments, %d miss segments (%d billed chars)", billing.HitSegments, billing.MissSegments, billing.BilledCharacters)
+
 	// Sử dụng Optimized TTS Service thay vì TTS cũ
-	ttsPath, err := p.processTTSWithOptimizedService(content, ttsLanguage)
+	ttsPath, report, err := p.processTTSWithOptimizedService(content, ttsLanguage, cueVoices)
 	if err != nil {
 		return nil, err
 	}
 
-	return &TTSResult{
+	result := &TTSResult{
 		TTSPath: ttsPath,
-	}, nil
+		Billing: billing,
+	}
+	if report != nil {
+		result.OverflowSegments = report.OverflowSegments
+		// Synthesize lại với SpeakingRate cao hơn là request riêng, tính phí như segment miss
+		result.Billing.AddRateRetries(report)
+	}
+	return result, nil
 }
 
 // processVideo xử lý video cuối cùng
 func (p *ProcessVideoParallel) processVideo(ttsResult *TTSResult, backgroundResult *BackgroundResult, translationResult *TranslationResult) (*ProcessVideoResult, error) {
 	log.Printf("Processing final video...")
 
-	// Merge video với audio
-	mergedPath, err := MergeVideoWithAudio(p.VideoPath, backgroundResult.Path, ttsResult.TTSPath, p.VideoDir, p.BackgroundVolume, p.TTSVolume)
-	if err != nil {
-		return nil, err
+	// Reframe video ngang sang dọc trước khi merge/burn để phụ đề nằm trong vùng an toàn
+	sourceVideoPath := p.VideoPath
+	burnProfile := p.OutputProfile
+	if p.reframedVideoPath != "" {
+		sourceVideoPath = p.reframedVideoPath
+		if burnProfile.SafeAreaBottom == 0 {
+			burnProfile.SafeAreaBottom = VerticalSafeAreaBottom
+		}
+	} else if p.ReframeMode != ReframeModeNone {
+		reframedPath, err := ReframeVideo(p.VideoPath, p.VideoDir, p.ReframeMode, p.OutputProfile)
+		if err != nil {
+			log.Printf("Reframe failed, using original video: %v", err)
+		} else if reframedPath != p.VideoPath {
+			sourceVideoPath = reframedPath
+			if burnProfile.SafeAreaBottom == 0 {
+				burnProfile.SafeAreaBottom = VerticalSafeAreaBottom
+			}
+		}
+	}
+
+	// Merge video với audio, subtitle-only giữ audio gốc và burn phụ đề trực tiếp lên video
+	mergedPath := sourceVideoPath
+	if VoiceModeUsesTTS(p.VoiceMode) {
+		var err error
+		mergedPath, err = MergeVideoWithAudio(sourceVideoPath, backgroundResult.Path, ttsResult.TTSPath, p.VideoDir, p.backgroundVolume(), p.TTSVolume, p.OutputProfile)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Burn subtitle
 	finalPath := mergedPath
 	if translationResult.TranslatedSRTPath != "" {
-		burnedPath, err := BurnSubtitleWithBackground(mergedPath, translationResult.TranslatedSRTPath, p.VideoDir, p.SubtitleColor, p.SubtitleBgColor)
+		burnedPath, err := BurnSubtitleWithBackground(mergedPath, translationResult.TranslatedSRTPath, p.VideoDir, p.SubtitleColor, p.SubtitleBgColor, burnProfile)
 		if err != nil {
 			log.Printf("Subtitle burn failed, using merged video: %v", err)
 		} else {
@@ -466,18 +643,24 @@ func (p *ProcessVideoParallel) processVideo(ttsResult *TTSResult, backgroundResu
 	}
 
 	return &ProcessVideoResult{
-		FinalVideoPath:    finalPath,
-		BackgroundPath:    backgroundResult.Path,
-		TTSPath:           ttsResult.TTSPath,
-		OriginalSRTPath:   "", // Sẽ được set sau
-		TranslatedSRTPath: translationResult.TranslatedSRTPath,
-		Transcript:        "",  // Sẽ được set sau
-		Segments:          nil, // Sẽ được set sau
+		FinalVideoPath:     finalPath,
+		BackgroundPath:     backgroundResult.Path,
+		TTSPath:            ttsResult.TTSPath,
+		OriginalSRTPath:    "", // Sẽ được set sau
+		TranslatedSRTPath:  translationResult.TranslatedSRTPath,
+		Transcript:         "",  // Sẽ được set sau
+		Segments:           nil, // Sẽ được set sau
+		TTSBilling:         ttsResult.Billing,
+		TTSOverflow:        ttsResult.OverflowSegments,
+		GlossaryViolations: translationResult.GlossaryViolations,
+		TranslationMemory:  translationResult.TranslationMemory,
+		TranslationQA:      translationResult.QAReport,
 	}, nil
 }
 
 // processTTSWithOptimizedService xử lý TTS với Optimized TTS Service
-func (p *ProcessVideoParallel) processTTSWithOptimizedService(srtContent, targetLanguage string) (string, error) {
+// Báo cáo căn chỉnh chỉ có khi fallback về TTS tuần tự (nil với Optimized TTS Service)
+func (p *ProcessVideoParallel) processTTSWithOptimizedService(srtContent, targetLanguage string, cueVoices map[int]string) (string, *TTSTimingReport, error) {
 	log.Printf("Processing TTS with Optimized TTS Service...")
 
 	// Khởi tạo Optimized TTS Service
@@ -485,7 +668,7 @@ func (p *ProcessVideoParallel) processTTSWithOptimizedService(srtContent, target
 	if err != nil {
 		log.Printf("Failed to initialize Optimized TTS Service, falling back to old TTS: %v", err)
 		// Fallback về TTS cũ nếu không thể khởi tạo service mới
-		return ConvertSRTToSpeechWithLanguageAndVoice(srtContent, p.VideoDir, p.SpeakingRate, targetLanguage, p.VoiceName)
+		return ConvertSRTToSpeechWithTimingReport(srtContent, p.VideoDir, p.SpeakingRate, targetLanguage, p.VoiceName, cueVoices)
 	}
 
 	// Tạo job ID cho TTS processing
@@ -503,6 +686,7 @@ func (p *ProcessVideoParallel) processTTSWithOptimizedService(srtContent, target
 		MaxConcurrent:    6,
 		UserID:           0,           // Không có user ID trong context này
 		VoiceName:        p.VoiceName, // Thêm voice selection
+		CueVoices:        cueVoices,
 	}
 
 	// Xử lý TTS với concurrent processing
@@ -510,11 +694,11 @@ func (p *ProcessVideoParallel) processTTSWithOptimizedService(srtContent, target
 	if err != nil {
 		log.Printf("Optimized TTS failed, falling back to old TTS: %v", err)
 		// Fallback về TTS cũ nếu service mới thất bại
-		return ConvertSRTToSpeechWithLanguageAndVoice(srtContent, p.VideoDir, p.SpeakingRate, targetLanguage, p.VoiceName)
+		return ConvertSRTToSpeechWithTimingReport(srtContent, p.VideoDir, p.SpeakingRate, targetLanguage, p.VoiceName, cueVoices)
 	}
 
 	log.Printf("Optimized TTS completed successfully: %s", audioPath)
-	return audioPath, nil
+	return audioPath, nil, nil
 }
 
 // Helper functions
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	PaymentOutcomePaid        = "paid"
+	PaymentOutcomeNeedsReview = "needs_review"
+	PaymentOutcomeDuplicate   = "duplicate"
+
+	PaymentSourceSepay  = "sepay"
+	PaymentSourceEmail  = "email"
+	PaymentSourceManual = "manual" // Admin xác nhận thủ công (kể cả khi đối soát hàng chờ)
+
+	paymentTransactionProcessing    = "processing"
+	paymentTransactionFailed        = "failed"
+	paymentTransactionFulfillFailed = "fulfill_failed" // Đơn đã paid nhưng cộng credit/kích hoạt gói lỗi, CheckExpiredOrders thử lại
+
+	// Giao dịch ở processing lâu hơn thời gian này coi như tiến trình xử lý đã chết giữa chừng và được giành lại
+	paymentTransactionProcessingTimeout = 15 * time.Minute
+)
+
+var ErrInvalidPaymentConfirmation = errors.New("invalid payment confirmation")
+
+// IncomingPayment là một khoản tiền vào tài khoản đọc được từ Sepay webhook, email ngân hàng hoặc admin nhập
+type IncomingPayment struct {
+	Source        string // sepay, email, manual
+	SourceLogID   uint   // ID SepayWebhookLog/PaymentEmailLog, 0 nếu admin nhập
+	OrderCode     string // Mã đơn trong nội dung chuyển khoản, có thể rỗng
+	TransactionID string
+	AmountVND     decimal.Decimal
+}
+
+// ConfirmPayment là điểm duy nhất ghi nhận tiền vào cho đơn hàng (Sepay, email, admin).
+// Mỗi giao dịch (source, transactionID) chỉ được xử lý một lần; lần xử lý lỗi trước khi đơn được ghi nhận thì được thử lại.
+// Sepay và email không có chung mã giao dịch ngân hàng, nên cùng một khoản chuyển khoản đọc được ở kênh thứ hai
+// (đơn đã paid bởi kênh khác với đúng số tiền đó) trả về duplicate thay vì đưa vào hàng chờ.
+// Đơn pending được ghi nhận paid theo số tiền thực nhận; không tìm thấy đơn, đơn đã hết hạn/huỷ/thanh toán,
+// hoặc đơn subscription nhận thiếu tiền thì đưa vào hàng chờ needs_review. Admin (manual) được ghi nhận cho đơn hết hạn/đã huỷ.
+// Mỗi lần gọi ghi đúng một PaymentLog
+func (s *PaymentOrderService) ConfirmPayment(source, transactionID, orderCode string, amount decimal.Decimal, sourceLogID uint) (string, *config.PaymentOrder, error) {
+	payment := IncomingPayment{
+		Source:        source,
+		SourceLogID:   sourceLogID,
+		OrderCode:     orderCode,
+		TransactionID: transactionID,
+		AmountVND:     amount,
+	}
+	if transactionID == "" {
+		err := fmt.Errorf("%w: transaction id is required", ErrInvalidPaymentConfirmation)
+		s.logPaymentAttempt(payment, nil, "", err)
+		return "", nil, err
+	}
+
+	attempt, err := s.claimPaymentTransaction(payment)
+	if err != nil {
+		s.logPaymentAttempt(payment, nil, "", err)
+		return "", nil, err
+	}
+	if attempt == nil {
+		order, _ := s.GetOrderByCode(orderCode)
+		s.logPaymentAttempt(payment, order, PaymentOutcomeDuplicate, nil)
+		log.Printf("Payment %s from %s already processed, skipping", transactionID, source)
+		return PaymentOutcomeDuplicate, order, nil
+	}
+
+	outcome, order, err := s.confirmPayment(payment)
+	s.finishPaymentTransaction(attempt, outcome, order, err)
+	s.logPaymentAttempt(payment, order, outcome, err)
+	return outcome, order, err
+}
+
+func (s *PaymentOrderService) confirmPayment(payment IncomingPayment) (string, *config.PaymentOrder, error) {
+	manual := payment.Source == PaymentSourceManual
+	queue := func(order *config.PaymentOrder, reason string) (string, *config.PaymentOrder, error) {
+		// Admin xác nhận thì báo lỗi ngay thay vì đưa vào hàng chờ của chính admin
+		if manual {
+			return "", order, fmt.Errorf("%w: %s", ErrInvalidPaymentConfirmation, reason)
+		}
+		_, err := NewPaymentReviewService(config.Db).Queue(payment, order, reason)
+		return PaymentOutcomeNeedsReview, order, err
+	}
+
+	if payment.OrderCode == "" {
+		return queue(nil, ReviewReasonOrderNotFound)
+	}
+	order, err := s.GetOrderByCode(payment.OrderCode)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return queue(nil, ReviewReasonOrderNotFound)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get order %s: %v", payment.OrderCode, err)
+	}
+
+	// Đơn đã paid bởi chính giao dịch này (lần xử lý trước chết sau khi ghi nhận paid): chỉ giao hàng lại
+	if order.OrderStatus == "paid" && order.TransactionID != nil && *order.TransactionID == payment.TransactionID {
+		if err := s.fulfillPaidOrder(order, payment.Source, payment.TransactionID); err != nil {
+			return PaymentOutcomePaid, order, err
+		}
+		return PaymentOutcomePaid, order, nil
+	}
+	if s.paidByOtherSource(order, payment) {
+		return PaymentOutcomeDuplicate, order, nil
+	}
+	reason := reviewReasonForOrder(order, payment.AmountVND)
+	if manual && (reason == ReviewReasonOrderExpired || reason == ReviewReasonOrderCancelled) {
+		reason = ""
+	}
+	if reason != "" {
+		return queue(order, reason)
+	}
+
+	if err := s.MarkOrderPaid(order, payment.TransactionID, payment.AmountVND); err != nil {
+		// Kênh khác vừa ghi nhận hoặc đơn vừa hết hạn: xử lý lại theo trạng thái mới
+		if errors.Is(err, ErrInvalidOrderTransition) {
+			if latest, getErr := s.GetOrderByCode(payment.OrderCode); getErr == nil {
+				if s.paidByOtherSource(latest, payment) {
+					return PaymentOutcomeDuplicate, latest, nil
+				}
+				if reason := reviewReasonForOrder(latest, payment.AmountVND); reason != "" {
+					return queue(latest, reason)
+				}
+			}
+		}
+		return "", order, err
+	}
+	if err := s.fulfillPaidOrder(order, payment.Source, payment.TransactionID); err != nil {
+		return PaymentOutcomePaid, order, err
+	}
+	return PaymentOutcomePaid, order, nil
+}
+
+// fulfillPaidOrder giao hàng cho đơn vừa paid và thưởng giới thiệu. Lỗi được trả về để giao dịch chuyển sang
+// fulfill_failed và được RetryFailedFulfillments thử lại; FulfillOrder bỏ qua phần credit đã cộng,
+// lượt giới thiệu chưa thưởng vẫn ở pending nên được thưởng ở lần thử lại
+func (s *PaymentOrderService) fulfillPaidOrder(order *config.PaymentOrder, source, transactionID string) error {
+	if err := s.FulfillOrder(order, paymentDescription(source, order.OrderCode), transactionID); err != nil {
+		return fmt.Errorf("failed to fulfill order: %v", err)
+	}
+	if err := NewReferralService(config.Db).RewardFirstPayment(order); err != nil {
+		return fmt.Errorf("failed to reward referral: %v", err)
+	}
+	return nil
+}
+
+// paidByOtherSource kiểm tra đơn đã paid bởi giao dịch ở kênh khác với đúng số tiền này (cùng một khoản chuyển khoản
+// được Sepay và email cùng báo). Khoản thứ hai cùng kênh vẫn là tiền chuyển thêm và đi vào hàng chờ
+func (s *PaymentOrderService) paidByOtherSource(order *config.PaymentOrder, payment IncomingPayment) bool {
+	if order.OrderStatus != "paid" {
+		return false
+	}
+	var count int64
+	config.Db.Model(&model.PaymentTransaction{}).
+		Where("order_code = ? AND source <> ? AND amount_vnd = ? AND status IN ?", order.OrderCode, payment.Source, payment.AmountVND,
+			[]string{PaymentOutcomePaid, paymentTransactionFulfillFailed, paymentTransactionProcessing}).
+		Count(&count)
+	return count > 0
+}
+
+// RetryFailedFulfillments giao lại hàng cho các đơn đã paid nhưng cộng credit/kích hoạt gói bị lỗi.
+// Giao dịch kẹt ở processing quá paymentTransactionProcessingTimeout (tiến trình chết giữa chừng) cũng được giành lại:
+// đơn đã paid bởi giao dịch đó thì giao hàng lại, chưa paid thì chuyển sang failed để lần gửi lại webhook/email xử lý lại
+func (s *PaymentOrderService) RetryFailedFulfillments() {
+	staleBefore := time.Now().Add(-paymentTransactionProcessingTimeout)
+	var attempts []model.PaymentTransaction
+	if err := config.Db.Where("(status = ? AND order_id IS NOT NULL) OR (status = ? AND updated_at < ?)",
+		paymentTransactionFulfillFailed, paymentTransactionProcessing, staleBefore).
+		Order("id").Limit(50).Find(&attempts).Error; err != nil {
+		log.Printf("Failed to get failed fulfillments: %v", err)
+		return
+	}
+
+	for i := range attempts {
+		attempt := &attempts[i]
+		// Điều kiện status để chỉ một worker giành được giao dịch
+		claim := config.Db.Model(&model.PaymentTransaction{}).Where("id = ?", attempt.ID)
+		if attempt.Status == paymentTransactionProcessing {
+			claim = claim.Where("status = ? AND updated_at < ?", paymentTransactionProcessing, staleBefore)
+		} else {
+			claim = claim.Where("status = ?", paymentTransactionFulfillFailed)
+		}
+		result := claim.Update("status", paymentTransactionProcessing)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		order, err := s.paidOrderOfTransaction(attempt)
+		if err != nil {
+			// Chết trước khi đơn được ghi nhận paid: để lần gửi lại của kênh thanh toán xử lý lại từ đầu
+			log.Printf("Payment transaction %s/%s interrupted before the order was paid: %v", attempt.Source, attempt.TransactionID, err)
+			s.finishPaymentTransaction(attempt, "", nil, fmt.Errorf("processing interrupted: %v", err))
+			continue
+		}
+		err = s.fulfillPaidOrder(order, attempt.Source, attempt.TransactionID)
+		s.finishPaymentTransaction(attempt, PaymentOutcomePaid, order, err)
+		if err != nil {
+			log.Printf("Retry fulfilling order %s (transaction %s) failed: %v", attempt.OrderCode, attempt.TransactionID, err)
+			continue
+		}
+		s.createPaymentLog(order.ID, "payment_confirmed", fmt.Sprintf("Giao lại đơn thành công (giao dịch %s)", attempt.TransactionID), nil)
+		log.Printf("Fulfilled order %s on retry (transaction %s)", order.OrderCode, attempt.TransactionID)
+	}
+}
+
+// paidOrderOfTransaction lấy đơn mà giao dịch đã ghi nhận paid: theo order_id đã lưu, hoặc theo mã đơn khi
+// tiến trình chết trước khi lưu order_id (đơn phải paid bởi đúng giao dịch này)
+func (s *PaymentOrderService) paidOrderOfTransaction(attempt *model.PaymentTransaction) (*config.PaymentOrder, error) {
+	if attempt.OrderID != nil {
+		var order config.PaymentOrder
+		if err := config.Db.First(&order, *attempt.OrderID).Error; err != nil {
+			return nil, err
+		}
+		return &order, nil
+	}
+	if attempt.OrderCode == "" {
+		return nil, fmt.Errorf("transaction has no order code")
+	}
+	order, err := s.GetOrderByCode(attempt.OrderCode)
+	if err != nil {
+		return nil, err
+	}
+	if order.OrderStatus != "paid" || order.TransactionID == nil || *order.TransactionID != attempt.TransactionID {
+		return nil, fmt.Errorf("order %s was not paid by this transaction", order.OrderCode)
+	}
+	return order, nil
+}
+
+func paymentDescription(source, orderCode string) string {
+	switch source {
+	case PaymentSourceSepay:
+		return fmt.Sprintf("Nạp credit qua Sepay - %s", orderCode)
+	case PaymentSourceManual:
+		return fmt.Sprintf("Nạp credit (xác nhận thủ công) - %s", orderCode)
+	}
+	return fmt.Sprintf("Nạp credit qua thanh toán QR - %s", orderCode)
+}
+
+// IsPaymentTransactionProcessed kiểm tra giao dịch đã được xử lý xong (không tính lần xử lý lỗi)
+func (s *PaymentOrderService) IsPaymentTransactionProcessed(source, transactionID string) bool {
+	var count int64
+	config.Db.Model(&model.PaymentTransaction{}).
+		Where("source = ? AND transaction_id = ? AND status <> ?", source, transactionID, paymentTransactionFailed).
+		Count(&count)
+	return count > 0
+}
+
+// claimPaymentTransaction giữ giao dịch để xử lý. Trả về nil nếu giao dịch đã/đang được xử lý ở request khác
+func (s *PaymentOrderService) claimPaymentTransaction(payment IncomingPayment) (*model.PaymentTransaction, error) {
+	attempt := &model.PaymentTransaction{
+		Source:        payment.Source,
+		TransactionID: payment.TransactionID,
+		OrderCode:     payment.OrderCode,
+		AmountVND:     payment.AmountVND,
+		Status:        paymentTransactionProcessing,
+	}
+	createErr := config.Db.Create(attempt).Error
+	if createErr == nil {
+		return attempt, nil
+	}
+
+	// Vi phạm unique (source, transaction_id): giao dịch đã có
+	var existing model.PaymentTransaction
+	if err := config.Db.Where("source = ? AND transaction_id = ?", payment.Source, payment.TransactionID).First(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to record payment transaction: %v", createErr)
+	}
+	staleBefore := time.Now().Add(-paymentTransactionProcessingTimeout)
+	stale := existing.Status == paymentTransactionProcessing && existing.UpdatedAt.Before(staleBefore)
+	if existing.Status != paymentTransactionFailed && !stale {
+		return nil, nil
+	}
+	if stale {
+		log.Printf("Payment transaction %s/%s stuck in processing since %s, reclaiming", existing.Source, existing.TransactionID, existing.UpdatedAt.Format(time.RFC3339))
+	}
+
+	// Lần trước lỗi trước khi đơn được ghi nhận, hoặc tiến trình xử lý chết giữa chừng: cho phép thử lại,
+	// điều kiện status để chỉ một request giành được
+	result := config.Db.Model(&model.PaymentTransaction{}).
+		Where("id = ? AND (status = ? OR (status = ? AND updated_at < ?))", existing.ID, paymentTransactionFailed, paymentTransactionProcessing, staleBefore).
+		Updates(map[string]interface{}{"status": paymentTransactionProcessing, "error_message": ""})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	existing.Status = paymentTransactionProcessing
+	return &existing, nil
+}
+
+func (s *PaymentOrderService) finishPaymentTransaction(attempt *model.PaymentTransaction, outcome string, order *config.PaymentOrder, err error) {
+	updates := map[string]interface{}{"status": outcome, "error_message": ""}
+	if order != nil && order.ID != 0 {
+		updates["order_id"] = order.ID
+	}
+	if err != nil {
+		updates["error_message"] = err.Error()
+		// Đơn đã ghi nhận paid thì không xử lý lại giao dịch, chỉ giao hàng lại (RetryFailedFulfillments)
+		switch outcome {
+		case "":
+			updates["status"] = paymentTransactionFailed
+		case PaymentOutcomePaid:
+			updates["status"] = paymentTransactionFulfillFailed
+		}
+	}
+	if updateErr := config.Db.Model(attempt).Updates(updates).Error; updateErr != nil {
+		log.Printf("Failed to update payment transaction %s/%s: %v", attempt.Source, attempt.TransactionID, updateErr)
+	}
+}
+
+// logPaymentAttempt ghi một PaymentLog cho mỗi lần xác nhận thanh toán. Giao dịch không khớp đơn ghi order_id = 0
+func (s *PaymentOrderService) logPaymentAttempt(payment IncomingPayment, order *config.PaymentOrder, outcome string, err error) {
+	var orderID uint
+	if order != nil {
+		orderID = order.ID
+	}
+
+	logType := "payment_detected"
+	message := fmt.Sprintf("Nhận %s VND từ %s (giao dịch %s)", payment.AmountVND.String(), payment.Source, payment.TransactionID)
+	switch {
+	case err != nil:
+		logType = "payment_failed"
+		message += ": " + err.Error()
+	case outcome == PaymentOutcomePaid:
+		logType = "payment_confirmed"
+		message += ": đơn đã thanh toán"
+	case outcome == PaymentOutcomeNeedsReview:
+		message += ": chờ admin đối soát"
+	case outcome == PaymentOutcomeDuplicate:
+		message += ": giao dịch đã xử lý trước đó"
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"source":         payment.Source,
+		"source_log_id":  payment.SourceLogID,
+		"transaction_id": payment.TransactionID,
+		"order_code":     payment.OrderCode,
+		"amount_vnd":     payment.AmountVND.String(),
+		"outcome":        outcome,
+		"at":             time.Now().Format(time.RFC3339),
+	})
+	metadataStr := string(metadata)
+	s.createPaymentLog(orderID, logType, message, &metadataStr)
+}
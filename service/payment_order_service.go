@@ -2,6 +2,8 @@ package service
 
 import (
 	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -23,8 +25,68 @@ func NewPaymentOrderService() *PaymentOrderService {
 	}
 }
 
-// CreateOrder tạo đơn hàng mới
+const (
+	OrderPurposeTopup        = "topup"
+	OrderPurposeSubscription = "subscription"
+)
+
+var ErrInvalidTopup = errors.New("invalid top-up")
+
+// orderDetails là thông tin gắn với đơn hàng ngoài số tiền
+type orderDetails struct {
+	purpose        string
+	subscriptionID *uint
+	packageID      *uint
+	promoCodeID    *uint
+	amountVND      float64 // Giá VND cố định (gói nạp), 0 = quy đổi từ amountUSD theo tỷ giá
+}
+
+// CreateOrder tạo đơn hàng nạp credit mới
 func (s *PaymentOrderService) CreateOrder(userID uint, amountUSD float64) (*config.PaymentOrder, error) {
+	return s.createOrder(userID, amountUSD, orderDetails{purpose: OrderPurposeTopup})
+}
+
+// CreateTopupOrder tạo đơn nạp credit theo gói định sẵn (packageID) hoặc số tiền tuỳ ý, kèm mã khuyến mãi nếu có.
+// Trả về các khoản thưởng dự kiến, thưởng thực tế được cộng khi đơn thanh toán
+func (s *PaymentOrderService) CreateTopupOrder(userID uint, amountUSD float64, packageID *uint, promoCode string) (*config.PaymentOrder, []model.TopupBonus, error) {
+	promotionService := NewPromotionService(config.Db)
+	details := orderDetails{purpose: OrderPurposeTopup}
+
+	var pkg *model.CreditPackage
+	if packageID != nil {
+		found, err := promotionService.GetActivePackage(*packageID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: credit package %d not found", ErrInvalidTopup, *packageID)
+		}
+		pkg = found
+		amountUSD = pkg.Credits
+		details.packageID = &pkg.ID
+		details.amountVND = pkg.PriceVND
+	}
+
+	var code *model.PromoCode
+	if promoCode != "" {
+		found, err := promotionService.ValidatePromoCode(userID, promoCode, amountUSD)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidTopup, err)
+		}
+		code = found
+		details.promoCodeID = &code.ID
+	}
+
+	order, err := s.createOrder(userID, amountUSD, details)
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, promotionService.EstimateBonuses(userID, amountUSD, pkg, code, order.ID), nil
+}
+
+// CreateSubscriptionOrder tạo đơn hàng thanh toán gói subscription, gói được kích hoạt khi đơn được thanh toán
+func (s *PaymentOrderService) CreateSubscriptionOrder(userID uint, amountUSD float64, subscriptionID uint) (*config.PaymentOrder, error) {
+	return s.createOrder(userID, amountUSD, orderDetails{purpose: OrderPurposeSubscription, subscriptionID: &subscriptionID})
+}
+
+func (s *PaymentOrderService) createOrder(userID uint, amountUSD float64, details orderDetails) (*config.PaymentOrder, error) {
 	tx := config.Db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -35,31 +97,40 @@ func (s *PaymentOrderService) CreateOrder(userID uint, amountUSD float64) (*conf
 	// Tạo order code duy nhất
 	orderCode := s.generateOrderCode()
 
-	// Chuyển đổi USD sang VND (tỷ giá cố định 25,000 VND/USD)
-	exchangeRate := decimal.NewFromFloat(25000)
+	// Chuyển đổi USD sang VND theo tỷ giá đang có hiệu lực, tỷ giá được lưu lại trên đơn để đối soát
+	exchangeRate := NewExchangeRateService(config.Db).GetCurrentRate()
 	amountUSDDecimal := decimal.NewFromFloat(amountUSD)
 	amountVND := amountUSDDecimal.Mul(exchangeRate)
+	if details.amountVND > 0 {
+		amountVND = decimal.NewFromFloat(details.amountVND)
+	}
+	// Chuyển khoản chỉ nhận số nguyên VND, số tiền trên đơn phải khớp số tiền trong QR
+	amountVND = amountVND.Round(0)
 
-	// Lấy tài khoản ngân hàng khả dụng
+	// Lấy tài khoản ngân hàng còn hạn mức
 	bankAccount, err := s.getAvailableBankAccount(amountVND)
 	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to get bank account: %v", err)
+		return nil, fmt.Errorf("failed to get bank account: %w", err)
 	}
 
 	// Tạo đơn hàng
 	order := &config.PaymentOrder{
-		UserID:        userID,
-		OrderCode:     orderCode,
-		AmountVND:     amountVND,
-		AmountUSD:     amountUSDDecimal,
-		ExchangeRate:  exchangeRate,
-		BankAccount:   bankAccount.AccountNumber,
-		BankName:      bankAccount.BankName,
-		OrderStatus:   "pending",
-		PaymentMethod: "qr_code",                        // Giữ nguyên qr_code để hiển thị QR
-		ExpiresAt:     time.Now().Add(30 * time.Minute), // Hết hạn sau 30 phút
-		CreatedAt:     time.Now(),
+		UserID:         userID,
+		OrderCode:      orderCode,
+		AmountVND:      amountVND,
+		AmountUSD:      amountUSDDecimal,
+		ExchangeRate:   exchangeRate,
+		BankAccount:    bankAccount.AccountNumber,
+		BankName:       bankAccount.BankName,
+		OrderStatus:    "pending",
+		PaymentMethod:  "qr_code", // Giữ nguyên qr_code để hiển thị QR
+		Purpose:        details.purpose,
+		SubscriptionID: details.subscriptionID,
+		PackageID:      details.packageID,
+		PromoCodeID:    details.promoCodeID,
+		ExpiresAt:      time.Now().Add(30 * time.Minute), // Hết hạn sau 30 phút
+		CreatedAt:      time.Now(),
 	}
 
 	err = tx.Create(order).Error
@@ -93,120 +164,55 @@ func (s *PaymentOrderService) generateOrderCode() string {
 	return fmt.Sprintf("PAY%s%04d", time.Now().Format("20060102150405"), randomNum)
 }
 
-// getAvailableBankAccount lấy tài khoản ngân hàng khả dụng
+// getAvailableBankAccount chọn tài khoản nhận còn đủ hạn mức ngày/tháng cho amount (BankAccountService.SelectAccount).
+// Trả về ErrNoBankAccountAvailable khi mọi tài khoản đều đã chạm hạn mức
 func (s *PaymentOrderService) getAvailableBankAccount(amount decimal.Decimal) (*config.BankAccount, error) {
-	var bankAccount config.BankAccount
-	err := config.Db.Where("is_active = ? AND daily_limit >= ?", true, amount).First(&bankAccount).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// Tạo tài khoản mặc định nếu chưa có
-			bankAccount = config.BankAccount{
-				BankName:      "Vietcombank",
-				AccountNumber: "1234567890",
-				AccountName:   "NGUYEN VAN A",
-				BankCode:      "VCB",
-				IsActive:      true,
-				DailyLimit:    decimal.NewFromInt(100000000),
-				MonthlyLimit:  decimal.NewFromInt(1000000000),
-				CreatedAt:     time.Now(),
-			}
-			err = config.Db.Create(&bankAccount).Error
-			if err != nil {
-				return nil, fmt.Errorf("failed to create default bank account: %v", err)
-			}
-		} else {
-			return nil, fmt.Errorf("failed to get bank account: %v", err)
-		}
+	var count int64
+	if err := config.Db.Model(&config.BankAccount{}).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count bank accounts: %v", err)
 	}
-
-	return &bankAccount, nil
-}
-
-// generateQRCode tạo QR code cho đơn hàng (với retry logic)
-func (s *PaymentOrderService) generateQRCode(order *config.PaymentOrder) error {
-	// Lấy thông tin tài khoản ngân hàng
-	var bankAccount config.BankAccount
-	err := config.Db.Where("account_number = ?", order.BankAccount).First(&bankAccount).Error
-	if err != nil {
-		return fmt.Errorf("failed to get bank account info: %v", err)
-	}
-
-	// Tạo QR code theo chuẩn VietQR NAPAS247
-	qrDataURL, err := s.qrService.GenerateVietQRCode(
-		bankAccount.CardBin,
-		order.BankAccount,
-		order.AmountVND.String(),
-		order.OrderCode,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to generate QR code: %v", err)
-	}
-
-	// Lưu QR data (URL VietQR cũ để backup)
-	qrString := fmt.Sprintf("https://api.vietqr.io/image/%s/%s/%s/%s",
-		bankAccount.BankCode,
-		order.BankAccount,
-		order.AmountVND.String(),
-		order.OrderCode,
-	)
-
-	// Lưu QR data
-	order.QRCodeData = &qrString
-	order.QRCodeURL = &qrDataURL // Sử dụng QR code tự generate
-
-	// Retry logic cho lock timeout
-	maxRetries := 3
-	for i := 0; i < maxRetries; i++ {
-		err := config.Db.Model(order).Updates(map[string]interface{}{
-			"qr_code_url":  order.QRCodeURL,
-			"qr_code_data": order.QRCodeData,
-		}).Error
-
-		if err == nil {
-			// Log tạo QR code
-			s.createPaymentLog(order.ID, "qr_generated", "QR code được tạo thành công", nil)
-			return nil
+	if count == 0 {
+		// Tạo tài khoản mặc định nếu chưa có
+		bankAccount := config.BankAccount{
+			BankName:      "Vietcombank",
+			AccountNumber: "1234567890",
+			AccountName:   "NGUYEN VAN A",
+			BankCode:      "VCB",
+			CardBin:       "970436",
+			IsActive:      true,
+			DailyLimit:    decimal.NewFromInt(100000000),
+			MonthlyLimit:  decimal.NewFromInt(1000000000),
+			CreatedAt:     time.Now(),
 		}
-
-		// Kiểm tra nếu là lock timeout error
-		if i < maxRetries-1 {
-			log.Printf("Lock timeout when updating QR code for order %s, retrying... (attempt %d/%d)",
-				order.OrderCode, i+1, maxRetries)
-			time.Sleep(time.Duration(i+1) * time.Second) // Exponential backoff
+		if err := config.Db.Create(&bankAccount).Error; err != nil {
+			return nil, fmt.Errorf("failed to create default bank account: %v", err)
 		}
 	}
 
-	return fmt.Errorf("failed to update QR code after %d retries", maxRetries)
+	return NewBankAccountService(config.Db).SelectAccount(amount)
 }
 
-// generateQRCodeInTransaction tạo QR code trong cùng transaction
+// generateQRCodeInTransaction tạo QR code trong cùng transaction.
+// QRCodeData lưu chuỗi VietQR (có số tiền và mã đơn) để frontend tự render lại QR khi cần
 func (s *PaymentOrderService) generateQRCodeInTransaction(tx *gorm.DB, order *config.PaymentOrder) error {
 	// Lấy thông tin tài khoản ngân hàng
 	var bankAccount config.BankAccount
-	err := config.Db.Where("account_number = ?", order.BankAccount).First(&bankAccount).Error
+	err := tx.Where("account_number = ?", order.BankAccount).First(&bankAccount).Error
 	if err != nil {
 		return fmt.Errorf("failed to get bank account info: %v", err)
 	}
 
-	// Tạo QR code theo chuẩn VietQR NAPAS247
-	qrDataURL, err := s.qrService.GenerateVietQRCode(
-		bankAccount.CardBin,
-		order.BankAccount,
-		order.AmountVND.String(),
-		order.OrderCode,
-	)
+	// Tạo QR code theo chuẩn VietQR NAPAS247, BIN lấy theo mã ngân hàng nếu tài khoản chưa khai báo CardBin
+	bank := ResolveBankBin(bankAccount.CardBin, bankAccount.BankCode, bankAccount.BankName)
+	qrString, err := s.qrService.VietQRPayload(bank, order.BankAccount, order.AmountVND.String(), order.OrderCode)
+	if err != nil {
+		return fmt.Errorf("failed to generate VietQR payload for %s: %v", bankAccount.BankName, err)
+	}
+	qrDataURL, err := s.qrService.GenerateSimpleQRCode(qrString)
 	if err != nil {
 		return fmt.Errorf("failed to generate QR code: %v", err)
 	}
 
-	// Lưu QR data (URL VietQR cũ để backup)
-	qrString := fmt.Sprintf("https://api.vietqr.io/image/%s/%s/%s/%s",
-		bankAccount.BankCode,
-		order.BankAccount,
-		order.AmountVND.String(),
-		order.OrderCode,
-	)
-
 	// Lưu QR data
 	order.QRCodeData = &qrString
 	order.QRCodeURL = &qrDataURL // Sử dụng QR code tự generate
@@ -225,15 +231,71 @@ func (s *PaymentOrderService) generateQRCodeInTransaction(tx *gorm.DB, order *co
 	return nil
 }
 
+// orderStatusTransitions là các chuyển trạng thái hợp lệ của PaymentOrder. Đơn đã paid không đổi trạng thái nữa;
+// đơn hết hạn/đã huỷ chỉ chuyển sang paid khi admin xác nhận khoản tiền đến muộn
+var orderStatusTransitions = map[string][]string{
+	"pending":   {"paid", "expired", "cancelled"},
+	"expired":   {"paid"},
+	"cancelled": {"paid"},
+}
+
+var ErrInvalidOrderTransition = errors.New("invalid order status transition")
+
+func canTransitionOrder(from, to string) bool {
+	for _, status := range orderStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// orderStatusUpdate là một lần chuyển trạng thái đơn hàng
+type orderStatusUpdate struct {
+	status        string
+	transactionID *string
+	receivedVND   *decimal.Decimal // Số tiền thực nhận khi chuyển sang paid, nil = AmountVND
+	expectedFrom  string           // Chỉ chuyển khi đơn đang ở trạng thái này, rỗng = trạng thái hiện tại
+	skipLog       bool             // Người gọi tự ghi PaymentLog (ConfirmPayment)
+}
+
 // UpdateOrderStatus cập nhật trạng thái đơn hàng
 func (s *PaymentOrderService) UpdateOrderStatus(orderID uint, status string, transactionID *string) error {
+	return s.updateOrderStatus(orderID, orderStatusUpdate{status: status, transactionID: transactionID})
+}
+
+// MarkOrderPaid ghi nhận đơn đã thanh toán với số tiền thực nhận (có thể thiếu/thừa so với AmountVND).
+// Trả về ErrInvalidOrderTransition nếu đơn đã đổi trạng thái so với order.OrderStatus (vd kênh khác vừa ghi nhận)
+func (s *PaymentOrderService) MarkOrderPaid(order *config.PaymentOrder, transactionID string, receivedVND decimal.Decimal) error {
+	err := s.updateOrderStatus(order.ID, orderStatusUpdate{
+		status:        "paid",
+		transactionID: &transactionID,
+		receivedVND:   &receivedVND,
+		expectedFrom:  order.OrderStatus,
+		skipLog:       true,
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	order.OrderStatus = "paid"
+	order.PaidAt = &now
+	order.TransactionID = &transactionID
+	order.AmountReceivedVND = &receivedVND
+	return nil
+}
+
+func (s *PaymentOrderService) updateOrderStatus(orderID uint, update orderStatusUpdate) error {
 	// Retry logic cho lock timeout
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		err := s.updateOrderStatusWithRetry(orderID, status, transactionID)
+		err := s.updateOrderStatusWithRetry(orderID, update)
 		if err == nil {
 			return nil
 		}
+		if errors.Is(err, ErrInvalidOrderTransition) {
+			return err
+		}
 
 		// Kiểm tra nếu là lock timeout error và còn retry
 		if i < maxRetries-1 {
@@ -249,7 +311,7 @@ func (s *PaymentOrderService) UpdateOrderStatus(orderID uint, status string, tra
 }
 
 // updateOrderStatusWithRetry thực hiện cập nhật trạng thái với retry
-func (s *PaymentOrderService) updateOrderStatusWithRetry(orderID uint, status string, transactionID *string) error {
+func (s *PaymentOrderService) updateOrderStatusWithRetry(orderID uint, update orderStatusUpdate) error {
 	tx := config.Db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -264,31 +326,127 @@ func (s *PaymentOrderService) updateOrderStatusWithRetry(orderID uint, status st
 		return fmt.Errorf("failed to get order: %v", err)
 	}
 
-	updates := map[string]interface{}{
-		"order_status": status,
+	from := order.OrderStatus
+	if (update.expectedFrom != "" && update.expectedFrom != from) || !canTransitionOrder(from, update.status) {
+		tx.Rollback()
+		return fmt.Errorf("%w: order %s is %s, cannot become %s", ErrInvalidOrderTransition, order.OrderCode, from, update.status)
 	}
 
-	if status == "paid" {
+	updates := map[string]interface{}{
+		"order_status": update.status,
+	}
+	received := order.AmountVND
+	if update.status == "paid" {
 		now := time.Now()
 		updates["paid_at"] = &now
-		if transactionID != nil {
-			updates["transaction_id"] = transactionID
+		if update.transactionID != nil {
+			updates["transaction_id"] = update.transactionID
+		}
+		if update.receivedVND != nil {
+			received = *update.receivedVND
+			updates["amount_received_vnd"] = received
 		}
 	}
 
-	err = tx.Model(&order).Updates(updates).Error
-	if err != nil {
+	// Điều kiện theo trạng thái vừa đọc để hai request đồng thời không cùng chuyển trạng thái
+	result := tx.Model(&config.PaymentOrder{}).Where("id = ? AND order_status = ?", orderID, from).Updates(updates)
+	if result.Error != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update order status: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
 		tx.Rollback()
-		return fmt.Errorf("failed to update order status: %v", err)
+		return fmt.Errorf("%w: order %s changed status concurrently", ErrInvalidOrderTransition, order.OrderCode)
 	}
 
-	// Log cập nhật trạng thái
-	logMessage := fmt.Sprintf("Trạng thái đơn hàng được cập nhật thành: %s", status)
-	s.createPaymentLogInTransaction(tx, orderID, "payment_confirmed", logMessage, transactionID)
+	// Cộng tiền vào hạn mức đã dùng của tài khoản nhận, cùng transaction để không cộng hai lần
+	if update.status == "paid" {
+		if err := NewBankAccountService(config.Db).RecordInflow(tx, order.BankAccount, received, time.Now()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record bank account inflow: %v", err)
+		}
+	}
+
+	if !update.skipLog {
+		// Log cập nhật trạng thái
+		logMessage := fmt.Sprintf("Trạng thái đơn hàng được cập nhật thành: %s", update.status)
+		s.createPaymentLogInTransaction(tx, orderID, "payment_confirmed", logMessage, update.transactionID)
+	}
 
 	return tx.Commit().Error
 }
 
+// FulfillOrder giao hàng cho đơn đã thanh toán: cộng credit với đơn nạp, kích hoạt gói với đơn mua subscription.
+// Đơn nạp nhận thiếu/thừa tiền được cộng credit theo tỷ lệ số tiền thực nhận, đơn subscription nhận thừa được cộng phần dư thành credit
+func (s *PaymentOrderService) FulfillOrder(order *config.PaymentOrder, description, referenceID string) error {
+	creditService := NewCreditService()
+	if order.Purpose == OrderPurposeSubscription && order.SubscriptionID != nil {
+		if err := NewSubscriptionService(config.Db).ActivateSubscription(*order.SubscriptionID); err != nil {
+			return err
+		}
+		if order.AmountReceivedVND == nil || !order.AmountReceivedVND.GreaterThan(order.AmountVND) {
+			return nil
+		}
+		excessUSD, _ := s.creditForAmount(order, order.AmountReceivedVND.Sub(order.AmountVND)).Float64()
+		if excessUSD <= 0 {
+			return nil
+		}
+		if s.creditsAdded(order.UserID, referenceID) {
+			return nil
+		}
+		log.Printf("Order %s overpaid by %s VND, adding %.2f credits", order.OrderCode, order.AmountReceivedVND.Sub(order.AmountVND).String(), excessUSD)
+		return creditService.AddCredits(order.UserID, excessUSD, description+" (tiền thừa)", referenceID)
+	}
+
+	credited := order.AmountUSD
+	if order.AmountReceivedVND != nil && !order.AmountReceivedVND.Equal(order.AmountVND) {
+		credited = s.creditForAmount(order, *order.AmountReceivedVND)
+		log.Printf("Order %s received %s VND instead of %s VND, crediting %s USD", order.OrderCode, order.AmountReceivedVND.String(), order.AmountVND.String(), credited.String())
+	}
+	order.CreditedUSD = &credited
+	if err := config.Db.Model(order).Update("credited_usd", credited).Error; err != nil {
+		log.Printf("Failed to save credited amount for order %s: %v", order.OrderCode, err)
+	}
+
+	// Giao lại đơn (RetryFailedFulfillments) không cộng credit gốc lần hai
+	amountUSD, _ := credited.Float64()
+	if amountUSD > 0 && !s.creditsAdded(order.UserID, referenceID) {
+		if err := creditService.AddCredits(order.UserID, amountUSD, description, referenceID); err != nil {
+			return err
+		}
+	}
+
+	// Credit thưởng lỗi được trả về để đơn được giao lại; credit gốc và khoản thưởng đã cộng không bị cộng lần hai
+	bonuses, err := NewPromotionService(config.Db).ApplyTopupBonuses(order)
+	for _, bonus := range bonuses {
+		log.Printf("Applied %s bonus %.2f credits to order %s", bonus.Type, bonus.Amount, order.OrderCode)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply top-up bonuses: %v", err)
+	}
+	return nil
+}
+
+// creditsAdded kiểm tra credit của giao dịch thanh toán referenceID đã được cộng chưa
+func (s *PaymentOrderService) creditsAdded(userID uint, referenceID string) bool {
+	var count int64
+	config.Db.Model(&config.CreditTransaction{}).
+		Where("user_id = ? AND reference_id = ? AND transaction_type = ? AND service = ?", userID, referenceID, "add", "topup").
+		Count(&count)
+	return count > 0
+}
+
+// creditForAmount quy đổi số tiền VND thành credit theo đúng tỷ lệ của đơn (giá gói nạp hoặc tỷ giá snapshot)
+func (s *PaymentOrderService) creditForAmount(order *config.PaymentOrder, amountVND decimal.Decimal) decimal.Decimal {
+	if order.AmountVND.IsPositive() {
+		return order.AmountUSD.Mul(amountVND).Div(order.AmountVND).Round(2)
+	}
+	if order.ExchangeRate.IsPositive() {
+		return amountVND.Div(order.ExchangeRate).Round(2)
+	}
+	return decimal.Zero
+}
+
 // GetOrderByCode lấy đơn hàng theo mã
 func (s *PaymentOrderService) GetOrderByCode(orderCode string) (*config.PaymentOrder, error) {
 	var order config.PaymentOrder
@@ -309,24 +467,77 @@ func (s *PaymentOrderService) GetUserOrders(userID uint, limit int) ([]config.Pa
 	return orders, err
 }
 
-// CheckExpiredOrders kiểm tra và cập nhật đơn hàng hết hạn
+// CheckExpiredOrders nhắc user đơn sắp hết hạn, giao lại đơn paid bị lỗi cộng credit và chuyển đơn pending quá hạn sang expired.
+// Tiền chuyển đến sau khi đơn hết hạn được đưa vào hàng chờ needs_review (xem ConfirmPayment)
 func (s *PaymentOrderService) CheckExpiredOrders() error {
+	s.sendPaymentReminders()
+	s.RetryFailedFulfillments()
+
 	var orders []config.PaymentOrder
 	err := config.Db.Where("order_status = ? AND expires_at < ?", "pending", time.Now()).Find(&orders).Error
 	if err != nil {
 		return fmt.Errorf("failed to get expired orders: %v", err)
 	}
 
+	notificationService := NewNotificationService(config.Db)
 	for _, order := range orders {
-		err = s.UpdateOrderStatus(order.ID, "expired", nil)
-		if err != nil {
-			log.Printf("Failed to expire order %s: %v", order.OrderCode, err)
+		// Chỉ chuyển khi đơn vẫn pending để không ghi đè đơn vừa được thanh toán
+		result := config.Db.Model(&config.PaymentOrder{}).
+			Where("id = ? AND order_status = ?", order.ID, "pending").
+			Update("order_status", "expired")
+		if result.Error != nil {
+			log.Printf("Failed to expire order %s: %v", order.OrderCode, result.Error)
+			continue
 		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		s.createPaymentLog(order.ID, "payment_failed", "Đơn hàng hết hạn thanh toán", nil)
+		notificationService.Notify(order.UserID, NotificationOrderExpired,
+			"Đơn hàng đã hết hạn",
+			fmt.Sprintf("Đơn %s (%s VND) đã hết hạn thanh toán. Nếu bạn đã chuyển khoản, khoản tiền sẽ được đối soát và xử lý thủ công.", order.OrderCode, order.AmountVND.String()),
+			&order.ID)
+		log.Printf("Payment order %s expired", order.OrderCode)
 	}
 
 	return nil
 }
 
+// sendPaymentReminders nhắc một lần với đơn pending còn dưới PAYMENT_REMINDER_MINUTES phút
+func (s *PaymentOrderService) sendPaymentReminders() {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if cfg.PaymentReminderMinutes <= 0 {
+		return
+	}
+
+	now := time.Now()
+	var orders []config.PaymentOrder
+	err := config.Db.Where("order_status = ? AND reminder_sent_at IS NULL AND expires_at > ? AND expires_at <= ?",
+		"pending", now, now.Add(time.Duration(cfg.PaymentReminderMinutes)*time.Minute)).Find(&orders).Error
+	if err != nil {
+		log.Printf("Failed to get orders to remind: %v", err)
+		return
+	}
+
+	notificationService := NewNotificationService(config.Db)
+	for _, order := range orders {
+		result := config.Db.Model(&config.PaymentOrder{}).
+			Where("id = ? AND reminder_sent_at IS NULL", order.ID).
+			Update("reminder_sent_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		minutesLeft := int(order.ExpiresAt.Sub(now).Minutes()) + 1
+		notificationService.Notify(order.UserID, NotificationPaymentReminder,
+			"Đơn hàng sắp hết hạn",
+			fmt.Sprintf("Đơn %s (%s VND) sẽ hết hạn sau khoảng %d phút. Vui lòng hoàn tất chuyển khoản với đúng nội dung %s.", order.OrderCode, order.AmountVND.String(), minutesLeft, order.OrderCode),
+			&order.ID)
+	}
+}
+
 // createPaymentLog tạo log thanh toán
 func (s *PaymentOrderService) createPaymentLog(orderID uint, logType, message string, metadata *string) {
 	paymentLog := config.PaymentLog{
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	ReviewStatusNeedsReview = "needs_review"
+	ReviewStatusResolved    = "resolved"
+	ReviewStatusRejected    = "rejected"
+
+	ReviewActionApply  = "apply"
+	ReviewActionReject = "reject"
+
+	ReviewReasonOrderNotFound  = "order_not_found"
+	ReviewReasonOrderExpired   = "order_expired"
+	ReviewReasonOrderCancelled = "order_cancelled"
+	ReviewReasonOrderPaid      = "order_paid"
+	ReviewReasonAmountShort    = "amount_short"
+	ReviewReasonInvalidAmount  = "invalid_amount"
+	ReviewReasonManual         = "manual"
+)
+
+var (
+	ErrReviewResolved          = errors.New("payment review already resolved")
+	ErrInvalidReviewResolution = errors.New("invalid payment review resolution")
+)
+
+// reviewReasonForOrder trả về lý do cần admin xử lý khi khoản tiền không tự ghi nhận được cho đơn, "" nếu ghi nhận được
+func reviewReasonForOrder(order *config.PaymentOrder, amountVND decimal.Decimal) string {
+	if !amountVND.IsPositive() {
+		return ReviewReasonInvalidAmount
+	}
+	switch order.OrderStatus {
+	case "paid":
+		return ReviewReasonOrderPaid
+	case "expired":
+		return ReviewReasonOrderExpired
+	case "cancelled":
+		return ReviewReasonOrderCancelled
+	}
+	// Gói subscription không kích hoạt một phần được
+	if order.Purpose == OrderPurposeSubscription && amountVND.LessThan(order.AmountVND) {
+		return ReviewReasonAmountShort
+	}
+	return ""
+}
+
+type PaymentReviewService struct {
+	db *gorm.DB
+}
+
+func NewPaymentReviewService(db *gorm.DB) *PaymentReviewService {
+	return &PaymentReviewService{db: db}
+}
+
+// Queue đưa khoản tiền vào hàng chờ needs_review và báo cho chủ đơn (nếu khớp được mã đơn)
+func (s *PaymentReviewService) Queue(payment IncomingPayment, order *config.PaymentOrder, reason string) (*model.PaymentReview, error) {
+	review := model.PaymentReview{
+		Source:        payment.Source,
+		SourceLogID:   payment.SourceLogID,
+		OrderCode:     payment.OrderCode,
+		TransactionID: payment.TransactionID,
+		AmountVND:     payment.AmountVND,
+		Reason:        reason,
+		Status:        ReviewStatusNeedsReview,
+	}
+	if order != nil {
+		review.OrderID = &order.ID
+		review.UserID = &order.UserID
+	}
+	if err := s.db.Create(&review).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue payment review: %v", err)
+	}
+	log.Printf("Payment %s from %s (%s VND, order %q) queued for review: %s", payment.TransactionID, payment.Source, payment.AmountVND.String(), payment.OrderCode, reason)
+
+	if order != nil {
+		NewNotificationService(s.db).Notify(order.UserID, NotificationPaymentReview,
+			"Thanh toán đang chờ xác nhận",
+			fmt.Sprintf("Chúng tôi đã nhận %s VND cho đơn %s nhưng đơn không còn chờ thanh toán hoặc số tiền không khớp. Khoản tiền sẽ được kiểm tra và xử lý thủ công.", payment.AmountVND.String(), order.OrderCode),
+			&order.ID)
+	}
+	return &review, nil
+}
+
+// ListReviews lấy hàng chờ đối soát, status rỗng = tất cả
+func (s *PaymentReviewService) ListReviews(status string, limit, offset int) ([]model.PaymentReview, int64, error) {
+	query := s.db.Model(&model.PaymentReview{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var reviews []model.PaymentReview
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&reviews).Error
+	return reviews, total, err
+}
+
+// Resolve xử lý một khoản tiền trong hàng chờ: apply = ghi nhận cho đơn (cộng credit theo số tiền thực nhận), reject = bỏ qua
+func (s *PaymentReviewService) Resolve(reviewID uint, req model.ResolvePaymentReviewRequest, adminID *uint) (*model.PaymentReview, error) {
+	var review model.PaymentReview
+	if err := s.db.First(&review, reviewID).Error; err != nil {
+		return nil, err
+	}
+	if review.Status != ReviewStatusNeedsReview {
+		return nil, ErrReviewResolved
+	}
+
+	var order *config.PaymentOrder
+	if req.Action == ReviewActionApply {
+		found, err := s.orderToApply(&review, req.OrderCode)
+		if err != nil {
+			return nil, err
+		}
+		order = found
+	} else if req.Action != ReviewActionReject {
+		return nil, fmt.Errorf("%w: action must be apply or reject", ErrInvalidReviewResolution)
+	}
+
+	// Chiếm review trước khi cộng credit để hai admin xử lý cùng lúc không ghi nhận hai lần
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":          ReviewStatusRejected,
+		"resolved_action": req.Action,
+		"resolved_by":     adminID,
+		"resolution_note": req.Note,
+		"resolved_at":     &now,
+	}
+	if order != nil {
+		updates["status"] = ReviewStatusResolved
+		updates["order_id"] = order.ID
+		updates["user_id"] = order.UserID
+	}
+	result := s.db.Model(&model.PaymentReview{}).Where("id = ? AND status = ?", review.ID, ReviewStatusNeedsReview).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrReviewResolved
+	}
+
+	if order != nil {
+		if err := s.applyToOrder(&review, order); err != nil {
+			// Đơn đã ghi nhận paid thì giữ review resolved, lỗi cộng credit cần xử lý riêng
+			if order.OrderStatus == "paid" {
+				return nil, err
+			}
+			s.db.Model(&model.PaymentReview{}).Where("id = ?", review.ID).Updates(map[string]interface{}{
+				"status":          ReviewStatusNeedsReview,
+				"resolved_action": "",
+				"resolved_by":     nil,
+				"resolved_at":     nil,
+			})
+			return nil, err
+		}
+	}
+
+	log.Printf("Payment review %d resolved with %s (order %q)", review.ID, req.Action, req.OrderCode)
+	s.db.First(&review, review.ID)
+	return &review, nil
+}
+
+// orderToApply tìm đơn nhận khoản tiền: orderCode admin chọn, mặc định đơn gốc của review
+func (s *PaymentReviewService) orderToApply(review *model.PaymentReview, orderCode string) (*config.PaymentOrder, error) {
+	var order config.PaymentOrder
+	query := s.db
+	switch {
+	case orderCode != "":
+		query = query.Where("order_code = ?", orderCode)
+	case review.OrderID != nil:
+		query = query.Where("id = ?", *review.OrderID)
+	default:
+		return nil, fmt.Errorf("%w: order_code is required", ErrInvalidReviewResolution)
+	}
+	if err := query.First(&order).Error; err != nil {
+		return nil, fmt.Errorf("%w: order not found", ErrInvalidReviewResolution)
+	}
+
+	if !review.AmountVND.IsPositive() {
+		return nil, fmt.Errorf("%w: payment amount is %s VND", ErrInvalidReviewResolution, review.AmountVND.String())
+	}
+	if order.OrderStatus == "paid" {
+		return nil, fmt.Errorf("%w: order %s is already paid", ErrInvalidReviewResolution, order.OrderCode)
+	}
+	if order.Purpose == OrderPurposeSubscription && review.AmountVND.LessThan(order.AmountVND) {
+		return nil, fmt.Errorf("%w: %s VND is not enough for subscription order %s (%s VND)", ErrInvalidReviewResolution, review.AmountVND.String(), order.OrderCode, order.AmountVND.String())
+	}
+	return &order, nil
+}
+
+func (s *PaymentReviewService) applyToOrder(review *model.PaymentReview, order *config.PaymentOrder) error {
+	transactionID := review.TransactionID
+	if transactionID == "" {
+		transactionID = fmt.Sprintf("review-%d", review.ID)
+	}
+
+	outcome, paidOrder, err := NewPaymentOrderService().ConfirmPayment(PaymentSourceManual, transactionID, order.OrderCode, review.AmountVND, review.SourceLogID)
+	if paidOrder != nil {
+		*order = *paidOrder
+	}
+	if err != nil {
+		return err
+	}
+	if outcome != PaymentOutcomePaid {
+		return fmt.Errorf("%w: transaction %s was already confirmed", ErrInvalidReviewResolution, transactionID)
+	}
+
+	NewNotificationService(s.db).Notify(order.UserID, NotificationPaymentResolved,
+		"Thanh toán đã được xác nhận",
+		fmt.Sprintf("Khoản %s VND đã được ghi nhận cho đơn %s.", review.AmountVND.String(), order.OrderCode),
+		&order.ID)
+	return nil
+}
+
+// UnmatchedPaymentLogs là các log Sepay/email không khớp được đơn và chưa có trong hàng chờ đối soát
+type UnmatchedPaymentLogs struct {
+	SepayLogs []config.SepayWebhookLog `json:"sepay_logs"`
+	EmailLogs []config.PaymentEmailLog `json:"email_logs"`
+}
+
+// GetUnmatchedLogs lấy log Sepay failed và log email unmatched/error chưa được đưa vào hàng chờ
+func (s *PaymentReviewService) GetUnmatchedLogs(limit int) (*UnmatchedPaymentLogs, error) {
+	logs := &UnmatchedPaymentLogs{}
+	err := s.db.Where("processing_status = ?", "failed").
+		Where("NOT EXISTS (SELECT 1 FROM tool_payment_reviews r WHERE r.source = ? AND r.source_log_id = sepay_webhook_logs.id)", PaymentSourceSepay).
+		Order("created_at DESC").Limit(limit).Find(&logs.SepayLogs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unmatched sepay logs: %v", err)
+	}
+
+	err = s.db.Where("status IN ?", []string{"unmatched", "error"}).
+		Where("NOT EXISTS (SELECT 1 FROM tool_payment_reviews r WHERE r.source = ? AND r.source_log_id = payment_email_logs.id)", PaymentSourceEmail).
+		Order("created_at DESC").Limit(limit).Find(&logs.EmailLogs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unmatched email logs: %v", err)
+	}
+	return logs, nil
+}
+
+// QueueFromLog đưa một log Sepay/email không khớp (trước khi có hàng chờ) vào hàng chờ để admin xử lý
+func (s *PaymentReviewService) QueueFromLog(source string, logID uint) (*model.PaymentReview, error) {
+	var count int64
+	s.db.Model(&model.PaymentReview{}).Where("source = ? AND source_log_id = ?", source, logID).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("%w: log %d is already queued", ErrInvalidReviewResolution, logID)
+	}
+
+	payment := IncomingPayment{Source: source, SourceLogID: logID}
+	switch source {
+	case PaymentSourceSepay:
+		var entry config.SepayWebhookLog
+		if err := s.db.First(&entry, logID).Error; err != nil {
+			return nil, err
+		}
+		if entry.OrderCode != nil {
+			payment.OrderCode = *entry.OrderCode
+		}
+		if entry.TransactionID != nil {
+			payment.TransactionID = *entry.TransactionID
+		}
+		if entry.Amount != nil {
+			payment.AmountVND = *entry.Amount
+		}
+	case PaymentSourceEmail:
+		var entry config.PaymentEmailLog
+		if err := s.db.First(&entry, logID).Error; err != nil {
+			return nil, err
+		}
+		payment.OrderCode = entry.OrderCode
+		payment.TransactionID = entry.TransactionID
+		payment.AmountVND, _ = decimal.NewFromString(entry.Amount)
+	default:
+		return nil, fmt.Errorf("%w: source must be sepay or email", ErrInvalidReviewResolution)
+	}
+
+	reason := ReviewReasonOrderNotFound
+	var order *config.PaymentOrder
+	if payment.OrderCode != "" {
+		var found config.PaymentOrder
+		if err := s.db.Where("order_code = ?", payment.OrderCode).First(&found).Error; err == nil {
+			order = &found
+			if reason = reviewReasonForOrder(order, payment.AmountVND); reason == "" {
+				reason = ReviewReasonManual
+			}
+		}
+	}
+
+	return s.Queue(payment, order, reason)
+}
@@ -472,6 +472,25 @@ func (s *PricingService) EstimateProcessVideoCostWithMarkup(durationMinutes floa
 	return estimates, nil
 }
 
+// ApplyVoiceModeToEstimate loại bỏ chi phí TTS khỏi ước tính khi chế độ giọng nói không dùng TTS (subtitle-only)
+func ApplyVoiceModeToEstimate(estimates map[string]float64, voiceMode string) map[string]float64 {
+	if VoiceModeUsesTTS(voiceMode) {
+		return estimates
+	}
+
+	totalBase := estimates["total_base"] - estimates["tts_base"]
+	totalPrice := estimates["total"] - estimates["tts"]
+	estimates["tts"] = 0
+	estimates["tts_base"] = 0
+	estimates["total_base"] = totalBase
+	estimates["total"] = totalPrice
+	estimates["markup_amount"] = totalPrice - totalBase
+	if totalBase > 0 {
+		estimates["markup_percentage"] = ((totalPrice - totalBase) / totalBase) * 100
+	}
+	return estimates
+}
+
 // GetGeminiModelAPIName lấy model_api_name từ DB theo service_name
 func (s *PricingService) GetGeminiModelAPIName(serviceName string) (string, error) {
 	var pricing config.ServicePricing
@@ -0,0 +1,436 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidPromoCode = errors.New("invalid promo code")
+
+type PromotionService struct {
+	db *gorm.DB
+}
+
+func NewPromotionService(db *gorm.DB) *PromotionService {
+	return &PromotionService{db: db}
+}
+
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func roundCredits(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// GetActivePackages lấy các gói nạp đang bán, theo thứ tự hiển thị
+func (s *PromotionService) GetActivePackages() ([]model.CreditPackage, error) {
+	var packages []model.CreditPackage
+	err := s.db.Where("is_active = ?", true).Order("sort_order ASC, price_vnd ASC").Find(&packages).Error
+	return packages, err
+}
+
+func (s *PromotionService) GetAllPackages() ([]model.CreditPackage, error) {
+	var packages []model.CreditPackage
+	err := s.db.Order("sort_order ASC, price_vnd ASC").Find(&packages).Error
+	return packages, err
+}
+
+func (s *PromotionService) GetActivePackage(packageID uint) (*model.CreditPackage, error) {
+	var pkg model.CreditPackage
+	if err := s.db.Where("id = ? AND is_active = ?", packageID, true).First(&pkg).Error; err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+func validateCreditPackage(req model.CreditPackageRequest) error {
+	if req.PriceVND <= 0 || req.Credits <= 0 {
+		return fmt.Errorf("price_vnd and credits must be greater than 0")
+	}
+	if req.BonusPercent < 0 || req.BonusPercent > 100 {
+		return fmt.Errorf("bonus_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+func (s *PromotionService) CreatePackage(req model.CreditPackageRequest) (*model.CreditPackage, error) {
+	if err := validateCreditPackage(req); err != nil {
+		return nil, err
+	}
+
+	pkg := &model.CreditPackage{
+		Name:         req.Name,
+		Description:  req.Description,
+		PriceVND:     req.PriceVND,
+		Credits:      req.Credits,
+		BonusPercent: req.BonusPercent,
+		SortOrder:    req.SortOrder,
+		IsActive:     req.IsActive == nil || *req.IsActive,
+	}
+	if err := s.db.Create(pkg).Error; err != nil {
+		return nil, fmt.Errorf("failed to create credit package: %v", err)
+	}
+	return pkg, nil
+}
+
+func (s *PromotionService) UpdatePackage(packageID uint, req model.CreditPackageRequest) (*model.CreditPackage, error) {
+	if err := validateCreditPackage(req); err != nil {
+		return nil, err
+	}
+
+	var pkg model.CreditPackage
+	if err := s.db.First(&pkg, packageID).Error; err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":          req.Name,
+		"description":   req.Description,
+		"price_vnd":     req.PriceVND,
+		"credits":       req.Credits,
+		"bonus_percent": req.BonusPercent,
+		"sort_order":    req.SortOrder,
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if err := s.db.Model(&pkg).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update credit package: %v", err)
+	}
+	s.db.First(&pkg, packageID)
+	return &pkg, nil
+}
+
+func (s *PromotionService) DeletePackage(packageID uint) error {
+	result := s.db.Delete(&model.CreditPackage{}, packageID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *PromotionService) GetPromoCodes() ([]model.PromoCode, error) {
+	var codes []model.PromoCode
+	err := s.db.Order("created_at DESC").Find(&codes).Error
+	return codes, err
+}
+
+func validatePromoCodeRequest(req model.PromoCodeRequest) error {
+	if normalizePromoCode(req.Code) == "" {
+		return fmt.Errorf("code is required")
+	}
+	if req.BonusPercent < 0 || req.BonusPercent > 100 || req.BonusCredits < 0 {
+		return fmt.Errorf("bonus_percent must be between 0 and 100 and bonus_credits must not be negative")
+	}
+	if req.BonusPercent == 0 && req.BonusCredits == 0 {
+		return fmt.Errorf("promo code needs bonus_percent or bonus_credits")
+	}
+	if req.StartsAt != nil && req.ExpiresAt != nil && !req.ExpiresAt.After(*req.StartsAt) {
+		return fmt.Errorf("expires_at must be after starts_at")
+	}
+	if req.MaxUses < 0 || (req.MaxUsesPerUser != nil && *req.MaxUsesPerUser < 0) {
+		return fmt.Errorf("usage caps must not be negative")
+	}
+	return nil
+}
+
+func promoCodeFields(req model.PromoCodeRequest) map[string]interface{} {
+	fields := map[string]interface{}{
+		"code":           normalizePromoCode(req.Code),
+		"description":    req.Description,
+		"bonus_percent":  req.BonusPercent,
+		"bonus_credits":  req.BonusCredits,
+		"min_amount_usd": req.MinAmountUSD,
+		"starts_at":      req.StartsAt,
+		"expires_at":     req.ExpiresAt,
+		"max_uses":       req.MaxUses,
+	}
+	if req.MaxUsesPerUser != nil {
+		fields["max_uses_per_user"] = *req.MaxUsesPerUser
+	}
+	if req.IsActive != nil {
+		fields["is_active"] = *req.IsActive
+	}
+	return fields
+}
+
+func (s *PromotionService) CreatePromoCode(req model.PromoCodeRequest) (*model.PromoCode, error) {
+	if err := validatePromoCodeRequest(req); err != nil {
+		return nil, err
+	}
+
+	code := &model.PromoCode{
+		Code:           normalizePromoCode(req.Code),
+		Description:    req.Description,
+		BonusPercent:   req.BonusPercent,
+		BonusCredits:   req.BonusCredits,
+		MinAmountUSD:   req.MinAmountUSD,
+		StartsAt:       req.StartsAt,
+		ExpiresAt:      req.ExpiresAt,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: 1,
+		IsActive:       req.IsActive == nil || *req.IsActive,
+	}
+	if req.MaxUsesPerUser != nil {
+		code.MaxUsesPerUser = *req.MaxUsesPerUser
+	}
+
+	var count int64
+	s.db.Model(&model.PromoCode{}).Where("code = ?", code.Code).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("promo code %s already exists", code.Code)
+	}
+	if err := s.db.Create(code).Error; err != nil {
+		return nil, fmt.Errorf("failed to create promo code: %v", err)
+	}
+	return code, nil
+}
+
+func (s *PromotionService) UpdatePromoCode(codeID uint, req model.PromoCodeRequest) (*model.PromoCode, error) {
+	if err := validatePromoCodeRequest(req); err != nil {
+		return nil, err
+	}
+
+	var code model.PromoCode
+	if err := s.db.First(&code, codeID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&code).Updates(promoCodeFields(req)).Error; err != nil {
+		return nil, fmt.Errorf("failed to update promo code: %v", err)
+	}
+	s.db.First(&code, codeID)
+	return &code, nil
+}
+
+func (s *PromotionService) DeletePromoCode(codeID uint) error {
+	result := s.db.Delete(&model.PromoCode{}, codeID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ValidatePromoCode kiểm tra mã khuyến mãi cho một lần nạp amountUSD: còn hiệu lực, chưa hết lượt (toàn hệ thống và theo user), đủ số tiền tối thiểu
+func (s *PromotionService) ValidatePromoCode(userID uint, rawCode string, amountUSD float64) (*model.PromoCode, error) {
+	var code model.PromoCode
+	if err := s.db.Where("code = ? AND is_active = ?", normalizePromoCode(rawCode), true).First(&code).Error; err != nil {
+		return nil, fmt.Errorf("%w: code not found", ErrInvalidPromoCode)
+	}
+
+	now := time.Now()
+	if code.StartsAt != nil && now.Before(*code.StartsAt) {
+		return nil, fmt.Errorf("%w: code is not active yet", ErrInvalidPromoCode)
+	}
+	if code.ExpiresAt != nil && !now.Before(*code.ExpiresAt) {
+		return nil, fmt.Errorf("%w: code has expired", ErrInvalidPromoCode)
+	}
+	if code.MaxUses > 0 && code.UsedCount >= code.MaxUses {
+		return nil, fmt.Errorf("%w: code has been fully redeemed", ErrInvalidPromoCode)
+	}
+	if code.MaxUsesPerUser > 0 && s.userRedemptions(s.db, code.ID, userID) >= int64(code.MaxUsesPerUser) {
+		return nil, fmt.Errorf("%w: code already used", ErrInvalidPromoCode)
+	}
+	if amountUSD < code.MinAmountUSD {
+		return nil, fmt.Errorf("%w: minimum top-up is $%.2f", ErrInvalidPromoCode, code.MinAmountUSD)
+	}
+	return &code, nil
+}
+
+func (s *PromotionService) userRedemptions(db *gorm.DB, codeID, userID uint) int64 {
+	var count int64
+	db.Model(&model.PromoCodeRedemption{}).Where("promo_code_id = ? AND user_id = ?", codeID, userID).Count(&count)
+	return count
+}
+
+// hasPaidTopup kiểm tra user đã có đơn nạp credit nào thanh toán thành công (trừ đơn excludeOrderID)
+func (s *PromotionService) hasPaidTopup(userID, excludeOrderID uint) bool {
+	var count int64
+	s.db.Model(&config.PaymentOrder{}).
+		Where("user_id = ? AND order_status = ? AND purpose = ? AND id <> ?", userID, "paid", OrderPurposeTopup, excludeOrderID).
+		Count(&count)
+	return count > 0
+}
+
+func promoCodeBonus(code *model.PromoCode, baseCredits float64) float64 {
+	return roundCredits(baseCredits*code.BonusPercent/100 + code.BonusCredits)
+}
+
+// EstimateBonuses tính credit thưởng dự kiến cho một lần nạp baseCredits: gói nạp, mã khuyến mãi và nạp lần đầu
+func (s *PromotionService) EstimateBonuses(userID uint, baseCredits float64, pkg *model.CreditPackage, code *model.PromoCode, excludeOrderID uint) []model.TopupBonus {
+	var bonuses []model.TopupBonus
+	if pkg != nil && pkg.BonusPercent > 0 {
+		bonuses = append(bonuses, model.TopupBonus{
+			Type:        "package",
+			Amount:      roundCredits(baseCredits * pkg.BonusPercent / 100),
+			Description: fmt.Sprintf("Thưởng %.0f%% gói %s", pkg.BonusPercent, pkg.Name),
+		})
+	}
+	if code != nil {
+		bonuses = append(bonuses, model.TopupBonus{
+			Type:        "promo_code",
+			Amount:      promoCodeBonus(code, baseCredits),
+			Description: fmt.Sprintf("Thưởng mã khuyến mãi %s", code.Code),
+		})
+	}
+	if bonus := s.firstTopupBonus(userID, baseCredits, excludeOrderID); bonus > 0 {
+		bonuses = append(bonuses, model.TopupBonus{
+			Type:        "first_topup",
+			Amount:      bonus,
+			Description: "Thưởng nạp credit lần đầu",
+		})
+	}
+	return bonuses
+}
+
+func (s *PromotionService) firstTopupBonus(userID uint, baseCredits float64, excludeOrderID uint) float64 {
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	if cfg.FirstTopupBonusPercent <= 0 || s.hasPaidTopup(userID, excludeOrderID) {
+		return 0
+	}
+	bonus := baseCredits * cfg.FirstTopupBonusPercent / 100
+	if cfg.FirstTopupBonusMax > 0 && bonus > cfg.FirstTopupBonusMax {
+		bonus = cfg.FirstTopupBonusMax
+	}
+	return roundCredits(bonus)
+}
+
+// errPromoCodeUnavailable báo mã khuyến mãi đã hết lượt (hoặc user hết lượt) khi đơn thanh toán, đơn không được thưởng mã
+var errPromoCodeUnavailable = errors.New("promo code unavailable")
+
+// ApplyTopupBonuses cộng credit thưởng cho đơn nạp vừa thanh toán, mỗi khoản thưởng là một CreditTransaction riêng
+// với reference theo đơn và loại thưởng nên giao lại đơn (RetryFailedFulfillments) không cộng thưởng lần hai.
+// Lượt dùng mã khuyến mãi được giữ chỗ tại đây (không phải lúc tạo đơn), cùng transaction với credit thưởng của mã,
+// nên mã hết lượt trong lúc chờ thanh toán sẽ không được thưởng và lượt dùng không bị tiêu khi cộng thưởng lỗi
+func (s *PromotionService) ApplyTopupBonuses(order *config.PaymentOrder) ([]model.TopupBonus, error) {
+	// Thưởng tính trên credit thực cộng (đơn nhận thiếu/thừa tiền), mặc định là AmountUSD
+	baseCredits, _ := order.AmountUSD.Float64()
+	if order.CreditedUSD != nil {
+		baseCredits, _ = order.CreditedUSD.Float64()
+	}
+
+	var pkg *model.CreditPackage
+	if order.PackageID != nil {
+		var found model.CreditPackage
+		if err := s.db.First(&found, *order.PackageID).Error; err != nil {
+			log.Printf("Credit package %d of order %s not found, skipping package bonus: %v", *order.PackageID, order.OrderCode, err)
+		} else {
+			pkg = &found
+		}
+	}
+
+	var code *model.PromoCode
+	if order.PromoCodeID != nil {
+		var found model.PromoCode
+		if err := s.db.First(&found, *order.PromoCodeID).Error; err != nil {
+			log.Printf("Promo code %d of order %s not found, skipping promo bonus: %v", *order.PromoCodeID, order.OrderCode, err)
+		} else {
+			code = &found
+		}
+	}
+
+	bonuses := s.EstimateBonuses(order.UserID, baseCredits, pkg, code, order.ID)
+	creditService := NewCreditService()
+	var applied []model.TopupBonus
+	for _, bonus := range bonuses {
+		if bonus.Amount <= 0 {
+			continue
+		}
+		referenceID := topupBonusReference(order, bonus.Type)
+		if s.bonusAdded(order.UserID, referenceID) {
+			applied = append(applied, bonus)
+			continue
+		}
+		description := fmt.Sprintf("%s - %s", bonus.Description, order.OrderCode)
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if bonus.Type == "promo_code" {
+				if err := s.redeemPromoCode(tx, code.ID, order, bonus.Amount); err != nil {
+					return err
+				}
+			}
+			return creditService.addCreditsTx(tx, order.UserID, bonus.Amount, "bonus", description, referenceID)
+		})
+		if errors.Is(err, errPromoCodeUnavailable) {
+			log.Printf("Promo code %s not applied to order %s: %v", code.Code, order.OrderCode, err)
+			continue
+		}
+		if err != nil {
+			return applied, fmt.Errorf("failed to add %s bonus: %v", bonus.Type, err)
+		}
+		applied = append(applied, bonus)
+	}
+	if len(applied) > 0 {
+		NewSpendingService(config.Db).CheckAlerts(order.UserID)
+	}
+	return applied, nil
+}
+
+// topupBonusReference là reference của CreditTransaction thưởng, duy nhất theo đơn và loại thưởng
+func topupBonusReference(order *config.PaymentOrder, bonusType string) string {
+	return fmt.Sprintf("%s_%s", order.OrderCode, bonusType)
+}
+
+// bonusAdded kiểm tra khoản thưởng referenceID đã được cộng chưa
+func (s *PromotionService) bonusAdded(userID uint, referenceID string) bool {
+	var count int64
+	s.db.Model(&config.CreditTransaction{}).
+		Where("user_id = ? AND reference_id = ? AND transaction_type = ? AND service = ?", userID, referenceID, "add", "bonus").
+		Count(&count)
+	return count > 0
+}
+
+// redeemPromoCode ghi một lượt dùng mã cho đơn trong transaction tx của người gọi: kiểm tra lại giới hạn theo user
+// và tăng used_count có điều kiện để không vượt MaxUses. Đơn đã có lượt dùng (ghi trước khi cộng thưởng lỗi) được dùng lại.
+// bonusCredits là số credit thưởng thực cộng, tính trên cùng baseCredits với khoản thưởng
+func (s *PromotionService) redeemPromoCode(tx *gorm.DB, codeID uint, order *config.PaymentOrder, bonusCredits float64) error {
+	var code model.PromoCode
+	if err := tx.First(&code, codeID).Error; err != nil {
+		return err
+	}
+
+	var redemption model.PromoCodeRedemption
+	err := tx.Where("promo_code_id = ? AND order_id = ?", code.ID, order.ID).First(&redemption).Error
+	if err == nil {
+		return tx.Model(&redemption).Update("bonus_credits", bonusCredits).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if code.MaxUsesPerUser > 0 && s.userRedemptions(tx, code.ID, order.UserID) >= int64(code.MaxUsesPerUser) {
+		return fmt.Errorf("%w: user %d reached the per-user limit", errPromoCodeUnavailable, order.UserID)
+	}
+
+	result := tx.Model(&model.PromoCode{}).
+		Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", code.ID).
+		UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: code has been fully redeemed", errPromoCodeUnavailable)
+	}
+
+	return tx.Create(&model.PromoCodeRedemption{
+		PromoCodeID:  code.ID,
+		UserID:       order.UserID,
+		OrderID:      order.ID,
+		BonusCredits: bonusCredits,
+	}).Error
+}
@@ -3,8 +3,10 @@ package service
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/skip2/go-qrcode"
 )
 
@@ -14,35 +16,45 @@ func NewQRService() *QRService {
 	return &QRService{}
 }
 
-// GenerateVietQRCode tạo QR code cho thanh toán VietQR theo chuẩn NAPAS247
-func (s *QRService) GenerateVietQRCode(bankCode, accountNumber, amount, orderCode string) (string, error) {
+// VietQRPayload tạo chuỗi VietQR (NAPAS247 QR động) có số tiền và mã đơn.
+// bank là BIN 6 số hoặc mã/tên ngân hàng (VCB, Vietcombank...), amount là số tiền VND (phần lẻ được làm tròn)
+func (s *QRService) VietQRPayload(bank, accountNumber, amount, orderCode string) (string, error) {
+	cardBin := ResolveBankBin(bank)
+	if cardBin == "" {
+		return "", fmt.Errorf("unknown bank BIN for %q", bank)
+	}
+	amountVND, err := decimal.NewFromString(strings.TrimSpace(amount))
+	if err != nil || amountVND.IsNegative() {
+		return "", fmt.Errorf("invalid amount %q", amount)
+	}
+
 	// Tạo VietQR payload theo chuẩn NAPAS247
 	params := ParamsQrCode{
 		SERVICE:      SERVICE_VA_ORDER, // QR-ĐỘNG
 		BANK_ACCOUNT: accountNumber,
-		CARDBIN:      bankCode, // VD: 970436 cho Vietcombank
-		AMOUNT:       amount,
+		CARDBIN:      cardBin, // VD: 970436 cho Vietcombank
+		AMOUNT:       amountVND.Round(0).String(),
 		CONTENT:      orderCode, // Nội dung thanh toán
 	}
+	return GenerateVietQR247(params), nil
+}
 
-	// Generate VietQR string
-	qrString := GenerateVietQR247(params)
-
-	// Tạo QR code từ chuỗi VietQR
-	qrCode, err := qrcode.Encode(qrString, qrcode.Medium, 256)
+// GenerateVietQRCode tạo QR code cho thanh toán VietQR theo chuẩn NAPAS247
+func (s *QRService) GenerateVietQRCode(bank, accountNumber, amount, orderCode string) (string, error) {
+	qrString, err := s.VietQRPayload(bank, accountNumber, amount, orderCode)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate QR code: %v", err)
+		return "", err
 	}
-
-	// Convert QR code thành base64
-	base64String := base64.StdEncoding.EncodeToString(qrCode)
-	dataURL := fmt.Sprintf("data:image/png;base64,%s", base64String)
-
-	return dataURL, nil
+	return s.GenerateSimpleQRCode(qrString)
 }
 
-// GeneratePaymentQRCode tạo QR code cho thông tin thanh toán
+// GeneratePaymentQRCode tạo QR code cho thông tin thanh toán. Ngân hàng nhận diện được thì tạo VietQR để app ngân hàng
+// điền sẵn số tiền và mã đơn, nếu không thì QR chứa thông tin chuyển khoản dạng text
 func (s *QRService) GeneratePaymentQRCode(bankName, accountNumber, accountName, amount, orderCode string) (string, error) {
+	if qrString, err := s.VietQRPayload(bankName, accountNumber, amount, orderCode); err == nil {
+		return s.GenerateSimpleQRCode(qrString)
+	}
+
 	// Tạo chuỗi thông tin thanh toán
 	qrString := fmt.Sprintf("Ngân hàng: %s\nTài khoản: %s\nChủ tài khoản: %s\nSố tiền: %s VND\nMã đơn hàng: %s\nThời gian: %s",
 		bankName,
@@ -52,18 +64,7 @@ func (s *QRService) GeneratePaymentQRCode(bankName, accountNumber, accountName,
 		orderCode,
 		time.Now().Format("02/01/2006 15:04:05"),
 	)
-
-	// Tạo QR code từ chuỗi
-	qrCode, err := qrcode.Encode(qrString, qrcode.Medium, 256)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate QR code: %v", err)
-	}
-
-	// Convert QR code thành base64
-	base64String := base64.StdEncoding.EncodeToString(qrCode)
-	dataURL := fmt.Sprintf("data:image/png;base64,%s", base64String)
-
-	return dataURL, nil
+	return s.GenerateSimpleQRCode(qrString)
 }
 
 // GenerateSimpleQRCode tạo QR code đơn giản từ text
@@ -38,6 +38,27 @@ type AudioProcessingJob struct {
 	TTSVolume        float64 `json:"tts_volume"`
 	SpeakingRate     float64 `json:"speaking_rate"`
 	VoiceName        string  `json:"voice_name"` // Thêm trường chọn giọng đọc
+
+	// Output profile dùng chung cho merge và burn subtitle ("tiktok", "youtube", "square", "source")
+	OutputProfile string `json:"output_profile"`
+	// Chế độ reframe sang 9:16 ("", "blur", "center", "smart")
+	ReframeMode string `json:"reframe_mode"`
+	// Chế độ giọng nói (replace, voice-over, subtitle-only) và âm lượng audio gốc khi voice-over
+	VoiceMode      string  `json:"voice_mode,omitempty"`
+	OriginalVolume float64 `json:"original_volume,omitempty"`
+	// Glossary của user áp dụng khi dịch
+	GlossaryIDs []uint `json:"glossary_ids,omitempty"`
+	// Nhiều ngôn ngữ đích cho một upload (>1 phần tử thì xử lý theo runProcessVideoMultiLanguage), giọng riêng theo ngôn ngữ
+	TargetLanguages []string          `json:"target_languages,omitempty"`
+	VoiceNames      map[string]string `json:"voice_names,omitempty"`
+	// Diarization: mỗi người nói một giọng, speaker_voices ghi đè giọng mặc định theo nhãn người nói
+	Diarize       bool              `json:"diarize,omitempty"`
+	SpeakerVoices map[string]string `json:"speaker_voices,omitempty"`
+	// Số credit đã lock khi nhận job, phần chưa dùng được mở khóa khi job kết thúc
+	LockedCredits float64 `json:"locked_credits,omitempty"`
+	// Hạn mức tháng của gói đã giữ khi nhận job (một video, AllowanceMinutes phút), trả lại nếu job lỗi
+	AllowanceReserved bool    `json:"allowance_reserved,omitempty"`
+	AllowanceMinutes  float64 `json:"allowance_minutes,omitempty"`
 }
 
 type QueueService struct {
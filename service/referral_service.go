@@ -0,0 +1,360 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ReferralStatusPending  = "pending"
+	ReferralStatusRewarded = "rewarded"
+	ReferralStatusRejected = "rejected"
+
+	ReferralRejectSelf       = "self_referral"
+	ReferralRejectSameIP     = "same_ip"
+	ReferralRejectSameDevice = "same_device"
+
+	referralCodeLength   = 8
+	referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // Bỏ 0/O, 1/I dễ nhập nhầm
+)
+
+var ErrInvalidReferralCode = errors.New("invalid referral code")
+
+type ReferralService struct {
+	db *gorm.DB
+}
+
+func NewReferralService(db *gorm.DB) *ReferralService {
+	return &ReferralService{db: db}
+}
+
+// NormalizeReferralCode viết hoa và bỏ ký tự ngoài chữ/số của mã giới thiệu người dùng nhập
+func NormalizeReferralCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(code))
+}
+
+// NormalizeDeviceID giữ chữ, số, '-' và '_' của device id do client gửi lên, tối đa 64 ký tự
+func NormalizeDeviceID(deviceID string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, deviceID)
+	if len(cleaned) > 64 {
+		cleaned = cleaned[:64]
+	}
+	return cleaned
+}
+
+// canonicalEmail đưa email về dạng chuẩn để nhận ra tài khoản phụ cùng hộp thư (bỏ +tag, bỏ dấu chấm với Gmail)
+func canonicalEmail(email string) string {
+	local, domain, found := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !found {
+		return local
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "gmail.com" || domain == "googlemail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// maskEmail che email người được giới thiệu trong danh sách (ab***@gmail.com)
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found {
+		return "***"
+	}
+	if len(local) > 2 {
+		local = local[:2]
+	}
+	return local + "***@" + domain
+}
+
+func generateReferralCode() (string, error) {
+	code := make([]byte, referralCodeLength)
+	max := big.NewInt(int64(len(referralCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = referralCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// GetOrCreateCode lấy mã giới thiệu của user, tạo mới nếu chưa có
+func (s *ReferralService) GetOrCreateCode(userID uint) (*model.ReferralCode, error) {
+	var code model.ReferralCode
+	err := s.db.Where("user_id = ?", userID).First(&code).Error
+	if err == nil {
+		return &code, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Thử lại khi trùng mã (unique index) hoặc request đồng thời vừa tạo mã cho user
+	for i := 0; i < 5; i++ {
+		value, err := generateReferralCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate referral code: %v", err)
+		}
+		code = model.ReferralCode{UserID: userID, Code: value}
+		if err := s.db.Create(&code).Error; err == nil {
+			return &code, nil
+		}
+		if err := s.db.Where("user_id = ?", userID).First(&code).Error; err == nil {
+			return &code, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to create referral code for user %d", userID)
+}
+
+// AttachReferral ghi nhận user mới đăng ký qua mã giới thiệu. Mã rỗng trả về nil, nil; mã không tồn tại trả về ErrInvalidReferralCode.
+// Lượt tự giới thiệu (cùng hộp thư, cùng IP/thiết bị với chủ mã hoặc với lượt giới thiệu trước của chủ mã) vẫn được lưu nhưng ở trạng thái rejected
+func (s *ReferralService) AttachReferral(refereeID uint, rawCode, signupIP, deviceID string) (*model.Referral, error) {
+	codeValue := NormalizeReferralCode(rawCode)
+	if codeValue == "" {
+		return nil, nil
+	}
+	deviceID = NormalizeDeviceID(deviceID)
+
+	var code model.ReferralCode
+	if err := s.db.Where("code = ?", codeValue).First(&code).Error; err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidReferralCode, codeValue)
+	}
+
+	referral := &model.Referral{
+		ReferrerID: code.UserID,
+		RefereeID:  refereeID,
+		Code:       code.Code,
+		Status:     ReferralStatusPending,
+		SignupIP:   signupIP,
+		DeviceID:   deviceID,
+	}
+	if reason := s.fraudReason(&code, refereeID, signupIP, deviceID); reason != "" {
+		referral.Status = ReferralStatusRejected
+		referral.RejectReason = reason
+		log.Printf("Referral of user %d by code %s rejected: %s", refereeID, code.Code, reason)
+	}
+
+	if err := s.db.Create(referral).Error; err != nil {
+		return nil, fmt.Errorf("failed to create referral: %v", err)
+	}
+	return referral, nil
+}
+
+// fraudReason trả về lý do chặn lượt giới thiệu, rỗng nếu hợp lệ
+func (s *ReferralService) fraudReason(code *model.ReferralCode, refereeID uint, signupIP, deviceID string) string {
+	if code.UserID == refereeID {
+		return ReferralRejectSelf
+	}
+
+	var users []config.Users
+	if err := s.db.Where("id IN ?", []uint{code.UserID, refereeID}).Find(&users).Error; err == nil && len(users) == 2 {
+		if canonicalEmail(users[0].Email) == canonicalEmail(users[1].Email) {
+			return ReferralRejectSelf
+		}
+	}
+
+	if signupIP != "" {
+		if signupIP == code.LastIP {
+			return ReferralRejectSameIP
+		}
+		var count int64
+		s.db.Model(&model.Referral{}).Where("referrer_id = ? AND signup_ip = ?", code.UserID, signupIP).Count(&count)
+		if count > 0 {
+			return ReferralRejectSameIP
+		}
+	}
+	if deviceID != "" {
+		if deviceID == code.LastDeviceID {
+			return ReferralRejectSameDevice
+		}
+		var count int64
+		s.db.Model(&model.Referral{}).Where("referrer_id = ? AND device_id = ?", code.UserID, deviceID).Count(&count)
+		if count > 0 {
+			return ReferralRejectSameDevice
+		}
+	}
+	return ""
+}
+
+// errReferralAlreadyRewarded báo lượt giới thiệu đã được request khác chuyển sang rewarded
+var errReferralAlreadyRewarded = errors.New("referral already rewarded")
+
+// RewardFirstPayment cộng thưởng giới thiệu cho cả hai bên khi đơn thanh toán đầu tiên của người được giới thiệu paid.
+// Chuyển lượt giới thiệu sang rewarded (có điều kiện, mỗi lượt chỉ thưởng một lần) và cộng credit hai bên trong cùng
+// một transaction: lỗi ở bất kỳ bước nào giữ lượt giới thiệu ở pending để lần giao lại đơn thưởng lại
+func (s *ReferralService) RewardFirstPayment(order *config.PaymentOrder) error {
+	var referral model.Referral
+	err := s.db.Where("referee_id = ? AND status = ?", order.UserID, ReferralStatusPending).First(&referral).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get referral: %v", err)
+	}
+
+	var paidBefore int64
+	s.db.Model(&config.PaymentOrder{}).
+		Where("user_id = ? AND order_status = ? AND id <> ?", order.UserID, "paid", order.ID).
+		Count(&paidBefore)
+	if paidBefore > 0 {
+		return nil
+	}
+
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	now := time.Now()
+	referenceID := fmt.Sprintf("referral_%d", referral.ID)
+	creditService := NewCreditService()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Referral{}).
+			Where("id = ? AND status = ?", referral.ID, ReferralStatusPending).
+			Updates(map[string]interface{}{
+				"status":          ReferralStatusRewarded,
+				"order_id":        order.ID,
+				"referrer_reward": cfg.ReferralReferrerCredits,
+				"referee_reward":  cfg.ReferralRefereeCredits,
+				"rewarded_at":     &now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim referral %d: %v", referral.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errReferralAlreadyRewarded
+		}
+		if cfg.ReferralReferrerCredits > 0 {
+			if err := creditService.addCreditsTx(tx, referral.ReferrerID, cfg.ReferralReferrerCredits, "topup", "Thưởng giới thiệu bạn bè", referenceID); err != nil {
+				return fmt.Errorf("failed to reward referrer %d: %v", referral.ReferrerID, err)
+			}
+		}
+		if cfg.ReferralRefereeCredits > 0 {
+			if err := creditService.addCreditsTx(tx, referral.RefereeID, cfg.ReferralRefereeCredits, "topup", "Thưởng đăng ký qua mã giới thiệu", referenceID); err != nil {
+				return fmt.Errorf("failed to reward referee %d: %v", referral.RefereeID, err)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errReferralAlreadyRewarded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	notificationService := NewNotificationService(s.db)
+	spendingService := NewSpendingService(s.db)
+	if cfg.ReferralReferrerCredits > 0 {
+		spendingService.CheckAlerts(referral.ReferrerID)
+		notificationService.Notify(referral.ReferrerID, NotificationReferralReward, "Bạn nhận được thưởng giới thiệu",
+			fmt.Sprintf("Người bạn giới thiệu vừa thanh toán đơn đầu tiên, bạn được cộng %.2f credit.", cfg.ReferralReferrerCredits), nil)
+	}
+	if cfg.ReferralRefereeCredits > 0 {
+		spendingService.CheckAlerts(referral.RefereeID)
+		notificationService.Notify(referral.RefereeID, NotificationReferralReward, "Bạn nhận được thưởng giới thiệu",
+			fmt.Sprintf("Cảm ơn bạn đã tham gia qua mã giới thiệu %s, bạn được cộng %.2f credit.", referral.Code, cfg.ReferralRefereeCredits), &order.ID)
+	}
+	log.Printf("Referral %d rewarded: referrer %d +%.2f, referee %d +%.2f (order %s)",
+		referral.ID, referral.ReferrerID, cfg.ReferralReferrerCredits, referral.RefereeID, cfg.ReferralRefereeCredits, order.OrderCode)
+	return nil
+}
+
+// GetSummary lấy mã giới thiệu (tạo nếu chưa có), danh sách người được giới thiệu và credit đã nhận.
+// IP/thiết bị của request được lưu lại làm dấu vết của chủ mã cho kiểm tra tự giới thiệu
+func (s *ReferralService) GetSummary(userID uint, ip, deviceID string) (*model.ReferralSummary, error) {
+	code, err := s.GetOrCreateCode(userID)
+	if err != nil {
+		return nil, err
+	}
+	deviceID = NormalizeDeviceID(deviceID)
+	if ip != code.LastIP || (deviceID != "" && deviceID != code.LastDeviceID) {
+		updates := map[string]interface{}{"last_ip": ip}
+		if deviceID != "" {
+			updates["last_device_id"] = deviceID
+		}
+		if err := s.db.Model(code).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update referral code fingerprint of user %d: %v", userID, err)
+		}
+	}
+
+	var referrals []model.Referral
+	if err := s.db.Where("referrer_id = ?", userID).Order("created_at DESC").Find(&referrals).Error; err != nil {
+		return nil, fmt.Errorf("failed to get referrals: %v", err)
+	}
+
+	refereeIDs := make([]uint, 0, len(referrals))
+	for _, referral := range referrals {
+		refereeIDs = append(refereeIDs, referral.RefereeID)
+	}
+	emails := map[uint]string{}
+	if len(refereeIDs) > 0 {
+		var users []config.Users
+		if err := s.db.Select("id, email").Where("id IN ?", refereeIDs).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("failed to get referees: %v", err)
+		}
+		for _, user := range users {
+			emails[user.ID] = user.Email
+		}
+	}
+
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	summary := &model.ReferralSummary{
+		Code:           code.Code,
+		ReferrerReward: cfg.ReferralReferrerCredits,
+		RefereeReward:  cfg.ReferralRefereeCredits,
+		TotalReferrals: len(referrals),
+		Referrals:      make([]model.ReferralItem, 0, len(referrals)),
+	}
+	for _, referral := range referrals {
+		switch referral.Status {
+		case ReferralStatusPending:
+			summary.Pending++
+		case ReferralStatusRewarded:
+			summary.Rewarded++
+			summary.EarnedCredits += referral.ReferrerReward
+		case ReferralStatusRejected:
+			summary.Rejected++
+		}
+		summary.Referrals = append(summary.Referrals, model.ReferralItem{
+			ID:           referral.ID,
+			RefereeEmail: maskEmail(emails[referral.RefereeID]),
+			Status:       referral.Status,
+			RejectReason: referral.RejectReason,
+			Reward:       referral.ReferrerReward,
+			RewardedAt:   referral.RewardedAt,
+			CreatedAt:    referral.CreatedAt,
+		})
+	}
+
+	var own model.Referral
+	if err := s.db.Where("referee_id = ?", userID).First(&own).Error; err == nil {
+		summary.ReferredBy = &own.Code
+		if own.Status == ReferralStatusRewarded {
+			summary.EarnedCredits += own.RefereeReward
+		}
+	}
+	summary.EarnedCredits = roundCredits(summary.EarnedCredits)
+	return summary, nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Các chế độ reframe video ngang sang dọc
+const (
+	ReframeModeNone   = ""
+	ReframeModeBlur   = "blur"   // Video gốc ở giữa, nền là chính video đó được phóng to và làm mờ
+	ReframeModeCenter = "center" // Cắt chính giữa khung hình
+	ReframeModeSmart  = "smart"  // Cắt theo vùng có chuyển động, khung cắt di chuyển theo thời gian
+)
+
+const (
+	// Kích thước mặc định khi output profile không quy định kích thước (9:16)
+	defaultReframeWidth  = 1080
+	defaultReframeHeight = 1920
+
+	// Khoảng thời gian gom các mẫu phân tích chuyển động thành một keyframe
+	smartReframeWindowSeconds = 2.0
+	// Giới hạn số keyframe để biểu thức crop của ffmpeg không quá sâu
+	smartReframeMaxKeyframes = 25
+	// Phần dưới khung hình dọc bị UI TikTok/Reels che (caption, nút bấm)
+	VerticalSafeAreaBottom = 0.18
+)
+
+var cropdetectLineRegex = regexp.MustCompile(`x1:(\d+)\s+x2:(\d+).*?\bt:([\d.]+)`)
+
+// NormalizeReframeMode chuẩn hoá tham số reframe_mode từ request, trả về rỗng nếu không hợp lệ
+func NormalizeReframeMode(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case ReframeModeBlur:
+		return ReframeModeBlur
+	case ReframeModeCenter:
+		return ReframeModeCenter
+	case ReframeModeSmart:
+		return ReframeModeSmart
+	case "", "none":
+		return ReframeModeNone
+	default:
+		log.Printf("Unknown reframe mode %q, reframing disabled", mode)
+		return ReframeModeNone
+	}
+}
+
+// ReframeSupported cho biết output profile có nhận video dọc hay không: profile dọc, hoặc profile giữ nguyên kích thước gốc.
+// Profile ngang/vuông (youtube, square) sẽ pad video 9:16 trở lại thành viền đen hai bên nên không reframe
+func ReframeSupported(profile OutputProfile) bool {
+	if profile.Width <= 0 || profile.Height <= 0 {
+		return true
+	}
+	return profile.Height > profile.Width
+}
+
+// ReframeModeForProfile chuẩn hoá reframe_mode và tắt reframe khi output profile không phải dọc
+func ReframeModeForProfile(mode string, profile OutputProfile) string {
+	mode = NormalizeReframeMode(mode)
+	if mode != ReframeModeNone && !ReframeSupported(profile) {
+		log.Printf("[REFRAME] Output profile %s is not vertical, reframe mode %q ignored", profile.Name, mode)
+		return ReframeModeNone
+	}
+	return mode
+}
+
+// reframeTargetSize trả về kích thước đích cho reframe dựa trên output profile
+func reframeTargetSize(profile OutputProfile) (int, int) {
+	if profile.Width > 0 && profile.Height > 0 && profile.Height > profile.Width {
+		return profile.Width, profile.Height
+	}
+	return defaultReframeWidth, defaultReframeHeight
+}
+
+// ReframeVideo chuyển video ngang sang dọc theo mode, trả về đường dẫn video mới
+// Nếu video đã dọc (hoặc mode rỗng, hoặc profile không phải dọc) thì trả về video gốc
+func ReframeVideo(videoPath, videoDir, mode string, profile OutputProfile) (string, error) {
+	mode = ReframeModeForProfile(mode, profile)
+	if mode == ReframeModeNone {
+		return videoPath, nil
+	}
+
+	srcWidth, srcHeight, err := probeVideoSize(videoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to probe video size: %v", err)
+	}
+
+	targetWidth, targetHeight := reframeTargetSize(profile)
+	targetRatio := float64(targetWidth) / float64(targetHeight)
+	if float64(srcWidth)/float64(srcHeight) <= targetRatio+0.01 {
+		log.Printf("[REFRAME] Video %dx%d is already vertical, skipping reframe", srcWidth, srcHeight)
+		return videoPath, nil
+	}
+
+	// Chiều rộng khung cắt trên video gốc (giữ nguyên chiều cao), làm tròn số chẵn cho libx264
+	cropWidth := int(math.Round(float64(srcHeight)*targetRatio)) &^ 1
+
+	var filter string
+	switch mode {
+	case ReframeModeBlur:
+		filter = fmt.Sprintf(
+			"split[main][bg];[bg]scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,boxblur=20:5[blurred];[main]scale=%d:%d:force_original_aspect_ratio=decrease[fg];[blurred][fg]overlay=(W-w)/2:(H-h)/2,setsar=1",
+			targetWidth, targetHeight, targetWidth, targetHeight, targetWidth, targetHeight,
+		)
+	case ReframeModeCenter:
+		filter = fmt.Sprintf("crop=%d:%d:(iw-%d)/2:0,scale=%d:%d,setsar=1", cropWidth, srcHeight, cropWidth, targetWidth, targetHeight)
+	case ReframeModeSmart:
+		xExpr, err := buildSmartCropExpression(videoPath, srcWidth, cropWidth)
+		if err != nil {
+			log.Printf("[REFRAME] Motion analysis failed, falling back to center crop: %v", err)
+			xExpr = fmt.Sprintf("(iw-%d)/2", cropWidth)
+		}
+		filter = fmt.Sprintf("crop=%d:%d:'%s':0,scale=%d:%d,setsar=1", cropWidth, srcHeight, xExpr, targetWidth, targetHeight)
+	}
+
+	outputDir := filepath.Join(videoDir, "reframed")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %v", err)
+	}
+	timestamp := time.Now().Format("20060102_150405")
+	outputPath := filepath.Join(outputDir, fmt.Sprintf("reframed_%s_%s.mp4", mode, timestamp))
+
+	log.Printf("[REFRAME] Reframing %s (%dx%d) -> %dx%d with mode=%s", videoPath, srcWidth, srcHeight, targetWidth, targetHeight, mode)
+
+	args := []string{"-i", videoPath, "-filter_complex", fmt.Sprintf("[0:v]%s[video]", filter), "-map", "[video]", "-map", "0:a?"}
+	args = append(args, profile.VideoEncodeArgs()...)
+	args = append(args, "-c:a", "copy", "-y", outputPath)
+
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg reframe error: %s", string(output))
+		return "", fmt.Errorf("failed to reframe video: %v, output: %s", err, string(output))
+	}
+
+	log.Printf("[REFRAME] Successfully reframed video to: %s", outputPath)
+	return outputPath, nil
+}
+
+// probeVideoSize lấy kích thước của video stream đầu tiên
+func probeVideoSize(videoPath string) (int, int, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "csv=s=x:p=0",
+		videoPath)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	parts := strings.Split(strings.TrimSpace(string(output)), "x")
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("unexpected ffprobe output: %s", string(output))
+	}
+	width, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+// smartCropSample là một mẫu phân tích: thời điểm và tâm vùng chuyển động theo trục x
+type smartCropSample struct {
+	Time    float64
+	CenterX float64
+}
+
+// buildSmartCropExpression phân tích chuyển động bằng cropdetect (mode mvedges) và
+// trả về biểu thức x theo thời gian t cho filter crop, nội suy tuyến tính giữa các keyframe
+func buildSmartCropExpression(videoPath string, srcWidth, cropWidth int) (string, error) {
+	cmd := exec.Command("ffmpeg",
+		"-flags2", "+export_mvs",
+		"-i", videoPath,
+		"-vf", "fps=2,cropdetect=mode=mvedges:reset=1",
+		"-an",
+		"-f", "null", "-",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("cropdetect failed: %v", err)
+	}
+
+	var samples []smartCropSample
+	for _, line := range strings.Split(string(output), "\n") {
+		match := cropdetectLineRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		x1, _ := strconv.Atoi(match[1])
+		x2, _ := strconv.Atoi(match[2])
+		t, _ := strconv.ParseFloat(match[3], 64)
+		if x2 <= x1 {
+			continue
+		}
+		samples = append(samples, smartCropSample{Time: t, CenterX: float64(x1+x2) / 2})
+	}
+	if len(samples) == 0 {
+		return "", fmt.Errorf("no motion samples detected")
+	}
+
+	keyframes := groupSmartCropSamples(samples, srcWidth, cropWidth)
+	return buildPiecewiseCropExpression(keyframes), nil
+}
+
+// groupSmartCropSamples gom mẫu theo cửa sổ thời gian (lấy median), làm mượt và giới hạn khung cắt trong video
+func groupSmartCropSamples(samples []smartCropSample, srcWidth, cropWidth int) []smartCropSample {
+	window := smartReframeWindowSeconds
+	lastTime := samples[len(samples)-1].Time
+	if lastTime/window > smartReframeMaxKeyframes {
+		window = lastTime / smartReframeMaxKeyframes
+	}
+
+	buckets := make(map[int][]float64)
+	var bucketIDs []int
+	for _, s := range samples {
+		id := int(s.Time / window)
+		if _, ok := buckets[id]; !ok {
+			bucketIDs = append(bucketIDs, id)
+		}
+		buckets[id] = append(buckets[id], s.CenterX)
+	}
+	sort.Ints(bucketIDs)
+
+	keyframes := make([]smartCropSample, 0, len(bucketIDs))
+	for _, id := range bucketIDs {
+		centers := buckets[id]
+		sort.Float64s(centers)
+		keyframes = append(keyframes, smartCropSample{
+			Time:    (float64(id) + 0.5) * window,
+			CenterX: centers[len(centers)/2],
+		})
+	}
+
+	// Làm mượt bằng trung bình trượt 3 điểm để khung cắt không bị giật
+	smoothed := make([]smartCropSample, len(keyframes))
+	for i := range keyframes {
+		sum, count := 0.0, 0
+		for j := i - 1; j <= i+1; j++ {
+			if j >= 0 && j < len(keyframes) {
+				sum += keyframes[j].CenterX
+				count++
+			}
+		}
+		left := sum/float64(count) - float64(cropWidth)/2
+		left = math.Max(0, math.Min(left, float64(srcWidth-cropWidth)))
+		smoothed[i] = smartCropSample{Time: keyframes[i].Time, CenterX: math.Round(left)}
+	}
+	return smoothed
+}
+
+// buildPiecewiseCropExpression tạo biểu thức if(lt(t,..)) lồng nhau, CenterX ở đây là toạ độ trái của khung cắt
+func buildPiecewiseCropExpression(keyframes []smartCropSample) string {
+	if len(keyframes) == 1 {
+		return fmt.Sprintf("%.0f", keyframes[0].CenterX)
+	}
+	expr := fmt.Sprintf("%.0f", keyframes[len(keyframes)-1].CenterX)
+	for i := len(keyframes) - 2; i >= 0; i-- {
+		cur, next := keyframes[i], keyframes[i+1]
+		segment := fmt.Sprintf("%.0f+(%.0f)*(t-%.3f)/%.3f", cur.CenterX, next.CenterX-cur.CenterX, cur.Time, next.Time-cur.Time)
+		expr = fmt.Sprintf("if(lt(t,%.3f),%s,%s)", next.Time, segment, expr)
+	}
+	// Trước keyframe đầu tiên giữ nguyên vị trí đầu
+	return fmt.Sprintf("if(lt(t,%.3f),%.0f,%s)", keyframes[0].Time, keyframes[0].CenterX, expr)
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSpendingCapReached      = errors.New("spending cap reached")
+	ErrInvalidSpendingSettings = errors.New("invalid spending settings")
+)
+
+// SpendingService quản lý hạn mức chi tiêu ngày/tháng và cảnh báo số dư thấp của user.
+// Chi tiêu = credit trừ cho dịch vụ (deduct) trừ credit hoàn lại (refund), không tính mua gói subscription
+type SpendingService struct {
+	db *gorm.DB
+}
+
+func NewSpendingService(db *gorm.DB) *SpendingService {
+	return &SpendingService{db: db}
+}
+
+// GetSettings lấy cài đặt chi tiêu của user, user chưa cài đặt nhận giá trị mặc định (chưa lưu, ID = 0)
+func (s *SpendingService) GetSettings(userID uint) (*model.SpendingSettings, error) {
+	return s.getSettings(s.db, userID)
+}
+
+func (s *SpendingService) getSettings(db *gorm.DB, userID uint) (*model.SpendingSettings, error) {
+	var settings model.SpendingSettings
+	err := db.Where("user_id = ?", userID).First(&settings).Error
+	if err == nil {
+		return &settings, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get spending settings: %v", err)
+	}
+
+	cfg := config.InfaConfig{}
+	cfg.LoadConfig()
+	return &model.SpendingSettings{
+		UserID:              userID,
+		LowBalanceThreshold: cfg.LowBalanceDefaultThreshold,
+		EmailAlerts:         true,
+	}, nil
+}
+
+// UpdateSettings cập nhật hạn mức và ngưỡng cảnh báo. Đổi hạn mức/ngưỡng thì cảnh báo tương ứng được bật lại
+func (s *SpendingService) UpdateSettings(userID uint, req model.SpendingSettingsRequest) (*model.SpendingSettings, error) {
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DailyCap != nil && *req.DailyCap != settings.DailyCap {
+		settings.DailyCap = roundCredits(*req.DailyCap)
+		settings.DailyCapAlertedAt = nil
+	}
+	if req.MonthlyCap != nil && *req.MonthlyCap != settings.MonthlyCap {
+		settings.MonthlyCap = roundCredits(*req.MonthlyCap)
+		settings.MonthlyCapAlertedAt = nil
+	}
+	if req.LowBalanceThreshold != nil && *req.LowBalanceThreshold != settings.LowBalanceThreshold {
+		settings.LowBalanceThreshold = roundCredits(*req.LowBalanceThreshold)
+		settings.LowBalanceAlertedAt = nil
+	}
+	if req.AutoStop != nil {
+		settings.AutoStop = *req.AutoStop
+	}
+	if req.EmailAlerts != nil {
+		settings.EmailAlerts = *req.EmailAlerts
+	}
+
+	if settings.DailyCap < 0 || settings.MonthlyCap < 0 || settings.LowBalanceThreshold < 0 {
+		return nil, fmt.Errorf("%w: caps and threshold must not be negative", ErrInvalidSpendingSettings)
+	}
+	if settings.DailyCap > 0 && settings.MonthlyCap > 0 && settings.DailyCap > settings.MonthlyCap {
+		return nil, fmt.Errorf("%w: daily cap must not exceed monthly cap", ErrInvalidSpendingSettings)
+	}
+
+	if err := s.db.Save(settings).Error; err != nil {
+		return nil, fmt.Errorf("failed to save spending settings: %v", err)
+	}
+	return settings, nil
+}
+
+// spentSince tính credit user đã chi cho dịch vụ từ thời điểm since
+func (s *SpendingService) spentSince(db *gorm.DB, userID uint, since time.Time) (float64, error) {
+	var spent float64
+	err := db.Model(&config.CreditTransaction{}).
+		Select("COALESCE(SUM(CASE WHEN transaction_type = 'deduct' THEN amount ELSE -amount END), 0)").
+		Where("user_id = ? AND created_at >= ? AND transaction_type IN ? AND service <> ?", userID, since, []string{"deduct", "refund"}, "subscription").
+		Scan(&spent).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum spending: %v", err)
+	}
+	if spent < 0 {
+		spent = 0
+	}
+	return spent, nil
+}
+
+// checkCap chạy trong transaction của LockCredits: với AutoStop, từ chối khoản lock mới nếu chi tiêu trong kỳ
+// cộng credit đang lock (job đang chạy) và amount vượt hạn mức ngày/tháng
+func (s *SpendingService) checkCap(tx *gorm.DB, userID uint, locked, amount float64) error {
+	settings, err := s.getSettings(tx, userID)
+	if err != nil {
+		return err
+	}
+	if !settings.AutoStop || (settings.DailyCap <= 0 && settings.MonthlyCap <= 0) {
+		return nil
+	}
+
+	now := time.Now()
+	periods := []struct {
+		name  string
+		limit float64
+		since time.Time
+	}{
+		{"daily", settings.DailyCap, startOfDay(now)},
+		{"monthly", settings.MonthlyCap, startOfMonth(now)},
+	}
+	for _, period := range periods {
+		if period.limit <= 0 {
+			continue
+		}
+		spent, err := s.spentSince(tx, userID, period.since)
+		if err != nil {
+			return err
+		}
+		if roundCredits(spent+locked+amount) > period.limit {
+			return fmt.Errorf("%w: %s cap %.2f, spent %.2f, locked %.2f, required %.2f", ErrSpendingCapReached, period.name, period.limit, spent, locked, amount)
+		}
+	}
+	return nil
+}
+
+// GetStatus tính chi tiêu hôm nay/tháng này so với hạn mức và trạng thái số dư thấp
+func (s *SpendingService) GetStatus(userID uint, availableCredits float64) (*model.SpendingStatus, error) {
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dailySpent, err := s.spentSince(s.db, userID, startOfDay(now))
+	if err != nil {
+		return nil, err
+	}
+	monthlySpent, err := s.spentSince(s.db, userID, startOfMonth(now))
+	if err != nil {
+		return nil, err
+	}
+
+	status := &model.SpendingStatus{
+		DailySpent:          roundCredits(dailySpent),
+		MonthlySpent:        roundCredits(monthlySpent),
+		DailyCap:            settings.DailyCap,
+		MonthlyCap:          settings.MonthlyCap,
+		AutoStop:            settings.AutoStop,
+		LowBalanceThreshold: settings.LowBalanceThreshold,
+		LowBalance:          settings.LowBalanceThreshold > 0 && availableCredits < settings.LowBalanceThreshold,
+	}
+	if settings.DailyCap > 0 {
+		remaining := roundCredits(settings.DailyCap - dailySpent)
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.DailyRemaining = &remaining
+		status.CapReached = remaining == 0
+	}
+	if settings.MonthlyCap > 0 {
+		remaining := roundCredits(settings.MonthlyCap - monthlySpent)
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.MonthlyRemaining = &remaining
+		status.CapReached = status.CapReached || remaining == 0
+	}
+	return status, nil
+}
+
+// CheckAlerts gửi cảnh báo (trong ứng dụng và email) khi số dư xuống dưới ngưỡng hoặc chi tiêu chạm hạn mức,
+// gọi sau mỗi lần số dư thay đổi. Mỗi cảnh báo chỉ gửi một lần cho đến khi số dư lên lại/sang kỳ mới. Lỗi chỉ được log
+func (s *SpendingService) CheckAlerts(userID uint) {
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		log.Printf("Failed to check spending alerts for user %d: %v", userID, err)
+		return
+	}
+
+	var userCredits config.UserCredits
+	if err := s.db.Where("user_id = ?", userID).First(&userCredits).Error; err != nil {
+		return
+	}
+	available := userCredits.TotalCredits - userCredits.UsedCredits - userCredits.LockedCredits
+
+	if settings.LowBalanceThreshold > 0 {
+		if available < settings.LowBalanceThreshold && settings.LowBalanceAlertedAt == nil {
+			if s.claimAlert(settings, "low_balance_alerted_at", nil) {
+				s.sendAlert(userID, settings.EmailAlerts, NotificationLowBalance, "Số dư credit sắp hết",
+					fmt.Sprintf("Số dư khả dụng của bạn còn %.2f credit, dưới ngưỡng cảnh báo %.2f credit. Vui lòng nạp thêm credit để các job không bị gián đoạn.", available, settings.LowBalanceThreshold))
+			}
+		} else if available >= settings.LowBalanceThreshold && settings.LowBalanceAlertedAt != nil {
+			// Số dư đã lên lại trên ngưỡng: bật lại cảnh báo cho lần xuống ngưỡng tiếp theo
+			if err := s.db.Model(settings).Update("low_balance_alerted_at", nil).Error; err != nil {
+				log.Printf("Failed to reset low balance alert for user %d: %v", userID, err)
+			}
+		}
+	}
+
+	now := time.Now()
+	periods := []struct {
+		name      string
+		column    string
+		limit     float64
+		since     time.Time
+		alertedAt *time.Time
+	}{
+		{"ngày", "daily_cap_alerted_at", settings.DailyCap, startOfDay(now), settings.DailyCapAlertedAt},
+		{"tháng", "monthly_cap_alerted_at", settings.MonthlyCap, startOfMonth(now), settings.MonthlyCapAlertedAt},
+	}
+	for _, period := range periods {
+		if period.limit <= 0 || (period.alertedAt != nil && !period.alertedAt.Before(period.since)) {
+			continue
+		}
+		spent, err := s.spentSince(s.db, userID, period.since)
+		if err != nil {
+			log.Printf("Failed to check %s spending cap for user %d: %v", period.column, userID, err)
+			continue
+		}
+		if spent < period.limit {
+			continue
+		}
+		since := period.since
+		if !s.claimAlert(settings, period.column, &since) {
+			continue
+		}
+		message := fmt.Sprintf("Bạn đã chi %.2f credit, chạm hạn mức %s %.2f credit.", spent, period.name, period.limit)
+		if settings.AutoStop {
+			message += " Job mới sẽ bị từ chối cho đến kỳ sau hoặc khi bạn tăng hạn mức."
+		}
+		s.sendAlert(userID, settings.EmailAlerts, NotificationSpendingCap, fmt.Sprintf("Đã chạm hạn mức chi tiêu %s", period.name), message)
+	}
+}
+
+// claimAlert đánh dấu đã gửi cảnh báo có điều kiện (cột đang trống hoặc thuộc kỳ trước since) để request đồng thời không gửi trùng
+func (s *SpendingService) claimAlert(settings *model.SpendingSettings, column string, since *time.Time) bool {
+	if settings.ID == 0 {
+		// User chưa lưu cài đặt: tạo bản ghi mặc định, request đồng thời tạo trước thì đọc lại
+		if err := s.db.Create(settings).Error; err != nil {
+			if err := s.db.Where("user_id = ?", settings.UserID).First(settings).Error; err != nil {
+				log.Printf("Failed to create spending settings for user %d: %v", settings.UserID, err)
+				return false
+			}
+		}
+	}
+
+	query := s.db.Model(&model.SpendingSettings{}).Where("id = ?", settings.ID)
+	if since != nil {
+		query = query.Where(fmt.Sprintf("(%s IS NULL OR %s < ?)", column, column), *since)
+	} else {
+		query = query.Where(fmt.Sprintf("%s IS NULL", column))
+	}
+	result := query.Update(column, time.Now())
+	if result.Error != nil {
+		log.Printf("Failed to mark %s for user %d: %v", column, settings.UserID, result.Error)
+		return false
+	}
+	return result.RowsAffected == 1
+}
+
+// sendAlert tạo thông báo trong ứng dụng và gửi email (không chặn luồng trừ credit)
+func (s *SpendingService) sendAlert(userID uint, email bool, notificationType, title, message string) {
+	NewNotificationService(s.db).Notify(userID, notificationType, title, message, nil)
+	log.Printf("Sent %s alert to user %d: %s", notificationType, userID, message)
+	if !email {
+		return
+	}
+
+	var user config.Users
+	if err := s.db.Select("id, email").First(&user, userID).Error; err != nil || user.Email == "" {
+		return
+	}
+	go func() {
+		if err := SendMail(user.Email, title, message); err != nil && !errors.Is(err, ErrMailerDisabled) {
+			log.Printf("Failed to email %s alert to user %d: %v", notificationType, userID, err)
+		}
+	}()
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"creator-tool-backend/model"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -34,6 +35,9 @@ type SRTChunk struct {
 	Result     string
 	Error      error
 	RetryCount int
+
+	Entries   []SRTEntry     // Toàn bộ cue gốc của chunk khi có cue lấy từ translation memory
+	Prefilled map[int]string // SRTEntry.Index → câu dịch lấy từ translation memory
 }
 
 // SRTChunkingStrategy chiến lược chia chunk
@@ -43,6 +47,10 @@ type SRTChunkingStrategy struct {
 	MaxConcurrent   int           // Số chunk xử lý đồng thời (mặc định: 5)
 	TimeoutPerChunk time.Duration // Timeout cho mỗi chunk (mặc định: 60s)
 	RetryAttempts   int           // Số lần retry (mặc định: 2)
+
+	Glossary       []model.GlossaryTerm      // Thuật ngữ bắt buộc của user, được chèn vào prompt mỗi chunk
+	Memory         *TranslationMemoryContext // Translation memory của user, cue khớp được điền sẵn không gửi LLM
+	SourceLanguage string                    // Ngôn ngữ nguồn đã nhận diện (rỗng = để model tự nhận biết)
 }
 
 // ChunkedTranslationResult kết quả translation với chunking
@@ -124,8 +132,11 @@ func (t *SRTChunkedTranslator) TranslateSRTWithChunking(
 	totalEntries := len(entries)
 	log.Printf("📊 [CHUNKED TRANSLATION] Total SRT entries: %d", totalEntries)
 
-	// Nếu ít câu hơn chunk size, sử dụng translation cũ
-	if totalEntries <= strategy.MaxChunkSize {
+	// Tra translation memory trước khi quyết định cách dịch
+	memoryFilled := strategy.Memory.Match(entries)
+
+	// Nếu ít câu hơn chunk size, sử dụng translation cũ (trừ khi có glossary hoặc memory: translation cũ dịch nguyên file)
+	if totalEntries <= strategy.MaxChunkSize && len(strategy.Glossary) == 0 && len(memoryFilled) == 0 {
 		log.Printf("⚠️ [CHUNKED TRANSLATION] SRT chỉ có %d entries (≤ %d), chuyển sang TRADITIONAL translation", totalEntries, strategy.MaxChunkSize)
 
 		// Tự động chọn service dựa trên modelName
@@ -145,6 +156,15 @@ func (t *SRTChunkedTranslator) TranslateSRTWithChunking(
 			return nil, err
 		}
 
+		// QA toàn file như một chunk duy nhất
+		wholeFile := &SRTChunk{ChunkID: 0, StartIndex: 0, EndIndex: totalEntries, EntryCount: totalEntries, Processed: true, Result: translatedContent}
+		repairChunksWithQA([]*SRTChunk{wholeFile}, entries, targetLanguage, 1, func(chunk *SRTChunk, sourceContent, issuesNote string) (string, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), strategy.TimeoutPerChunk)
+			defer cancel()
+			return t.translateChunkJSON(ctx, sourceContent, issuesNote, apiKey, modelName, strategy.SourceLanguage, targetLanguage, nil)
+		})
+		translatedContent = wholeFile.Result
+
 		log.Printf("✅ [TRADITIONAL] Translation hoàn thành trong %v", time.Since(startTime))
 		return &ChunkedTranslationResult{
 			TranslatedContent: translatedContent,
@@ -165,12 +185,22 @@ func (t *SRTChunkedTranslator) TranslateSRTWithChunking(
 
 	log.Printf("✂️ [CHUNKED TRANSLATION] Đã chia SRT thành %d chunks", len(chunks))
 
+	// Điền sẵn các cue có trong translation memory
+	prefillChunksFromMemory(chunks, memoryFilled)
+
 	// Xử lý chunks với concurrent processing
 	results, err := t.processChunksConcurrent(chunks, apiKey, modelName, targetLanguage, strategy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process chunks: %v", err)
 	}
 
+	// QA từng chunk: sửa timestamp lệch, dịch lại chunk còn lỗi
+	repairChunksWithQA(results, entries, targetLanguage, strategy.MaxConcurrent, func(chunk *SRTChunk, sourceContent, issuesNote string) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), strategy.TimeoutPerChunk)
+		defer cancel()
+		return t.translateChunkJSON(ctx, sourceContent, issuesNote, apiKey, modelName, strategy.SourceLanguage, targetLanguage, strategy.Glossary)
+	})
+
 	// Ghép chunks lại
 	mergedContent, err := t.mergeChunks(results, entries, strategy)
 	if err != nil {
@@ -260,6 +290,13 @@ func (t *SRTChunkedTranslator) processChunksConcurrent(
 
 	// Khởi động workers
 	for _, chunk := range chunks {
+		// Chunk đã được điền đủ từ translation memory thì không gửi LLM
+		if chunk.Processed {
+			results[chunk.ChunkID] = chunk
+			log.Printf("📚 [CHUNKED TRANSLATION] Chunk %d lấy hoàn toàn từ translation memory", chunk.ChunkID)
+			continue
+		}
+
 		wg.Add(1)
 		go func(chunk *SRTChunk, index int) {
 			defer wg.Done()
@@ -309,6 +346,11 @@ func (t *SRTChunkedTranslator) processChunksConcurrent(
 		log.Printf("✅ [CHUNKED TRANSLATION] Retry completed")
 	}
 
+	// Ghép câu dịch từ translation memory vào kết quả LLM
+	for _, result := range results {
+		finalizePrefilledChunk(result)
+	}
+
 	log.Printf("🏁 [CHUNKED TRANSLATION] Concurrent processing hoàn thành cho %d chunks", len(chunks))
 	return results, nil
 }
@@ -328,7 +370,7 @@ func (t *SRTChunkedTranslator) processSingleChunkWithRetry(
 		ctx, cancel := context.WithTimeout(context.Background(), strategy.TimeoutPerChunk)
 
 		// Xử lý chunk
-		result, err := t.processSingleChunk(ctx, chunk, apiKey, modelName, targetLanguage)
+		result, err := t.processSingleChunk(ctx, chunk, apiKey, modelName, strategy.SourceLanguage, targetLanguage, strategy.Glossary)
 		cancel()
 
 		if err == nil {
@@ -356,12 +398,38 @@ func (t *SRTChunkedTranslator) processSingleChunkWithRetry(
 func (t *SRTChunkedTranslator) processSingleChunk(
 	ctx context.Context,
 	chunk *SRTChunk,
-	apiKey, modelName, targetLanguage string,
+	apiKey, modelName, sourceLanguage, targetLanguage string,
+	glossary []model.GlossaryTerm,
 ) (string, error) {
-	// Tạo prompt cho chunk này
-	prompt := t.createChunkPrompt(chunk, targetLanguage)
+	return t.translateChunkJSON(ctx, chunk.Content, "", apiKey, modelName, sourceLanguage, targetLanguage, glossary)
+}
+
+// translateChunkJSON dịch nội dung SRT của chunk ở JSON mode: model chỉ nhận/trả {id, text}, timing giữ nguyên từ SRT gốc.
+// issuesNote (có thể rỗng) được đặt trước prompt khi dịch lại chunk bị QA báo lỗi
+func (t *SRTChunkedTranslator) translateChunkJSON(
+	ctx context.Context,
+	content, issuesNote, apiKey, modelName, sourceLanguage, targetLanguage string,
+	glossary []model.GlossaryTerm,
+) (string, error) {
+	entries, err := parseSRT(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse chunk content: %v", err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("chunk has no cues")
+	}
 
-	// Tự động chọn service dựa trên modelName
+	return translateCuesJSON(entries,
+		func(cuesJSON string) string {
+			return issuesNote + t.createChunkPrompt(cuesJSON, sourceLanguage, targetLanguage, glossary)
+		},
+		func(prompt string) (string, error) {
+			return t.callTranslationAPI(ctx, prompt, apiKey, modelName)
+		})
+}
+
+// callTranslationAPI tự động chọn GPT hoặc Gemini dựa trên modelName
+func (t *SRTChunkedTranslator) callTranslationAPI(ctx context.Context, prompt, apiKey, modelName string) (string, error) {
 	if strings.Contains(strings.ToLower(modelName), "gpt") {
 		return t.callGPTAPI(ctx, prompt, apiKey, modelName)
 	} else {
@@ -369,8 +437,8 @@ func (t *SRTChunkedTranslator) processSingleChunk(
 	}
 }
 
-// createChunkPrompt tạo prompt cho chunk
-func (t *SRTChunkedTranslator) createChunkPrompt(chunk *SRTChunk, targetLanguage string) string {
+// createChunkPrompt tạo prompt cho chunk, cuesJSON là mảng {id, text, duration} từ encodeJSONCues
+func (t *SRTChunkedTranslator) createChunkPrompt(cuesJSON string, sourceLanguage, targetLanguage string, glossary []model.GlossaryTerm) string {
 	languageMap := map[string]string{
 		"vi": "Tiếng Việt", "en": "Tiếng Anh", "ja": "Tiếng Nhật",
 		"ko": "Tiếng Hàn", "zh": "Tiếng Trung", "fr": "Tiếng Pháp",
@@ -382,15 +450,20 @@ func (t *SRTChunkedTranslator) createChunkPrompt(chunk *SRTChunk, targetLanguage
 		languageName = "Tiếng Việt"
 	}
 
-	// Sử dụng prompt giống hệt logic cũ để đảm bảo tương thích
-	return fmt.Sprintf(`Hãy dịch phần SRT sau sang %s, tối ưu hóa đặc biệt cho Text-to-Speech (TTS).
+	// Thuật ngữ của user đặt ngay sau yêu cầu chính để được ưu tiên hơn QUY TẮC 5
+	glossaryRules := FormatGlossaryPrompt(glossary)
+	if glossaryRules != "" {
+		glossaryRules = "\n" + glossaryRules
+	}
+
+	// Giữ nguyên các quy tắc dịch của prompt cũ, chỉ đổi định dạng vào/ra sang JSON
+	return fmt.Sprintf(`Hãy dịch các câu thoại phụ đề sau%s sang %s, tối ưu hóa đặc biệt cho Text-to-Speech (TTS).%s
 Mục tiêu cuối cùng là bản dịch khi được đọc lên phải vừa vặn một cách tự nhiên trong khoảng thời gian cho phép, đồng thời phản ánh đúng sắc thái và mối quan hệ của nhân vật qua cách xưng hô.
 TUÂN THỦ NGHIÊM NGẶT CÁC QUY TẮC SAU:
-QUY TẮC 1: TIMESTAMP VÀ SỐ THỨ TỰ LÀ BẤT BIẾN
-Giữ nguyên 100%% số thứ tự và dòng thời gian (timestamps) từ file gốc.
-TUYỆT ĐỐI KHÔNG được thay đổi, làm tròn, hay "sửa lỗi" thời gian. Đây là quy tắc quan trọng nhất.
+QUY TẮC 1: ID LÀ BẤT BIẾN
+Mỗi câu có một id. Giữ nguyên 100%% id, mỗi id trả về đúng một câu dịch. Đây là quy tắc quan trọng nhất.
 QUY TẮC 2: ƯU TIÊN HÀNG ĐẦU LÀ ĐỘ DÀI CÂU DỊCH
-Ngắn gọn là Vua: Câu dịch phải đủ ngắn để đọc xong trong khoảng thời gian của timestamp. Đây là ưu tiên cao hơn việc dịch đầy đủ từng chữ.
+Ngắn gọn là Vua: Câu dịch phải đủ ngắn để đọc xong trong thời lượng duration của câu. Đây là ưu tiên cao hơn việc dịch đầy đủ từng chữ.
 Chủ động cô đọng ý: Nắm bắt ý chính và diễn đạt lại một cách súc tích nhất có thể trong văn nói. Mạnh dạn loại bỏ các từ phụ không làm thay đổi ý nghĩa cốt lõi.
 Áp dụng quy tắc Ký tự/Giây (CPS): Cố gắng giữ cho câu dịch không vượt quá 17 ký tự cho mỗi giây thời lượng.
 Ví dụ: Nếu thời lượng là 2 giây, câu dịch nên dài khoảng 34 ký tự.
@@ -401,21 +474,21 @@ Về cách xưng hô:
 Tuy nhiên, khi bối cảnh là cuộc trò chuyện thân mật, suồng sã giữa bạn bè, người thân hoặc những người ngang hàng, hãy chủ động sử dụng các đại từ tự nhiên hơn như "tao - mày", "tớ - cậu", v.v., để giữ được sự chân thực của lời thoại.
 Hạn chế sử dụng đại từ "ta" trừ khi bối cảnh thật sự đặc trưng (nhân vật là vua chúa, thần linh, hoặc có tính cách rất ngạo mạn).
 Mục tiêu là làm cho lời thoại chân thực như người Việt đang nói chuyện, chứ không phải là một bản dịch máy móc.
-QUY TẮC 4: QUẢ TRẢ VỀ LUÔN LÀ ĐỊNH DẠNG SRT
-Kết quả trả về chỉ là nội dung file srt, không thêm bất kỳ 1 ghi chú hay giải thích gì khác.
+QUY TẮC 4: KẾT QUẢ TRẢ VỀ LUÔN LÀ JSON
+%s
 QUY TẮC 5: Tên nhân vật, hoặc địa danh. ưu tiên để dạng hán việt, ví dụ: Nhị Cẩu, Cúc Hoa, Đại Lang, Lão Tam .... Bắc Kinh, Hồ Nam, Đại Hưng An Lĩnh
 QUY TẮC 6: XỬ LÝ ĐẠI TỪ NHÂN XƯNG CÓ LỰA CHỌN
 Khi quy tắc xưng hô cung cấp một lựa chọn (ví dụ: 'thầy/cô', 'tôi/em' ...), bạn BẮT BUỘC PHẢI CHỌN MỘT phương án phù hợp nhất với ngữ cảnh của câu thoại đó. TUYỆT ĐỐI KHÔNG được viết cả hai lựa chọn cách nhau bằng dấu gạch chéo trong câu dịch.
 
 KIỂM TRA CUỐI CÙNG:
 Trước khi xuất kết quả, hãy tự kiểm tra lại để chắc chắn:
-Không có dòng thời gian nào bị sai lệch.
+Không thiếu, không thừa id nào so với đầu vào.
 Độ dài câu dịch hợp lý với thời gian hiển thị.
 Cách xưng hô ("tôi", "tao", "tớ", "mày"...) tự nhiên và phù hợp với ngữ cảnh của đoạn hội thoại.
-Kết quả chỉ luôn là nội dung của file srt. Không thêm bất kỳ nội dung ghi chú hay giải thích nào khác
+Kết quả chỉ là object JSON. Không thêm bất kỳ nội dung ghi chú hay giải thích nào khác
 
-Phần SRT cần dịch:
-%s`, languageName, chunk.Content)
+Các câu cần dịch:
+%s`, sourceLanguageClause(sourceLanguage), languageName, glossaryRules, jsonCueOutputRule, cuesJSON)
 }
 
 // retryFailedChunksWithSmallerSize retry chunks thất bại với size nhỏ hơn
@@ -428,6 +501,7 @@ func (t *SRTChunkedTranslator) retryFailedChunksWithSmallerSize(
 	// Giảm chunk size cho lần retry
 	smallerStrategy := *strategy
 	smallerStrategy.MaxChunkSize = strategy.MaxChunkSize / 2
+	smallerStrategy.Memory = nil // Các cue còn lại đã tra memory rồi
 	if smallerStrategy.MaxChunkSize < 10 {
 		smallerStrategy.MaxChunkSize = 10 // Không nhỏ hơn 10
 	}
@@ -612,6 +686,7 @@ func (t *SRTChunkedTranslator) callGPTAPI(ctx context.Context, prompt, apiKey, m
 		Messages: []GPTMessage{
 			{Role: "user", Content: prompt},
 		},
+		ResponseFormat: &GPTResponseFormat{Type: "json_object"},
 	}
 
 	// Gọi API với context timeout
@@ -637,12 +712,7 @@ func (t *SRTChunkedTranslator) callGPTAPI(ctx context.Context, prompt, apiKey, m
 	json.Unmarshal(respBody, &gptResp)
 
 	if len(gptResp.Choices) > 0 {
-		translatedContent := gptResp.Choices[0].Message.Content
-
-		// Clean up response giống hệt logic cũ
-		translatedContent = t.cleanupGPTResponse(translatedContent)
-
-		return translatedContent, nil
+		return gptResp.Choices[0].Message.Content, nil
 	}
 
 	return "", fmt.Errorf("no response from API")
@@ -650,181 +720,18 @@ func (t *SRTChunkedTranslator) callGPTAPI(ctx context.Context, prompt, apiKey, m
 
 // callGeminiAPI gọi Gemini API với context timeout
 func (t *SRTChunkedTranslator) callGeminiAPI(ctx context.Context, prompt, apiKey, modelName string) (string, error) {
-	// Gọi Gemini API
-	translatedContent, err := GenerateWithGemini(prompt, apiKey, modelName)
+	// Gọi Gemini API với responseSchema {"cues": [{id, text}]}
+	translatedContent, err := GenerateJSONWithGemini(prompt, apiKey, modelName, jsonCueResponseSchema)
 	if err != nil {
 		return "", fmt.Errorf("Gemini API call failed: %v", err)
 	}
 
-	// Clean up response giống hệt logic cũ
-	translatedContent = t.cleanupGeminiResponse(translatedContent)
-
 	return translatedContent, nil
 }
 
-// cleanupGPTResponse clean up GPT response giống hệt logic cũ
-func (t *SRTChunkedTranslator) cleanupGPTResponse(translatedContent string) string {
-	// Clean up the response - remove any extra text that might be added by GPT
-	translatedContent = strings.TrimSpace(translatedContent)
-
-	// Remove markdown code blocks if present
-	translatedContent = strings.TrimPrefix(translatedContent, "```")
-	translatedContent = strings.TrimSuffix(translatedContent, "```")
-	translatedContent = strings.TrimSpace(translatedContent)
-
-	// If GPT added any prefix or explanation, try to extract just the SRT content
-	if strings.Contains(translatedContent, "1\n") {
-		// Find the start of the SRT content
-		startIndex := strings.Index(translatedContent, "1\n")
-		if startIndex != -1 {
-			translatedContent = translatedContent[startIndex:]
-		}
-	}
-
-	// Remove any explanatory text that might be added after the SRT content
-	endMarkers := []string{
-		"\n\n**Giải thích",
-		"\n\nGiải thích",
-		"\n\n**",
-		"\n\nTôi đã",
-		"\n\nHy vọng",
-		"\n\nBản dịch",
-		"\n\n---",
-		"\n\nNote:",
-		"\n\nLưu ý:",
-		"\n\n```",
-		"```",
-	}
-
-	for _, marker := range endMarkers {
-		if index := strings.Index(translatedContent, marker); index != -1 {
-			translatedContent = strings.TrimSpace(translatedContent[:index])
-			break
-		}
-	}
-
-	// Final cleanup - ensure we only have valid SRT content
-	lines := strings.Split(translatedContent, "\n")
-	var cleanLines []string
-	inSRTContent := false
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// Start SRT content when we see a number
-		if t.isNumeric(line) {
-			inSRTContent = true
-		}
-
-		// Stop if we see explanatory text
-		if inSRTContent && (strings.Contains(line, "**") ||
-			strings.Contains(line, "Giải thích") ||
-			strings.Contains(line, "Tôi đã") ||
-			strings.Contains(line, "Hy vọng") ||
-			strings.Contains(line, "Bản dịch") ||
-			strings.Contains(line, "Note:") ||
-			strings.Contains(line, "Lưu ý:") ||
-			strings.Contains(line, "```")) {
-			break
-		}
-
-		if inSRTContent {
-			cleanLines = append(cleanLines, line)
-		}
-	}
-
-	if len(cleanLines) > 0 {
-		translatedContent = strings.Join(cleanLines, "\n")
-	}
-
-	return translatedContent
-}
-
-// cleanupGeminiResponse clean up Gemini response giống hệt logic cũ
-func (t *SRTChunkedTranslator) cleanupGeminiResponse(translatedContent string) string {
-	// Clean up response giống logic cũ
-	translatedContent = strings.TrimSpace(translatedContent)
-
-	// Nếu Gemini thêm prefix, extract chỉ SRT content
-	if strings.Contains(translatedContent, "1\n") {
-		startIndex := strings.Index(translatedContent, "1\n")
-		if startIndex != -1 {
-			translatedContent = translatedContent[startIndex:]
-		}
-	}
-
-	// Remove any explanatory text that might be added after the SRT content
-	endMarkers := []string{
-		"\n\n**Giải thích",
-		"\n\nGiải thích",
-		"\n\n**",
-		"\n\nTôi đã",
-		"\n\nHy vọng",
-		"\n\nBản dịch",
-		"\n\n---",
-		"\n\nNote:",
-		"\n\nLưu ý:",
-		"\n\n```",
-		"```",
-	}
-
-	for _, marker := range endMarkers {
-		if index := strings.Index(translatedContent, marker); index != -1 {
-			translatedContent = strings.TrimSpace(translatedContent[:index])
-			break
-		}
-	}
-
-	// Final cleanup - ensure we only have valid SRT content
-	lines := strings.Split(translatedContent, "\n")
-	var cleanLines []string
-	inSRTContent := false
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// Start SRT content when we see a number
-		if t.isNumeric(line) {
-			inSRTContent = true
-		}
-
-		// Stop if we see explanatory text
-		if inSRTContent && (strings.Contains(line, "**") ||
-			strings.Contains(line, "Giải thích") ||
-			strings.Contains(line, "Tôi đã") ||
-			strings.Contains(line, "Hy vọng") ||
-			strings.Contains(line, "Bản dịch") ||
-			strings.Contains(line, "Note:") ||
-			strings.Contains(line, "Lưu ý:") ||
-			strings.Contains(line, "```")) {
-			break
-		}
-
-		if inSRTContent {
-			cleanLines = append(cleanLines, line)
-		}
-	}
-
-	if len(cleanLines) > 0 {
-		translatedContent = strings.Join(cleanLines, "\n")
-	}
-
-	return translatedContent
-}
-
-// isNumeric helper function
-func (t *SRTChunkedTranslator) isNumeric(s string) bool {
-	for _, r := range s {
-		if r < '0' || r > '9' {
-			return false
-		}
-	}
-	return len(s) > 0
-}
-
 // TranslateSRTWithChunkingWrapper wrapper function để tích hợp với logic cũ
 // Hỗ trợ cả GPT và Gemini dựa trên service config
-func TranslateSRTWithChunkingWrapper(srtFilePath, apiKey, modelName, targetLanguage string) (string, error) {
+func TranslateSRTWithChunkingWrapper(srtFilePath, apiKey, modelName, sourceLanguage, targetLanguage string, glossary []model.GlossaryTerm, memory *TranslationMemoryContext) (string, error) {
 	// Khởi tạo chunked translator
 	translator := GetSRTChunkedTranslator()
 
@@ -835,6 +742,9 @@ func TranslateSRTWithChunkingWrapper(srtFilePath, apiKey, modelName, targetLangu
 		MaxConcurrent:   5,  // 5 chunks đồng thời
 		TimeoutPerChunk: 60 * time.Second,
 		RetryAttempts:   2,
+		Glossary:        glossary,
+		Memory:          memory,
+		SourceLanguage:  sourceLanguage,
 	}
 
 	// Gọi chunked translation
@@ -848,20 +758,44 @@ func TranslateSRTWithChunkingWrapper(srtFilePath, apiKey, modelName, targetLangu
 
 // TranslateSRTWithContextAwareness wrapper function mới với context awareness
 // Hỗ trợ cả GPT và Gemini dựa trên service config
-func TranslateSRTWithContextAwareness(srtFilePath, apiKey, modelName, targetLanguage string) (string, error) {
+func TranslateSRTWithContextAwareness(srtFilePath, apiKey, modelName, sourceLanguage, targetLanguage string, glossary []model.GlossaryTerm, memory *TranslationMemoryContext) (string, error) {
 	log.Printf("🚀 [CONTEXT AWARE TRANSLATION] Bắt đầu context-aware translation cho %s", srtFilePath)
 
+	srtContent, err := os.ReadFile(srtFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read SRT file: %v", err)
+	}
+	entries, err := parseSRT(string(srtContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse SRT: %v", err)
+	}
+
+	// Tra translation memory, nếu mọi cue đều có sẵn bản dịch thì không cần gọi LLM
+	memoryFilled := memory.Match(entries)
+	if len(entries) > 0 && len(memoryFilled) == len(entries) {
+		log.Printf("📚 [CONTEXT AWARE TRANSLATION] Toàn bộ %d cue lấy từ translation memory", len(entries))
+		filledEntries := make([]SRTEntry, len(entries))
+		for i, entry := range entries {
+			filledEntries[i] = entry
+			filledEntries[i].Text = memoryFilled[entry.Index]
+		}
+		return (&SRTChunkedTranslator{}).createSRTFromEntries(filledEntries), nil
+	}
+
 	// Bước 1: Phân tích ngữ cảnh (một lần gọi API duy nhất)
 	contextAnalyzer := NewContextAnalyzer(apiKey, modelName)
 	contextResult, err := contextAnalyzer.AnalyzeSRTContext(srtFilePath, targetLanguage)
 	if err != nil {
 		log.Printf("⚠️ [CONTEXT AWARE TRANSLATION] Context analysis failed, fallback to chunked translation: %v", err)
 		// Fallback to chunked translation nếu context analysis thất bại
-		return TranslateSRTWithChunkingWrapper(srtFilePath, apiKey, modelName, targetLanguage)
+		return TranslateSRTWithChunkingWrapper(srtFilePath, apiKey, modelName, sourceLanguage, targetLanguage, glossary, memory)
 	}
 
+	// Glossary của user ghi đè thuật ngữ LLM tự suy ra
+	contextResult.ApplyUserGlossary(glossary)
+
 	// Bước 2: Tạo prompt mẫu với context awareness
-	contextAwarePrompt := contextAnalyzer.GenerateContextAwarePrompt(contextResult, targetLanguage)
+	contextAwarePrompt := contextAnalyzer.GenerateContextAwarePrompt(contextResult, sourceLanguage, targetLanguage)
 
 	// Bước 3: Chia file SRT thành chunks
 	chunks, err := SplitSRTIntoChunksForContextAware(srtFilePath, 50, 0) // 50 câu mỗi chunk, 0 overlap
@@ -871,13 +805,21 @@ func TranslateSRTWithContextAwareness(srtFilePath, apiKey, modelName, targetLang
 
 	log.Printf("📊 [CONTEXT AWARE TRANSLATION] Đã chia SRT thành %d chunks", len(chunks))
 
+	// Điền sẵn các cue có trong translation memory
+	prefillChunksFromMemory(chunks, memoryFilled)
+
 	// Bước 4: Xử lý chunks với context-aware prompts
 	results, err := processChunksWithContextAwareness(chunks, contextAwarePrompt, apiKey, modelName, 5) // 5 concurrent
 	if err != nil {
 		return "", fmt.Errorf("failed to process chunks with context awareness: %v", err)
 	}
 
-	// Bước 5: Ghép chunks lại
+	// Bước 5: QA từng chunk, dịch lại chunk còn lỗi với cùng prompt ngữ cảnh
+	repairChunksWithQA(results, entries, targetLanguage, 5, func(chunk *SRTChunk, sourceContent, issuesNote string) (string, error) {
+		return translateChunkWithContextAwareness(sourceContent, issuesNote+contextAwarePrompt, apiKey, modelName)
+	})
+
+	// Bước 6: Ghép chunks lại
 	mergedContent, err := mergeChunksWithContextAwareness(results, chunks)
 	if err != nil {
 		return "", fmt.Errorf("failed to merge chunks: %v", err)
@@ -938,6 +880,12 @@ func processChunksWithContextAwareness(chunks []*SRTChunk, contextAwarePrompt, a
 
 	// Khởi động workers
 	for _, chunk := range chunks {
+		// Chunk đã được điền đủ từ translation memory thì không gửi LLM
+		if chunk.Processed {
+			results[chunk.ChunkID] = chunk
+			continue
+		}
+
 		wg.Add(1)
 		go func(chunk *SRTChunk, index int) {
 			defer wg.Done()
@@ -948,11 +896,8 @@ func processChunksWithContextAwareness(chunks []*SRTChunk, contextAwarePrompt, a
 
 			log.Printf("🔄 [CONTEXT AWARE TRANSLATION] Worker bắt đầu xử lý chunk %d (index: %d)", chunk.ChunkID, index)
 
-			// Tạo prompt cho chunk này với context awareness
-			chunkPrompt := strings.Replace(contextAwarePrompt, "{{SRT_CONTENT}}", chunk.Content, 1)
-
 			// Xử lý chunk với context-aware prompt
-			result := processSingleChunkWithContextAwareness(chunk, chunkPrompt, apiKey, modelName)
+			result := processSingleChunkWithContextAwareness(chunk, contextAwarePrompt, apiKey, modelName)
 
 			// Lưu kết quả thread-safe
 			resultMutex.Lock()
@@ -971,20 +916,17 @@ func processChunksWithContextAwareness(chunks []*SRTChunk, contextAwarePrompt, a
 	wg.Wait()
 	log.Printf("🎯 [CONTEXT AWARE TRANSLATION] Tất cả workers đã hoàn thành!")
 
+	// Ghép câu dịch từ translation memory vào kết quả LLM
+	for _, result := range results {
+		finalizePrefilledChunk(result)
+	}
+
 	return results, nil
 }
 
 // processSingleChunkWithContextAwareness xử lý một chunk với context-aware prompt
-func processSingleChunkWithContextAwareness(chunk *SRTChunk, chunkPrompt, apiKey, modelName string) *SRTChunk {
-	// Tự động chọn service dựa trên modelName
-	var translatedContent string
-	var err error
-
-	if strings.Contains(strings.ToLower(modelName), "gpt") {
-		translatedContent, err = callGPTAPIForChunk(chunkPrompt, apiKey, modelName)
-	} else {
-		translatedContent, err = callGeminiAPIForChunk(chunkPrompt, apiKey, modelName)
-	}
+func processSingleChunkWithContextAwareness(chunk *SRTChunk, contextAwarePrompt, apiKey, modelName string) *SRTChunk {
+	translatedContent, err := translateChunkWithContextAwareness(chunk.Content, contextAwarePrompt, apiKey, modelName)
 
 	if err != nil {
 		chunk.Error = err
@@ -998,15 +940,39 @@ func processSingleChunkWithContextAwareness(chunk *SRTChunk, chunkPrompt, apiKey
 	return chunk
 }
 
-// callGPTAPIForChunk gọi GPT API cho một chunk
+// translateChunkWithContextAwareness dịch nội dung SRT của chunk ở JSON mode, các cue thay vào {{CUES_JSON}} của prompt mẫu
+func translateChunkWithContextAwareness(content, contextAwarePrompt, apiKey, modelName string) (string, error) {
+	entries, err := parseSRT(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse chunk content: %v", err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("chunk has no cues")
+	}
+
+	return translateCuesJSON(entries,
+		func(cuesJSON string) string {
+			return strings.Replace(contextAwarePrompt, "{{CUES_JSON}}", cuesJSON, 1)
+		},
+		func(prompt string) (string, error) {
+			// Tự động chọn service dựa trên modelName
+			if strings.Contains(strings.ToLower(modelName), "gpt") {
+				return callGPTAPIForChunk(prompt, apiKey, modelName)
+			}
+			return callGeminiAPIForChunk(prompt, apiKey, modelName)
+		})
+}
+
+// callGPTAPIForChunk gọi GPT API cho một chunk (JSON mode)
 func callGPTAPIForChunk(prompt, apiKey, modelName string) (string, error) {
 	url := "https://api.openai.com/v1/chat/completions"
 
 	requestBody := map[string]interface{}{
-		"model":       modelName,
-		"messages":    []map[string]string{{"role": "user", "content": prompt}},
-		"temperature": 0.1,
-		"max_tokens":  4000,
+		"model":           modelName,
+		"messages":        []map[string]string{{"role": "user", "content": prompt}},
+		"temperature":     0.1,
+		"max_tokens":      4000,
+		"response_format": map[string]string{"type": "json_object"},
 	}
 
 	jsonData, err := json.Marshal(requestBody)
@@ -1058,27 +1024,12 @@ func callGPTAPIForChunk(prompt, apiKey, modelName string) (string, error) {
 		return "", fmt.Errorf("no choices in GPT response")
 	}
 
-	translatedContent := response.Choices[0].Message.Content
-
-	// Remove markdown code blocks if present - simple approach
-	translatedContent = strings.TrimPrefix(translatedContent, "```srt")
-	translatedContent = strings.TrimPrefix(translatedContent, "```")
-	translatedContent = strings.TrimSuffix(translatedContent, "```")
-	// translatedContent = strings.TrimSpace(translatedContent)
-
-	// Remove any remaining "srt" at the beginning
-	if strings.HasPrefix(translatedContent, "srt") {
-		translatedContent = strings.TrimPrefix(translatedContent, "srt")
-		//translatedContent = strings.TrimSpace(translatedContent)
-	}
-
-	return translatedContent, nil
+	return response.Choices[0].Message.Content, nil
 }
 
-// callGeminiAPIForChunk gọi Gemini API cho một chunk
+// callGeminiAPIForChunk gọi Gemini API cho một chunk (responseSchema {"cues": [{id, text}]})
 func callGeminiAPIForChunk(prompt, apiKey, modelName string) (string, error) {
-	// Sử dụng service Gemini có sẵn
-	return GenerateWithGemini(prompt, apiKey, modelName)
+	return GenerateJSONWithGemini(prompt, apiKey, modelName, jsonCueResponseSchema)
 }
 
 // mergeChunksWithContextAwareness ghép chunks lại với context awareness
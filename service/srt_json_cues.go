@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Số lần dịch lại riêng các cue bị thiếu id trong response
+const jsonCueMissingRetries = 2
+
+// jsonCue là một cue gửi/nhận khi dịch chunk ở JSON mode. Timing giữ ở server, model chỉ thấy id và thời lượng
+type jsonCue struct {
+	ID       int     `json:"id"`
+	Text     string  `json:"text"`
+	Duration float64 `json:"duration,omitempty"` // Giây, chỉ để model tự canh độ dài câu (CPS)
+}
+
+// jsonCueResponseSchema là responseSchema cho Gemini: {"cues": [{"id", "text"}]}
+var jsonCueResponseSchema = map[string]interface{}{
+	"type": "OBJECT",
+	"properties": map[string]interface{}{
+		"cues": map[string]interface{}{
+			"type": "ARRAY",
+			"items": map[string]interface{}{
+				"type": "OBJECT",
+				"properties": map[string]interface{}{
+					"id":   map[string]interface{}{"type": "INTEGER"},
+					"text": map[string]interface{}{"type": "STRING"},
+				},
+				"required": []string{"id", "text"},
+			},
+		},
+	},
+	"required": []string{"cues"},
+}
+
+// jsonCueOutputRule là quy tắc định dạng output chung cho prompt dịch chunk ở JSON mode
+const jsonCueOutputRule = `Đầu vào là mảng JSON các câu thoại dạng {"id", "text", "duration"} (duration là số giây hiển thị).
+Trả về DUY NHẤT một object JSON dạng {"cues": [{"id": <id>, "text": "<câu dịch>"}]}.
+Mỗi id đầu vào phải có đúng một phần tử với id giữ nguyên, không gộp, không tách, không bỏ câu nào, không thêm ghi chú hay giải thích.`
+
+// encodeJSONCues chuyển các cue sang payload JSON gửi cho model
+func encodeJSONCues(entries []SRTEntry) string {
+	cues := make([]jsonCue, len(entries))
+	for i, entry := range entries {
+		cues[i] = jsonCue{
+			ID:       entry.Index,
+			Text:     entry.Text,
+			Duration: math.Round((entry.End-entry.Start)*10) / 10,
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(cues); err != nil {
+		return "[]"
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// decodeJSONCues đọc response {"cues": [...]} (hoặc mảng trần) thành map id → câu dịch
+func decodeJSONCues(content string) (map[int]string, error) {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	content = strings.TrimSpace(content)
+
+	var wrapped struct {
+		Cues []jsonCue `json:"cues"`
+	}
+	var cues []jsonCue
+	if err := json.Unmarshal([]byte(content), &wrapped); err == nil && len(wrapped.Cues) > 0 {
+		cues = wrapped.Cues
+	} else if err := json.Unmarshal([]byte(content), &cues); err != nil {
+		return nil, fmt.Errorf("invalid JSON cue response: %v", err)
+	}
+
+	texts := make(map[int]string, len(cues))
+	for _, cue := range cues {
+		if text := strings.TrimSpace(cue.Text); text != "" {
+			texts[cue.ID] = text
+		}
+	}
+	return texts, nil
+}
+
+// translateCuesJSON dịch các cue qua JSON mode: buildPrompt nhận payload JSON, call gọi model.
+// Cue bị thiếu id trong response được gửi lại riêng; kết quả là SRT dựng từ timing gốc nên model không thể làm lệch timing
+func translateCuesJSON(entries []SRTEntry, buildPrompt func(cuesJSON string) string, call func(prompt string) (string, error)) (string, error) {
+	translated := make(map[int]string, len(entries))
+	pending := entries
+
+	for attempt := 0; attempt <= jsonCueMissingRetries && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			log.Printf("🔁 [JSON CUES] Thiếu %d cue trong response, dịch lại riêng các id: %v", len(pending), jsonCueIDs(pending))
+		}
+
+		response, err := call(buildPrompt(encodeJSONCues(pending)))
+		if err != nil {
+			return "", err
+		}
+		texts, err := decodeJSONCues(response)
+		if err != nil {
+			if attempt == 0 {
+				return "", err
+			}
+			log.Printf("⚠️ [JSON CUES] %v", err)
+			continue
+		}
+
+		var stillMissing []SRTEntry
+		for _, entry := range pending {
+			if text, ok := texts[entry.Index]; ok {
+				translated[entry.Index] = text
+			} else {
+				stillMissing = append(stillMissing, entry)
+			}
+		}
+		pending = stillMissing
+	}
+
+	if len(pending) > 0 {
+		return "", fmt.Errorf("model did not return cue ids %v", jsonCueIDs(pending))
+	}
+
+	result := make([]SRTEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = entry
+		result[i].Text = translated[entry.Index]
+	}
+	return (&SRTChunkedTranslator{}).createChunkContent(result), nil
+}
+
+func jsonCueIDs(entries []SRTEntry) []int {
+	ids := make([]int, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Index
+	}
+	sort.Ints(ids)
+	return ids
+}
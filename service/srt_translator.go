@@ -301,12 +301,11 @@ func TranslateSRTFileWithGPT(srtFilePath, apiKey, modelName, targetLanguage stri
 	return TranslateSRTWithGPT(srtFilePath, apiKey, modelName, targetLanguage)
 }
 
-// DetectSRTLanguage detects the language of SRT content using heuristic approach
+// DetectSRTLanguage detects the language of SRT content, defaulting to Vietnamese when the text gives no clear signal
 func DetectSRTLanguage(srtContent string) string {
 	// Extract text content from SRT (remove timestamps and numbers)
 	textContent := extractTextFromSRT(srtContent)
 
-	// Simple language detection based on character patterns and common words
 	language := detectLanguageFromText(textContent)
 
 	log.Printf("Detected language: %s for SRT content", language)
@@ -337,154 +336,16 @@ func isTimestampLine(line string) bool {
 	return strings.Contains(line, "-->")
 }
 
-// detectLanguageFromText detects language using character patterns and common words
+// detectLanguageFromText detects language using script ranges and common-word frequency (DetectTextLanguage)
 func detectLanguageFromText(text string) string {
-	text = strings.ToLower(text)
-
-	// Vietnamese detection
-	if containsVietnameseChars(text) {
-		return "vi"
-	}
-
-	// Chinese detection (simplified and traditional)
-	if containsChineseChars(text) {
-		return "zh"
-	}
-
-	// Japanese detection
-	if containsJapaneseChars(text) {
-		return "ja"
-	}
-
-	// Korean detection
-	if containsKoreanChars(text) {
-		return "ko"
-	}
-
-	// English detection
-	if containsEnglishWords(text) {
-		return "en"
-	}
-
-	// French detection
-	if containsFrenchWords(text) {
-		return "fr"
-	}
-
-	// German detection
-	if containsGermanWords(text) {
-		return "de"
-	}
-
-	// Spanish detection
-	if containsSpanishWords(text) {
-		return "es"
+	if language, _ := DetectTextLanguage(text); language != "" {
+		return language
 	}
 
 	// Default to Vietnamese if no clear pattern detected
 	return "vi"
 }
 
-// containsVietnameseChars checks for Vietnamese diacritics
-func containsVietnameseChars(text string) bool {
-	vietnameseChars := []rune{'à', 'á', 'ạ', 'ả', 'ã', 'â', 'ầ', 'ấ', 'ậ', 'ẩ', 'ẫ', 'ă', 'ằ', 'ắ', 'ặ', 'ẳ', 'ẵ',
-		'è', 'é', 'ẹ', 'ẻ', 'ẽ', 'ê', 'ề', 'ế', 'ệ', 'ể', 'ễ',
-		'ì', 'í', 'ị', 'ỉ', 'ĩ',
-		'ò', 'ó', 'ọ', 'ỏ', 'õ', 'ô', 'ồ', 'ố', 'ộ', 'ổ', 'ỗ', 'ơ', 'ờ', 'ớ', 'ợ', 'ở', 'ỡ',
-		'ù', 'ú', 'ụ', 'ủ', 'ũ', 'ư', 'ừ', 'ứ', 'ự', 'ử', 'ữ',
-		'ỳ', 'ý', 'ỵ', 'ỷ', 'ỹ',
-		'đ'}
-
-	for _, char := range vietnameseChars {
-		if strings.ContainsRune(text, char) {
-			return true
-		}
-	}
-	return false
-}
-
-// containsChineseChars checks for Chinese characters
-func containsChineseChars(text string) bool {
-	for _, r := range text {
-		if (r >= 0x4E00 && r <= 0x9FFF) || // CJK Unified Ideographs
-			(r >= 0x3400 && r <= 0x4DBF) || // CJK Unified Ideographs Extension A
-			(r >= 0x20000 && r <= 0x2A6DF) { // CJK Unified Ideographs Extension B
-			return true
-		}
-	}
-	return false
-}
-
-// containsJapaneseChars checks for Japanese characters
-func containsJapaneseChars(text string) bool {
-	for _, r := range text {
-		if (r >= 0x3040 && r <= 0x309F) || // Hiragana
-			(r >= 0x30A0 && r <= 0x30FF) || // Katakana
-			(r >= 0x4E00 && r <= 0x9FFF) { // Kanji
-			return true
-		}
-	}
-	return false
-}
-
-// containsKoreanChars checks for Korean characters
-func containsKoreanChars(text string) bool {
-	for _, r := range text {
-		if r >= 0xAC00 && r <= 0xD7AF { // Hangul Syllables
-			return true
-		}
-	}
-	return false
-}
-
-// containsEnglishWords checks for common English words
-func containsEnglishWords(text string) bool {
-	englishWords := []string{"the", "and", "or", "but", "in", "on", "at", "to", "for", "of", "with", "by", "is", "are", "was", "were", "be", "been", "have", "has", "had", "do", "does", "did", "will", "would", "could", "should", "may", "might", "can", "this", "that", "these", "those", "i", "you", "he", "she", "it", "we", "they", "me", "him", "her", "us", "them"}
-
-	for _, word := range englishWords {
-		if strings.Contains(text, " "+word+" ") || strings.HasPrefix(text, word+" ") || strings.HasSuffix(text, " "+word) {
-			return true
-		}
-	}
-	return false
-}
-
-// containsFrenchWords checks for common French words
-func containsFrenchWords(text string) bool {
-	frenchWords := []string{"le", "la", "les", "un", "une", "des", "et", "ou", "mais", "dans", "sur", "avec", "sans", "pour", "par", "de", "du", "des", "est", "sont", "était", "étaient", "être", "avoir", "faire", "aller", "venir", "voir", "savoir", "pouvoir", "vouloir", "devoir", "je", "tu", "il", "elle", "nous", "vous", "ils", "elles"}
-
-	for _, word := range frenchWords {
-		if strings.Contains(text, " "+word+" ") || strings.HasPrefix(text, word+" ") || strings.HasSuffix(text, " "+word) {
-			return true
-		}
-	}
-	return false
-}
-
-// containsGermanWords checks for common German words
-func containsGermanWords(text string) bool {
-	germanWords := []string{"der", "die", "das", "ein", "eine", "und", "oder", "aber", "in", "auf", "mit", "ohne", "für", "von", "zu", "ist", "sind", "war", "waren", "sein", "haben", "machen", "gehen", "kommen", "sehen", "wissen", "können", "wollen", "müssen", "ich", "du", "er", "sie", "es", "wir", "ihr", "sie"}
-
-	for _, word := range germanWords {
-		if strings.Contains(text, " "+word+" ") || strings.HasPrefix(text, word+" ") || strings.HasSuffix(text, " "+word) {
-			return true
-		}
-	}
-	return false
-}
-
-// containsSpanishWords checks for common Spanish words
-func containsSpanishWords(text string) bool {
-	spanishWords := []string{"el", "la", "los", "las", "un", "una", "unos", "unas", "y", "o", "pero", "en", "sobre", "con", "sin", "para", "por", "de", "del", "es", "son", "era", "eran", "ser", "estar", "tener", "hacer", "ir", "venir", "ver", "saber", "poder", "querer", "deber", "yo", "tú", "él", "ella", "nosotros", "vosotros", "ellos", "ellas"}
-
-	for _, word := range spanishWords {
-		if strings.Contains(text, " "+word+" ") || strings.HasPrefix(text, word+" ") || strings.HasSuffix(text, " "+word) {
-			return true
-		}
-	}
-	return false
-}
-
 // TestDetectSRTLanguage is a simple test function to verify language detection
 func TestDetectSRTLanguage() {
 	testCases := []struct {
@@ -0,0 +1,507 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SubscriptionStatusPending   = "pending"
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusCancelled = "cancelled"
+	SubscriptionStatusExpired   = "expired"
+
+	SubscriptionPaymentCredits = "credits"
+	SubscriptionPaymentOrder   = "payment_order"
+
+	LimitUnitMinutes = "minutes"
+	LimitUnitVideos  = "videos"
+
+	// Số tháng tối đa cho một lần mua gói
+	maxSubscriptionMonths = 12
+	// Tier mặc định khi gói hết hạn (id dùng khi bảng pricing_tiers chưa có tier "free")
+	freeTierName = "free"
+	freeTierID   = 1
+)
+
+var (
+	ErrInvalidSubscriptionRequest = errors.New("invalid subscription request")
+	ErrSubscriptionPayment        = errors.New("subscription payment failed")
+	ErrNoActiveSubscription       = errors.New("no active subscription")
+	ErrMonthlyLimitExceeded       = errors.New("monthly limit exceeded")
+
+	errSubscriptionChanged = errors.New("subscription changed concurrently")
+)
+
+type SubscriptionService struct {
+	db *gorm.DB
+}
+
+func NewSubscriptionService(db *gorm.DB) *SubscriptionService {
+	return &SubscriptionService{db: db}
+}
+
+// GetPlans lấy các tier có thể mua theo tháng (đang active và có SubscriptionPrice)
+func (s *SubscriptionService) GetPlans() ([]config.PricingTier, error) {
+	var tiers []config.PricingTier
+	err := s.db.Where("is_active = ? AND subscription_price > 0", true).Order("subscription_price ASC").Find(&tiers).Error
+	return tiers, err
+}
+
+// Subscribe mua gói tier trong req.Months tháng. Trả bằng credit thì gói kích hoạt ngay,
+// trả bằng đơn thanh toán thì gói ở trạng thái pending và được kích hoạt khi đơn được thanh toán
+func (s *SubscriptionService) Subscribe(userID uint, req model.CreateSubscriptionRequest) (*model.UserSubscription, *config.PaymentOrder, error) {
+	months := req.Months
+	if months == 0 {
+		months = 1
+	}
+	if months < 1 || months > maxSubscriptionMonths {
+		return nil, nil, fmt.Errorf("%w: months must be between 1 and %d", ErrInvalidSubscriptionRequest, maxSubscriptionMonths)
+	}
+
+	paymentMethod := req.PaymentMethod
+	if paymentMethod == "" {
+		paymentMethod = SubscriptionPaymentCredits
+	}
+	if paymentMethod != SubscriptionPaymentCredits && paymentMethod != SubscriptionPaymentOrder {
+		return nil, nil, fmt.Errorf("%w: unsupported payment method %q", ErrInvalidSubscriptionRequest, paymentMethod)
+	}
+
+	var tier config.PricingTier
+	if err := s.db.Where("id = ? AND is_active = ?", req.TierID, true).First(&tier).Error; err != nil {
+		return nil, nil, fmt.Errorf("%w: tier %d not found", ErrInvalidSubscriptionRequest, req.TierID)
+	}
+	if tier.SubscriptionPrice <= 0 {
+		return nil, nil, fmt.Errorf("%w: tier %s is not sold as a subscription", ErrInvalidSubscriptionRequest, tier.Name)
+	}
+
+	autoRenew := true
+	if req.AutoRenew != nil {
+		autoRenew = *req.AutoRenew
+	}
+
+	subscription := &model.UserSubscription{
+		UserID:        userID,
+		TierID:        tier.ID,
+		TierName:      tier.Name,
+		Status:        SubscriptionStatusPending,
+		Months:        months,
+		Price:         tier.SubscriptionPrice * float64(months),
+		PaymentSource: paymentMethod,
+		AutoRenew:     autoRenew,
+	}
+
+	if paymentMethod == SubscriptionPaymentOrder {
+		if err := s.db.Create(subscription).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to create subscription: %v", err)
+		}
+		order, err := NewPaymentOrderService().CreateSubscriptionOrder(userID, subscription.Price, subscription.ID)
+		if err != nil {
+			s.db.Model(subscription).Update("status", SubscriptionStatusCancelled)
+			return nil, nil, fmt.Errorf("failed to create payment order: %w", err)
+		}
+		subscription.OrderID = &order.ID
+		if err := s.db.Model(subscription).Update("order_id", order.ID).Error; err != nil {
+			log.Printf("Failed to link order %s to subscription %d: %v", order.OrderCode, subscription.ID, err)
+		}
+		return subscription, order, nil
+	}
+
+	creditService := NewCreditService()
+	description := fmt.Sprintf("Mua gói %s %d tháng", tier.Name, months)
+	if err := creditService.ChargeCredits(userID, subscription.Price, "subscription", description, fmt.Sprintf("tier_%d", tier.ID)); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrSubscriptionPayment, err)
+	}
+
+	err := s.db.Create(subscription).Error
+	if err == nil {
+		err = s.activate(subscription)
+	}
+	if err != nil {
+		if refundErr := creditService.RefundCredits(userID, subscription.Price, "subscription", "Hoàn credit do kích hoạt gói thất bại", nil); refundErr != nil {
+			log.Printf("Failed to refund subscription charge for user %d: %v", userID, refundErr)
+		}
+		return nil, nil, fmt.Errorf("failed to activate subscription: %v", err)
+	}
+
+	log.Printf("User %d subscribed to %s for %d month(s) using credits", userID, tier.Name, months)
+	return subscription, nil, nil
+}
+
+// ActivateSubscription kích hoạt gói pending sau khi đơn thanh toán của gói được xác nhận
+func (s *SubscriptionService) ActivateSubscription(subscriptionID uint) error {
+	var subscription model.UserSubscription
+	if err := s.db.First(&subscription, subscriptionID).Error; err != nil {
+		return fmt.Errorf("subscription %d not found: %v", subscriptionID, err)
+	}
+	if subscription.Status == SubscriptionStatusActive {
+		return nil
+	}
+	if subscription.Status != SubscriptionStatusPending {
+		return fmt.Errorf("subscription %d is %s", subscriptionID, subscription.Status)
+	}
+
+	if err := s.activate(&subscription); err != nil {
+		return err
+	}
+	log.Printf("Subscription %d (%s) activated for user %d via payment order", subscription.ID, subscription.TierName, subscription.UserID)
+	return nil
+}
+
+// activate tính thời hạn gói: cùng tier với gói đang chạy thì nối tiếp sau gói đó,
+// khác tier thì kết thúc gói cũ ngay (không hoàn phần còn lại) và gói mới bắt đầu từ bây giờ
+func (s *SubscriptionService) activate(subscription *model.UserSubscription) error {
+	now := time.Now().Truncate(time.Second)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		start := now
+		var latest model.UserSubscription
+		err := tx.Where("user_id = ? AND status = ? AND period_end > ? AND id <> ?", subscription.UserID, SubscriptionStatusActive, now, subscription.ID).
+			Order("period_end DESC").First(&latest).Error
+		if err == nil {
+			if latest.TierID == subscription.TierID {
+				start = latest.PeriodEnd
+			} else if err := tx.Model(&model.UserSubscription{}).
+				Where("user_id = ? AND status = ? AND id <> ?", subscription.UserID, SubscriptionStatusActive, subscription.ID).
+				Updates(map[string]interface{}{"status": SubscriptionStatusCancelled, "period_end": now}).Error; err != nil {
+				return err
+			}
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		subscription.Status = SubscriptionStatusActive
+		subscription.PeriodStart = start
+		subscription.PeriodEnd = start.AddDate(0, subscription.Months, 0)
+		if err := tx.Model(subscription).Updates(map[string]interface{}{
+			"status":       subscription.Status,
+			"period_start": subscription.PeriodStart,
+			"period_end":   subscription.PeriodEnd,
+		}).Error; err != nil {
+			return err
+		}
+		return setUserTier(tx, subscription.UserID, subscription.TierID)
+	})
+}
+
+// setUserTier đổi tier của user (tier quyết định markup trong CalculateUserPrice và hạn mức tháng)
+func setUserTier(tx *gorm.DB, userID uint, tierID int) error {
+	result := tx.Model(&config.UserCredits{}).Where("user_id = ?", userID).Update("tier_id", tierID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user tier: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		tx.Model(&config.UserCredits{}).Where("user_id = ?", userID).Count(&count)
+		if count == 0 {
+			return tx.Create(&config.UserCredits{UserID: userID, TierID: tierID}).Error
+		}
+	}
+	return nil
+}
+
+func (s *SubscriptionService) freeTierID() int {
+	var tier config.PricingTier
+	if err := s.db.Where("name = ?", freeTierName).First(&tier).Error; err != nil {
+		return freeTierID
+	}
+	return tier.ID
+}
+
+// GetActiveSubscription lấy gói đang có hiệu lực của user, nil nếu user không có gói
+func (s *SubscriptionService) GetActiveSubscription(userID uint) (*model.UserSubscription, error) {
+	now := time.Now()
+	var subscription model.UserSubscription
+	err := s.db.Where("user_id = ? AND status = ? AND period_start <= ? AND period_end > ?", userID, SubscriptionStatusActive, now, now).
+		Order("period_start DESC").First(&subscription).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// usageCycle trả về chu kỳ hạn mức chứa now: theo tháng kể từ ngày bắt đầu gói, không có gói thì theo tháng dương lịch
+func usageCycle(subscription *model.UserSubscription, now time.Time) (time.Time, time.Time) {
+	if subscription == nil {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	anchor := subscription.PeriodStart.Truncate(time.Second)
+	start := anchor
+	for months := 1; ; months++ {
+		next := anchor.AddDate(0, months, 0)
+		if next.After(now) {
+			return start, next
+		}
+		start = next
+	}
+}
+
+func (s *SubscriptionService) currentUsage(userID uint) (*model.SubscriptionUsage, *model.UserSubscription, time.Time, error) {
+	subscription, err := s.GetActiveSubscription(userID)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	start, end := usageCycle(subscription, time.Now())
+	usage := &model.SubscriptionUsage{UserID: userID, CycleStart: start}
+	err = s.db.Where("user_id = ? AND cycle_start = ?", userID, start).First(usage).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, nil, time.Time{}, err
+	}
+	return usage, subscription, end, nil
+}
+
+func limitUnit(tier *config.PricingTier) string {
+	if tier.LimitUnit == LimitUnitVideos {
+		return LimitUnitVideos
+	}
+	return LimitUnitMinutes
+}
+
+// ReserveAllowance giữ trước một video dài minutes phút trong hạn mức tháng của tier (gọi trước LockCredits).
+// Lượng dùng được cộng bằng một câu UPDATE có điều kiện nên các job chạy đồng thời không vượt MonthlyLimit;
+// job lỗi thì gọi ReleaseAllowance. Tier không có MonthlyLimit chỉ ghi nhận usage; lỗi đọc/ghi usage thì cho qua để không chặn xử lý
+func (s *SubscriptionService) ReserveAllowance(userID uint, minutes float64) error {
+	var limit *int
+	unit := LimitUnitMinutes
+	tier, err := NewPricingService().GetUserTier(userID)
+	if err == nil {
+		limit = tier.MonthlyLimit
+		unit = limitUnit(tier)
+	}
+
+	usage, _, cycleEnd, err := s.currentUsage(userID)
+	if err != nil {
+		log.Printf("Failed to read subscription usage for user %d: %v", userID, err)
+		return nil
+	}
+
+	// Tạo dòng usage của chu kỳ nếu chưa có để UPDATE bên dưới luôn có dòng để cộng
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.SubscriptionUsage{UserID: userID, CycleStart: usage.CycleStart}).Error; err != nil {
+		log.Printf("Failed to create subscription usage for user %d: %v", userID, err)
+		return nil
+	}
+
+	query := s.db.Model(&model.SubscriptionUsage{}).Where("user_id = ? AND cycle_start = ?", userID, usage.CycleStart)
+	if limit != nil {
+		if unit == LimitUnitVideos {
+			query = query.Where("used_videos + 1 <= ?", *limit)
+		} else {
+			query = query.Where("used_minutes + ? <= ?", minutes, *limit)
+		}
+	}
+	result := query.Updates(map[string]interface{}{
+		"used_minutes": gorm.Expr("used_minutes + ?", minutes),
+		"used_videos":  gorm.Expr("used_videos + 1"),
+	})
+	if result.Error != nil {
+		log.Printf("Failed to reserve subscription usage for user %d: %v", userID, result.Error)
+		return nil
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	// Không cộng được: đã chạm hạn mức, đọc lại usage để báo lỗi
+	s.db.Where("user_id = ? AND cycle_start = ?", userID, usage.CycleStart).First(usage)
+	if unit == LimitUnitVideos {
+		return fmt.Errorf("%w: tier %s used %d/%d videos until %s", ErrMonthlyLimitExceeded, tier.Name, usage.UsedVideos, *limit, cycleEnd.Format("2006-01-02"))
+	}
+	return fmt.Errorf("%w: tier %s used %.1f/%d minutes (requested %.1f) until %s", ErrMonthlyLimitExceeded, tier.Name, usage.UsedMinutes, *limit, minutes, cycleEnd.Format("2006-01-02"))
+}
+
+// ReleaseAllowance trả lại phần hạn mức đã giữ bởi ReserveAllowance khi job lỗi trước khi video được xử lý và tính phí
+func (s *SubscriptionService) ReleaseAllowance(userID uint, minutes float64) error {
+	usage, _, _, err := s.currentUsage(userID)
+	if err != nil {
+		return err
+	}
+	return s.db.Model(&model.SubscriptionUsage{}).
+		Where("user_id = ? AND cycle_start = ?", userID, usage.CycleStart).
+		Updates(map[string]interface{}{
+			"used_minutes": gorm.Expr("GREATEST(used_minutes - ?, 0)", minutes),
+			"used_videos":  gorm.Expr("GREATEST(used_videos - 1, 0)"),
+		}).Error
+}
+
+// GetStatus lấy gói hiện tại, hạn mức, lượng đã dùng và ngày gia hạn của user
+func (s *SubscriptionService) GetStatus(userID uint) (*model.SubscriptionStatus, error) {
+	tier, err := NewPricingService().GetUserTier(userID)
+	if err != nil {
+		tier = &config.PricingTier{ID: freeTierID, Name: freeTierName}
+	}
+
+	usage, subscription, cycleEnd, err := s.currentUsage(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription usage: %v", err)
+	}
+
+	status := &model.SubscriptionStatus{
+		TierID:       tier.ID,
+		TierName:     tier.Name,
+		MonthlyLimit: tier.MonthlyLimit,
+		LimitUnit:    limitUnit(tier),
+		UsedMinutes:  usage.UsedMinutes,
+		UsedVideos:   usage.UsedVideos,
+		CycleStart:   usage.CycleStart,
+		CycleEnd:     cycleEnd,
+		Subscription: subscription,
+	}
+	status.Used = usage.UsedMinutes
+	if status.LimitUnit == LimitUnitVideos {
+		status.Used = float64(usage.UsedVideos)
+	}
+	if tier.MonthlyLimit != nil {
+		remaining := float64(*tier.MonthlyLimit) - status.Used
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.Remaining = &remaining
+	}
+
+	if subscription != nil {
+		// Gói cùng tier mua thêm được xếp nối tiếp, ngày hết hạn là PeriodEnd của gói cuối
+		var latest model.UserSubscription
+		if err := s.db.Where("user_id = ? AND status = ?", userID, SubscriptionStatusActive).Order("period_end DESC").First(&latest).Error; err == nil {
+			status.ExpiresAt = &latest.PeriodEnd
+			if latest.AutoRenew {
+				status.RenewsAt = &latest.PeriodEnd
+				status.RenewalPrice = tier.SubscriptionPrice
+			}
+		}
+	}
+
+	var pending model.UserSubscription
+	if err := s.db.Where("user_id = ? AND status = ?", userID, SubscriptionStatusPending).Order("created_at DESC").First(&pending).Error; err == nil {
+		status.Pending = &pending
+	}
+
+	return status, nil
+}
+
+// SetAutoRenew bật/tắt tự gia hạn cho các gói còn hiệu lực của user. Tắt tự gia hạn = huỷ gói, gói vẫn dùng được đến hết hạn
+func (s *SubscriptionService) SetAutoRenew(userID uint, autoRenew bool) error {
+	result := s.db.Model(&model.UserSubscription{}).
+		Where("user_id = ? AND status = ? AND period_end > ?", userID, SubscriptionStatusActive, time.Now()).
+		Update("auto_renew", autoRenew)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update auto renew: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		s.db.Model(&model.UserSubscription{}).Where("user_id = ? AND status = ? AND period_end > ?", userID, SubscriptionStatusActive, time.Now()).Count(&count)
+		if count == 0 {
+			return ErrNoActiveSubscription
+		}
+	}
+	return nil
+}
+
+// ProcessRenewals xử lý các gói đã hết hạn: gia hạn thêm 1 tháng bằng credit nếu bật tự gia hạn,
+// không thì (hoặc không đủ credit) chuyển gói sang expired và đưa user về tier free
+func (s *SubscriptionService) ProcessRenewals() error {
+	var due []model.UserSubscription
+	err := s.db.Where("status = ? AND period_end <= ?", SubscriptionStatusActive, time.Now()).Find(&due).Error
+	if err != nil {
+		return fmt.Errorf("failed to get due subscriptions: %v", err)
+	}
+
+	for i := range due {
+		if err := s.renewOrExpire(&due[i]); err != nil {
+			log.Printf("Failed to process renewal for subscription %d: %v", due[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// renew trừ credit và gia hạn gói thêm 1 tháng trong cùng transaction. Khoản trừ mang reference theo kỳ
+// (subscription_<id>_<period_end>) và thời hạn chỉ được nối khi period_end chưa đổi, nên mỗi kỳ chỉ bị trừ một lần
+func (s *SubscriptionService) renew(subscription *model.UserSubscription, tier *config.PricingTier) error {
+	periodEnd := subscription.PeriodEnd.AddDate(0, 1, 0)
+	referenceID := fmt.Sprintf("subscription_%d_%d", subscription.ID, subscription.PeriodEnd.Unix())
+	description := fmt.Sprintf("Gia hạn gói %s 1 tháng", tier.Name)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var charged int64
+		if err := tx.Model(&config.CreditTransaction{}).Where("user_id = ? AND reference_id = ?", subscription.UserID, referenceID).Count(&charged).Error; err != nil {
+			return err
+		}
+		if charged == 0 {
+			if err := NewCreditService().chargeCredits(tx, subscription.UserID, tier.SubscriptionPrice, "subscription", description, referenceID); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&model.UserSubscription{}).
+			Where("id = ? AND status = ? AND period_end = ?", subscription.ID, SubscriptionStatusActive, subscription.PeriodEnd).
+			Updates(map[string]interface{}{
+				"period_end": periodEnd,
+				"months":     subscription.Months + 1,
+				"price":      subscription.Price + tier.SubscriptionPrice,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errSubscriptionChanged
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Renewed subscription %d (%s) for user %d until %s", subscription.ID, tier.Name, subscription.UserID, periodEnd.Format("2006-01-02"))
+	subscription.PeriodEnd = periodEnd
+	subscription.Months++
+	subscription.Price += tier.SubscriptionPrice
+	return nil
+}
+
+func (s *SubscriptionService) renewOrExpire(subscription *model.UserSubscription) error {
+	// Đã có gói nối tiếp thì gói này chỉ cần kết thúc
+	var next model.UserSubscription
+	err := s.db.Where("user_id = ? AND status = ? AND period_end > ? AND id <> ?", subscription.UserID, SubscriptionStatusActive, subscription.PeriodEnd, subscription.ID).
+		First(&next).Error
+	if err == nil {
+		return s.db.Model(subscription).Update("status", SubscriptionStatusExpired).Error
+	}
+
+	if subscription.AutoRenew {
+		var tier config.PricingTier
+		err := s.db.Where("id = ? AND is_active = ?", subscription.TierID, true).First(&tier).Error
+		if err == nil && tier.SubscriptionPrice > 0 {
+			err = s.renew(subscription, &tier)
+			if errors.Is(err, errSubscriptionChanged) {
+				// Lần chạy khác vừa gia hạn/kết thúc gói
+				return nil
+			}
+			if err == nil {
+				NewSpendingService(config.Db).CheckAlerts(subscription.UserID)
+				return nil
+			}
+		}
+		log.Printf("Auto renew failed for subscription %d (user %d), expiring: %v", subscription.ID, subscription.UserID, err)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(subscription).Update("status", SubscriptionStatusExpired).Error; err != nil {
+			return err
+		}
+		log.Printf("Subscription %d (%s) expired, user %d moved back to %s", subscription.ID, subscription.TierName, subscription.UserID, freeTierName)
+		return setUserTier(tx, subscription.UserID, s.freeTierID())
+	})
+}
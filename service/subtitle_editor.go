@@ -0,0 +1,383 @@
+package service
+
+import (
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RenderSettings lưu các tham số render của một job để có thể render lại sau khi sửa phụ đề
+type RenderSettings struct {
+	TargetLanguage   string  `json:"target_language"`
+	VoiceName        string  `json:"voice_name"`
+	VoiceMode        string  `json:"voice_mode"`
+	SpeakingRate     float64 `json:"speaking_rate"`
+	BackgroundVolume float64 `json:"background_volume"`
+	TTSVolume        float64 `json:"tts_volume"`
+	OutputProfile    string  `json:"output_profile"`
+	ReframeMode      string  `json:"reframe_mode"`
+	SubtitleColor    string  `json:"subtitle_color"`
+	SubtitleBgColor  string  `json:"subtitle_bgcolor"`
+}
+
+// LoadRenderSettings đọc render settings của history, history cũ chưa lưu settings thì dùng mặc định của process-video
+func LoadRenderSettings(history *config.CaptionHistory) RenderSettings {
+	settings := RenderSettings{
+		VoiceMode:        VoiceModeReplace,
+		SpeakingRate:     1.2,
+		BackgroundVolume: 1.2,
+		TTSVolume:        1.5,
+		OutputProfile:    DefaultOutputProfile,
+		SubtitleColor:    "#FFFFFF",
+		SubtitleBgColor:  "#808080",
+	}
+	if history.ProcessType == "burn-sub" {
+		settings.VoiceMode = VoiceModeSubtitleOnly
+	}
+	if len(history.RenderSettings) > 0 {
+		if err := json.Unmarshal(history.RenderSettings, &settings); err != nil {
+			log.Printf("Failed to parse render settings of history %d: %v", history.ID, err)
+		}
+	}
+	settings.VoiceMode = NormalizeVoiceMode(settings.VoiceMode)
+	return settings
+}
+
+// MarshalRenderSettings chuyển settings thành JSON để lưu vào CaptionHistory
+func MarshalRenderSettings(settings RenderSettings) []byte {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		log.Printf("Failed to marshal render settings: %v", err)
+		return nil
+	}
+	return data
+}
+
+// CueOperation là một thao tác sửa cue từ PATCH /history/:id/cues
+// index, from, to là số thứ tự cue (bắt đầu từ 1) như trong file SRT
+type CueOperation struct {
+	Op        string   `json:"op"` // edit, split, merge, shift
+	Index     int      `json:"index"`
+	Text      *string  `json:"text,omitempty"`
+	Start     *float64 `json:"start,omitempty"`
+	End       *float64 `json:"end,omitempty"`
+	At        float64  `json:"at,omitempty"`         // split: thời điểm cắt
+	TextAfter string   `json:"text_after,omitempty"` // split: text của cue thứ hai, rỗng thì chia theo từ
+	Count     int      `json:"count,omitempty"`      // merge: số cue gộp (mặc định 2)
+	From      int      `json:"from,omitempty"`       // shift: cue đầu tiên (mặc định 1)
+	To        int      `json:"to,omitempty"`         // shift: cue cuối cùng (mặc định cue cuối)
+	Offset    float64  `json:"offset,omitempty"`     // shift: số giây dịch (âm = sớm hơn)
+}
+
+// cueDraftPath là file lưu các chỉnh sửa chưa render, nằm cạnh file SRT của history
+func cueDraftPath(history *config.CaptionHistory) string {
+	return filepath.Join(filepath.Dir(history.SrtFile), fmt.Sprintf("cues_draft_%d.json", history.ID))
+}
+
+// LoadRenderedCues đọc các cue của file SRT đã render gần nhất
+func LoadRenderedCues(history *config.CaptionHistory) ([]Segment, error) {
+	if history.SrtFile == "" {
+		return nil, fmt.Errorf("history has no subtitle file")
+	}
+	content, err := os.ReadFile(history.SrtFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SRT file: %v", err)
+	}
+	entries, err := parseSRT(cleanSRTContent(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SRT: %v", err)
+	}
+	cues := make([]Segment, 0, len(entries))
+	for _, entry := range entries {
+		cues = append(cues, Segment{Start: entry.Start, End: entry.End, Text: entry.Text})
+	}
+	renumberCues(cues)
+	return cues, nil
+}
+
+// LoadCues trả về các cue đang chỉnh sửa (bản nháp nếu có), kèm cờ cho biết có thay đổi chưa render
+func LoadCues(history *config.CaptionHistory) ([]Segment, bool, error) {
+	if history.SrtFile != "" {
+		if data, err := os.ReadFile(cueDraftPath(history)); err == nil {
+			var cues []Segment
+			if err := json.Unmarshal(data, &cues); err == nil {
+				return cues, true, nil
+			}
+			log.Printf("Invalid cue draft for history %d, falling back to rendered SRT: %v", history.ID, err)
+		}
+	}
+	cues, err := LoadRenderedCues(history)
+	return cues, false, err
+}
+
+// SaveCueDraft validate và lưu bản nháp cue, chưa render lại video
+func SaveCueDraft(history *config.CaptionHistory, cues []Segment) ([]Segment, error) {
+	if history.SrtFile == "" {
+		return nil, fmt.Errorf("history has no subtitle file")
+	}
+	cues, err := NormalizeCues(cues)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cues)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(cueDraftPath(history), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save cue draft: %v", err)
+	}
+	return cues, nil
+}
+
+// NormalizeCues sắp xếp theo thời gian, đánh lại số thứ tự và kiểm tra tính hợp lệ của cue
+func NormalizeCues(cues []Segment) ([]Segment, error) {
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("cue list is empty")
+	}
+	result := make([]Segment, len(cues))
+	copy(result, cues)
+	for i := range result {
+		result[i].Text = strings.TrimSpace(result[i].Text)
+		if result[i].Text == "" {
+			return nil, fmt.Errorf("cue %d has empty text", i+1)
+		}
+		if result[i].Start < 0 {
+			return nil, fmt.Errorf("cue %d starts before 0", i+1)
+		}
+		if result[i].End <= result[i].Start {
+			return nil, fmt.Errorf("cue %d ends before it starts", i+1)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Start < result[j].Start })
+	renumberCues(result)
+	return result, nil
+}
+
+func renumberCues(cues []Segment) {
+	for i := range cues {
+		cues[i].ID = i + 1
+	}
+}
+
+// ApplyCueOperation áp dụng một thao tác edit/split/merge/shift lên danh sách cue
+func ApplyCueOperation(cues []Segment, op CueOperation) ([]Segment, error) {
+	result := make([]Segment, len(cues))
+	copy(result, cues)
+
+	switch strings.ToLower(op.Op) {
+	case "edit":
+		i, err := cuePosition(result, op.Index)
+		if err != nil {
+			return nil, err
+		}
+		if op.Text != nil {
+			result[i].Text = *op.Text
+		}
+		if op.Start != nil {
+			result[i].Start = *op.Start
+		}
+		if op.End != nil {
+			result[i].End = *op.End
+		}
+
+	case "split":
+		i, err := cuePosition(result, op.Index)
+		if err != nil {
+			return nil, err
+		}
+		cue := result[i]
+		if op.At <= cue.Start || op.At >= cue.End {
+			return nil, fmt.Errorf("split point %.3f is outside cue %d", op.At, op.Index)
+		}
+		firstText, secondText := cue.Text, op.TextAfter
+		if op.Text != nil {
+			firstText = *op.Text
+		}
+		if secondText == "" {
+			// Chia text theo tỉ lệ thời gian tại điểm cắt
+			words := strings.Fields(firstText)
+			if len(words) < 2 {
+				return nil, fmt.Errorf("cue %d has too few words to split", op.Index)
+			}
+			cut := int(float64(len(words)) * (op.At - cue.Start) / (cue.End - cue.Start))
+			if cut < 1 {
+				cut = 1
+			}
+			if cut > len(words)-1 {
+				cut = len(words) - 1
+			}
+			firstText = strings.Join(words[:cut], " ")
+			secondText = strings.Join(words[cut:], " ")
+		}
+		first := Segment{Start: cue.Start, End: op.At, Text: firstText}
+		second := Segment{Start: op.At, End: cue.End, Text: secondText}
+		result = append(result[:i], append([]Segment{first, second}, result[i+1:]...)...)
+
+	case "merge":
+		i, err := cuePosition(result, op.Index)
+		if err != nil {
+			return nil, err
+		}
+		count := op.Count
+		if count == 0 {
+			count = 2
+		}
+		if count < 2 || i+count > len(result) {
+			return nil, fmt.Errorf("cannot merge %d cues from cue %d", count, op.Index)
+		}
+		merged := result[i]
+		for _, next := range result[i+1 : i+count] {
+			merged.Text = merged.Text + " " + next.Text
+			if next.End > merged.End {
+				merged.End = next.End
+			}
+		}
+		result = append(result[:i], append([]Segment{merged}, result[i+count:]...)...)
+
+	case "shift":
+		from, to := op.From, op.To
+		if from == 0 {
+			from = 1
+		}
+		if to == 0 {
+			to = len(result)
+		}
+		if from < 1 || to > len(result) || from > to {
+			return nil, fmt.Errorf("invalid shift range %d-%d", from, to)
+		}
+		for i := from - 1; i < to; i++ {
+			result[i].Start += op.Offset
+			result[i].End += op.Offset
+			if result[i].Start < 0 {
+				return nil, fmt.Errorf("shift moves cue %d before 0", i+1)
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown cue operation: %s", op.Op)
+	}
+
+	return NormalizeCues(result)
+}
+
+func cuePosition(cues []Segment, index int) (int, error) {
+	if index < 1 || index > len(cues) {
+		return 0, fmt.Errorf("cue %d not found", index)
+	}
+	return index - 1, nil
+}
+
+// EstimateRerenderTTS chia các cue sẽ TTS lại thành phần đã có trong cache segment (miễn phí) và phần phải gọi API (tính phí),
+// cùng giọng theo người nói mà RerenderHistory sẽ dùng. Gọi trước RerenderHistory để cue được tạo trong lần render này vẫn là miss
+func EstimateRerenderTTS(history *config.CaptionHistory, cues []Segment, settings RenderSettings) TTSBillingSplit {
+	srtContent := createSRT(cues)
+	return SplitTTSBillingByCache(srtContent, rerenderLanguage(settings, srtContent), settings.VoiceName, settings.SpeakingRate, rerenderCueVoices(history, cues))
+}
+
+// rerenderLanguage là ngôn ngữ TTS khi render lại: ngôn ngữ đích đã lưu, history cũ thì detect từ SRT
+func rerenderLanguage(settings RenderSettings, srtContent string) string {
+	if settings.TargetLanguage != "" {
+		return settings.TargetLanguage
+	}
+	return DetectSRTLanguage(srtContent)
+}
+
+// rerenderCueVoices giữ giọng riêng của từng người nói (CaptionHistory.Speakers) cho các cue đã sửa
+func rerenderCueVoices(history *config.CaptionHistory, cues []Segment) map[int]string {
+	if len(history.Speakers) == 0 {
+		return nil
+	}
+	var speakers []model.SpeakerVoice
+	if err := json.Unmarshal(history.Speakers, &speakers); err != nil {
+		log.Printf("Failed to parse speakers of history %d: %v", history.ID, err)
+		return nil
+	}
+	return BuildCueVoices(cues, speakers)
+}
+
+// RerenderResult kết quả render lại sau khi sửa phụ đề
+type RerenderResult struct {
+	SRTPath        string
+	TTSPath        string
+	FinalVideoPath string
+	TTSOverflow    []TTSMapping // Segment TTS bị cắt phần thừa vì không căn vừa cue, cần review
+	TTSTiming      *TTSTimingReport
+}
+
+// RerenderHistory tạo lại TTS, mix và burn phụ đề từ danh sách cue mới, giữ nguyên video upload gốc và nhạc nền.
+// Segment TTS không đổi text được lấy từ cache segment nên chỉ các cue bị sửa mới gọi Google TTS
+func RerenderHistory(history *config.CaptionHistory, cues []Segment, settings RenderSettings) (*RerenderResult, error) {
+	videoPath := history.VideoFilename
+	if _, err := os.Stat(videoPath); err != nil {
+		return nil, fmt.Errorf("original video not found: %v", err)
+	}
+	videoDir := filepath.Dir(videoPath)
+
+	// Ghi SRT mới ra file riêng để không ghi đè file đang được serve
+	srtPath := filepath.Join(videoDir, fmt.Sprintf("edited_%d_%s.srt", history.ID, time.Now().Format("20060102150405")))
+	if err := CreateSRTFromSegments(cues, srtPath); err != nil {
+		return nil, err
+	}
+	result := &RerenderResult{SRTPath: srtPath}
+
+	profile := GetOutputProfile(settings.OutputProfile)
+	sourceVideoPath := videoPath
+	if NormalizeReframeMode(settings.ReframeMode) != ReframeModeNone {
+		reframedPath, err := ReframeVideo(videoPath, videoDir, settings.ReframeMode, profile)
+		if err != nil {
+			log.Printf("Reframe failed, using original video: %v", err)
+		} else if reframedPath != videoPath {
+			sourceVideoPath = reframedPath
+			if profile.SafeAreaBottom == 0 {
+				profile.SafeAreaBottom = VerticalSafeAreaBottom
+			}
+		}
+	}
+
+	mergedPath := sourceVideoPath
+	if VoiceModeUsesTTS(settings.VoiceMode) {
+		if history.BackgroundMusic == "" {
+			return nil, fmt.Errorf("history has no background track to re-mix")
+		}
+		srtContent, err := os.ReadFile(srtPath)
+		if err != nil {
+			return nil, err
+		}
+		language := rerenderLanguage(settings, string(srtContent))
+		ttsPath, report, err := ConvertSRTToSpeechWithTimingReport(string(srtContent), videoDir, settings.SpeakingRate, language, settings.VoiceName, rerenderCueVoices(history, cues))
+		if err != nil {
+			return nil, fmt.Errorf("TTS failed: %v", err)
+		}
+		result.TTSPath = ttsPath
+		result.TTSOverflow = report.OverflowSegments
+		result.TTSTiming = report
+
+		mergedPath, err = MergeVideoWithAudio(sourceVideoPath, history.BackgroundMusic, ttsPath, videoDir, settings.BackgroundVolume, settings.TTSVolume, profile)
+		if err != nil {
+			return nil, fmt.Errorf("merge failed: %v", err)
+		}
+	}
+
+	finalPath, err := BurnSubtitleWithBackground(mergedPath, srtPath, videoDir, settings.SubtitleColor, settings.SubtitleBgColor, profile)
+	if err != nil {
+		log.Printf("SRT burn failed, trying ASS method: %v", err)
+		finalPath, err = BurnSubtitleWithASS(mergedPath, srtPath, videoDir, settings.SubtitleColor, settings.SubtitleBgColor, profile)
+		if err != nil {
+			return nil, fmt.Errorf("subtitle burn failed: %v", err)
+		}
+	}
+	result.FinalVideoPath = finalPath
+
+	// Render thành công thì bản nháp đã được áp dụng
+	if err := os.Remove(cueDraftPath(history)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove cue draft: %v", err)
+	}
+	return result, nil
+}
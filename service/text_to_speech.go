@@ -349,17 +349,39 @@ func ConvertSRTToSpeechWithLanguage(srtContent string, videoDir string, speaking
 
 // ConvertSRTToSpeechWithLanguageAndVoice converts SRT content to speech with specified language and voice
 func ConvertSRTToSpeechWithLanguageAndVoice(srtContent string, videoDir string, speakingRate float64, targetLanguage string, voiceName string) (string, error) {
+	return ConvertSRTToSpeechWithCueVoices(srtContent, videoDir, speakingRate, targetLanguage, voiceName, nil)
+}
+
+// ConvertSRTToSpeechWithCueVoices giống ConvertSRTToSpeechWithLanguageAndVoice, cue có giọng riêng trong cueVoices
+// (diarization, theo số thứ tự cue) được đọc bằng giọng đó
+func ConvertSRTToSpeechWithCueVoices(srtContent string, videoDir string, speakingRate float64, targetLanguage string, voiceName string, cueVoices map[int]string) (string, error) {
+	outputPath, _, err := ConvertSRTToSpeechWithTimingReport(srtContent, videoDir, speakingRate, targetLanguage, voiceName, cueVoices)
+	return outputPath, err
+}
+
+// TTSTimingReport là kết quả căn thời lượng audio TTS vào các cue của một lần convert SRT
+type TTSTimingReport struct {
+	OverflowSegments []TTSMapping `json:"overflow_segments"` // Segment vẫn phải cắt bỏ phần thừa, cần review
+	// Các lần synthesize lại với SpeakingRate cao hơn không có trong cache, là request Google TTS riêng nên phải tính phí
+	RetrySegments   int    `json:"retry_segments"`
+	RetryCharacters int    `json:"retry_characters"`
+	RetryText       string `json:"-"`
+}
+
+// ConvertSRTToSpeechWithTimingReport giống ConvertSRTToSpeechWithCueVoices, trả thêm báo cáo căn chỉnh từng segment
+// (speaking rate, atempo, khoảng lặng đã mượn, phần bị cắt) để đưa vào kết quả job
+func ConvertSRTToSpeechWithTimingReport(srtContent string, videoDir string, speakingRate float64, targetLanguage string, voiceName string, cueVoices map[int]string) (string, *TTSTimingReport, error) {
 	// Clean SRT content first
 	srtContent = cleanSRTContent(srtContent)
 
 	// Parse SRT content
 	entries, err := parseSRT(srtContent)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse SRT: %v", err)
+		return "", nil, fmt.Errorf("failed to parse SRT: %v", err)
 	}
 
 	if len(entries) == 0 {
-		return "", fmt.Errorf("no entries found in SRT content")
+		return "", nil, fmt.Errorf("no entries found in SRT content")
 	}
 
 	// Create output file path
@@ -375,7 +397,7 @@ func ConvertSRTToSpeechWithLanguageAndVoice(srtContent string, videoDir string,
 	client, err := texttospeech.NewClient(ctx, option.WithCredentialsFile(credsPath))
 	if err != nil {
 		log.Printf("Failed to create TTS client: %v", err)
-		return "", fmt.Errorf("failed to create TTS client: %v", err)
+		return "", nil, fmt.Errorf("failed to create TTS client: %v", err)
 	}
 	defer client.Close()
 	log.Printf("Google TTS client created successfully")
@@ -387,15 +409,27 @@ func ConvertSRTToSpeechWithLanguageAndVoice(srtContent string, videoDir string,
 	// Create a temporary directory for segment files
 	tempDir, err := os.MkdirTemp("", "tts_segments")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %v", err)
+		return "", nil, fmt.Errorf("failed to create temp directory: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
 
+	// Theo dõi kết quả căn chỉnh từng segment (overflow, tempo, khoảng lặng đã mượn), xoá khi trả báo cáo
+	jobID := fmt.Sprintf("srt_tts_%s_%d", filepath.Base(videoDir), time.Now().UnixNano())
+	mappingService := GetTTSMappingService()
+	mappingService.CreateJobMapping(jobID, entries)
+	defer mappingService.CleanupJobMapping(jobID)
+	timingCfg := LoadTTSTimingConfig()
+	report := &TTSTimingReport{}
+	var retryTexts []string
+	cache := GetCacheService()
+
 	// TTS từng đoạn, căn chỉnh duration, adelay
 	var delayedFiles []string
+	prevEnd := 0.0 // Thời điểm kết thúc thực tế của audio segment trước
 	log.Printf("Processing %d SRT entries for TTS", len(entries))
 	for i, entry := range entries {
 		log.Printf("Processing segment %d: '%s' (%.2f -> %.2f)", i, entry.Text, entry.Start, entry.End)
+		segmentStart := time.Now()
 
 		// Clean text trước khi gửi lên TTS
 		cleanText := strings.TrimSpace(entry.Text)
@@ -406,126 +440,112 @@ func ConvertSRTToSpeechWithLanguageAndVoice(srtContent string, videoDir string,
 
 		log.Printf("Segment %d: Sending to TTS: '%s'", i, cleanText)
 
-		// TTS đoạn
-		req := texttospeechpb.SynthesizeSpeechRequest{
-			Input: &texttospeechpb.SynthesisInput{
-				InputSource: &texttospeechpb.SynthesisInput_Text{Text: cleanText},
-			},
-			Voice: &texttospeechpb.VoiceSelectionParams{
-				LanguageCode: languageCode,
-				Name:         selectedVoiceName,
-			},
-			AudioConfig: &texttospeechpb.AudioConfig{
-				AudioEncoding:   texttospeechpb.AudioEncoding_MP3,
-				SpeakingRate:    speakingRate,
-				SampleRateHertz: 44100,
-			},
+		// Cue có người nói riêng thì đọc bằng giọng của người nói đó
+		cueLanguageCode, cueVoiceName := languageCode, selectedVoiceName
+		if voice := cueVoices[entry.Index]; voice != "" {
+			cueLanguageCode, cueVoiceName = getVoiceForLanguageWithSelection(targetLanguage, voice)
 		}
-		resp, err := client.SynthesizeSpeech(ctx, &req)
+
+		expectedDuration := entry.End - entry.Start
+		usedRate := speakingRate
+		wavSegmentFile, actualDuration, err := synthesizeSegmentWAV(ctx, client, cleanText, cueLanguageCode, cueVoiceName, usedRate, tempDir, fmt.Sprintf("%d", i))
 		if err != nil {
-			return "", fmt.Errorf("failed to synthesize speech for segment %d: %v", i, err)
+			return "", nil, fmt.Errorf("segment %d: %v", i, err)
 		}
-		segmentFile := filepath.Join(tempDir, fmt.Sprintf("segment_%d.mp3", i))
-		if err := os.WriteFile(segmentFile, resp.AudioContent, 0644); err != nil {
-			return "", fmt.Errorf("failed to save segment %d: %v", i, err)
+
+		// Audio dài hơn cue: synthesize lại với SpeakingRate cao hơn trước khi xử lý bằng atempo
+		rateRetries := 0
+		for actualDuration > expectedDuration+timingCfg.Tolerance && rateRetries < timingCfg.RateRetries {
+			nextRate, ok := timingCfg.nextSpeakingRate(usedRate, actualDuration, expectedDuration)
+			if !ok {
+				break
+			}
+			rateRetries++
+			log.Printf("Segment %d: %.2fs > %.2fs, retrying with speaking rate %.2f", i, actualDuration, expectedDuration, nextRate)
+			if !cache.HasCachedTTSSegment(TTSProviderGoogle, cleanText, cueVoiceName, cueLanguageCode, nextRate) {
+				report.RetrySegments++
+				report.RetryCharacters += len([]rune(cleanText))
+				retryTexts = append(retryTexts, cleanText)
+			}
+			retryFile, retryDuration, err := synthesizeSegmentWAV(ctx, client, cleanText, cueLanguageCode, cueVoiceName, nextRate, tempDir, fmt.Sprintf("%d_r%d", i, rateRetries))
+			if err != nil {
+				log.Printf("Segment %d: retry synthesis failed, keeping previous audio: %v", i, err)
+				break
+			}
+			wavSegmentFile, actualDuration, usedRate = retryFile, retryDuration, nextRate
 		}
-		// Convert to WAV
-		wavSegmentFile := filepath.Join(tempDir, fmt.Sprintf("segment_%d.wav", i))
-		cmd := exec.Command("ffmpeg",
-			"-i", segmentFile,
-			"-af", "volume=2.0",
-			"-ar", "44100",
-			"-ac", "2",
-			"-acodec", "pcm_s16le",
-			"-y",
-			wavSegmentFile)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("FFmpeg segment conversion error: %s", string(output))
-			return "", fmt.Errorf("failed to convert segment %d to WAV: %v", i, err)
+
+		// Khoảng lặng có thể mượn: trước cue (sau audio thực tế của segment trước) và sau cue (trước cue kế tiếp)
+		gapBefore := entry.Start - math.Max(prevEnd, 0)
+		gapAfter := 0.0
+		if i < len(entries)-1 {
+			gapAfter = entries[i+1].Start - entry.End
+		} else {
+			gapAfter = timingCfg.MaxLeadIn + timingCfg.GapPadding
 		}
-		// Get actual duration
-		cmd = exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", wavSegmentFile)
-		durationStr, err := cmd.Output()
-		if err != nil {
-			return "", fmt.Errorf("failed to get audio duration for segment %d: %v", i, err)
+		fit := timingCfg.fitSegment(actualDuration, expectedDuration, gapBefore, gapAfter)
+		if fit.Tempo > 1.0 || fit.BorrowedBefore > 0 || fit.BorrowedAfter > 0 {
+			log.Printf("Segment %d: fitted %.2fs into %.2fs (tempo=%.2f, borrowed before=%.2fs, after=%.2fs)",
+				i, actualDuration, expectedDuration, fit.Tempo, fit.BorrowedBefore, fit.BorrowedAfter)
 		}
-		actualDuration, err := strconv.ParseFloat(strings.TrimSpace(string(durationStr)), 64)
-		if err != nil {
-			return "", fmt.Errorf("failed to parse audio duration for segment %d: %v", i, err)
+		if fit.Overflow > 0 {
+			log.Printf("⚠️ Segment %d: trimmed %.2fs overflow after rate retry and time-stretch (speaking rate %.2f, %d retries)", i, fit.Overflow, usedRate, rateRetries)
 		}
-		expectedDuration := entry.End - entry.Start
+
 		adjustedWavFile := wavSegmentFile
-		if math.Abs(actualDuration-expectedDuration) > 0.05 {
+		if fit.Tempo > 1.0 || fit.Overflow > 0 || actualDuration < expectedDuration-timingCfg.Tolerance {
 			adjustedWavFile = filepath.Join(tempDir, fmt.Sprintf("adjusted_segment_%d.wav", i))
-			if actualDuration < expectedDuration {
-				// Add silence
-				silenceDuration := expectedDuration - actualDuration
-				silenceFile := filepath.Join(tempDir, fmt.Sprintf("silence_%d.wav", i))
-				cmd := exec.Command("ffmpeg",
-					"-f", "lavfi",
-					"-i", fmt.Sprintf("anullsrc=r=44100:cl=stereo:d=%f", silenceDuration),
-					"-ar", "44100",
-					"-ac", "2",
-					"-acodec", "pcm_s16le",
-					"-y",
-					silenceFile)
-				output, err := cmd.CombinedOutput()
-				if err != nil {
-					log.Printf("FFmpeg silence creation error: %s", string(output))
-					return "", fmt.Errorf("failed to create silence for segment %d: %v", i, err)
-				}
-				// Concatenate segment with silence
-				cmd = exec.Command("ffmpeg",
-					"-i", wavSegmentFile,
-					"-i", silenceFile,
-					"-filter_complex", "[0:a][1:a]concat=n=2:v=0:a=1[a]",
-					"-map", "[a]",
-					"-ar", "44100",
-					"-ac", "2",
-					"-acodec", "pcm_s16le",
-					"-y",
-					adjustedWavFile)
-				output, err = cmd.CombinedOutput()
-				if err != nil {
-					log.Printf("FFmpeg concat error: %s", string(output))
-					return "", fmt.Errorf("failed to concat segment %d with silence: %v", i, err)
-				}
-			} else {
-				// Trim segment
-				cmd := exec.Command("ffmpeg",
-					"-i", wavSegmentFile,
-					"-t", fmt.Sprintf("%f", expectedDuration),
-					"-ar", "44100",
-					"-ac", "2",
-					"-acodec", "pcm_s16le",
-					"-y",
-					adjustedWavFile)
-				output, err := cmd.CombinedOutput()
-				if err != nil {
-					log.Printf("FFmpeg trim error: %s", string(output))
-					return "", fmt.Errorf("failed to trim segment %d: %v", i, err)
-				}
+			if err := applySegmentFit(wavSegmentFile, adjustedWavFile, fit, expectedDuration); err != nil {
+				return "", nil, fmt.Errorf("segment %d: %v", i, err)
 			}
 		}
+
+		mappingService.UpdateSegmentMapping(jobID, i, map[string]interface{}{
+			"audio_duration":  actualDuration,
+			"adjusted_path":   adjustedWavFile,
+			"speaking_rate":   usedRate,
+			"rate_retries":    rateRetries,
+			"tempo_factor":    fit.Tempo,
+			"borrowed_before": fit.BorrowedBefore,
+			"borrowed_after":  fit.BorrowedAfter,
+			"overflow":        fit.Overflow,
+			"processing_time": time.Since(segmentStart),
+		})
+
+		startAt := entry.Start - fit.BorrowedBefore
+		prevEnd = startAt + math.Max(fit.FinalDuration, expectedDuration)
+
 		// Dùng adelay để căn đúng thời điểm bắt đầu
 		delayedFile := filepath.Join(tempDir, fmt.Sprintf("delayed_%d.wav", i))
-		cmd = exec.Command("ffmpeg",
+		cmd := exec.Command("ffmpeg",
 			"-i", adjustedWavFile,
-			"-af", fmt.Sprintf("adelay=%d|%d", int(entry.Start*1000), int(entry.Start*1000)),
+			"-af", fmt.Sprintf("adelay=%d|%d", int(startAt*1000), int(startAt*1000)),
 			"-ar", "44100",
 			"-ac", "2",
 			"-acodec", "pcm_s16le",
 			"-y",
 			delayedFile)
-		output, err = cmd.CombinedOutput()
+		output, err := cmd.CombinedOutput()
 		if err != nil {
 			log.Printf("FFmpeg delay error for segment %d: %s", i, string(output))
-			return "", fmt.Errorf("failed to delay segment %d: %v", i, err)
+			return "", nil, fmt.Errorf("failed to delay segment %d: %v", i, err)
 		}
 		delayedFiles = append(delayedFiles, delayedFile)
 	}
 
+	report.OverflowSegments = mappingService.GetOverflowSegments(jobID)
+	report.RetryText = strings.Join(retryTexts, "\n")
+	if report.RetrySegments > 0 {
+		log.Printf("TTS job %s: %d speaking-rate retries synthesized (%d chars billed)", jobID, report.RetrySegments, report.RetryCharacters)
+	}
+	for i := range report.OverflowSegments {
+		// File căn chỉnh nằm trong tempDir đã bị xoá khi trả về
+		report.OverflowSegments[i].AdjustedPath = ""
+	}
+	if len(report.OverflowSegments) > 0 {
+		log.Printf("⚠️ TTS job %s: %d/%d segment(s) trimmed, review overflow_segments", jobID, len(report.OverflowSegments), len(entries))
+	}
+
 	// Mix all delayed files
 	if len(delayedFiles) > 0 {
 		args := []string{"-i"}
@@ -547,13 +567,52 @@ func ConvertSRTToSpeechWithLanguageAndVoice(srtContent string, videoDir string,
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			log.Printf("FFmpeg final mix error: %s", string(output))
-			return "", fmt.Errorf("failed to create final TTS audio: %v", err)
+			return "", nil, fmt.Errorf("failed to create final TTS audio: %v", err)
 		}
 		log.Printf("TTS audio created successfully: %s", outputPath)
-		return outputPath, nil
+		return outputPath, report, nil
 	} else {
-		return "", fmt.Errorf("no valid segments processed")
+		return "", nil, fmt.Errorf("no valid segments processed")
+	}
+}
+
+// synthesizeSegmentWAV gọi Google TTS cho một đoạn text, chuyển sang WAV và trả về đường dẫn cùng thời lượng thực tế
+// Audio MP3 được cache theo (text, giọng, ngôn ngữ, tốc độ) để dùng lại giữa các job
+func synthesizeSegmentWAV(ctx context.Context, client *texttospeech.Client, text, languageCode, voiceName string, speakingRate float64, tempDir, suffix string) (string, float64, error) {
+	audioContent, _, err := synthesizeWithCache(ctx, client, text, languageCode, voiceName, speakingRate)
+	if err != nil {
+		return "", 0, err
+	}
+	segmentFile := filepath.Join(tempDir, fmt.Sprintf("segment_%s.mp3", suffix))
+	if err := os.WriteFile(segmentFile, audioContent, 0644); err != nil {
+		return "", 0, fmt.Errorf("failed to save segment: %v", err)
+	}
+	// Convert to WAV
+	wavSegmentFile := filepath.Join(tempDir, fmt.Sprintf("segment_%s.wav", suffix))
+	cmd := exec.Command("ffmpeg",
+		"-i", segmentFile,
+		"-af", "volume=2.0",
+		"-ar", "44100",
+		"-ac", "2",
+		"-acodec", "pcm_s16le",
+		"-y",
+		wavSegmentFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg segment conversion error: %s", string(output))
+		return "", 0, fmt.Errorf("failed to convert segment to WAV: %v", err)
+	}
+	// Get actual duration
+	cmd = exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", wavSegmentFile)
+	durationStr, err := cmd.Output()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get audio duration: %v", err)
+	}
+	actualDuration, err := strconv.ParseFloat(strings.TrimSpace(string(durationStr)), 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse audio duration: %v", err)
 	}
+	return wavSegmentFile, actualDuration, nil
 }
 
 // processSegmentsProgressive xử lý segments lớn bằng cách mix từng phần
@@ -996,30 +1055,18 @@ func processIndividualTTS(client *texttospeech.Client, ctx context.Context, entr
 		// Get voice settings for target language
 		languageCode, voiceName := getVoiceForLanguage(targetLanguage)
 
-		// Convert text to speech
-		req := texttospeechpb.SynthesizeSpeechRequest{
-			Input: &texttospeechpb.SynthesisInput{
-				InputSource: &texttospeechpb.SynthesisInput_Text{Text: entry.Text},
-			},
-			Voice: &texttospeechpb.VoiceSelectionParams{
-				LanguageCode: languageCode,
-				Name:         voiceName,
-			},
-			AudioConfig: &texttospeechpb.AudioConfig{
-				AudioEncoding:   texttospeechpb.AudioEncoding_MP3,
-				SpeakingRate:    speakingRate,
-				SampleRateHertz: 44100,
-			},
-		}
-
-		resp, err := client.SynthesizeSpeech(ctx, &req)
+		// Convert text to speech (ưu tiên audio đã cache của segment)
+		audioContent, cacheHit, err := synthesizeWithCache(ctx, client, entry.Text, languageCode, voiceName, speakingRate)
 		if err != nil {
 			return nil, fmt.Errorf("failed to synthesize speech for segment %d: %v", i, err)
 		}
+		if cacheHit {
+			log.Printf("Segment %d served from TTS cache", i)
+		}
 
 		// Save segment to temporary file
 		segmentFile := filepath.Join(tempDir, fmt.Sprintf("segment_%d.mp3", i))
-		if err := os.WriteFile(segmentFile, resp.AudioContent, 0644); err != nil {
+		if err := os.WriteFile(segmentFile, audioContent, 0644); err != nil {
 			return nil, fmt.Errorf("failed to save segment %d: %v", i, err)
 		}
 		// Log đường dẫn, kích thước, thời lượng file mp3 gốc Google trả về
@@ -1150,14 +1197,15 @@ func mergeSegments(segments []SRTEntry) SRTEntry {
 }
 
 // ConvertSRTToSpeechWithService wrapper function that uses service_config to determine which TTS service to use
-func ConvertSRTToSpeechWithService(srtContent string, videoDir string, speakingRate float64, targetLanguage string, serviceName string, modelAPIName string) (string, error) {
+// Trả kèm báo cáo căn thời lượng từng segment (segment bị cắt phần thừa)
+func ConvertSRTToSpeechWithService(srtContent string, videoDir string, speakingRate float64, targetLanguage string, serviceName string, modelAPIName string) (string, *TTSTimingReport, error) {
 	// Currently only Google TTS (tts_wavenet) is supported for text_to_speech
 	if serviceName == "tts_wavenet" {
-		return ConvertSRTToSpeechWithLanguage(srtContent, videoDir, speakingRate, targetLanguage)
+		return ConvertSRTToSpeechWithTimingReport(srtContent, videoDir, speakingRate, targetLanguage, "", nil)
 	}
 
 	// For future services, we can add more conditions here
 	// Example: if serviceName == "azure_tts" { return ConvertSRTToSpeechWithAzure(srtContent, videoDir, speakingRate, targetLanguage, modelAPIName) }
 
-	return "", fmt.Errorf("unsupported text-to-speech service: %s", serviceName)
+	return "", nil, fmt.Errorf("unsupported text-to-speech service: %s", serviceName)
 }
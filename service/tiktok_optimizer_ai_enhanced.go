@@ -3,11 +3,13 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // AITikTokOptimizer sử dụng AI để tạo nội dung đa ngôn ngữ và trending
 type AITikTokOptimizer struct {
-	apiKey string
+	apiKey         string
+	sourceLanguage string // Ngôn ngữ gốc của video (mã ISO), rỗng = không xác định
 }
 
 // NewAITikTokOptimizer tạo instance mới
@@ -98,7 +100,7 @@ THÔNG TIN VIDEO:
 - Transcript: %s
 - Loại nội dung: %s
 - Thời lượng: %.1f giây
-- Ngôn ngữ mục tiêu: %s
+- Ngôn ngữ mục tiêu: %s%s
 
 YÊU CẦU TẠO NỘI DUNG (TRẢ VỀ JSON):
 
@@ -125,11 +127,25 @@ TRẢ VỀ CHỈ JSON, KHÔNG CÓ TEXT KHÁC:
   "suggested_caption": "Caption tối ưu...",
   "trending_hashtags": ["#hashtag1", "#hashtag2"],
   "trending_topics": ["Topic 1", "Topic 2", "Topic 3"]
-}`, languageName, transcript, category, duration, languageName, languageName, languageName, languageName, languageName, languageName, languageName, languageName, languageName, languageName)
+}`, languageName, transcript, category, duration, languageName, a.sourceLanguageNote(targetLanguage), languageName, languageName, languageName, languageName, languageName, languageName, languageName, languageName, languageName)
 
 	return prompt
 }
 
+// sourceLanguageNote mô tả ngôn ngữ gốc của transcript trong prompt, nhắc AI bản địa hoá thay vì dịch sát khi khác ngôn ngữ mục tiêu
+func (a *AITikTokOptimizer) sourceLanguageNote(targetLanguage string) string {
+	clause := sourceLanguageClause(a.sourceLanguage)
+	if clause == "" {
+		return ""
+	}
+	note := "\n- Ngôn ngữ gốc của video: " + strings.TrimPrefix(clause, " từ ")
+	if !IsSameLanguage(a.sourceLanguage, targetLanguage) {
+		note += " (transcript khác ngôn ngữ mục tiêu: hãy bản địa hoá nội dung cho khán giả %s, không dịch sát từng chữ)"
+		note = fmt.Sprintf(note, getLanguageNameForAI(targetLanguage))
+	}
+	return note
+}
+
 // getLanguageNameForAI trả về tên ngôn ngữ cho AI prompt
 func getLanguageNameForAI(language string) string {
 	languageNames := map[string]string{
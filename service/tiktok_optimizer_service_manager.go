@@ -130,8 +130,9 @@ func (t *TikTokServiceManager) CreateOptimizer(apiKey string) *AITikTokOptimizer
 	return NewAITikTokOptimizer(apiKey)
 }
 
-// GenerateOptimizedContentWithConfig tạo nội dung tối ưu với cấu hình đầy đủ
-func (t *TikTokServiceManager) GenerateOptimizedContentWithConfig(transcript, category, targetLanguage string, duration float64, apiKey string) (*LocalizedTikTokContent, error) {
+// GenerateOptimizedContentWithConfig tạo nội dung tối ưu với cấu hình đầy đủ.
+// sourceLanguage là ngôn ngữ gốc của video; targetLanguage rỗng thì tạo nội dung bằng chính ngôn ngữ gốc
+func (t *TikTokServiceManager) GenerateOptimizedContentWithConfig(transcript, category, sourceLanguage, targetLanguage string, duration float64, apiKey string) (*LocalizedTikTokContent, error) {
 	// Lấy cấu hình dịch vụ
 	serviceConfig, err := t.GetTikTokServiceConfig()
 	if err != nil {
@@ -140,6 +141,10 @@ func (t *TikTokServiceManager) GenerateOptimizedContentWithConfig(transcript, ca
 	_ = serviceConfig
 	// Tạo optimizer (chỉ dùng AI)
 	optimizer := t.CreateOptimizer(apiKey)
+	optimizer.sourceLanguage = sourceLanguage
+	if targetLanguage == "" {
+		targetLanguage = sourceLanguage
+	}
 
 	// Generate content bằng AI
 	content, err := optimizer.GenerateLocalizedContent(transcript, category, targetLanguage, duration)
@@ -0,0 +1,491 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+
+	"creator-tool-backend/config"
+	"creator-tool-backend/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Ngưỡng similarity mặc định để coi là fuzzy match
+	DefaultTranslationMemoryThreshold = 0.9
+	// Câu ngắn hơn ngưỡng này chỉ dùng exact match ("Go." và "No." giống nhau 67% nhưng nghĩa khác hẳn)
+	minFuzzyMatchRunes = 10
+	// Số bản ghi tối đa đem ra so fuzzy cho mỗi job
+	maxFuzzyCandidates = 2000
+)
+
+type TranslationMemoryService struct {
+	db *gorm.DB
+}
+
+func NewTranslationMemoryService(db *gorm.DB) *TranslationMemoryService {
+	return &TranslationMemoryService{db: db}
+}
+
+// TranslationMemoryPair là một cặp câu nguồn → câu dịch để lưu vào memory
+type TranslationMemoryPair struct {
+	SourceText string
+	TargetText string
+}
+
+// TranslationMemoryMatch là kết quả tra memory cho một cue
+type TranslationMemoryMatch struct {
+	MemoryID   uint
+	TargetText string
+	Similarity float64
+	Exact      bool
+}
+
+// normalizeMemoryText chuẩn hoá câu để so khớp: chữ thường, gộp khoảng trắng, bỏ dấu câu ở hai đầu
+func normalizeMemoryText(text string) string {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	return strings.TrimFunc(text, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+}
+
+func memoryTextHash(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// memorySimilarity tính độ giống nhau 0..1 theo khoảng cách Levenshtein trên rune
+func memorySimilarity(a, b []rune) float64 {
+	maxLen := len(a)
+	if len(b) > maxLen {
+		maxLen = len(b)
+	}
+	if maxLen == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(min(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return 1 - float64(prev[len(b)])/float64(maxLen)
+}
+
+// Lookup tra memory cho danh sách câu nguồn, trả về map vị trí câu → match (exact trước, fuzzy sau)
+func (s *TranslationMemoryService) Lookup(userID uint, sourceLanguage, targetLanguage string, texts []string, threshold float64) (map[int]TranslationMemoryMatch, error) {
+	matches := make(map[int]TranslationMemoryMatch)
+	if len(texts) == 0 {
+		return matches, nil
+	}
+	if threshold <= 0 || threshold > 1 {
+		threshold = DefaultTranslationMemoryThreshold
+	}
+
+	normalized := make([]string, len(texts))
+	hashes := make([]string, 0, len(texts))
+	for i, text := range texts {
+		normalized[i] = normalizeMemoryText(text)
+		if normalized[i] != "" {
+			hashes = append(hashes, memoryTextHash(normalized[i]))
+		}
+	}
+	if len(hashes) == 0 {
+		return matches, nil
+	}
+
+	// Memory lưu trước khi có nhận diện ngôn ngữ nguồn có source_language rỗng, vẫn dùng lại được
+	sourceLanguages := []string{sourceLanguage}
+	if sourceLanguage != "" {
+		sourceLanguages = append(sourceLanguages, "")
+	}
+
+	// Exact match theo hash
+	var exact []model.TranslationMemory
+	if err := s.db.Where("user_id = ? AND source_language IN ? AND target_language = ? AND source_hash IN ?",
+		userID, sourceLanguages, targetLanguage, hashes).Find(&exact).Error; err != nil {
+		return nil, fmt.Errorf("failed to query translation memory: %v", err)
+	}
+	// Nhiều dòng cùng hash (khác source_language): ưu tiên câu user sửa tay, sau đó đúng ngôn ngữ nguồn
+	byHash := make(map[string]model.TranslationMemory, len(exact))
+	for _, entry := range exact {
+		if current, ok := byHash[entry.SourceHash]; ok && !preferMemoryEntry(entry, current, sourceLanguage) {
+			continue
+		}
+		byHash[entry.SourceHash] = entry
+	}
+
+	var fuzzyIndexes []int
+	for i, text := range normalized {
+		if text == "" {
+			continue
+		}
+		if entry, ok := byHash[memoryTextHash(text)]; ok {
+			matches[i] = TranslationMemoryMatch{MemoryID: entry.ID, TargetText: entry.TargetText, Similarity: 1, Exact: true}
+			continue
+		}
+		if len([]rune(text)) >= minFuzzyMatchRunes {
+			fuzzyIndexes = append(fuzzyIndexes, i)
+		}
+	}
+
+	// Fuzzy match với các câu hay dùng nhất của user
+	if len(fuzzyIndexes) > 0 {
+		var candidates []model.TranslationMemory
+		if err := s.db.Where("user_id = ? AND source_language IN ? AND target_language = ?", userID, sourceLanguages, targetLanguage).
+			Order("use_count DESC, updated_at DESC").Limit(maxFuzzyCandidates).Find(&candidates).Error; err != nil {
+			return nil, fmt.Errorf("failed to query translation memory candidates: %v", err)
+		}
+		candidateRunes := make([][]rune, len(candidates))
+		for i, candidate := range candidates {
+			candidateRunes[i] = []rune(normalizeMemoryText(candidate.SourceText))
+		}
+
+		for _, i := range fuzzyIndexes {
+			textRunes := []rune(normalized[i])
+			best := TranslationMemoryMatch{}
+			for j, candidate := range candidates {
+				// Lọc theo độ dài trước khi tính Levenshtein
+				longer := max(len(textRunes), len(candidateRunes[j]))
+				if float64(abs(len(textRunes)-len(candidateRunes[j]))) > (1-threshold)*float64(longer) {
+					continue
+				}
+				similarity := memorySimilarity(textRunes, candidateRunes[j])
+				if similarity >= threshold && similarity > best.Similarity {
+					best = TranslationMemoryMatch{MemoryID: candidate.ID, TargetText: candidate.TargetText, Similarity: similarity}
+				}
+			}
+			if best.MemoryID != 0 {
+				matches[i] = best
+			}
+		}
+	}
+
+	// Tăng use_count để câu hay dùng được ưu tiên khi so fuzzy
+	if len(matches) > 0 {
+		ids := make([]uint, 0, len(matches))
+		for _, match := range matches {
+			ids = append(ids, match.MemoryID)
+		}
+		if err := s.db.Model(&model.TranslationMemory{}).Where("id IN ?", ids).
+			UpdateColumn("use_count", gorm.Expr("use_count + 1")).Error; err != nil {
+			log.Printf("Failed to update translation memory use count: %v", err)
+		}
+	}
+
+	return matches, nil
+}
+
+// preferMemoryEntry cho biết candidate có nên thay current khi cả hai khớp cùng một câu nguồn
+func preferMemoryEntry(candidate, current model.TranslationMemory, sourceLanguage string) bool {
+	if (candidate.Origin == "edit") != (current.Origin == "edit") {
+		return candidate.Origin == "edit"
+	}
+	return candidate.SourceLanguage == sourceLanguage && current.SourceLanguage != sourceLanguage
+}
+
+// Store lưu các cặp câu vào memory. Bản dịch từ job không ghi đè câu user đã sửa tay (origin = edit)
+func (s *TranslationMemoryService) Store(userID uint, sourceLanguage, targetLanguage string, pairs []TranslationMemoryPair, origin string) error {
+	entries := make([]model.TranslationMemory, 0, len(pairs))
+	seen := make(map[string]bool)
+	for _, pair := range pairs {
+		normalized := normalizeMemoryText(pair.SourceText)
+		targetText := strings.TrimSpace(pair.TargetText)
+		if normalized == "" || targetText == "" {
+			continue
+		}
+		hash := memoryTextHash(normalized)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		entries = append(entries, model.TranslationMemory{
+			UserID:         userID,
+			SourceLanguage: sourceLanguage,
+			TargetLanguage: targetLanguage,
+			SourceHash:     hash,
+			SourceText:     strings.TrimSpace(pair.SourceText),
+			TargetText:     targetText,
+			Origin:         origin,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	updates := clause.AssignmentColumns([]string{"source_text", "target_text", "origin", "updated_at"})
+	if origin != "edit" {
+		updates = clause.Set{
+			{Column: clause.Column{Name: "target_text"}, Value: gorm.Expr("IF(origin = 'edit', target_text, VALUES(target_text))")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("VALUES(updated_at)")},
+		}
+	}
+
+	if err := s.db.Clauses(clause.OnConflict{DoUpdates: updates}).CreateInBatches(entries, 200).Error; err != nil {
+		return fmt.Errorf("failed to store translation memory: %v", err)
+	}
+	return nil
+}
+
+// PairSRTForMemory ghép cue nguồn và cue dịch theo thứ tự, bỏ qua nếu số cue lệch nhau
+func PairSRTForMemory(sourceSRT, translatedSRT string) []TranslationMemoryPair {
+	sourceEntries, err := parseSRT(sourceSRT)
+	if err != nil {
+		return nil
+	}
+	translatedEntries, err := parseSRT(translatedSRT)
+	if err != nil {
+		return nil
+	}
+	if len(sourceEntries) != len(translatedEntries) {
+		log.Printf("Translation memory: cue count mismatch (%d vs %d), skip storing", len(sourceEntries), len(translatedEntries))
+		return nil
+	}
+
+	pairs := make([]TranslationMemoryPair, len(sourceEntries))
+	for i := range sourceEntries {
+		pairs[i] = TranslationMemoryPair{SourceText: sourceEntries[i].Text, TargetText: translatedEntries[i].Text}
+	}
+	return pairs
+}
+
+// TranslationMemoryContext gắn memory của user vào một lần dịch và gom thống kê để báo cáo
+type TranslationMemoryContext struct {
+	UserID         uint
+	SourceLanguage string
+	TargetLanguage string
+	Threshold      float64
+
+	mutex        sync.Mutex
+	stats        model.TranslationMemoryStats
+	reusedSource strings.Builder
+	reusedTarget strings.Builder
+	prefilled    map[string]bool // Câu nguồn (đã chuẩn hoá) lấy từ memory, không lưu lại
+	filled       map[int]string  // Kết quả tra của file đang dịch, fallback sang chunked translation không tra lại
+	looked       bool
+}
+
+// NewTranslationMemoryContext tạo context memory cho job của user, userID = 0 thì không dùng memory
+func NewTranslationMemoryContext(userID uint, sourceLanguage, targetLanguage string) *TranslationMemoryContext {
+	if userID == 0 {
+		return nil
+	}
+	return &TranslationMemoryContext{
+		UserID:         userID,
+		SourceLanguage: sourceLanguage,
+		TargetLanguage: targetLanguage,
+		Threshold:      DefaultTranslationMemoryThreshold,
+		prefilled:      make(map[string]bool),
+	}
+}
+
+// Match tra memory cho các cue, trả về map SRTEntry.Index → câu dịch. Mỗi context chỉ tra một lần
+func (m *TranslationMemoryContext) Match(entries []SRTEntry) map[int]string {
+	if m == nil || len(entries) == 0 {
+		return nil
+	}
+	m.mutex.Lock()
+	if m.looked {
+		defer m.mutex.Unlock()
+		return m.filled
+	}
+	m.looked = true
+	m.mutex.Unlock()
+
+	texts := make([]string, len(entries))
+	for i, entry := range entries {
+		texts[i] = entry.Text
+	}
+	matches, err := NewTranslationMemoryService(config.Db).Lookup(m.UserID, m.SourceLanguage, m.TargetLanguage, texts, m.Threshold)
+	if err != nil {
+		log.Printf("Translation memory lookup failed for user %d: %v", m.UserID, err)
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.stats.TotalCues += len(entries)
+	filled := make(map[int]string, len(matches))
+	for i, match := range matches {
+		entry := entries[i]
+		filled[entry.Index] = match.TargetText
+		if match.Exact {
+			m.stats.ExactMatches++
+		} else {
+			m.stats.FuzzyMatches++
+		}
+		m.stats.CharactersReused += len([]rune(entry.Text))
+		m.reusedSource.WriteString(entry.Text + "\n")
+		m.reusedTarget.WriteString(match.TargetText + "\n")
+		m.prefilled[normalizeMemoryText(entry.Text)] = true
+	}
+	m.filled = filled
+	log.Printf("📚 [TRANSLATION MEMORY] %d/%d cues pre-filled (%d exact, %d fuzzy)",
+		len(matches), len(entries), m.stats.ExactMatches, m.stats.FuzzyMatches)
+	return filled
+}
+
+// Record lưu kết quả dịch của job vào memory, bỏ qua các cue đã lấy từ memory
+func (m *TranslationMemoryContext) Record(sourceSRT, translatedSRT string) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	var pairs []TranslationMemoryPair
+	for _, pair := range PairSRTForMemory(sourceSRT, translatedSRT) {
+		if !m.prefilled[normalizeMemoryText(pair.SourceText)] {
+			pairs = append(pairs, pair)
+		}
+	}
+	m.mutex.Unlock()
+
+	if err := NewTranslationMemoryService(config.Db).Store(m.UserID, m.SourceLanguage, m.TargetLanguage, pairs, "job"); err != nil {
+		log.Printf("Failed to record translation memory for user %d: %v", m.UserID, err)
+	}
+}
+
+// Stats trả về thống kê memory, chi phí tiết kiệm tính theo giá LLM của serviceName (không gồm markup)
+func (m *TranslationMemoryContext) Stats(serviceName string) *model.TranslationMemoryStats {
+	if m == nil {
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.stats
+	if stats.ExactMatches+stats.FuzzyMatches > 0 && serviceName != "" {
+		inCost, outCost, _, _, _, err := NewPricingService().CalculateLLMCostSplit(m.reusedSource.String(), m.reusedTarget.String(), serviceName)
+		if err != nil {
+			log.Printf("Failed to calculate translation memory savings: %v", err)
+		} else {
+			stats.CostSaved = inCost + outCost
+		}
+	}
+	return &stats
+}
+
+// prefillChunksFromMemory điền sẵn câu dịch từ memory vào chunk: chunk chỉ còn các cue chưa có bản dịch,
+// chunk được điền đủ thì đánh dấu Processed để không gửi LLM
+func prefillChunksFromMemory(chunks []*SRTChunk, filled map[int]string) {
+	if len(filled) == 0 {
+		return
+	}
+
+	translator := &SRTChunkedTranslator{}
+	for _, chunk := range chunks {
+		entries, err := parseSRT(chunk.Content)
+		if err != nil {
+			continue
+		}
+
+		var pending []SRTEntry
+		prefilled := make(map[int]string)
+		for _, entry := range entries {
+			if text, ok := filled[entry.Index]; ok {
+				prefilled[entry.Index] = text
+			} else {
+				pending = append(pending, entry)
+			}
+		}
+		if len(prefilled) == 0 {
+			continue
+		}
+
+		chunk.Entries = entries
+		chunk.Prefilled = prefilled
+		if len(pending) == 0 {
+			chunk.Result = translator.createChunkContent(entries)
+			chunk.Processed = true
+			chunk.Error = nil
+			finalizePrefilledChunk(chunk)
+			continue
+		}
+		chunk.Content = translator.createChunkContent(pending)
+		chunk.EntryCount = len(pending)
+	}
+}
+
+// finalizePrefilledChunk ghép câu dịch từ memory với kết quả LLM của các cue còn lại
+func finalizePrefilledChunk(chunk *SRTChunk) {
+	if len(chunk.Prefilled) == 0 || !chunk.Processed {
+		return
+	}
+
+	translated := make(map[int]string)
+	var translatedInOrder []string
+	if results, err := parseSRT(chunk.Result); err == nil {
+		for _, entry := range results {
+			translated[entry.Index] = entry.Text
+			translatedInOrder = append(translatedInOrder, entry.Text)
+		}
+	}
+
+	// LLM đôi khi đánh số lại từ 1: khi đó ghép theo thứ tự các cue còn lại
+	pendingPosition := 0
+	merged := make([]SRTEntry, len(chunk.Entries))
+	for i, entry := range chunk.Entries {
+		merged[i] = entry
+		if text, ok := chunk.Prefilled[entry.Index]; ok {
+			merged[i].Text = text
+			continue
+		}
+		if text, ok := translated[entry.Index]; ok {
+			merged[i].Text = text
+		} else if pendingPosition < len(translatedInOrder) {
+			merged[i].Text = translatedInOrder[pendingPosition]
+		}
+		pendingPosition++
+	}
+
+	chunk.Result = (&SRTChunkedTranslator{}).createChunkContent(merged)
+	chunk.Prefilled = nil
+}
+
+// RecordCueEditsToMemory lưu các cue user sửa tay vào memory (ưu tiên hơn bản dịch của job).
+// Chỉ ghép được câu nguồn khi số cue không đổi so với SRT gốc (không split/merge)
+func RecordCueEditsToMemory(history *config.CaptionHistory, rendered, edited []Segment, targetLanguage string) {
+	if history.OriginalSrtFile == "" || history.OriginalSrtFile == history.SrtFile || targetLanguage == "" {
+		return
+	}
+	original, err := ParseSRTToSegments(history.OriginalSrtFile)
+	if err != nil || len(original) != len(edited) || len(rendered) != len(edited) {
+		return
+	}
+
+	var pairs []TranslationMemoryPair
+	for i := range edited {
+		if strings.TrimSpace(edited[i].Text) != strings.TrimSpace(rendered[i].Text) {
+			pairs = append(pairs, TranslationMemoryPair{SourceText: original[i].Text, TargetText: edited[i].Text})
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+
+	if err := NewTranslationMemoryService(config.Db).Store(history.UserID, history.SourceLanguage, targetLanguage, pairs, "edit"); err != nil {
+		log.Printf("Failed to record cue edits to translation memory for history %d: %v", history.ID, err)
+		return
+	}
+	log.Printf("📚 Recorded %d edited cues to translation memory for history %d", len(pairs), history.ID)
+}
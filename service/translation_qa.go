@@ -0,0 +1,272 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+
+	"creator-tool-backend/model"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	// Giới hạn ký tự/giây để TTS đọc kịp (khớp QUY TẮC 2 trong prompt dịch)
+	translationQAMaxCPS = 17.0
+	// Vượt giới hạn CPS quá hệ số này thì coi là lỗi và dịch lại chunk
+	translationQACPSErrorFactor = 1.5
+	// Lệch timestamp so với SRT gốc (giây)
+	translationQATimingTolerance = 0.05
+	// Câu giữ nguyên y hệt bản gốc và dài hơn ngưỡng này coi là chưa dịch (tên riêng, "OK" thì bỏ qua)
+	translationQAUntranslatedMinRunes = 12
+)
+
+func qaIssueSeverity(issueType string, cps float64) string {
+	if issueType == model.QAIssueCPSExceeded && cps <= translationQAMaxCPS*translationQACPSErrorFactor {
+		return "warning"
+	}
+	return "error"
+}
+
+func hasLetters(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunTranslationQA kiểm tra bản dịch theo từng cue: chưa dịch, vượt CPS, rỗng, trùng lặp, lệch timing
+func RunTranslationQA(source, translated []SRTEntry, sourceLanguage, targetLanguage string) *model.TranslationQAReport {
+	report := &model.TranslationQAReport{
+		SourceLanguage: sourceLanguage,
+		TargetLanguage: targetLanguage,
+		TotalCues:      len(translated),
+		IssueCounts:    make(map[string]int),
+	}
+	addIssue := func(issue model.TranslationQAIssue) {
+		issue.Severity = qaIssueSeverity(issue.Type, issue.CPS)
+		report.Issues = append(report.Issues, issue)
+		report.IssueCounts[issue.Type]++
+	}
+
+	if len(source) != len(translated) {
+		addIssue(model.TranslationQAIssue{
+			Type:    model.QAIssueCountMismatch,
+			Message: fmt.Sprintf("Số cue bản dịch (%d) khác bản gốc (%d)", len(translated), len(source)),
+		})
+	}
+
+	checkLanguage := sourceLanguage != "" && targetLanguage != "" && sourceLanguage != targetLanguage
+	for i, cue := range translated {
+		text := strings.TrimSpace(cue.Text)
+		var src *SRTEntry
+		if i < len(source) {
+			src = &source[i]
+		}
+		issue := model.TranslationQAIssue{CueIndex: i + 1, TranslatedText: text}
+		if src != nil {
+			issue.SourceText = strings.TrimSpace(src.Text)
+		}
+
+		if text == "" {
+			issue.Type = model.QAIssueEmpty
+			issue.Message = "Cue không có nội dung"
+			addIssue(issue)
+			continue
+		}
+
+		if src != nil && checkLanguage && hasLetters(text) {
+			sameAsSource := normalizeMemoryText(text) == normalizeMemoryText(src.Text) && len([]rune(text)) >= translationQAUntranslatedMinRunes
+			cueLanguage := detectLanguageFromText(text)
+			if sameAsSource || (cueLanguage == sourceLanguage && cueLanguage != targetLanguage) {
+				issue.Type = model.QAIssueUntranslated
+				issue.Message = fmt.Sprintf("Cue vẫn còn ngôn ngữ gốc (%s)", sourceLanguage)
+				addIssue(issue)
+			}
+		}
+
+		if duration := cue.End - cue.Start; duration > 0 {
+			cps := float64(len([]rune(text))) / duration
+			if cps > translationQAMaxCPS {
+				cpsIssue := issue
+				cpsIssue.Type = model.QAIssueCPSExceeded
+				cpsIssue.CPS = math.Round(cps*10) / 10
+				cpsIssue.Message = fmt.Sprintf("%.1f ký tự/giây, vượt giới hạn %.0f cho TTS", cps, translationQAMaxCPS)
+				addIssue(cpsIssue)
+			}
+		}
+
+		if i > 0 && src != nil {
+			prevText := strings.TrimSpace(translated[i-1].Text)
+			prevSource := strings.TrimSpace(source[i-1].Text)
+			if normalizeMemoryText(prevText) == normalizeMemoryText(text) && normalizeMemoryText(prevSource) != normalizeMemoryText(src.Text) {
+				dupIssue := issue
+				dupIssue.Type = model.QAIssueDuplicate
+				dupIssue.Message = fmt.Sprintf("Trùng với cue %d trong khi câu gốc khác nhau", i)
+				addIssue(dupIssue)
+			}
+		}
+
+		if src != nil && (math.Abs(cue.Start-src.Start) > translationQATimingTolerance || math.Abs(cue.End-src.End) > translationQATimingTolerance) {
+			timingIssue := issue
+			timingIssue.Type = model.QAIssueTimingDrift
+			timingIssue.Message = fmt.Sprintf("Timestamp %s --> %s lệch so với gốc %s --> %s",
+				formatTime(cue.Start), formatTime(cue.End), formatTime(src.Start), formatTime(src.End))
+			addIssue(timingIssue)
+		}
+	}
+
+	report.Passed = countQAErrors(report) == 0
+	return report
+}
+
+// RunTranslationQAOnSRT chạy QA trên nội dung SRT gốc và SRT đã dịch, ngôn ngữ gốc detect bằng DetectSRTLanguage
+func RunTranslationQAOnSRT(sourceSRT, translatedSRT, targetLanguage string) *model.TranslationQAReport {
+	source, err := parseSRT(sourceSRT)
+	if err != nil {
+		log.Printf("Translation QA: failed to parse source SRT: %v", err)
+		return nil
+	}
+	translated, err := parseSRT(translatedSRT)
+	if err != nil {
+		log.Printf("Translation QA: failed to parse translated SRT: %v", err)
+		return nil
+	}
+	report := RunTranslationQA(source, translated, DetectSRTLanguage(sourceSRT), targetLanguage)
+	log.Printf("Translation QA: %d cues, %d issues (%d errors)", report.TotalCues, len(report.Issues), countQAErrors(report))
+	return report
+}
+
+// MarshalTranslationQA chuyển report sang JSON để lưu vào CaptionHistory.TranslationQA
+func MarshalTranslationQA(report *model.TranslationQAReport) datatypes.JSON {
+	if report == nil {
+		return nil
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil
+	}
+	return datatypes.JSON(data)
+}
+
+func countQAErrors(report *model.TranslationQAReport) int {
+	count := 0
+	for _, issue := range report.Issues {
+		if issue.Severity == "error" {
+			count++
+		}
+	}
+	return count
+}
+
+// formatQAIssuesForPrompt liệt kê lỗi của bản dịch trước để LLM sửa khi dịch lại
+func formatQAIssuesForPrompt(report *model.TranslationQAReport, firstIndex int) string {
+	var sb strings.Builder
+	sb.WriteString("BẢN DỊCH TRƯỚC CỦA PHẦN SRT NÀY BỊ LỖI. HÃY DỊCH LẠI TOÀN BỘ VÀ SỬA CÁC LỖI SAU:\n")
+	for _, issue := range report.Issues {
+		if issue.Severity != "error" || issue.Type == model.QAIssueTimingDrift {
+			continue
+		}
+		switch issue.Type {
+		case model.QAIssueCountMismatch:
+			sb.WriteString("- Số câu trả về không khớp bản gốc: phải giữ đúng từng câu, không gộp, không tách, không bỏ câu nào\n")
+		case model.QAIssueCPSExceeded:
+			sb.WriteString(fmt.Sprintf("- Câu id %d quá dài để đọc kịp (%.1f ký tự/giây), hãy rút gọn: %q\n", firstIndex+issue.CueIndex-1, issue.CPS, issue.TranslatedText))
+		default:
+			sb.WriteString(fmt.Sprintf("- Câu id %d: %s\n", firstIndex+issue.CueIndex-1, issue.Message))
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// restoreSourceTiming khôi phục số thứ tự và timestamp gốc (bất biến theo QUY TẮC 1, LLM sửa sai thì ghi đè lại)
+func restoreSourceTiming(source, translated []SRTEntry) bool {
+	if len(source) != len(translated) {
+		return false
+	}
+	changed := false
+	for i := range translated {
+		if translated[i].Index != source[i].Index || translated[i].Start != source[i].Start || translated[i].End != source[i].End {
+			translated[i].Index = source[i].Index
+			translated[i].Start = source[i].Start
+			translated[i].End = source[i].End
+			changed = true
+		}
+	}
+	return changed
+}
+
+// repairChunksWithQA chạy QA từng chunk sau khi dịch: sửa timestamp lệch và dịch lại chunk còn lỗi mức error.
+// reprompt nhận chunk và ghi chú lỗi, trả về SRT dịch lại của toàn bộ chunk
+func repairChunksWithQA(chunks []*SRTChunk, entries []SRTEntry, targetLanguage string, maxConcurrent int,
+	reprompt func(chunk *SRTChunk, sourceContent, issuesNote string) (string, error)) {
+	if len(entries) == 0 {
+		return
+	}
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+
+	translator := &SRTChunkedTranslator{}
+	sourceLanguage := DetectSRTLanguage(translator.createChunkContent(entries))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, maxConcurrent)
+	for _, chunk := range chunks {
+		if chunk == nil || !chunk.Processed || chunk.EndIndex > len(entries) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(chunk *SRTChunk) {
+			defer wg.Done()
+
+			source := entries[chunk.StartIndex:chunk.EndIndex]
+			translated, err := parseSRT(chunk.Result)
+			if err != nil {
+				return
+			}
+			if restoreSourceTiming(source, translated) {
+				chunk.Result = translator.createChunkContent(translated)
+			}
+
+			report := RunTranslationQA(source, translated, sourceLanguage, targetLanguage)
+			errorCount := countQAErrors(report)
+			if errorCount == 0 {
+				return
+			}
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			log.Printf("🔁 [TRANSLATION QA] Chunk %d có %d lỗi, dịch lại", chunk.ChunkID, errorCount)
+			result, err := reprompt(chunk, translator.createChunkContent(source), formatQAIssuesForPrompt(report, source[0].Index))
+			if err != nil {
+				log.Printf("⚠️ [TRANSLATION QA] Dịch lại chunk %d thất bại: %v", chunk.ChunkID, err)
+				return
+			}
+			repaired, err := parseSRT(result)
+			if err != nil {
+				return
+			}
+			restoreSourceTiming(source, repaired)
+
+			// Chỉ nhận bản dịch lại nếu ít lỗi hơn
+			repairedErrors := countQAErrors(RunTranslationQA(source, repaired, sourceLanguage, targetLanguage))
+			if repairedErrors < errorCount {
+				chunk.Result = translator.createChunkContent(repaired)
+				log.Printf("✅ [TRANSLATION QA] Chunk %d: %d → %d lỗi sau khi dịch lại", chunk.ChunkID, errorCount, repairedErrors)
+			} else {
+				log.Printf("⚠️ [TRANSLATION QA] Chunk %d: dịch lại không cải thiện (%d lỗi), giữ bản cũ", chunk.ChunkID, repairedErrors)
+			}
+		}(chunk)
+	}
+	wg.Wait()
+}
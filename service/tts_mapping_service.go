@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 )
@@ -18,6 +19,13 @@ type TTSMapping struct {
 	PauseBefore    float64       `json:"pause_before"`
 	PauseAfter     float64       `json:"pause_after"`
 	AdjustedPath   string        `json:"adjusted_path"`
+	SpeakingRate   float64       `json:"speaking_rate"`   // SpeakingRate cuối cùng đã dùng (sau khi synthesize lại)
+	RateRetries    int           `json:"rate_retries"`    // Số lần synthesize lại để vừa cue
+	TempoFactor    float64       `json:"tempo_factor"`    // Hệ số atempo đã áp dụng, 1.0 = giữ nguyên
+	BorrowedBefore float64       `json:"borrowed_before"` // Số giây bắt đầu sớm hơn cue
+	BorrowedAfter  float64       `json:"borrowed_after"`  // Số giây kéo dài sang khoảng lặng sau cue
+	Overflow       float64       `json:"overflow"`        // Số giây bị cắt bỏ vì không căn vừa, > 0 cần review
+	CacheHit       bool          `json:"cache_hit"`       // Audio lấy từ cache segment, không gọi API
 	ProcessingTime time.Duration `json:"processing_time"`
 	Error          error         `json:"error,omitempty"`
 	CreatedAt      time.Time     `json:"created_at"`
@@ -135,6 +143,29 @@ func (s *TTSMappingService) UpdateSegmentMapping(jobID string, segmentIndex int,
 			if path, ok := value.(string); ok {
 				mapping.AdjustedPath = path
 			}
+		case "speaking_rate", "tempo_factor", "borrowed_before", "borrowed_after", "overflow":
+			if f, ok := value.(float64); ok {
+				switch key {
+				case "speaking_rate":
+					mapping.SpeakingRate = f
+				case "tempo_factor":
+					mapping.TempoFactor = f
+				case "borrowed_before":
+					mapping.BorrowedBefore = f
+				case "borrowed_after":
+					mapping.BorrowedAfter = f
+				case "overflow":
+					mapping.Overflow = f
+				}
+			}
+		case "rate_retries":
+			if retries, ok := value.(int); ok {
+				mapping.RateRetries = retries
+			}
+		case "cache_hit":
+			if hit, ok := value.(bool); ok {
+				mapping.CacheHit = hit
+			}
 		case "processing_time":
 			if procTime, ok := value.(time.Duration); ok {
 				mapping.ProcessingTime = procTime
@@ -187,6 +218,21 @@ func (s *TTSMappingService) GetJobMapping(jobID string) (map[int]*TTSMapping, er
 	return result, nil
 }
 
+// GetOverflowSegments trả về bản sao các segment bị cắt bỏ phần thừa, sắp xếp theo thứ tự segment để review
+func (s *TTSMappingService) GetOverflowSegments(jobID string) []TTSMapping {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var result []TTSMapping
+	for _, mapping := range s.mappings[jobID] {
+		if mapping.Overflow > 0 {
+			result = append(result, *mapping)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SegmentIndex < result[j].SegmentIndex })
+	return result
+}
+
 // GetJobProgress lấy tiến độ xử lý của một job
 func (s *TTSMappingService) GetJobProgress(jobID string) map[string]interface{} {
 	s.mutex.RLock()
@@ -203,7 +249,11 @@ func (s *TTSMappingService) GetJobProgress(jobID string) map[string]interface{}
 	failedSegments := 0
 	processingSegments := 0
 
+	overflowSegments := 0
 	for _, mapping := range s.mappings[jobID] {
+		if mapping.Overflow > 0 {
+			overflowSegments++
+		}
 		if mapping.Error != nil {
 			failedSegments++
 		} else if mapping.AdjustedPath != "" {
@@ -224,6 +274,7 @@ func (s *TTSMappingService) GetJobProgress(jobID string) map[string]interface{}
 		"completed_segments":  completedSegments,
 		"failed_segments":     failedSegments,
 		"processing_segments": processingSegments,
+		"overflow_segments":   overflowSegments,
 		"progress_percentage": progressPercentage,
 		"status":              s.getJobStatus(completedSegments, failedSegments, totalSegments),
 	}
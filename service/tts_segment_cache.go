@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	texttospeech "cloud.google.com/go/texttospeech/apiv1"
+	"cloud.google.com/go/texttospeech/apiv1/texttospeechpb"
+)
+
+// TTSProviderGoogle là nhà cung cấp TTS hiện tại, là một phần của key cache segment
+const TTSProviderGoogle = "google"
+
+// Số lần đọc cache segment TTS trúng/trượt, đếm ở mọi chỗ synthesize (synthesizeWithCache và OptimizedTTSService)
+var ttsSegmentCacheHits, ttsSegmentCacheMisses int64
+
+// recordTTSSegmentCacheLookup ghi nhận một lần đọc cache segment TTS
+func recordTTSSegmentCacheLookup(hit bool) {
+	if hit {
+		atomic.AddInt64(&ttsSegmentCacheHits, 1)
+	} else {
+		atomic.AddInt64(&ttsSegmentCacheMisses, 1)
+	}
+}
+
+// TTSSegmentCacheStats trả về số hit/miss và tỉ lệ hit của cache segment TTS kể từ khi khởi động
+func TTSSegmentCacheStats() map[string]interface{} {
+	hits := atomic.LoadInt64(&ttsSegmentCacheHits)
+	misses := atomic.LoadInt64(&ttsSegmentCacheMisses)
+	hitRatio := 0.0
+	if hits+misses > 0 {
+		hitRatio = float64(hits) / float64(hits+misses)
+	}
+	return map[string]interface{}{
+		"hits":      hits,
+		"misses":    misses,
+		"hit_ratio": hitRatio,
+	}
+}
+
+// NormalizeTTSText chuẩn hoá text trước khi tạo key cache (bỏ khoảng trắng thừa)
+func NormalizeTTSText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// TTSBillingSplit chia các segment TTS thành phần đã có trong cache (miễn phí) và phần cần gọi API (tính phí)
+type TTSBillingSplit struct {
+	HitSegments      int    `json:"hit_segments"`
+	MissSegments     int    `json:"miss_segments"`
+	CachedCharacters int    `json:"cached_characters"`
+	BilledCharacters int    `json:"billed_characters"`
+	BilledText       string `json:"-"`
+}
+
+// SplitTTSBillingByCache kiểm tra từng cue của SRT với cache segment TTS, chỉ text của các cue chưa có trong cache bị tính phí.
+// Gọi trước khi synthesize để cue vừa được tạo trong job hiện tại vẫn được tính là miss
+func SplitTTSBillingByCache(srtContent, targetLanguage, voiceName string, speakingRate float64, cueVoices map[int]string) TTSBillingSplit {
+	var split TTSBillingSplit
+	entries, err := parseSRT(cleanSRTContent(srtContent))
+	if err != nil {
+		split.BilledText = srtContent
+		split.BilledCharacters = len([]rune(srtContent))
+		return split
+	}
+
+	cache := GetCacheService()
+	var billed []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		text := NormalizeTTSText(entry.Text)
+		if text == "" {
+			continue
+		}
+		// Cue có giọng riêng theo người nói (diarization) được cache theo giọng đó
+		cueVoice := voiceName
+		if voice := cueVoices[entry.Index]; voice != "" {
+			cueVoice = voice
+		}
+		languageCode, selectedVoice := getVoiceForLanguageWithSelection(targetLanguage, cueVoice)
+		seenKey := selectedVoice + "|" + text
+		// Cue trùng nội dung (cùng giọng) trong cùng job chỉ gọi API một lần
+		if seen[seenKey] || cache.HasCachedTTSSegment(TTSProviderGoogle, text, selectedVoice, languageCode, speakingRate) {
+			split.HitSegments++
+			split.CachedCharacters += len([]rune(text))
+			continue
+		}
+		seen[seenKey] = true
+		split.MissSegments++
+		split.BilledCharacters += len([]rune(text))
+		billed = append(billed, text)
+	}
+	split.BilledText = strings.Join(billed, "\n")
+	return split
+}
+
+// AddRateRetries cộng các lần synthesize lại để vừa cue (không có trong cache) vào phần tính phí
+func (split *TTSBillingSplit) AddRateRetries(report *TTSTimingReport) {
+	if report == nil || report.RetrySegments == 0 {
+		return
+	}
+	split.MissSegments += report.RetrySegments
+	split.BilledCharacters += report.RetryCharacters
+	if split.BilledText == "" {
+		split.BilledText = report.RetryText
+	} else {
+		split.BilledText += "\n" + report.RetryText
+	}
+}
+
+// synthesizeWithCache trả về audio MP3 cho một đoạn text, ưu tiên lấy từ cache, chỉ gọi Google TTS khi miss
+func synthesizeWithCache(ctx context.Context, client *texttospeech.Client, text, languageCode, voiceName string, speakingRate float64) ([]byte, bool, error) {
+	cache := GetCacheService()
+	if audio, err := cache.GetCachedTTSSegment(TTSProviderGoogle, text, voiceName, languageCode, speakingRate); err == nil {
+		recordTTSSegmentCacheLookup(true)
+		return audio, true, nil
+	}
+	recordTTSSegmentCacheLookup(false)
+
+	req := texttospeechpb.SynthesizeSpeechRequest{
+		Input: &texttospeechpb.SynthesisInput{
+			InputSource: &texttospeechpb.SynthesisInput_Text{Text: text},
+		},
+		Voice: &texttospeechpb.VoiceSelectionParams{
+			LanguageCode: languageCode,
+			Name:         voiceName,
+		},
+		AudioConfig: &texttospeechpb.AudioConfig{
+			AudioEncoding:   texttospeechpb.AudioEncoding_MP3,
+			SpeakingRate:    speakingRate,
+			SampleRateHertz: 44100,
+		},
+	}
+	resp, err := client.SynthesizeSpeech(ctx, &req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to synthesize speech: %v", err)
+	}
+	if err := cache.CacheTTSSegment(TTSProviderGoogle, text, voiceName, languageCode, speakingRate, resp.AudioContent); err != nil {
+		log.Printf("Failed to cache TTS segment: %v", err)
+	}
+	return resp.AudioContent, false, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"strings"
+
+	"creator-tool-backend/config"
+)
+
+// TTSTimingConfig giới hạn cho việc căn thời lượng audio TTS vào khung thời gian của cue
+type TTSTimingConfig struct {
+	Tolerance       float64 // Sai số cho phép (giây) trước khi cần căn chỉnh
+	MaxSpeakingRate float64 // SpeakingRate tối đa khi synthesize lại (Google hỗ trợ 0.25 - 4.0)
+	RateRetries     int     // Số lần synthesize lại với SpeakingRate cao hơn
+	MaxTempo        float64 // Hệ số atempo tối đa khi nén audio
+	MaxLeadIn       float64 // Thời gian tối đa được phép bắt đầu sớm hơn cue (mượn khoảng lặng phía trước)
+	GapPadding      float64 // Khoảng lặng tối thiểu giữ lại giữa hai cue khi mượn khoảng trống
+}
+
+// ttsSegmentFit là kết quả căn chỉnh cho một segment
+type ttsSegmentFit struct {
+	Tempo          float64 // Hệ số atempo áp dụng, 1.0 = giữ nguyên
+	BorrowedBefore float64 // Số giây bắt đầu sớm hơn cue
+	BorrowedAfter  float64 // Số giây kéo dài sang khoảng lặng sau cue
+	Overflow       float64 // Số giây bị cắt bỏ vì không thể căn vừa
+	FinalDuration  float64 // Thời lượng audio sau khi căn chỉnh
+}
+
+// LoadTTSTimingConfig đọc giới hạn căn chỉnh từ env, dùng giá trị mặc định an toàn nếu cấu hình sai
+func LoadTTSTimingConfig() TTSTimingConfig {
+	conf := config.InfaConfig{}
+	conf.LoadConfig()
+
+	cfg := TTSTimingConfig{
+		Tolerance:       0.05,
+		MaxSpeakingRate: conf.TTSMaxSpeakingRate,
+		RateRetries:     conf.TTSRateRetries,
+		MaxTempo:        conf.TTSMaxTempo,
+		MaxLeadIn:       conf.TTSMaxLeadIn,
+		GapPadding:      0.1,
+	}
+	if cfg.MaxSpeakingRate <= 0 || cfg.MaxSpeakingRate > 4.0 {
+		cfg.MaxSpeakingRate = 1.5
+	}
+	if cfg.RateRetries < 0 {
+		cfg.RateRetries = 0
+	}
+	if cfg.MaxTempo < 1.0 {
+		cfg.MaxTempo = 1.0
+	}
+	if cfg.MaxLeadIn < 0 {
+		cfg.MaxLeadIn = 0
+	}
+	return cfg
+}
+
+// nextSpeakingRate tính SpeakingRate cho lần synthesize lại để audio vừa với cue, trả về false nếu không thể tăng thêm
+func (cfg TTSTimingConfig) nextSpeakingRate(currentRate, actualDuration, expectedDuration float64) (float64, bool) {
+	if currentRate <= 0 {
+		currentRate = 1.0
+	}
+	if expectedDuration <= 0 || currentRate >= cfg.MaxSpeakingRate {
+		return currentRate, false
+	}
+	// Tăng thêm 2% để bù phần thời lượng không tỉ lệ tuyến tính với tốc độ (khoảng lặng đầu/cuối)
+	rate := math.Min(currentRate*actualDuration/expectedDuration*1.02, cfg.MaxSpeakingRate)
+	if rate-currentRate < 0.01 {
+		return currentRate, false
+	}
+	return rate, true
+}
+
+// fitSegment quyết định cách căn audio dài actualDuration vào cue dài expectedDuration.
+// Thứ tự ưu tiên: mượn khoảng lặng sau cue, nén bằng atempo trong giới hạn,
+// bắt đầu sớm hơn trong khoảng lặng trước cue, cuối cùng mới cắt bỏ phần thừa.
+func (cfg TTSTimingConfig) fitSegment(actualDuration, expectedDuration, gapBefore, gapAfter float64) ttsSegmentFit {
+	fit := ttsSegmentFit{Tempo: 1.0, FinalDuration: actualDuration}
+	if actualDuration <= expectedDuration+cfg.Tolerance {
+		return fit
+	}
+
+	gapAfter = math.Max(0, gapAfter-cfg.GapPadding)
+	gapBefore = math.Max(0, math.Min(gapBefore-cfg.GapPadding, cfg.MaxLeadIn))
+
+	window := expectedDuration + gapAfter
+	if actualDuration > window {
+		fit.Tempo = math.Min(actualDuration/window, cfg.MaxTempo)
+	}
+	stretched := actualDuration / fit.Tempo
+	fit.BorrowedAfter = math.Min(math.Max(0, stretched-expectedDuration), gapAfter)
+
+	if stretched > window {
+		fit.BorrowedBefore = math.Min(stretched-window, gapBefore)
+		window += fit.BorrowedBefore
+	}
+
+	fit.FinalDuration = stretched
+	if stretched > window+cfg.Tolerance {
+		fit.Overflow = stretched - window
+		fit.FinalDuration = window
+	}
+	return fit
+}
+
+// atempoFilter tạo chuỗi atempo, mỗi filter atempo chỉ hỗ trợ hệ số trong khoảng 0.5 - 2.0
+func atempoFilter(tempo float64) string {
+	var filters []string
+	for tempo > 2.0 {
+		filters = append(filters, "atempo=2.0")
+		tempo /= 2.0
+	}
+	filters = append(filters, fmt.Sprintf("atempo=%.4f", tempo))
+	return strings.Join(filters, ",")
+}
+
+// applySegmentFit render lại segment WAV theo kết quả căn chỉnh.
+// Audio ngắn hơn cue được thêm khoảng lặng cho đủ thời lượng cue.
+func applySegmentFit(inputPath, outputPath string, fit ttsSegmentFit, expectedDuration float64) error {
+	var filters []string
+	if fit.Tempo > 1.0 {
+		filters = append(filters, atempoFilter(fit.Tempo))
+	}
+	if fit.FinalDuration < expectedDuration {
+		filters = append(filters, fmt.Sprintf("apad=whole_dur=%f", expectedDuration))
+	}
+
+	args := []string{"-i", inputPath}
+	if fit.Overflow > 0 {
+		// Fade out ngắn trước điểm cắt để tránh tiếng click
+		fadeStart := math.Max(0, fit.FinalDuration-0.08)
+		filters = append(filters, fmt.Sprintf("afade=t=out:st=%f:d=0.08", fadeStart))
+		args = append(args, "-af", strings.Join(filters, ","), "-t", fmt.Sprintf("%f", fit.FinalDuration))
+	} else if len(filters) > 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
+	args = append(args,
+		"-ar", "44100",
+		"-ac", "2",
+		"-acodec", "pcm_s16le",
+		"-y",
+		outputPath)
+
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg timing fit error: %s", string(output))
+		return fmt.Errorf("failed to fit segment timing: %v", err)
+	}
+	return nil
+}
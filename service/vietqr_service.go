@@ -3,6 +3,10 @@ package service
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
@@ -104,7 +108,7 @@ func GenerateVietQR247(input ParamsQrCode) string {
 	strGen += infoCountry
 
 	// Content
-	content := params.CONTENT
+	content := SanitizeQRContent(params.CONTENT)
 	infoContent := "08" + getLength(content) + content
 	infoContentOptions := "62" + getLength(infoContent) + infoContent
 	strGen += infoContentOptions
@@ -112,12 +116,97 @@ func GenerateVietQR247(input ParamsQrCode) string {
 	// CRC16
 	infoCRC := "6304"
 	strGen += infoCRC
-	var str string = fmt.Sprintf("%04s", Dechex(int64(Crc16([]byte(strGen)))))
-	strGen += str
+	// CRC viết hoa, đủ 4 ký tự (app ngân hàng từ chối CRC chữ thường hoặc thiếu số 0 đầu)
+	strGen += fmt.Sprintf("%04X", Crc16([]byte(strGen)))
 
 	return strGen
 }
 
+// bankBins mã BIN NAPAS theo mã ngân hàng, dùng khi BankAccount chưa khai báo CardBin
+var bankBins = map[string]string{
+	"VCB":  "970436",
+	"BIDV": "970418",
+	"ICB":  "970415",
+	"CTG":  "970415",
+	"VBA":  "970405",
+	"TCB":  "970407",
+	"ACB":  "970416",
+	"MB":   "970422",
+	"VPB":  "970432",
+	"TPB":  "970423",
+	"VIB":  "970441",
+	"STB":  "970403",
+	"SHB":  "970443",
+	"HDB":  "970437",
+	"OCB":  "970448",
+	"MSB":  "970426",
+	"EIB":  "970431",
+	"SCB":  "970429",
+	"LPB":  "970449",
+	"SEAB": "970440",
+	"NAB":  "970428",
+}
+
+// bankNameCodes tên ngân hàng thường gặp (viết hoa, bỏ khoảng trắng) -> mã ngân hàng
+var bankNameCodes = map[string]string{
+	"VIETCOMBANK":      "VCB",
+	"VIETINBANK":       "ICB",
+	"AGRIBANK":         "VBA",
+	"TECHCOMBANK":      "TCB",
+	"MBBANK":           "MB",
+	"VPBANK":           "VPB",
+	"TPBANK":           "TPB",
+	"SACOMBANK":        "STB",
+	"HDBANK":           "HDB",
+	"EXIMBANK":         "EIB",
+	"LIENVIETPOSTBANK": "LPB",
+	"SEABANK":          "SEAB",
+	"NAMABANK":         "NAB",
+}
+
+// ResolveBankBin trả về mã BIN 6 số từ giá trị đầu tiên nhận diện được: BIN, mã ngân hàng (VCB, TCB...) hoặc tên ngân hàng
+func ResolveBankBin(values ...string) string {
+	for _, value := range values {
+		key := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(value), " ", ""))
+		if key == "" {
+			continue
+		}
+		if len(key) == 6 && strings.IndexFunc(key, func(r rune) bool { return r < '0' || r > '9' }) < 0 {
+			return key
+		}
+		if code, ok := bankNameCodes[key]; ok {
+			key = code
+		}
+		if bin, ok := bankBins[key]; ok {
+			return bin
+		}
+	}
+	return ""
+}
+
+// SanitizeQRContent bỏ dấu tiếng Việt, chỉ giữ chữ, số và khoảng trắng ASCII trong nội dung chuyển khoản, tối đa 25 ký tự theo EMVCo.
+// App ngân hàng bỏ hoặc đổi ký tự đặc biệt, làm mất mã đơn khi đối soát
+func SanitizeQRContent(content string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == 'đ':
+			return 'd'
+		case r == 'Đ':
+			return 'D'
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			return r
+		case unicode.Is(unicode.Mn, r):
+			return -1
+		}
+		return ' '
+	}, norm.NFD.String(content))
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+	if len(cleaned) > 25 {
+		cleaned = cleaned[:25]
+	}
+	return cleaned
+}
+
 // Dechex convert decimal to hex
 func Dechex(number int64) string {
 	return strconv.FormatInt(number, 16)
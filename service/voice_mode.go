@@ -0,0 +1,41 @@
+package service
+
+import (
+	"log"
+	"strings"
+)
+
+// Các chế độ xử lý giọng nói cho process-video
+const (
+	VoiceModeReplace      = "replace"       // Thay giọng gốc: nhạc nền (Demucs no_vocals) + TTS
+	VoiceModeVoiceOver    = "voice-over"    // Giữ audio gốc ở âm lượng thấp bên dưới TTS (kiểu phim tài liệu)
+	VoiceModeSubtitleOnly = "subtitle-only" // Không TTS, chỉ dịch và burn phụ đề lên video gốc
+)
+
+// DefaultVoiceOverOriginalVolume là âm lượng mặc định của audio gốc trong chế độ voice-over
+const DefaultVoiceOverOriginalVolume = 0.35
+
+// NormalizeVoiceMode chuẩn hoá tham số voice_mode từ request, mặc định là replace
+func NormalizeVoiceMode(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", VoiceModeReplace:
+		return VoiceModeReplace
+	case VoiceModeVoiceOver, "voiceover", "voice_over":
+		return VoiceModeVoiceOver
+	case VoiceModeSubtitleOnly, "subtitle_only", "subtitles":
+		return VoiceModeSubtitleOnly
+	default:
+		log.Printf("Unknown voice mode %q, falling back to %s", mode, VoiceModeReplace)
+		return VoiceModeReplace
+	}
+}
+
+// VoiceModeUsesTTS cho biết chế độ có cần tạo giọng đọc TTS không
+func VoiceModeUsesTTS(mode string) bool {
+	return mode != VoiceModeSubtitleOnly
+}
+
+// VoiceModeUsesDemucs cho biết chế độ có cần tách nhạc nền bằng Demucs không
+func VoiceModeUsesDemucs(mode string) bool {
+	return mode == VoiceModeReplace
+}
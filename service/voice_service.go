@@ -182,8 +182,8 @@ func ExtractVocals(audioPath string, fileName string, videoDir string) (string,
 }
 
 // MergeVideoWithAudio merges a video with background music and TTS audio
-func MergeVideoWithAudio(videoPath, backgroundMusicPath, ttsPath, videoDir string, backgroundVolume, ttsVolume float64) (string, error) {
-	log.Printf("MergeVideoWithAudio called with volumes - background: %.2f, tts: %.2f", backgroundVolume, ttsVolume)
+func MergeVideoWithAudio(videoPath, backgroundMusicPath, ttsPath, videoDir string, backgroundVolume, ttsVolume float64, profile OutputProfile) (string, error) {
+	log.Printf("MergeVideoWithAudio called with volumes - background: %.2f, tts: %.2f, profile: %s", backgroundVolume, ttsVolume, profile.Name)
 
 	// Create output directory if it doesn't exist
 	outputDir := filepath.Join(videoDir, "merged")
@@ -221,33 +221,35 @@ func MergeVideoWithAudio(videoPath, backgroundMusicPath, ttsPath, videoDir strin
 		log.Printf("TTS duration: %s seconds", string(ttsDurationOutput))
 	}
 
-	// Create a complex filter để mix audio với volume tuỳ chỉnh và đảm bảo đồng bộ
-	// Áp dụng boost tuyến tính nhẹ cho TTS để mặc định rõ hơn nhưng vẫn giữ ý nghĩa tham số đầu vào
-	effectiveTTSVolume := ttsVolume * 1.2
-	log.Printf("Effective TTS volume after boost: %.2f (from input %.2f)", effectiveTTSVolume, ttsVolume)
-	// Áp dụng boost tuyến tính nhẹ cho nhạc nền để mặc định rõ hơn nhưng vẫn giữ ý nghĩa tham số đầu vào
-	effectiveBGVolume := backgroundVolume * 1.2
-	log.Printf("Effective BG volume after boost: %.2f (from input %.2f)", effectiveBGVolume, backgroundVolume)
-	// Sử dụng apad để đảm bảo background music có đủ độ dài
-	// Thêm normalize=0 để tránh amix tự động normalize volume
-	filterComplex := fmt.Sprintf(
-		"[1:a]volume=%.2f,apad=whole_dur=%s[bg];[2:a]volume=%.2f[tts];[bg][tts]amix=inputs=2:duration=longest:normalize=0[audio]",
-		effectiveBGVolume, strings.TrimSpace(string(videoDurationOutput)), effectiveTTSVolume,
-	)
+	// Mix nhạc nền (duck theo TTS bằng sidechaincompress) với TTS, sau đó chuẩn hoá EBU R128 theo profile.
+	// Volume người dùng chọn giữ vai trò cân bằng tương đối giữa hai track, loudnorm quyết định mức âm lượng cuối
+	filterComplex := buildNormalizedMixFilter(videoPath, backgroundMusicPath, ttsPath, backgroundVolume, ttsVolume,
+		strings.TrimSpace(string(videoDurationOutput)), profile)
+
+	// Áp dụng scale/pad/crop của output profile ngay khi merge để kết quả đồng nhất kể cả khi burn sub thất bại
+	videoMap := "0:v"
+	if scaleFilter := profile.ScaleFilter(); scaleFilter != "" {
+		filterComplex = fmt.Sprintf("[0:v]%s[video];%s", scaleFilter, filterComplex)
+		videoMap = "[video]"
+	}
 
 	log.Printf("FFmpeg filter complex: %s", filterComplex)
 
-	// Merge video with adjusted audio - sử dụng -shortest để đảm bảo đồng bộ
-	cmd := exec.Command("ffmpeg",
+	args := []string{
 		"-i", videoPath, // Input video
 		"-i", backgroundMusicPath, // Background music
 		"-i", ttsPath, // TTS audio
 		"-filter_complex", filterComplex, // Apply audio filters
-		"-map", "0:v", // Map video stream
+		"-map", videoMap, // Map video stream
 		"-map", "[audio]", // Map mixed audio
-		"-c:v", "copy", // Copy video codec
-		"-c:a", "aac", // Use AAC for audio
-		"-b:a", "192k", // Set audio bitrate
+	}
+	if profile.RequiresVideoReencode() {
+		args = append(args, profile.VideoEncodeArgs()...)
+	} else {
+		args = append(args, "-c:v", "copy") // Copy video codec
+	}
+	args = append(args, profile.AudioEncodeArgs()...)
+	args = append(args,
 		"-shortest",                       // End when shortest input ends - quan trọng cho đồng bộ
 		"-avoid_negative_ts", "make_zero", // Tránh timestamp âm
 		"-fflags", "+genpts", // Generate presentation timestamps
@@ -255,6 +257,9 @@ func MergeVideoWithAudio(videoPath, backgroundMusicPath, ttsPath, videoDir strin
 		outputPath,
 	)
 
+	// Merge video with adjusted audio - sử dụng -shortest để đảm bảo đồng bộ
+	cmd := exec.Command("ffmpeg", args...)
+
 	// Capture command output for better error handling
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -279,7 +284,7 @@ func MergeVideoWithAudio(videoPath, backgroundMusicPath, ttsPath, videoDir strin
 }
 
 // BurnSubtitleWithBackground burns subtitle into video with solid background box
-func BurnSubtitleWithBackground(videoPath, srtPath, outputDir string, textColor, bgColor string) (string, error) {
+func BurnSubtitleWithBackground(videoPath, srtPath, outputDir string, textColor, bgColor string, profile OutputProfile) (string, error) {
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create output directory: %v", err)
@@ -334,23 +339,24 @@ func BurnSubtitleWithBackground(videoPath, srtPath, outputDir string, textColor,
 		return "", fmt.Errorf("failed to get absolute path for SRT: %v", err)
 	}
 
-	log.Printf("Burning subtitle: video=%s, srt=%s, textColor=%s, bgColor=%s", videoPath, absSrtPath, textColor, bgColor)
+	log.Printf("Burning subtitle: video=%s, srt=%s, textColor=%s, bgColor=%s, profile=%s", videoPath, absSrtPath, textColor, bgColor, profile.Name)
 
 	// FFmpeg command to burn subtitle with solid background box
 	// Use absolute path and escape special characters
 	escapedSrtPath := strings.ReplaceAll(absSrtPath, "'", "\\'")
-	cmd := exec.Command("ffmpeg",
-		"-i", videoPath,
-		"-vf", fmt.Sprintf("subtitles='%s':force_style='Fontsize=24,PrimaryColour=%s,BackColour=%s,Outline=2,Shadow=0,BorderStyle=3',scale=-2:720", escapedSrtPath, textColorASS, bgColorASS),
-		"-c:v", "libx264",
-		"-preset", "veryfast",
-		"-crf", "23",
-		"-pix_fmt", "yuv420p",
-		"-movflags", "+faststart",
+	forceStyle := fmt.Sprintf("Fontsize=24,PrimaryColour=%s,BackColour=%s,Outline=2,Shadow=0,BorderStyle=3", textColorASS, bgColorASS)
+	if marginV := profile.SubtitleMarginV(); marginV > 0 {
+		forceStyle += fmt.Sprintf(",MarginV=%d", marginV)
+	}
+	subtitleFilter := fmt.Sprintf("subtitles='%s':force_style='%s'", escapedSrtPath, forceStyle)
+	args := []string{"-i", videoPath, "-vf", profile.BuildVideoFilter(subtitleFilter)}
+	args = append(args, profile.VideoEncodeArgs()...)
+	args = append(args,
 		"-c:a", "copy", // Copy audio without re-encoding
 		"-y", // Overwrite output file
 		outputPath,
 	)
+	cmd := exec.Command("ffmpeg", args...)
 
 	// Capture command output for better error handling
 	output, err := cmd.CombinedOutput()
@@ -370,7 +376,7 @@ func BurnSubtitleWithBackground(videoPath, srtPath, outputDir string, textColor,
 }
 
 // BurnSubtitleWithASS burns subtitle using ASS format (alternative method)
-func BurnSubtitleWithASS(videoPath, srtPath, outputDir string, textColor, bgColor string) (string, error) {
+func BurnSubtitleWithASS(videoPath, srtPath, outputDir string, textColor, bgColor string, profile OutputProfile) (string, error) {
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create output directory: %v", err)
@@ -382,7 +388,7 @@ func BurnSubtitleWithASS(videoPath, srtPath, outputDir string, textColor, bgColo
 
 	// Convert SRT to ASS format
 	assPath := strings.Replace(srtPath, ".srt", ".ass", 1)
-	if err := convertSRTtoASS(srtPath, assPath, textColor, bgColor); err != nil {
+	if err := convertSRTtoASS(srtPath, assPath, textColor, bgColor, profile.SubtitleMarginV()); err != nil {
 		return "", fmt.Errorf("failed to convert SRT to ASS: %v", err)
 	}
 
@@ -392,16 +398,13 @@ func BurnSubtitleWithASS(videoPath, srtPath, outputDir string, textColor, bgColo
 		return "", fmt.Errorf("failed to get absolute path for ASS: %v", err)
 	}
 
-	log.Printf("Burning subtitle with ASS: video=%s, ass=%s", videoPath, absAssPath)
+	log.Printf("Burning subtitle with ASS: video=%s, ass=%s, profile=%s", videoPath, absAssPath, profile.Name)
 
 	// FFmpeg command using ASS format
-	cmd := exec.Command("ffmpeg",
-		"-i", videoPath,
-		"-vf", fmt.Sprintf("ass=%s", absAssPath),
-		"-c:a", "copy",
-		"-y",
-		outputPath,
-	)
+	args := []string{"-i", videoPath, "-vf", profile.BuildVideoFilter(fmt.Sprintf("ass=%s", absAssPath))}
+	args = append(args, profile.VideoEncodeArgs()...)
+	args = append(args, "-c:a", "copy", "-y", outputPath)
+	cmd := exec.Command("ffmpeg", args...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -434,7 +437,8 @@ func convertHexToASSColor(hex string) string {
 }
 
 // convertSRTtoASS converts SRT subtitle to ASS format with custom colors
-func convertSRTtoASS(srtPath, assPath, textColor, bgColor string) error {
+// marginV = 0 sẽ dùng lề dưới mặc định (10)
+func convertSRTtoASS(srtPath, assPath, textColor, bgColor string, marginV int) error {
 	// Read SRT file
 	srtContent, err := os.ReadFile(srtPath)
 	if err != nil {
@@ -444,6 +448,9 @@ func convertSRTtoASS(srtPath, assPath, textColor, bgColor string) error {
 	// Convert colors to ASS format
 	textColorASS := convertHexToASSColor(textColor)
 	bgColorASS := convertHexToASSColor(bgColor)
+	if marginV <= 0 {
+		marginV = 10
+	}
 
 	// Create ASS header with styling
 	assHeader := fmt.Sprintf(`[Script Info]
@@ -455,11 +462,11 @@ YCbCr Matrix: TV.601
 
 [V4+ Styles]
 Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
-Style: Default,Arial,24,%s,%s,%s,%s,0,0,0,0,100,100,0,0,3,2,0,2,10,10,10,1
+Style: Default,Arial,24,%s,%s,%s,%s,0,0,0,0,100,100,0,0,3,2,0,2,10,10,%d,1
 
 [Events]
 Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
-`, textColorASS, textColorASS, textColorASS, bgColorASS)
+`, textColorASS, textColorASS, textColorASS, bgColorASS, marginV)
 
 	// Parse SRT and convert to ASS
 	lines := strings.Split(string(srtContent), "\n")
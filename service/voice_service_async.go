@@ -72,6 +72,12 @@ func SeparateAudioAsync(audioPath string, fileName string, stemType string, vide
 		return "", fmt.Errorf("failed to create separated audio directory: %v", err)
 	}
 
+	// Kiểm tra cache theo nội dung audio trước khi chạy Demucs
+	if cachedPath, err := GetCacheService().GetCachedBackgroundResult(audioPath, stemType, outputDir); err == nil {
+		log.Printf("Using cached %s stem: %s", stemType, cachedPath)
+		return cachedPath, nil
+	}
+
 	fileNameWithoutExt := strings.TrimSuffix(fileName, filepath.Ext(fileName))
 	// Đảm bảo tên file separated là duy nhất (thêm timestamp)
 	timestamp := time.Now().UnixNano()
@@ -179,6 +185,9 @@ func SeparateAudioAsync(audioPath string, fileName string, stemType string, vide
 	}
 
 	log.Printf("%s converted to MP3: %s", stemType, mp3Path)
+	if err := GetCacheService().CacheBackgroundResult(audioPath, stemType, mp3Path); err != nil {
+		log.Printf("Failed to cache %s stem: %v", stemType, err)
+	}
 
 	// Clean up temporary files (giữ lại file MP3)
 	// os.RemoveAll(filepath.Join(outputDir, fileNameWithoutExt))
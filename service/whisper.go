@@ -12,10 +12,11 @@ import (
 )
 
 type Segment struct {
-	ID    int     `json:"id"`
-	Start float64 `json:"start"`
-	End   float64 `json:"end"`
-	Text  string  `json:"text"`
+	ID      int     `json:"id"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Text    string  `json:"text"`
+	Speaker string  `json:"speaker,omitempty"` // Nhãn người nói từ diarization (rỗng = không chạy diarization)
 }
 
 type WhisperUsage struct {
@@ -30,6 +31,7 @@ type WhisperResponse struct {
 	Segments []Segment     `json:"segments"`
 	Usage    *WhisperUsage `json:"usage,omitempty"`
 	Duration float64       `json:"duration,omitempty"`
+	Language string        `json:"language,omitempty"` // Ngôn ngữ Whisper tự nhận diện, dạng tên đầy đủ ("english")
 }
 
 // SplitLongSegments tách các segment dài thành các segment ngắn như CapCut
@@ -384,12 +386,21 @@ func sortAndDeduplicate(positions []int) []int {
 }
 
 func TranscribeWhisperOpenAI(filePath, apiKey string) (string, []Segment, *WhisperUsage, error) {
+	result, usage, err := TranscribeWhisperOpenAIResult(filePath, apiKey)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return result.Transcript, result.Segments, usage, nil
+}
+
+// TranscribeWhisperOpenAIResult transcribe audio bằng Whisper và trả về cả ngôn ngữ nguồn (mã ISO) Whisper nhận diện
+func TranscribeWhisperOpenAIResult(filePath, apiKey string) (*WhisperResult, *WhisperUsage, error) {
 
 	url := "https://api.openai.com/v1/audio/transcriptions"
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("failed to open file: %v", err)
+		return nil, nil, fmt.Errorf("failed to open file: %v", err)
 	}
 	defer file.Close()
 
@@ -399,11 +410,11 @@ func TranscribeWhisperOpenAI(filePath, apiKey string) (string, []Segment, *Whisp
 	// Thêm file
 	part, err := writer.CreateFormFile("file", file.Name())
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, err
 	}
 	_, err = io.Copy(part, file)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, err
 	}
 
 	// Thêm model + format
@@ -414,7 +425,7 @@ func TranscribeWhisperOpenAI(filePath, apiKey string) (string, []Segment, *Whisp
 	// Tạo request
 	req, err := http.NewRequest("POST", url, &requestBody)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
@@ -423,33 +434,33 @@ func TranscribeWhisperOpenAI(filePath, apiKey string) (string, []Segment, *Whisp
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
+		return nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
 	}
 	defer resp.Body.Close()
 
 	// Đọc response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
+		return nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		// Kiểm tra các loại lỗi cụ thể để đưa ra thông báo phù hợp
 		if resp.StatusCode == 429 {
-			return "", nil, nil, fmt.Errorf("Hệ thống đang quá tải, vui lòng thử lại sau")
+			return nil, nil, fmt.Errorf("Hệ thống đang quá tải, vui lòng thử lại sau")
 		} else if resp.StatusCode == 401 {
-			return "", nil, nil, fmt.Errorf("Lỗi xác thực, vui lòng liên hệ hỗ trợ")
+			return nil, nil, fmt.Errorf("Lỗi xác thực, vui lòng liên hệ hỗ trợ")
 		} else if resp.StatusCode == 500 || resp.StatusCode == 502 || resp.StatusCode == 503 {
-			return "", nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
+			return nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
 		} else {
-			return "", nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
+			return nil, nil, fmt.Errorf("Hệ thống đang gặp sự cố, vui lòng thử lại sau")
 		}
 	}
 
 	var whisperResp WhisperResponse
 	err = json.Unmarshal(body, &whisperResp)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("Hệ thống không thể xử lý yêu cầu, vui lòng thử lại sau")
+		return nil, nil, fmt.Errorf("Hệ thống không thể xử lý yêu cầu, vui lòng thử lại sau")
 	}
 
 	// Giữ nguyên segments gốc từ Whisper để đảm bảo thời gian chính xác
@@ -474,18 +485,31 @@ func TranscribeWhisperOpenAI(filePath, apiKey string) (string, []Segment, *Whisp
 		splitText.WriteString(" ")
 	}
 
-	return strings.TrimSpace(splitText.String()), cleanedSegments, whisperResp.Usage, nil
+	return &WhisperResult{
+		Transcript:     strings.TrimSpace(splitText.String()),
+		Segments:       cleanedSegments,
+		SourceLanguage: NormalizeLanguageCode(whisperResp.Language),
+	}, whisperResp.Usage, nil
 }
 
 // TranscribeWithService wrapper function that uses service_config to determine which service to use
 func TranscribeWithService(filePath, apiKey, serviceName, modelAPIName string) (string, []Segment, *WhisperUsage, error) {
+	result, usage, err := TranscribeWithServiceResult(filePath, apiKey, serviceName, modelAPIName)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return result.Transcript, result.Segments, usage, nil
+}
+
+// TranscribeWithServiceResult giống TranscribeWithService nhưng trả về WhisperResult (kèm ngôn ngữ nguồn)
+func TranscribeWithServiceResult(filePath, apiKey, serviceName, modelAPIName string) (*WhisperResult, *WhisperUsage, error) {
 	// Currently only Whisper is supported for speech_to_text
 	if serviceName == "whisper" {
-		return TranscribeWhisperOpenAI(filePath, apiKey)
+		return TranscribeWhisperOpenAIResult(filePath, apiKey)
 	}
 
 	// For future services, we can add more conditions here
 	// Example: if serviceName == "azure_speech" { return TranscribeWithAzure(filePath, apiKey, modelAPIName) }
 
-	return "", nil, nil, fmt.Errorf("unsupported speech-to-text service: %s", serviceName)
+	return nil, nil, fmt.Errorf("unsupported speech-to-text service: %s", serviceName)
 }
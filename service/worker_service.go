@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"creator-tool-backend/config"
+	"creator-tool-backend/model"
 
 	"gorm.io/datatypes"
 )
@@ -169,10 +170,17 @@ func (ws *WorkerService) processJob(job *AudioProcessingJob) {
 	}
 
 	if job.JobType == "process-video" {
-		// Xử lý process video (parallel processing)
-		resultPath, err := ws.runProcessVideo(job)
+		// Xử lý process video (parallel processing), nhiều ngôn ngữ đích thì fan out theo ngôn ngữ
+		var resultPath string
+		var err error
+		if len(job.TargetLanguages) > 1 {
+			resultPath, err = ws.runProcessVideoMultiLanguage(job)
+		} else {
+			resultPath, err = ws.runProcessVideo(job)
+		}
 		if err != nil {
 			log.Printf("Job %s: Failed to process video: %v", job.ID, err)
+			ws.releaseSubscriptionAllowance(job)
 			ws.queueService.UpdateJobStatus(job.ID, "failed")
 			return
 		}
@@ -318,14 +326,16 @@ func (ws *WorkerService) runBurnSubtitle(job *AudioProcessingJob) (string, error
 	bgcolor := hexToASSColor(job.SubtitleBgColor)
 	forceStyle := fmt.Sprintf("Fontsize=24,PrimaryColour=%s,BackColour=%s,Outline=2,Shadow=0,BorderStyle=3", color, bgcolor)
 
-	cmd := exec.Command(
-		"ffmpeg",
-		"-i", videoPath,
-		"-vf", fmt.Sprintf("subtitles='%s':force_style='%s'", subPath, forceStyle),
-		"-c:a", "copy",
-		"-y",
-		outputPath,
-	)
+	// Áp dụng output profile để chất lượng đồng nhất với process-video
+	profile := GetOutputProfile(job.OutputProfile)
+	if marginV := profile.SubtitleMarginV(); marginV > 0 {
+		forceStyle += fmt.Sprintf(",MarginV=%d", marginV)
+	}
+	args := []string{"-i", videoPath, "-vf", profile.BuildVideoFilter(fmt.Sprintf("subtitles='%s':force_style='%s'", subPath, forceStyle))}
+	args = append(args, profile.VideoEncodeArgs()...)
+	args = append(args, "-c:a", "copy", "-y", outputPath)
+
+	cmd := exec.Command("ffmpeg", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("FFmpeg burn subtitle error: %s", string(output))
@@ -384,6 +394,13 @@ func (ws *WorkerService) runProcessVideo(job *AudioProcessingJob) (string, error
 	task.TTSVolume = job.TTSVolume
 	task.SpeakingRate = job.SpeakingRate
 	task.VoiceName = job.VoiceName // Thêm voice selection
+	task.OutputProfile = GetOutputProfile(job.OutputProfile)
+	task.ReframeMode = ReframeModeForProfile(job.ReframeMode, task.OutputProfile)
+	applyJobVoiceMode(task, job)
+	task.Glossary = LoadGlossaryTermsForRequest(job.UserID, job.GlossaryIDs, job.TargetLanguage)
+	task.MemoryUserID = job.UserID
+	task.Diarize = job.Diarize
+	task.SpeakerVoices = job.SpeakerVoices
 
 	log.Printf("🎬 [WORKER SERVICE] Bắt đầu parallel processing với ProcessParallel()...")
 	// Xử lý song song
@@ -396,6 +413,16 @@ func (ws *WorkerService) runProcessVideo(job *AudioProcessingJob) (string, error
 	log.Printf("✅ [WORKER SERVICE] Parallel processing completed successfully!")
 	log.Printf("📊 [WORKER SERVICE] Results: srt=%s, tts=%s, video=%s",
 		result.TranslatedSRTPath, result.TTSPath, result.FinalVideoPath)
+	if len(result.GlossaryViolations) > 0 {
+		log.Printf("⚠️ [WORKER SERVICE] %d cues did not respect the glossary", len(result.GlossaryViolations))
+	}
+	if len(result.TTSOverflow) > 0 {
+		log.Printf("⚠️ [WORKER SERVICE] %d TTS segments trimmed to fit their cues", len(result.TTSOverflow))
+	}
+	if tm := result.TranslationMemory; tm != nil && tm.ExactMatches+tm.FuzzyMatches > 0 {
+		log.Printf("📚 [WORKER SERVICE] Translation memory: %d exact, %d fuzzy of %d cues, saved %.6f",
+			tm.ExactMatches, tm.FuzzyMatches, tm.TotalCues, tm.CostSaved)
+	}
 
 	// Tính duration để tính chi phí và lưu vào database
 	duration := getAudioDuration(job.AudioPath)
@@ -418,6 +445,10 @@ func (ws *WorkerService) runProcessVideo(job *AudioProcessingJob) (string, error
 		BackgroundMusic:     result.BackgroundPath,
 		ProcessType:         "process-video",
 		VideoDuration:       duration,
+		RenderSettings:      datatypes.JSON(MarshalRenderSettings(task.RenderSettings())),
+		TranslationQA:       MarshalTranslationQA(result.TranslationQA),
+		Speakers:            marshalSpeakers(result.Speakers),
+		SourceLanguage:      result.SourceLanguage,
 		CreatedAt:           time.Now(),
 	}
 	if err := config.Db.Create(&captionHistory).Error; err != nil {
@@ -441,72 +472,252 @@ func (ws *WorkerService) runProcessVideo(job *AudioProcessingJob) (string, error
 		}
 	}
 
-	// 2) Translation (Gemini/GPT) per_token
+	// 2) Translation (Gemini/GPT) per_token - không tính khi ngôn ngữ nguồn trùng ngôn ngữ đích
+	if result.TranslationSkipped {
+		log.Printf("⏭️ [WORKER SERVICE] Ngôn ngữ nguồn %s trùng ngôn ngữ đích, không tính phí dịch", result.SourceLanguage)
+	} else {
+		ws.deductTranslationCredits(job.UserID, &captionHistory.ID, result.OriginalSRTPath, result.TranslatedSRTPath, result.Transcript, "")
+	}
+
+	// 3) TTS per_character - chỉ tính các segment không có trong cache TTS
+	ws.deductTTSCredits(job.UserID, &captionHistory.ID, result.TTSBilling, "")
+
+	// Cập nhật trạng thái process thành completed
+	processService := NewProcessStatusService()
+	processService.UpdateProcessStatus(job.ProcessID, "completed")
+	processService.UpdateProcessVideoID(job.ProcessID, captionHistory.ID)
+
+	log.Printf("🏁 [WORKER SERVICE] Process-video job %s hoàn thành thành công!", job.ID)
+	return result.FinalVideoPath, nil
+}
+
+// releaseSubscriptionAllowance trả lại hạn mức tháng handler đã giữ cho job (một video cho cả nhóm ngôn ngữ) khi job lỗi
+func (ws *WorkerService) releaseSubscriptionAllowance(job *AudioProcessingJob) {
+	if !job.AllowanceReserved {
+		return
+	}
+	if err := NewSubscriptionService(config.Db).ReleaseAllowance(job.UserID, job.AllowanceMinutes); err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to release subscription allowance: %v", err)
+	}
+}
+
+// deductTranslationCredits trừ credit dịch SRT theo token input/output, trả về số credit thực trừ (đã markup)
+func (ws *WorkerService) deductTranslationCredits(userID uint, historyID *uint, originalSRTPath, translatedSRTPath, transcript, label string) float64 {
+	creditService := NewCreditService()
+	pricingService := NewPricingService()
+
 	serviceName, _, err := pricingService.GetActiveServiceForType("srt_translation")
 	if err != nil {
 		log.Printf("⚠️ [WORKER SERVICE] Failed to get translation service: %v", err)
-	} else {
-		// Tính chi phí dịch theo input/output riêng
-		var inputText, outputText string
-		if result.OriginalSRTPath != "" {
-			if b, e := os.ReadFile(result.OriginalSRTPath); e == nil {
-				inputText = string(b)
-			}
-		}
-		if result.TranslatedSRTPath != "" {
-			if b, e := os.ReadFile(result.TranslatedSRTPath); e == nil {
-				outputText = string(b)
-			}
-		}
-		if inputText == "" {
-			inputText = result.Transcript
+		return 0
+	}
+
+	// Tính chi phí dịch theo input/output riêng
+	var inputText, outputText string
+	if originalSRTPath != "" {
+		if b, e := os.ReadFile(originalSRTPath); e == nil {
+			inputText = string(b)
 		}
-		if outputText == "" {
-			outputText = result.Transcript
+	}
+	if translatedSRTPath != "" {
+		if b, e := os.ReadFile(translatedSRTPath); e == nil {
+			outputText = string(b)
 		}
+	}
+	if inputText == "" {
+		inputText = transcript
+	}
+	if outputText == "" {
+		outputText = transcript
+	}
 
-		inCost, outCost, inTok, outTok, _, err := pricingService.CalculateLLMCostSplit(inputText, outputText, serviceName)
-		if err != nil {
-			log.Printf("⚠️ [WORKER SERVICE] Failed to calculate translation cost: %v", err)
-		} else {
-			translationBase := inCost + outCost
-			translationTokens := inTok + outTok
-			var translationDesc string
-			if strings.Contains(serviceName, "gpt") {
-				translationDesc = "GPT dịch SRT"
-			} else {
-				translationDesc = "Gemini dịch SRT"
-			}
+	inCost, outCost, inTok, outTok, _, err := pricingService.CalculateLLMCostSplit(inputText, outputText, serviceName)
+	if err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to calculate translation cost: %v", err)
+		return 0
+	}
+	translationBase := inCost + outCost
+	translationTokens := inTok + outTok
+	var translationDesc string
+	if strings.Contains(serviceName, "gpt") {
+		translationDesc = "GPT dịch SRT"
+	} else {
+		translationDesc = "Gemini dịch SRT"
+	}
 
-			if err := creditService.DeductCredits(job.UserID, translationBase, serviceName, translationDesc, &captionHistory.ID, "per_token", float64(translationTokens)); err != nil {
-				log.Printf("⚠️ [WORKER SERVICE] Failed to deduct translation credits: %v", err)
-			} else {
-				log.Printf("✅ [WORKER SERVICE] Deducted %.6f credits for translation", translationBase)
-			}
+	if err := creditService.DeductCredits(userID, translationBase, serviceName, translationDesc+label, historyID, "per_token", float64(translationTokens)); err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to deduct translation credits: %v", err)
+		return 0
+	}
+	log.Printf("✅ [WORKER SERVICE] Deducted %.6f credits for translation%s", translationBase, label)
+	return creditService.FinalAmount(userID, translationBase, serviceName)
+}
+
+// deductTTSCredits trừ credit TTS cho các segment không có trong cache, trả về số credit thực trừ (đã markup)
+func (ws *WorkerService) deductTTSCredits(userID uint, historyID *uint, billing TTSBillingSplit, label string) float64 {
+	if billing.MissSegments == 0 {
+		log.Printf("[WORKER SERVICE] All TTS segments served from cache (%d segments), skipping TTS charge%s", billing.HitSegments, label)
+		return 0
+	}
+
+	ttsBase, err := NewPricingService().CalculateTTSCost(billing.BilledText, true)
+	if err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to calculate TTS cost: %v", err)
+		return 0
+	}
+	creditService := NewCreditService()
+	if err := creditService.DeductCredits(userID, ttsBase, "tts", "Google TTS"+label, historyID, "per_character", float64(billing.BilledCharacters)); err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to deduct TTS credits: %v", err)
+		return 0
+	}
+	log.Printf("✅ [WORKER SERVICE] Deducted %.6f credits for TTS%s", ttsBase, label)
+	return creditService.FinalAmount(userID, ttsBase, "tts")
+}
+
+// runProcessVideoMultiLanguage xử lý một upload cho nhiều ngôn ngữ đích: Whisper/Demucs một lần,
+// dịch/TTS/burn theo từng ngôn ngữ, lưu một history nhóm với output từng ngôn ngữ
+func (ws *WorkerService) runProcessVideoMultiLanguage(job *AudioProcessingJob) (string, error) {
+	log.Printf("🚀 [WORKER SERVICE] Bắt đầu xử lý process-video nhiều ngôn ngữ cho job %s: %v", job.ID, job.TargetLanguages)
+	creditService := NewCreditService()
+	processService := NewProcessStatusService()
+
+	// Mở khóa phần credit lock chưa dùng khi job kết thúc (DeductCredits đã trừ dần vào locked)
+	charged := 0.0
+	defer func() {
+		if remaining := job.LockedCredits - charged; remaining > 0 {
+			creditService.UnlockCredits(job.UserID, remaining, "process-video", "Unlock remaining credits after multi-language processing", nil)
 		}
+	}()
+
+	configg := config.InfaConfig{}
+	configg.LoadConfig()
+
+	videoPath := filepath.Join(job.VideoDir, job.FileName)
+	task := NewProcessVideoParallel(videoPath, job.AudioPath, job.VideoDir, job.TargetLanguages[0], configg.ApiKey, configg.GeminiKey)
+	task.HasCustomSrt = job.HasCustomSrt
+	task.CustomSrtPath = job.CustomSrtPath
+	task.SubtitleColor = job.SubtitleColor
+	task.SubtitleBgColor = job.SubtitleBgColor
+	task.BackgroundVolume = job.BackgroundVolume
+	task.TTSVolume = job.TTSVolume
+	task.SpeakingRate = job.SpeakingRate
+	task.OutputProfile = GetOutputProfile(job.OutputProfile)
+	task.ReframeMode = ReframeModeForProfile(job.ReframeMode, task.OutputProfile)
+	applyJobVoiceMode(task, job)
+	task.Diarize = job.Diarize
+	task.SpeakerVoices = job.SpeakerVoices
+	task.MemoryUserID = job.UserID
+
+	result, err := task.ProcessParallelMultiLanguage(job.TargetLanguages, func(languageTask *ProcessVideoParallel) {
+		lang := languageTask.TargetLanguage
+		languageTask.VoiceName = VoiceForLanguage(lang, job.VoiceName, job.VoiceNames)
+		languageTask.Glossary = LoadGlossaryTermsForRequest(job.UserID, job.GlossaryIDs, lang)
+	})
+	if err != nil {
+		log.Printf("❌ [WORKER SERVICE] Multi-language processing failed: %v", err)
+		processService.UpdateProcessStatus(job.ProcessID, "failed")
+		return "", fmt.Errorf("multi-language processing failed: %v", err)
 	}
 
-	// 3) TTS per_character
-	if result.Transcript != "" {
-		ttsBase, err := pricingService.CalculateTTSCost(result.Transcript, true)
-		if err != nil {
-			log.Printf("⚠️ [WORKER SERVICE] Failed to calculate TTS cost: %v", err)
-		} else {
-			if err := creditService.DeductCredits(job.UserID, ttsBase, "tts", "Google TTS", &captionHistory.ID, "per_character", float64(len([]rune(result.Transcript)))); err != nil {
-				log.Printf("⚠️ [WORKER SERVICE] Failed to deduct TTS credits: %v", err)
-			} else {
-				log.Printf("✅ [WORKER SERVICE] Deducted %.6f credits for TTS", ttsBase)
+	// Ngôn ngữ thành công đầu tiên là output chính của history (dùng cho subtitle editor / render lại)
+	primary := result.Succeeded()[0]
+	duration := getAudioDuration(job.AudioPath)
+	durationMinutes := duration / 60.0
+	segmentsJSON, _ := json.Marshal(result.Segments)
+
+	captionHistory := config.CaptionHistory{
+		UserID:              job.UserID,
+		VideoFilename:       videoPath,
+		VideoFilenameOrigin: job.FileName,
+		Transcript:          result.Transcript,
+		Segments:            datatypes.JSON(segmentsJSON),
+		SegmentsVi:          datatypes.JSON(segmentsJSON),
+		SrtFile:             primary.Result.TranslatedSRTPath,
+		OriginalSrtFile:     result.OriginalSRTPath,
+		TTSFile:             primary.Result.TTSPath,
+		MergedVideoFile:     primary.Result.FinalVideoPath,
+		BackgroundMusic:     result.BackgroundPath,
+		ProcessType:         "process-video",
+		VideoDuration:       duration,
+		RenderSettings:      datatypes.JSON(MarshalRenderSettings(primary.Task.RenderSettings())),
+		TranslationQA:       MarshalTranslationQA(primary.Result.TranslationQA),
+		Speakers:            marshalSpeakers(primary.Result.Speakers),
+		SourceLanguage:      result.SourceLanguage,
+		CreatedAt:           time.Now(),
+	}
+	if err := config.Db.Create(&captionHistory).Error; err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to save process-video history: %v", err)
+		processService.UpdateProcessStatus(job.ProcessID, "failed")
+		return "", fmt.Errorf("failed to save to database: %v", err)
+	}
+
+	// 1) Whisper tính một lần cho cả nhóm
+	if whisperBase, err := NewPricingService().CalculateWhisperCost(durationMinutes); err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to calculate Whisper cost: %v", err)
+	} else if err := creditService.DeductCredits(job.UserID, whisperBase, "whisper", "Whisper transcribe", &captionHistory.ID, "per_minute", durationMinutes); err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to deduct Whisper credits: %v", err)
+	} else {
+		charged += creditService.FinalAmount(job.UserID, whisperBase, "whisper")
+		log.Printf("✅ [WORKER SERVICE] Deducted %.6f credits for Whisper", whisperBase)
+	}
+
+	// 2) Dịch + TTS theo từng ngôn ngữ thành công
+	outputs := make([]model.LanguageOutput, 0, len(result.Outputs))
+	for _, output := range result.Outputs {
+		languageOutput := model.LanguageOutput{TargetLanguage: output.Language, Status: "failed"}
+		if output.Task != nil {
+			languageOutput.VoiceName = output.Task.VoiceName
+		}
+		if output.Err != nil || output.Result == nil {
+			if output.Err != nil {
+				languageOutput.Error = output.Err.Error()
 			}
+			outputs = append(outputs, languageOutput)
+			continue
+		}
+
+		label := fmt.Sprintf(" (%s)", output.Language)
+		cost := 0.0
+		if !output.Result.TranslationSkipped {
+			cost = ws.deductTranslationCredits(job.UserID, &captionHistory.ID, result.OriginalSRTPath, output.Result.TranslatedSRTPath, result.Transcript, label)
 		}
+		cost += ws.deductTTSCredits(job.UserID, &captionHistory.ID, output.Result.TTSBilling, label)
+		charged += cost
+
+		languageOutput.Status = "completed"
+		languageOutput.SrtFile = output.Result.TranslatedSRTPath
+		languageOutput.TTSFile = output.Result.TTSPath
+		languageOutput.MergedVideoFile = output.Result.FinalVideoPath
+		languageOutput.TranslationQA = output.Result.TranslationQA
+		languageOutput.Speakers = output.Result.Speakers
+		languageOutput.TranslationSkipped = output.Result.TranslationSkipped
+		languageOutput.Cost = cost
+		outputs = append(outputs, languageOutput)
+	}
+
+	outputsJSON, _ := json.Marshal(outputs)
+	if err := config.Db.Model(&captionHistory).Update("language_outputs", datatypes.JSON(outputsJSON)).Error; err != nil {
+		log.Printf("⚠️ [WORKER SERVICE] Failed to save language outputs: %v", err)
 	}
 
-	// Cập nhật trạng thái process thành completed
-	processService := NewProcessStatusService()
 	processService.UpdateProcessStatus(job.ProcessID, "completed")
 	processService.UpdateProcessVideoID(job.ProcessID, captionHistory.ID)
 
-	log.Printf("🏁 [WORKER SERVICE] Process-video job %s hoàn thành thành công!", job.ID)
-	return result.FinalVideoPath, nil
+	log.Printf("🏁 [WORKER SERVICE] Process-video job %s hoàn thành %d/%d ngôn ngữ, tổng %.6f credits",
+		job.ID, len(result.Succeeded()), len(job.TargetLanguages), charged)
+	return primary.Result.FinalVideoPath, nil
+}
+
+// marshalSpeakers chuyển danh sách người nói sang JSON để lưu vào CaptionHistory.Speakers
+func marshalSpeakers(speakers []model.SpeakerVoice) datatypes.JSON {
+	if len(speakers) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(speakers)
+	if err != nil {
+		return nil
+	}
+	return datatypes.JSON(data)
 }
 
 // getAudioDuration trả về duration (giây) của file audio/video
@@ -572,3 +783,11 @@ func (ws *WorkerService) GetStatus() map[string]interface{} {
 		"queue_status":   queueStatus,
 	}
 }
+
+// applyJobVoiceMode gắn chế độ giọng nói của job vào task, job cũ không có voice_mode chạy như replace
+func applyJobVoiceMode(task *ProcessVideoParallel, job *AudioProcessingJob) {
+	task.VoiceMode = NormalizeVoiceMode(job.VoiceMode)
+	if job.OriginalVolume > 0 {
+		task.OriginalVolume = job.OriginalVolume
+	}
+}